@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+var (
+	ErrUnknownAction    = errors.New("unknown admin action")
+	ErrActionNotHandled = errors.New("no hook configured for admin action")
+	ErrNoStatsOutput    = errors.New("no output configured for stats dumps")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+)
+
+// Action is an administrative operation operators can trigger on a running index
+type Action string
+
+const (
+	ActionSnapshot Action = "snapshot"
+	ActionCompact  Action = "compact"
+	ActionStats    Action = "stats"
+	ActionMetrics  Action = "metrics"
+)
+
+// Admin dispatches administrative actions to the configured hooks. Actions may be triggered by signals
+// such as SIGUSR1 or through the http handler.
+type Admin struct {
+	Snapshot func() error                // persists the index
+	Compact  func() error                // compacts the index
+	Stats    func() (interface{}, error) // returns the statistics to dump as json
+	Metrics  func(w io.Writer) error     // writes metrics in the Prometheus text format, e.g. with stats.WritePrometheus
+
+	StatsOutput io.Writer                      // destination of stats dumps triggered by signals
+	OnError     func(action Action, err error) // called when a signal triggered action fails
+}
+
+// Run executes the action returning the stats for ActionStats
+func (a *Admin) Run(action Action) (interface{}, error) {
+	switch action {
+	case ActionSnapshot:
+		if a.Snapshot == nil {
+			return nil, fmt.Errorf("%w, %s", ErrActionNotHandled, action)
+		}
+		return nil, a.Snapshot()
+	case ActionCompact:
+		if a.Compact == nil {
+			return nil, fmt.Errorf("%w, %s", ErrActionNotHandled, action)
+		}
+		return nil, a.Compact()
+	case ActionStats:
+		if a.Stats == nil {
+			return nil, fmt.Errorf("%w, %s", ErrActionNotHandled, action)
+		}
+		return a.Stats()
+	default:
+		return nil, fmt.Errorf("%w, %s", ErrUnknownAction, action)
+	}
+}
+
+// NotifyOnSignal runs the action every time one of the signals is received until the context is
+// cancelled, e.g. admin.NotifyOnSignal(ctx, ActionSnapshot, syscall.SIGUSR1). Stats are written as
+// json to StatsOutput.
+func (a *Admin) NotifyOnSignal(ctx context.Context, action Action, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				if err := a.runAndDump(action); err != nil && a.OnError != nil {
+					a.OnError(action, err)
+				}
+			}
+		}
+	}()
+}
+
+func (a *Admin) runAndDump(action Action) error {
+	out, err := a.Run(action)
+	if err != nil {
+		return err
+	}
+	if action != ActionStats {
+		return nil
+	}
+	if a.StatsOutput == nil {
+		return ErrNoStatsOutput
+	}
+	return json.NewEncoder(a.StatsOutput).Encode(out)
+}
+
+// ServeHTTP exposes the actions under their names, e.g. POST /snapshot, POST /compact, GET /stats and
+// GET /metrics when mounted with http.StripPrefix.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := Action(strings.Trim(r.URL.Path, "/"))
+	expected := http.MethodPost
+	if action == ActionStats || action == ActionMetrics {
+		expected = http.MethodGet
+	}
+	if r.Method != expected {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	if action == ActionMetrics {
+		a.serveMetrics(w)
+		return
+	}
+
+	out, err := a.Run(action)
+	switch {
+	case errors.Is(err, ErrUnknownAction):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, ErrActionNotHandled):
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if out == nil {
+		out = map[string]string{"status": "ok"}
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// serveMetrics writes the metrics in the Prometheus text format
+func (a *Admin) serveMetrics(w http.ResponseWriter) {
+	if a.Metrics == nil {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("%w, %s", ErrActionNotHandled, ActionMetrics))
+		return
+	}
+	var buf bytes.Buffer
+	if err := a.Metrics(&buf); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
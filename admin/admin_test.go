@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHTTP(t *testing.T) {
+	var snapshots int
+	a := &Admin{
+		Snapshot: func() error { snapshots++; return nil },
+		Compact:  func() error { return errors.New("compaction failed") },
+		Stats:    func() (interface{}, error) { return map[string]int{"num_docs": 3}, nil },
+		Metrics: func(w io.Writer) error {
+			_, err := io.WriteString(w, "golsh_num_docs 3\n")
+			return err
+		},
+	}
+
+	testData := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodPost, "/snapshot", http.StatusOK},
+		{http.MethodGet, "/snapshot", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/compact", http.StatusInternalServerError},
+		{http.MethodGet, "/stats", http.StatusOK},
+		{http.MethodGet, "/metrics", http.StatusOK},
+		{http.MethodPost, "/metrics", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/unknown", http.StatusNotFound},
+	}
+	for _, td := range testData {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest(td.method, td.path, nil))
+		if w.Code != td.code {
+			t.Errorf("expected %d, but got %d for %s %s", td.code, w.Code, td.method, td.path)
+		}
+	}
+	if snapshots != 1 {
+		t.Fatalf("expected %d snapshots, but got %d", 1, snapshots)
+	}
+}
+
+func TestAdminStatsDump(t *testing.T) {
+	var buf bytes.Buffer
+	a := &Admin{
+		Stats:       func() (interface{}, error) { return map[string]int{"num_docs": 3}, nil },
+		StatsOutput: &buf,
+	}
+	if err := a.runAndDump(ActionStats); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["num_docs"] != 3 {
+		t.Fatalf("expected %d docs, but got %d", 3, out["num_docs"])
+	}
+
+	if err := a.runAndDump(ActionSnapshot); !errors.Is(err, ErrActionNotHandled) {
+		t.Fatalf("expected %v, but got %v", ErrActionNotHandled, err)
+	}
+}
@@ -0,0 +1,223 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+var (
+	ErrNoRuleName        = errors.New("rule must have a name")
+	ErrDuplicateRule     = errors.New("rule already exists")
+	ErrRuleNotFound      = errors.New("rule not found")
+	ErrInvalidMinMatches = errors.New("invalid min matches, must be at least 0")
+	ErrInvalidDurations  = errors.New("invalid window or cooldown, must be at least 0")
+	ErrWebhookRequest    = errors.New("webhook request failed")
+)
+
+// Severity describes the urgency of an alert
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Rule fires an alert when newly indexed windows match the query shape at least MinMatches times within
+// Window. A rule that fired stays silent for Cooldown.
+type Rule struct {
+	Name     string            `json:"name"`
+	Query    document.Document `json:"-"`
+	Search   *options.Search   `json:"search"`
+	Severity Severity          `json:"severity"`
+
+	MinMatches int           `json:"min_matches"` // values below 1 fire on every match
+	Window     time.Duration `json:"window"`      // 0 counts matches since the rule last fired
+	Cooldown   time.Duration `json:"cooldown"`
+}
+
+// Validate returns an error if any of the rule parameters are invalid
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return ErrNoRuleName
+	}
+	if r.MinMatches < 0 {
+		return ErrInvalidMinMatches
+	}
+	if r.Window < 0 || r.Cooldown < 0 {
+		return ErrInvalidDurations
+	}
+	return nil
+}
+
+// Alert is a fired rule along with the matches that triggered it
+type Alert struct {
+	Rule     string      `json:"rule"`
+	Severity Severity    `json:"severity"`
+	Time     time.Time   `json:"time"`
+	Matches  []lsh.Match `json:"matches"`
+}
+
+// Notifier delivers fired alerts
+type Notifier interface {
+	Notify(a Alert) error
+}
+
+// NotifierFunc adapts a callback into a Notifier
+type NotifierFunc func(a Alert) error
+
+// Notify implements the Notifier interface
+func (f NotifierFunc) Notify(a Alert) error {
+	return f(a)
+}
+
+// Webhook posts each alert as json to the URL
+type Webhook struct {
+	URL    string
+	Header http.Header // additional headers such as authorization
+	Client *http.Client
+}
+
+// Notify implements the Notifier interface
+func (w *Webhook) Notify(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vals := range w.Header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w, status: %d", ErrWebhookRequest, resp.StatusCode)
+	}
+	return nil
+}
+
+// Engine evaluates rules as standing queries of an index and delivers fired alerts to every notifier.
+// Rules are evaluated and notifiers called synchronously while documents are indexed.
+type Engine struct {
+	LSH       *lsh.LSH
+	Notifiers []Notifier
+	OnError   func(rule string, err error) // called when a notifier fails
+	Now       func() time.Time             // clock of the match times, defaults to time.Now
+
+	mu    sync.Mutex
+	rules map[string]*ruleState
+}
+
+// ruleState tracks the recent matches of a rule
+type ruleState struct {
+	rule         Rule
+	subscription uint64
+	matches      []lsh.Match
+	times        []time.Time
+	fired        time.Time
+}
+
+// NewEngine returns an engine evaluating rules against documents indexed into l
+func NewEngine(l *lsh.LSH, notifiers ...Notifier) *Engine {
+	return &Engine{
+		LSH:       l,
+		Notifiers: notifiers,
+		rules:     make(map[string]*ruleState),
+	}
+}
+
+// AddRule starts evaluating the rule against every following indexed document
+func (e *Engine) AddRule(r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, exists := e.rules[r.Name]; exists {
+		return fmt.Errorf("%w, %s", ErrDuplicateRule, r.Name)
+	}
+	rs := &ruleState{rule: r}
+	id, err := e.LSH.Subscribe(r.Query, r.Search, func(m lsh.Match) {
+		e.match(rs, m)
+	})
+	if err != nil {
+		return err
+	}
+	rs.subscription = id
+	e.rules[r.Name] = rs
+	return nil
+}
+
+// RemoveRule stops evaluating the rule
+func (e *Engine) RemoveRule(name string) error {
+	e.mu.Lock()
+	rs, exists := e.rules[name]
+	delete(e.rules, name)
+	e.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("%w, %s", ErrRuleNotFound, name)
+	}
+	return e.LSH.Unsubscribe(rs.subscription)
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// match records the match of the rule and notifies if the rule fires
+func (e *Engine) match(rs *ruleState, m lsh.Match) {
+	now := e.now()
+	e.mu.Lock()
+	rs.matches = append(rs.matches, m)
+	rs.times = append(rs.times, now)
+	if rs.rule.Window > 0 {
+		var expired int
+		for expired < len(rs.times) && now.Sub(rs.times[expired]) > rs.rule.Window {
+			expired++
+		}
+		rs.matches = rs.matches[expired:]
+		rs.times = rs.times[expired:]
+	}
+	if len(rs.matches) < rs.rule.MinMatches ||
+		(!rs.fired.IsZero() && now.Sub(rs.fired) < rs.rule.Cooldown) {
+		e.mu.Unlock()
+		return
+	}
+	alert := Alert{Rule: rs.rule.Name, Severity: rs.rule.Severity, Time: now, Matches: rs.matches}
+	rs.fired = now
+	rs.matches = nil
+	rs.times = nil
+	e.mu.Unlock()
+
+	for _, n := range e.Notifiers {
+		if err := n.Notify(alert); err != nil && e.OnError != nil {
+			e.OnError(rs.rule.Name, err)
+		}
+	}
+}
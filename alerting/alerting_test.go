@@ -0,0 +1,107 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestEngine(t *testing.T) {
+	l, err := lsh.New(configs.NewDefaultLSHConfigs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []Alert
+	e := NewEngine(l, NotifierFunc(func(a Alert) error {
+		alerts = append(alerts, a)
+		return nil
+	}))
+	now := time.Unix(0, 0)
+	e.Now = func() time.Time { return now }
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.9
+	rule := Rule{
+		Name:       "spike",
+		Query:      document.NewSimple(0, 0, []float64{0, 1, 0}),
+		Search:     so,
+		Severity:   SeverityCritical,
+		MinMatches: 2,
+		Window:     time.Minute,
+		Cooldown:   time.Hour,
+	}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddRule(rule); !errors.Is(err, ErrDuplicateRule) {
+		t.Fatalf("expected %v, but got %v", ErrDuplicateRule, err)
+	}
+
+	testData := []struct {
+		elapsed        time.Duration
+		vec            []float64
+		expectedAlerts int
+	}{
+		{0, []float64{0, 2, 0}, 0},
+		{2 * time.Minute, []float64{0, 3, 0}, 0}, // first match expired from the window
+		{2 * time.Minute, []float64{3, 0, 3}, 0}, // no match
+		{3 * time.Minute, []float64{0, 4, 0}, 1},
+		{4 * time.Minute, []float64{0, 5, 0}, 1},
+		{5 * time.Minute, []float64{0, 6, 0}, 1}, // silenced by the cooldown
+		{2 * time.Hour, []float64{0, 7, 0}, 1},
+		{2 * time.Hour, []float64{0, 8, 0}, 2},
+	}
+	for i, td := range testData {
+		now = time.Unix(0, 0).Add(td.elapsed)
+		if err := l.Index(document.NewSimple(uint64(i), 0, td.vec)); err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != td.expectedAlerts {
+			t.Fatalf("expected %d alerts after document %d, but got %d", td.expectedAlerts, i, len(alerts))
+		}
+	}
+	if alerts[0].Rule != "spike" || alerts[0].Severity != SeverityCritical || len(alerts[0].Matches) != 2 {
+		t.Errorf("expected critical spike alert of %d matches, but got %v", 2, alerts[0])
+	}
+
+	if err := e.RemoveRule("spike"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RemoveRule("spike"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("expected %v, but got %v", ErrRuleNotFound, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var received Alert
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL}
+	if err := w.Notify(Alert{Rule: "spike", Severity: SeverityWarning}); err != nil {
+		t.Fatal(err)
+	}
+	if received.Rule != "spike" || received.Severity != SeverityWarning {
+		t.Errorf("expected spike warning, but got %v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := w.Notify(Alert{Rule: "spike"}); !errors.Is(err, ErrWebhookRequest) {
+		t.Errorf("expected %v, but got %v", ErrWebhookRequest, err)
+	}
+}
@@ -34,3 +34,66 @@ func (b *Bitmap) IsEmpty() bool {
 	defer b.Unlock()
 	return b.Rb.IsEmpty()
 }
+
+func (b *Bitmap) Cardinality() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.Rb.GetCardinality()
+}
+
+func (b *Bitmap) SizeInBytes() uint64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.Rb.GetSizeInBytes()
+}
+
+// AndNot removes every uid of the other bitmap
+func (b *Bitmap) AndNot(o *Bitmap) {
+	b.Lock()
+	defer b.Unlock()
+	b.Rb.AndNot(o.Rb)
+}
+
+// RunOptimize converts containers to run length encoding where it is smaller
+func (b *Bitmap) RunOptimize() {
+	b.Lock()
+	defer b.Unlock()
+	b.Rb.RunOptimize()
+}
+
+func (b *Bitmap) Contains(uid uint64) bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.Rb.Contains(uid)
+}
+
+// AddedBytes returns the bytes the bitmap would grow by if the uid was added without adding it
+func (b *Bitmap) AddedBytes(uid uint64) uint64 {
+	b.Lock()
+	defer b.Unlock()
+	if b.Rb.Contains(uid) {
+		return 0
+	}
+	grown := b.Rb.Clone()
+	grown.Add(uid)
+	before, after := b.Rb.GetSizeInBytes(), grown.GetSizeInBytes()
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// GobEncode encodes the uids in the portable roaring format
+func (b *Bitmap) GobEncode() ([]byte, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Rb.MarshalBinary()
+}
+
+// GobDecode replaces the uids with those encoded by GobEncode
+func (b *Bitmap) GobDecode(data []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	b.Rb = roaring64.New()
+	return b.Rb.UnmarshalBinary(data)
+}
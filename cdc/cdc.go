@@ -0,0 +1,121 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/document"
+)
+
+// Op is the type of mutation applied to the index
+type Op string
+
+const (
+	OpIndex  Op = "index"
+	OpDelete Op = "delete"
+)
+
+// Mutation is a single change applied to the index. Seq increases by one with every mutation so
+// downstream consumers can detect gaps and replay in order.
+type Mutation struct {
+	Seq    uint64    `json:"seq"`
+	Op     Op        `json:"op"`
+	UID    uint64    `json:"uid"`
+	Index  int64     `json:"index,omitempty"`
+	Vector []float64 `json:"vector,omitempty"`
+	Time   time.Time `json:"time"`
+
+	SamplePeriod int64  `json:"sample_period,omitempty"` // sample period of the indexed document if it set its own
+	Label        string `json:"label,omitempty"`         // access control label of the indexed document
+}
+
+// Document returns the document an index mutation was applied with
+func (m Mutation) Document() *document.Simple {
+	return &document.Simple{
+		UID:          m.UID,
+		Index:        m.Index,
+		Vector:       m.Vector,
+		Label:        m.Label,
+		SamplePeriod: m.SamplePeriod,
+	}
+}
+
+// Writer receives every mutation applied to the index in order
+type Writer interface {
+	Write(m Mutation) error
+}
+
+// JSONWriter appends each mutation as a line of json to the underlying writer
+type JSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONWriter returns a writer appending json lines to w
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{enc: json.NewEncoder(w)}
+}
+
+// Write implements the Writer interface
+func (w *JSONWriter) Write(m Mutation) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(m)
+}
+
+// Reader returns mutations in the order they were written
+type Reader interface {
+	Next() (Mutation, error)
+}
+
+// JSONReader reads mutations written by a JSONWriter
+type JSONReader struct {
+	r   io.Reader
+	dec *json.Decoder
+}
+
+// NewJSONReader returns a reader of json lines from r
+func NewJSONReader(r io.Reader) *JSONReader {
+	return &JSONReader{r: r, dec: json.NewDecoder(r)}
+}
+
+// Next returns the next mutation or io.EOF once the stream is exhausted. Mutations appended to the
+// stream afterwards are returned by the following calls so a growing stream can be tailed. A line only
+// partially written yet is exhausted too and read again by the following calls.
+func (r *JSONReader) Next() (Mutation, error) {
+	var m Mutation
+	err := r.dec.Decode(&m)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the decoder keeps returning its first error so resume with a new one starting from the
+		// partial line
+		r.dec = json.NewDecoder(io.MultiReader(r.dec.Buffered(), r.r))
+		return Mutation{}, io.EOF
+	}
+	return m, err
+}
+
+// Producer is the minimal interface of a message queue client such as a Kafka producer
+type Producer interface {
+	Produce(topic string, key, value []byte) error
+}
+
+// ProducerWriter publishes each mutation as json to a topic keyed by uid so a partitioned topic keeps
+// the mutations of a uid in order
+type ProducerWriter struct {
+	Producer Producer
+	Topic    string
+}
+
+// Write implements the Writer interface
+func (w *ProducerWriter) Write(m Mutation) error {
+	value, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, m.UID)
+	return w.Producer.Produce(w.Topic, key, value)
+}
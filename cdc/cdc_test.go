@@ -0,0 +1,55 @@
+package cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestJSONReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONWriter(&buf)
+	if err := w.Write(Mutation{Seq: 1, Op: OpIndex, UID: 1, Vector: []float64{0, 1, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewJSONReader(&buf)
+	m, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Seq != 1 || m.Op != OpIndex || len(m.Vector) != 3 {
+		t.Errorf("expected index mutation %d, but got %+v", 1, m)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected %v, but got %v", io.EOF, err)
+	}
+
+	// mutations appended afterwards are tailed
+	if err := w.Write(Mutation{Seq: 2, Op: OpDelete, UID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := r.Next(); err != nil || m.Seq != 2 || m.Op != OpDelete {
+		t.Errorf("expected delete mutation %d, but got %+v with error %v", 2, m, err)
+	}
+
+	// a partially written line is read once the rest of it is written
+	line, err := json.Marshal(Mutation{Seq: 3, Op: OpIndex, UID: 2, Vector: []float64{3, 1, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = append(line, '\n')
+	for _, cut := range []int{1, len(line) / 2, len(line) - 2} {
+		buf.Write(line[:cut])
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("expected %v with %d bytes of the line written, but got %v", io.EOF, cut, err)
+		}
+		buf.Write(line[cut:])
+		if m, err := r.Next(); err != nil || m.Seq != 3 || m.UID != 2 || len(m.Vector) != 3 {
+			t.Errorf("expected index mutation %d with %d bytes written first, but got %+v with error %v", 3, cut, m, err)
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Fatalf("expected %v, but got %v", io.EOF, err)
+		}
+	}
+}
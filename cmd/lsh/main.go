@@ -0,0 +1,132 @@
+// Command lsh runs maintenance tasks against indexes persisted by the lsh package.
+//
+// Usage:
+//
+//	lsh verify -config config.json -snapshot backup.snap [-queries queries.jsonl] [-sample n] [-seed n] [-key-file key.hex]
+//
+// verify loads the snapshot, checks the invariants of the index and replays the recorded queries
+// written by lsh.WriteRecordedQueries printing a json report. It exits with status 1 if the snapshot
+// fails verification.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+const (
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand of args returning the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: lsh <command> [flags], commands: verify")
+		return exitUsage
+	}
+	switch args[0] {
+	case "verify":
+		return verify(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q, commands: verify\n", args[0])
+		return exitUsage
+	}
+}
+
+func verify(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfgPath := fs.String("config", "", "path of the json configuration of the index")
+	snapPath := fs.String("snapshot", "", "path of the snapshot to verify")
+	queriesPath := fs.String("queries", "", "optional path of the recorded queries as json lines")
+	sample := fs.Int("sample", 0, "number of recorded queries replayed, 0 replays every query")
+	seed := fs.Int64("seed", 0, "seed of the query sample")
+	keyPath := fs.String("key-file", "", "optional path of the hex encoded key of an encrypted snapshot")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *cfgPath == "" || *snapPath == "" {
+		fmt.Fprintln(stderr, "verify requires -config and -snapshot")
+		return exitUsage
+	}
+
+	report, err := verifySnapshot(*cfgPath, *snapPath, *queriesPath, *keyPath, lsh.VerifyOptions{SampleSize: *sample, Seed: *seed})
+	failed := errors.Is(err, lsh.ErrInvariantViolated) || errors.Is(err, lsh.ErrVerifyFailed)
+	if err != nil && !failed {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(report); encErr != nil {
+		fmt.Fprintln(stderr, encErr)
+		return exitFailed
+	}
+	if failed {
+		fmt.Fprintln(stderr, err)
+		return exitFailed
+	}
+	return 0
+}
+
+func verifySnapshot(cfgPath, snapPath, queriesPath, keyPath string, opts lsh.VerifyOptions) (lsh.VerifyReport, error) {
+	cfg, err := configs.FromFile(cfgPath)
+	if err != nil {
+		return lsh.VerifyReport{}, err
+	}
+	if keyPath != "" {
+		if opts.Snapshot, err = snapshotOptions(keyPath); err != nil {
+			return lsh.VerifyReport{}, err
+		}
+	}
+	if queriesPath != "" {
+		f, err := os.Open(queriesPath)
+		if err != nil {
+			return lsh.VerifyReport{}, err
+		}
+		opts.Queries, err = lsh.ReadRecordedQueries(f)
+		f.Close()
+		if err != nil {
+			return lsh.VerifyReport{}, err
+		}
+	}
+
+	f, err := os.Open(snapPath)
+	if err != nil {
+		return lsh.VerifyReport{}, err
+	}
+	defer f.Close()
+	return lsh.Verify(cfg, f, opts)
+}
+
+// snapshotOptions returns the options opening a snapshot encrypted with the hex encoded key of the file
+func snapshotOptions(keyPath string) (snapshot.Options, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return snapshot.Options{}, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return snapshot.Options{}, err
+	}
+	c, err := snapshot.NewCipher(key)
+	if err != nil {
+		return snapshot.Options{}, err
+	}
+	return snapshot.Options{Cipher: c}, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	cfg := configs.NewDefaultLSHConfigs()
+	l, err := lsh.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	q, err := l.RecordQuery(document.NewSimple(0, 0, []float64{0, 1, 2.9}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(dir, "config.json")
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := l.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	snapPath := filepath.Join(dir, "backup.snap")
+	if err := os.WriteFile(snapPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := lsh.WriteRecordedQueries(&buf, []lsh.RecordedQuery{q}); err != nil {
+		t.Fatal(err)
+	}
+	queriesPath := filepath.Join(dir, "queries.jsonl")
+	if err := os.WriteFile(queriesPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"verify", "-config", cfgPath, "-snapshot", snapPath, "-queries", queriesPath}
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("expected exit status %d, but got %d, %s", 0, code, stderr.String())
+	}
+	var report lsh.VerifyReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.NumDocs != 1 || report.QueriesReplayed != 1 {
+		t.Errorf("expected %d doc and %d query, but got %+v", 1, 1, report)
+	}
+
+	testData := []struct {
+		args     []string
+		expected int
+	}{
+		{nil, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"verify", "-snapshot", snapPath}, exitUsage},
+		{[]string{"verify", "-config", cfgPath, "-snapshot", filepath.Join(dir, "missing.snap")}, exitFailed},
+	}
+	for _, td := range testData {
+		if code := run(td.args, &stdout, &stderr); code != td.expected {
+			t.Errorf("expected exit status %d, but got %d for %v", td.expected, code, td.args)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/document"
+)
+
+var ErrUnknownEnrichment = errors.New("unknown enrichment")
+
+// EnrichFunc returns the document enriched before it is hashed, e.g. with derived features appended or
+// outliers clipped. It is given a copy of the document which it may modify and should keep the type,
+// uid and index of the document.
+type EnrichFunc func(d document.Document) (document.Document, error)
+
+var (
+	enrichmentsMu sync.RWMutex
+	enrichments   = make(map[string]EnrichFunc)
+)
+
+// RegisterEnrichment makes an enrichment available by name to the Enrichment config. Registering an
+// existing name replaces it.
+func RegisterEnrichment(name string, f EnrichFunc) {
+	enrichmentsMu.Lock()
+	enrichments[name] = f
+	enrichmentsMu.Unlock()
+}
+
+// EnrichmentByName returns the registered enrichment of the given name
+func EnrichmentByName(name string) (EnrichFunc, error) {
+	enrichmentsMu.RLock()
+	f, exists := enrichments[name]
+	enrichmentsMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w, %s", ErrUnknownEnrichment, name)
+	}
+	return f, nil
+}
+
+// RegisteredEnrichments returns the sorted names of all registered enrichments
+func RegisteredEnrichments() []string {
+	enrichmentsMu.RLock()
+	defer enrichmentsMu.RUnlock()
+	names := make([]string, 0, len(enrichments))
+	for name := range enrichments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
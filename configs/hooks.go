@@ -0,0 +1,29 @@
+package configs
+
+import "time"
+
+// Hooks are optional callbacks invoked around index operations so embedders can record their own
+// metrics. Hooks are called synchronously and should not block.
+type Hooks struct {
+	OnIndex       func(e IndexEvent)
+	OnSearchStart func()
+	OnSearchEnd   func(e SearchEvent)
+}
+
+// IndexEvent describes a completed call to index a document
+type IndexEvent struct {
+	UID      uint64
+	Index    int64
+	Duration time.Duration
+	Err      error
+}
+
+// SearchEvent describes a completed search
+type SearchEvent struct {
+	Duration      time.Duration
+	NumCandidates int
+	NumScored     int
+	NumResults    int
+	TablesProbed  int
+	Err           error
+}
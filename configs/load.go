@@ -0,0 +1,112 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables read by FromEnv
+const EnvPrefix = "GOLSH_"
+
+// FromFile reads a JSON configuration on top of the defaults. Unknown fields are rejected so typos
+// don't silently fall back to defaults.
+func FromFile(path string) (*LSHConfigs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewDefaultLSHConfigs()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("decoding %s, %w", path, err)
+	}
+	return c, c.resolve()
+}
+
+// FromEnv overrides the defaults with environment variables named after the upper cased json field
+// names prefixed by EnvPrefix, e.g. GOLSH_NUM_TABLES=64. Lists are comma separated and durations use
+// time.ParseDuration.
+func FromEnv() (*LSHConfigs, error) {
+	c := NewDefaultLSHConfigs()
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := EnvPrefix + strings.ToUpper(name)
+		val, exists := os.LookupEnv(key)
+		if !exists {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return nil, fmt.Errorf("parsing %s, %w", key, err)
+		}
+	}
+	return c, c.resolve()
+}
+
+// resolve sets the transform function from its name and validates the configs
+func (c *LSHConfigs) resolve() error {
+	tfunc, err := TransformByName(c.Transform)
+	if err != nil {
+		return err
+	}
+	c.TFunc = tfunc
+	return c.Validate()
+}
+
+func setField(f reflect.Value, val string) error {
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Slice:
+		parts := strings.Split(val, ",")
+		s := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setField(s.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+	default:
+		return fmt.Errorf("unsupported config type %s", f.Kind())
+	}
+	return nil
+}
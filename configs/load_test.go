@@ -0,0 +1,77 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFromFile(t *testing.T) {
+	RegisterTransform("identity", func(v []float64) []float64 { return v })
+
+	testData := []struct {
+		contents    string
+		expectedErr error
+	}{
+		{`{"num_tables": 4, "table_hyperplanes": [4, 4, 8, 8], "transform": "identity"}`, nil},
+		{`{"num_tables": 4, "transform": "missing"}`, ErrUnknownTransform},
+		{`{"num_tables": 0}`, ErrInvalidNumTables},
+		{`{"num_tables": 4, "filter_concurrency": -1}`, ErrInvalidFilterFanOut},
+		{`{"batch_concurrency": -1}`, ErrInvalidBatchConcurrency},
+		{`{"num_tables": 4, "length_policy": "pad"}`, ErrInvalidLengthPolicy},
+		{`{"num_tables": 4, "enrichment": "missing"}`, ErrUnknownEnrichment},
+		{`{"num_tables": 4, "duplicate_policy": "replace"}`, ErrInvalidDuplicatePolicy},
+		{`{"num_tables": 4, "length_policy": "pad_zero", "max_length_adjustment": -1}`, ErrInvalidLengthAdjustment},
+	}
+	dir := t.TempDir()
+	for i, td := range testData {
+		path := filepath.Join(dir, "lsh.json")
+		if err := os.WriteFile(path, []byte(td.contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := FromFile(path)
+		if !errors.Is(err, td.expectedErr) {
+			t.Errorf("expected %v, but got %v for case %d", td.expectedErr, err, i)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.NumTables != 4 || c.HyperplanesForTable(2) != 8 || c.SamplePeriod != 60 {
+			t.Errorf("expected file to override defaults, but got %+v", c)
+		}
+		if v := c.TFunc([]float64{3, 4}); v[0] != 3 {
+			t.Errorf("expected identity transform, but got %v", v)
+		}
+	}
+
+	path := filepath.Join(dir, "typo.json")
+	if err := os.WriteFile(path, []byte(`{"num_tabels": 4}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(path); err == nil {
+		t.Errorf("expected unknown field error")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("GOLSH_NUM_TABLES", "2")
+	t.Setenv("GOLSH_TABLE_HYPERPLANES", "4, 12")
+	t.Setenv("GOLSH_ENFORCE_ACL", "true")
+	t.Setenv("GOLSH_SEARCH_QUEUE_TIMEOUT", "250ms")
+
+	c, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NumTables != 2 || c.HyperplanesForTable(1) != 12 || !c.EnforceACL || c.SearchQueueTimeout != 250*time.Millisecond {
+		t.Errorf("expected environment to override defaults, but got %+v", c)
+	}
+
+	t.Setenv("GOLSH_ROW_SIZE", "two hours")
+	if _, err := FromEnv(); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
@@ -15,6 +15,7 @@ func TestNewLSHConfigs(t *testing.T) {
 		{1, 1, 1, 1, 1, nil},
 		{3, 5, 2, 60, 7200, nil},
 		{0, 0, 0, 0, 0, ErrInvalidNumHyperplanes},
+		{3, 64, 2, 60, 7200, nil},
 		{3, 65, 2, 0, 0, ErrExceededMaxNumHyperplanes},
 		{0, 5, 2, 0, 0, ErrInvalidVectorLength},
 		{3, 5, 0, 0, 0, ErrInvalidNumTables},
@@ -22,7 +23,14 @@ func TestNewLSHConfigs(t *testing.T) {
 		{3, 5, 2, 60, 0, ErrInvalidRowSize},
 	}
 	for _, td := range testData {
-		opt := &LSHConfigs{td.nh, td.nt, td.nf, td.sp, td.rs, NewDefaultTransformFunc}
+		opt := &LSHConfigs{
+			NumHyperplanes: td.nh,
+			NumTables:      td.nt,
+			VectorLength:   td.nf,
+			SamplePeriod:   td.sp,
+			RowSize:        td.rs,
+			TFunc:          NewDefaultTransformFunc,
+		}
 		if err := opt.Validate(); err != td.err {
 			t.Errorf("expected %v, but got %v", td.err, err)
 			continue
@@ -3,13 +3,15 @@ package configs
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/aouyang1/go-lsh/document"
 	"gonum.org/v1/gonum/floats"
 )
 
 const (
-	// key value is expected to be at most 16 bits
-	maxNumHyperplanes = 16
+	// bucket keys of the tables are at most 64 bits
+	maxNumHyperplanes = 64
 )
 
 var (
@@ -19,23 +21,182 @@ var (
 	ErrInvalidVectorLength       = errors.New("invalid vector length, must be at least 1")
 	ErrInvalidSamplePeriod       = errors.New("invalid sample period, must be at least 1")
 	ErrInvalidRowSize            = errors.New("invalid row size, must be at least 1")
+	ErrTableHyperplanesMismatch  = errors.New("number of per table hyperplanes does not match the number of tables")
+	ErrInvalidNumDocShards       = errors.New("invalid number of document shards, must be at least 0")
+	ErrInvalidVectorArenaSize    = errors.New("invalid vector arena size, must be at least 0")
+	ErrInvalidPAASegments        = errors.New("invalid number of PAA segments, must be between 0 and the vector length")
+	ErrInvalidSearchConcurrency  = errors.New("invalid max concurrent searches and queue timeout, must be at least 0")
+	ErrInvalidMaxDocs            = errors.New("invalid max docs, must be at least 0")
+	ErrInvalidBucketSampleSize   = errors.New("invalid bucket sample size, must be at least 0")
+	ErrInvalidFilterFanOut       = errors.New("invalid filter concurrency or sequential filter docs, must be at least 0")
+	ErrInvalidBatchConcurrency   = errors.New("invalid batch concurrency, must be at least 0")
+	ErrInvalidEvictionPolicy     = errors.New("invalid eviction policy, must be empty, least_recently_indexed or least_recently_matched")
+	ErrInvalidLengthPolicy       = errors.New("invalid length policy, must be empty, pad_zero or pad_missing")
+	ErrInvalidLengthAdjustment   = errors.New("invalid max length adjustment, must be at least 0")
+	ErrInvalidDuplicatePolicy    = errors.New("invalid duplicate policy, must be empty, conflict or ignore")
 )
 
 type TransformFunc func([]float64) []float64
 
+// ValidatorFunc returns an error if the document breaks a rule of the embedding application
+type ValidatorFunc func(d document.Document) error
+
+// Eviction policies choosing which documents to remove when the index is full
+const (
+	EvictNone                 = ""                       // refuse to index more documents
+	EvictLeastRecentlyIndexed = "least_recently_indexed" // evict the documents indexed longest ago
+	EvictLeastRecentlyMatched = "least_recently_matched" // evict the documents returned in search results longest ago
+)
+
+// Duplicate policies choosing how a window that is already indexed is handled when it is indexed again
+// with a different vector
+const (
+	DuplicateAllow    = ""         // rehash the window with the new vector
+	DuplicateConflict = "conflict" // refuse the window with a ConflictError
+	DuplicateIgnore   = "ignore"   // keep the stored window dropping the new one
+)
+
+// Length policies choosing how vectors of a length other than VectorLength are handled
+const (
+	LengthStrict     = ""            // refuse vectors of any other length
+	LengthPadZero    = "pad_zero"    // pad short vectors with zeros and truncate long vectors
+	LengthPadMissing = "pad_missing" // pad short vectors with NaN missing samples and truncate long vectors
+)
+
 func NewDefaultTransformFunc(vec []float64) []float64 {
 	floats.Scale(1.0/floats.Norm(vec, 2), vec)
 	return vec
 }
 
+func init() {
+	RegisterTransform(DefaultTransform, NewDefaultTransformFunc)
+	RegisterTransform(DetrendTransform, NewDetrendTransformFunc)
+	RegisterTransform(DifferenceTransform, NewDifferenceTransformFunc)
+}
+
 // LSHConfigs represents a set of parameters that configure the LSH tables
 type LSHConfigs struct {
-	NumHyperplanes int
-	NumTables      int
-	VectorLength   int
-	SamplePeriod   int64         // expected time period between each sample in the vector
-	RowSize        int64         // size of each range of store bitmaps per table. Larger values will generally store more uids
-	TFunc          TransformFunc // transformation to vector on index and search
+	NumHyperplanes int           `json:"num_hyperplanes"`
+	NumTables      int           `json:"num_tables"`
+	VectorLength   int           `json:"vector_length"`
+	SamplePeriod   int64         `json:"sample_period"` // expected time period between each sample in the vector
+	RowSize        int64         `json:"row_size"`      // size of each range of store bitmaps per table. Larger values will generally store more uids
+	TFunc          TransformFunc `json:"-"`             // transformation to vector on index and search
+
+	// Transform names a registered transform used to set TFunc when loading configs from a file or the
+	// environment
+	Transform string `json:"transform"`
+
+	// TableHyperplanes optionally sets the number of hyperplanes for each table overriding NumHyperplanes
+	// so that tables of different selectivity can be mixed in one index
+	TableHyperplanes []int `json:"table_hyperplanes"`
+
+	// MaxBucketSize splits any bucket holding more uids than this with additional hyperplanes local to
+	// the bucket so skewed data doesn't degrade search into scanning one giant bucket. 0 disables splitting.
+	MaxBucketSize int `json:"max_bucket_size"`
+
+	// EnforceACL requires every search to provide the access control labels of the caller so that
+	// documents of other owners are never returned
+	EnforceACL bool `json:"enforce_acl"`
+
+	// NumDocShards partitions the forward index by uid so concurrent indexing and lookups of different
+	// documents don't contend on a single lock. 0 uses a single shard.
+	NumDocShards int `json:"num_doc_shards"`
+
+	// VectorArenaSize stores vectors in contiguous chunks of this many values instead of a slice per
+	// document which reduces garbage collection scan time for large indexes. 0 disables the arena.
+	VectorArenaSize int `json:"vector_arena_size"`
+
+	// MinOverlap is the fewest samples that must be present, not NaN, in both the query and a stored
+	// vector for the pair to be scored. Values below 2 require 2.
+	MinOverlap int `json:"min_overlap"`
+
+	// PAASegments reduces vectors to this many segment averages before hashing which lowers the
+	// hashing cost and hyperplane storage of long windows. Scoring still uses the full vectors. 0
+	// hashes the full vectors.
+	PAASegments int `json:"paa_segments"`
+
+	// MaxConcurrentSearches limits the number of searches materializing candidates at once. Searches
+	// beyond the limit wait up to SearchQueueTimeout for a slot before failing with an overloaded error.
+	// 0 disables the limit and a timeout of 0 waits indefinitely.
+	MaxConcurrentSearches int           `json:"max_concurrent_searches"`
+	SearchQueueTimeout    time.Duration `json:"search_queue_timeout"`
+
+	// MemoryBudget is the estimated number of bytes the tables and forward index may hold. Indexing is
+	// refused once the budget is reached unless an EvictionPolicy is set. 0 disables the budget.
+	MemoryBudget uint64 `json:"memory_budget"`
+
+	// MaxDocs caps the number of stored documents. 0 leaves the number uncapped.
+	MaxDocs int `json:"max_docs"`
+
+	// EvictionPolicy makes room for new documents when MaxDocs or MemoryBudget is reached instead of
+	// refusing to index them
+	EvictionPolicy string `json:"eviction_policy"`
+
+	// BucketSampleSize keeps a reservoir sample of up to this many hashed vectors per bucket hash so
+	// centroids can be computed to understand how the hash space partitions the data. 0 disables sampling.
+	BucketSampleSize int `json:"bucket_sample_size"`
+
+	// Seed makes the hyperplanes, bucket splits and bucket samples reproducible so repeated runs over
+	// the same data produce the same tables and candidates. 0 uses a random seed.
+	Seed int64 `json:"seed"`
+
+	// FilterConcurrency caps the number of goroutines filtering tables for a single search. 0 uses a
+	// goroutine per table.
+	FilterConcurrency int `json:"filter_concurrency"`
+
+	// SequentialFilterDocs filters the tables of a search sequentially while the index holds fewer
+	// documents than this since the goroutine fan out costs more than it saves for small indexes. 0
+	// always fans out.
+	SequentialFilterDocs int `json:"sequential_filter_docs"`
+
+	// BatchConcurrency caps the number of queries of a SearchBatch searched at once. 0 uses GOMAXPROCS
+	// bounded by MaxConcurrentSearches.
+	BatchConcurrency int `json:"batch_concurrency"`
+
+	// Float32Planes generates and stores the hyperplanes as float32 coefficients hashing with float32
+	// dot products which halves the memory of the planes
+	Float32Planes bool `json:"float32_planes"`
+
+	// LengthPolicy pads or truncates vectors at the configured sample period that are shorter or longer
+	// than VectorLength instead of refusing them. The trailing samples are the ones added or removed.
+	LengthPolicy string `json:"length_policy"`
+
+	// MaxLengthAdjustment is the most samples the LengthPolicy may pad or truncate. Vectors further off
+	// are still refused. 0 allows any adjustment.
+	MaxLengthAdjustment int `json:"max_length_adjustment"`
+
+	// DuplicatePolicy handles a window indexed again under the same uid and index with a different
+	// vector which is detected by a checksum kept for each stored window when a policy is set.
+	// Identical windows are always reindexed.
+	DuplicatePolicy string `json:"duplicate_policy"`
+
+	// Enrichment names a registered enrichment applied to every document before it is indexed and to
+	// every query before it is searched. VectorLength is the length of the enriched vectors.
+	Enrichment string `json:"enrichment"`
+
+	// Validator optionally checks every document before it is indexed in addition to the built-in
+	// length and complexity checks, e.g. to enforce uid ranges or value bounds
+	Validator ValidatorFunc `json:"-"`
+
+	// Hooks are optional instrumentation callbacks around indexing and searching
+	Hooks Hooks `json:"-"`
+}
+
+// HashLength returns the length of the vectors hashed into the tables
+func (c *LSHConfigs) HashLength() int {
+	if c.PAASegments > 0 {
+		return c.PAASegments
+	}
+	return c.VectorLength
+}
+
+// HyperplanesForTable returns the number of hyperplanes configured for the i-th table
+func (c *LSHConfigs) HyperplanesForTable(i int) int {
+	if len(c.TableHyperplanes) == 0 {
+		return c.NumHyperplanes
+	}
+	return c.TableHyperplanes[i]
 }
 
 // NewDefaultLSHConfigs returns a set of default options to create the LSH tables
@@ -47,9 +208,23 @@ func NewDefaultLSHConfigs() *LSHConfigs {
 		SamplePeriod:   60,   // defaults to 1m between each sample in the vector
 		RowSize:        7200, // if the index represents seconds from epoch then this would translate to a table window of 2hrs
 		TFunc:          NewDefaultTransformFunc,
+		Transform:      DefaultTransform,
+		NumDocShards:   16,
+
+		SequentialFilterDocs: 1000, // small indexes are filtered faster without a goroutine per table
 	}
 }
 
+// NewEmbeddingLSHConfigs returns a preset for plain vector similarity of the given dimension where
+// vectors carry no time semantics. Every vector is stored in a single row at index 0.
+func NewEmbeddingLSHConfigs(dim int) *LSHConfigs {
+	cfg := NewDefaultLSHConfigs()
+	cfg.VectorLength = dim
+	cfg.SamplePeriod = 1
+	cfg.RowSize = 1
+	return cfg
+}
+
 // Validate returns an error if any of the LSH options are invalid
 func (c *LSHConfigs) Validate() error {
 	if c.NumHyperplanes < 1 {
@@ -63,6 +238,20 @@ func (c *LSHConfigs) Validate() error {
 		return ErrInvalidNumTables
 	}
 
+	if len(c.TableHyperplanes) > 0 {
+		if len(c.TableHyperplanes) != c.NumTables {
+			return ErrTableHyperplanesMismatch
+		}
+		for _, nh := range c.TableHyperplanes {
+			if nh < 1 {
+				return ErrInvalidNumHyperplanes
+			}
+			if nh > maxNumHyperplanes {
+				return ErrExceededMaxNumHyperplanes
+			}
+		}
+	}
+
 	if c.VectorLength < 1 {
 		return ErrInvalidVectorLength
 	}
@@ -75,5 +264,65 @@ func (c *LSHConfigs) Validate() error {
 		return ErrInvalidRowSize
 	}
 
+	if c.NumDocShards < 0 {
+		return ErrInvalidNumDocShards
+	}
+
+	if c.VectorArenaSize < 0 {
+		return ErrInvalidVectorArenaSize
+	}
+
+	if c.PAASegments < 0 || c.PAASegments > c.VectorLength {
+		return ErrInvalidPAASegments
+	}
+
+	if c.MaxConcurrentSearches < 0 || c.SearchQueueTimeout < 0 {
+		return ErrInvalidSearchConcurrency
+	}
+
+	if c.MaxDocs < 0 {
+		return ErrInvalidMaxDocs
+	}
+
+	if c.FilterConcurrency < 0 || c.SequentialFilterDocs < 0 {
+		return ErrInvalidFilterFanOut
+	}
+
+	if c.BatchConcurrency < 0 {
+		return ErrInvalidBatchConcurrency
+	}
+
+	if c.BucketSampleSize < 0 {
+		return ErrInvalidBucketSampleSize
+	}
+
+	switch c.EvictionPolicy {
+	case EvictNone, EvictLeastRecentlyIndexed, EvictLeastRecentlyMatched:
+	default:
+		return ErrInvalidEvictionPolicy
+	}
+
+	switch c.DuplicatePolicy {
+	case DuplicateAllow, DuplicateConflict, DuplicateIgnore:
+	default:
+		return ErrInvalidDuplicatePolicy
+	}
+
+	switch c.LengthPolicy {
+	case LengthStrict, LengthPadZero, LengthPadMissing:
+	default:
+		return ErrInvalidLengthPolicy
+	}
+
+	if c.MaxLengthAdjustment < 0 {
+		return ErrInvalidLengthAdjustment
+	}
+
+	if c.Enrichment != "" {
+		if _, err := EnrichmentByName(c.Enrichment); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
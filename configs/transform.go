@@ -0,0 +1,119 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+var ErrUnknownTransform = errors.New("unknown transform")
+
+const (
+	// DefaultTransform is the name of the transform that scales vectors to unit length
+	DefaultTransform = "normalize"
+
+	// DetrendTransform is the name of the transform that removes the linear trend before scaling to
+	// unit length
+	DetrendTransform = "detrend"
+
+	// DifferenceTransform is the name of the transform that compares the shape of change between
+	// samples rather than their levels
+	DifferenceTransform = "difference"
+)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = make(map[string]TransformFunc)
+)
+
+// RegisterTransform makes a transform available by name to configs loaded from a file or the
+// environment. Registering an existing name replaces it.
+func RegisterTransform(name string, f TransformFunc) {
+	transformsMu.Lock()
+	transforms[name] = f
+	transformsMu.Unlock()
+}
+
+// TransformByName returns the registered transform of the given name
+func TransformByName(name string) (TransformFunc, error) {
+	transformsMu.RLock()
+	f, exists := transforms[name]
+	transformsMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w, %s", ErrUnknownTransform, name)
+	}
+	return f, nil
+}
+
+// RegisteredTransforms returns the sorted names of all registered transforms
+func RegisteredTransforms() []string {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LinearTrend returns the least squares slope per sample and intercept of the vector ignoring NaN
+// samples
+func LinearTrend(vec []float64) (slope, intercept float64) {
+	var n, sumX, sumY, sumXY, sumXX float64
+	for i, y := range vec {
+		if math.IsNaN(y) {
+			continue
+		}
+		x := float64(i)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, sumY / n
+	}
+	slope = (n*sumXY - sumX*sumY) / denom
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept
+}
+
+// NewDetrendTransformFunc removes the linear trend so that correlation compares the shape of the
+// vectors rather than being dominated by a shared trend. The residual is scaled to unit length.
+func NewDetrendTransformFunc(vec []float64) []float64 {
+	slope, intercept := LinearTrend(vec)
+	for i := range vec {
+		vec[i] -= slope*float64(i) + intercept
+	}
+	if norm := floats.Norm(vec, 2); norm > 0 {
+		floats.Scale(1.0/norm, vec)
+	}
+	return vec
+}
+
+// NewDifferenceTransformFunc replaces each sample with its first difference so that vectors are
+// compared by how they change rather than their levels. The first sample repeats the first difference
+// to keep the vector length and the result is scaled to unit length.
+func NewDifferenceTransformFunc(vec []float64) []float64 {
+	if len(vec) < 2 {
+		return vec
+	}
+	for i := len(vec) - 1; i > 0; i-- {
+		vec[i] -= vec[i-1]
+	}
+	vec[0] = vec[1]
+	if norm := floats.Norm(vec, 2); norm > 0 {
+		floats.Scale(1.0/norm, vec)
+	}
+	return vec
+}
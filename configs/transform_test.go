@@ -0,0 +1,38 @@
+package configs
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	testData := []struct {
+		name     string
+		vec      []float64
+		expected []float64
+	}{
+		{DefaultTransform, []float64{3, 4}, []float64{0.6, 0.8}},
+		{DetrendTransform, []float64{1, 3, 5, 7}, []float64{0, 0, 0, 0}},
+		{DetrendTransform, []float64{0, 2, 0, 2}, []float64{-0.2236, 0.6708, -0.6708, 0.2236}},
+		{DifferenceTransform, []float64{10, 13, 17}, []float64{0.5145, 0.5145, 0.6860}},
+		{DifferenceTransform, []float64{5}, []float64{5}},
+	}
+	for _, td := range testData {
+		tfunc, err := TransformByName(td.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := tfunc(td.vec)
+		for i := range res {
+			if math.Abs(res[i]-td.expected[i]) > 1e-4 {
+				t.Errorf("expected %v, but got %v for transform %s", td.expected, res, td.name)
+				break
+			}
+		}
+	}
+
+	if _, err := TransformByName("fourier"); !errors.Is(err, ErrUnknownTransform) {
+		t.Errorf("expected %v, but got %v", ErrUnknownTransform, err)
+	}
+}
@@ -12,10 +12,33 @@ type Document interface {
 	Register()
 }
 
+// Labeler is implemented by documents owned by an access control label. Searches may be restricted to
+// the documents of the labels a caller is allowed to read.
+type Labeler interface {
+	GetLabel() string
+}
+
+// SamplePerioder is implemented by documents sampled at their own period rather than the period
+// configured for the index
+type SamplePerioder interface {
+	GetSamplePeriod() int64
+}
+
+// SamplePeriod returns the sample period of the document or def if it doesn't set its own
+func SamplePeriod(d Document, def int64) int64 {
+	if sp, ok := d.(SamplePerioder); ok && sp.GetSamplePeriod() > 0 {
+		return sp.GetSamplePeriod()
+	}
+	return def
+}
+
 type Simple struct {
 	UID    uint64    `json:"uid"`
 	Index  int64     `json:"index"` // represents the first timestamp of the vector
 	Vector []float64 `json:"vector"`
+	Label  string    `json:"label,omitempty"` // optional access control label of the owner
+
+	SamplePeriod int64 `json:"sample_period,omitempty"` // optional period between samples overriding the configured one
 }
 
 func NewSimple(uid uint64, index int64, v []float64) *Simple {
@@ -34,6 +57,9 @@ func (s Simple) Copy() Document {
 		UID:    s.GetUID(),
 		Index:  s.GetIndex(),
 		Vector: nextVec,
+		Label:  s.Label,
+
+		SamplePeriod: s.SamplePeriod,
 	}
 	return next
 }
@@ -50,6 +76,14 @@ func (s Simple) GetVector() []float64 {
 	return s.Vector
 }
 
+func (s Simple) GetLabel() string {
+	return s.Label
+}
+
+func (s Simple) GetSamplePeriod() int64 {
+	return s.SamplePeriod
+}
+
 func (s Simple) Register() {
 	gob.Register(s)
 }
@@ -0,0 +1,42 @@
+package document
+
+import "errors"
+
+var ErrInvalidNumBits = errors.New("invalid number of hash bits, must be greater than 0")
+
+// NewImageHash converts the lowest nbits of a perceptual image hash (pHash, dHash, aHash) into a
+// vector of +1/-1 values ordered from the most significant bit. Indexing these vectors lets near
+// duplicate images be found with the same tables and search where a smaller hamming distance between
+// hashes translates into a higher correlation. Returns ErrInvalidNumBits if nbits is less than 1.
+func NewImageHash(uid uint64, hash uint64, nbits int) (*Simple, error) {
+	if nbits < 1 {
+		return nil, ErrInvalidNumBits
+	}
+	if nbits > 64 {
+		nbits = 64
+	}
+	vec := make([]float64, nbits)
+	for i := 0; i < nbits; i++ {
+		vec[i] = bitToFloat(hash>>(nbits-1-i)&1 == 1)
+	}
+	return NewSimple(uid, 0, vec), nil
+}
+
+// NewImageHashBytes converts a perceptual image hash of any length into a vector of +1/-1 values with
+// 8 values per byte ordered from the most significant bit of the first byte.
+func NewImageHashBytes(uid uint64, hash []byte) *Simple {
+	vec := make([]float64, 0, len(hash)*8)
+	for _, b := range hash {
+		for i := 7; i >= 0; i-- {
+			vec = append(vec, bitToFloat(b>>i&1 == 1))
+		}
+	}
+	return NewSimple(uid, 0, vec)
+}
+
+func bitToFloat(set bool) float64 {
+	if set {
+		return 1
+	}
+	return -1
+}
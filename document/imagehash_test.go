@@ -0,0 +1,39 @@
+package document
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewImageHash(t *testing.T) {
+	testData := []struct {
+		nbits    int
+		expected []float64
+		err      error
+	}{
+		{4, []float64{1, -1, 1, 1}, nil},
+		{1, []float64{1}, nil},
+		{0, nil, ErrInvalidNumBits},
+		{-1, nil, ErrInvalidNumBits},
+	}
+	for _, td := range testData {
+		d, err := NewImageHash(1, 0b1011, td.nbits)
+		if !errors.Is(err, td.err) {
+			t.Errorf("expected %v, but got %v", td.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(d.Vector) != len(td.expected) {
+			t.Errorf("expected %v, but got %v", td.expected, d.Vector)
+			continue
+		}
+		for i, v := range td.expected {
+			if d.Vector[i] != v {
+				t.Errorf("expected %v, but got %v", td.expected, d.Vector)
+				break
+			}
+		}
+	}
+}
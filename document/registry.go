@@ -0,0 +1,81 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrInvalidTypeName = errors.New("invalid document type name, must not be empty")
+	ErrDuplicateType   = errors.New("document type is already registered")
+	ErrUnknownType     = errors.New("document type is not registered")
+)
+
+// SimpleTypeName is the name Simple documents are registered under
+const SimpleTypeName = "simple"
+
+// Constructor returns a new empty document of a registered type for a snapshot to be decoded into
+type Constructor func() Document
+
+// registry maps document type names to their constructors and the concrete type of each constructed
+// document back to its name
+var registry = struct {
+	sync.RWMutex
+	ctors map[string]Constructor
+	names map[reflect.Type]string
+}{
+	ctors: make(map[string]Constructor),
+	names: make(map[reflect.Type]string),
+}
+
+func init() {
+	if err := RegisterType(SimpleTypeName, func() Document { return new(Simple) }); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterType registers the constructor of a document type under a name stored in snapshots so
+// documents of the type can be restored. The concrete type returned by the constructor must be the
+// type of the documents indexed, e.g. a pointer.
+func RegisterType(name string, c Constructor) error {
+	if name == "" {
+		return ErrInvalidTypeName
+	}
+	typ := reflect.TypeOf(c())
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.ctors[name]; exists {
+		return fmt.Errorf("%w, %s", ErrDuplicateType, name)
+	}
+	if _, exists := registry.names[typ]; exists {
+		return fmt.Errorf("%w, %s", ErrDuplicateType, typ)
+	}
+	registry.ctors[name] = c
+	registry.names[typ] = name
+	return nil
+}
+
+// TypeName returns the name the type of the document is registered under
+func TypeName(d Document) (string, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, exists := registry.names[reflect.TypeOf(d)]
+	if !exists {
+		return "", fmt.Errorf("%w, %T", ErrUnknownType, d)
+	}
+	return name, nil
+}
+
+// Lookup returns the constructor registered under the name
+func Lookup(name string) (Constructor, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, exists := registry.ctors[name]
+	if !exists {
+		return nil, fmt.Errorf("%w, %s", ErrUnknownType, name)
+	}
+	return c, nil
+}
@@ -0,0 +1,56 @@
+package document
+
+import (
+	"errors"
+	"testing"
+)
+
+type custom struct {
+	Simple
+	Region string
+}
+
+func (c *custom) Copy() Document {
+	next := *c
+	next.Vector = append([]float64(nil), c.Vector...)
+	return &next
+}
+
+func TestRegistry(t *testing.T) {
+	if err := RegisterType("custom", func() Document { return new(custom) }); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		doc          Document
+		expectedName string
+		expectedErr  error
+	}{
+		{NewSimple(1, 0, nil), SimpleTypeName, nil},
+		{&custom{Region: "us"}, "custom", nil},
+		{Simple{}, "", ErrUnknownType},
+	}
+	for _, td := range testData {
+		name, err := TypeName(td.doc)
+		if !errors.Is(err, td.expectedErr) {
+			t.Fatalf("expected %v, but got %v error for %T", td.expectedErr, err, td.doc)
+		}
+		if name != td.expectedName {
+			t.Errorf("expected %s, but got %s", td.expectedName, name)
+		}
+	}
+
+	c, err := Lookup("custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c().(*custom); !ok {
+		t.Errorf("expected constructor of *custom, but got %T", c())
+	}
+	if _, err := Lookup("missing"); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected %v, but got %v", ErrUnknownType, err)
+	}
+	if err := RegisterType("custom", func() Document { return new(Simple) }); !errors.Is(err, ErrDuplicateType) {
+		t.Errorf("expected %v, but got %v", ErrDuplicateType, err)
+	}
+}
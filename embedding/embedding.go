@@ -0,0 +1,120 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+var (
+	ErrEmbeddingRequest = errors.New("embedding request failed")
+	ErrNoEmbedding      = errors.New("no embedding found in response")
+)
+
+// Embedder converts text into a vector to be indexed or searched
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// HTTPEmbedder calls an external embedding endpoint with a json body of {"input": text, "model": model}.
+// Responses of either {"embedding": [...]} or the OpenAI style {"data": [{"embedding": [...]}]} are
+// supported.
+type HTTPEmbedder struct {
+	URL    string
+	Model  string
+	Header http.Header // additional headers such as authorization
+	Client *http.Client
+}
+
+type embedRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+type embedResponse struct {
+	Embedding []float64 `json:"embedding"`
+	Data      []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed implements the Embedder interface
+func (e *HTTPEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	body, err := json.Marshal(embedRequest{Input: text, Model: e.Model})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vals := range e.Header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w, status: %d", ErrEmbeddingRequest, resp.StatusCode)
+	}
+
+	var er embedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		return nil, err
+	}
+	if len(er.Embedding) > 0 {
+		return er.Embedding, nil
+	}
+	if len(er.Data) > 0 && len(er.Data[0].Embedding) > 0 {
+		return er.Data[0].Embedding, nil
+	}
+	return nil, ErrNoEmbedding
+}
+
+// TextIndex wraps an LSH index with an embedder so text can be indexed and searched directly. The LSH
+// vector length must match the dimension of the embeddings.
+type TextIndex struct {
+	LSH      *lsh.LSH
+	Embedder Embedder
+}
+
+// NewTextIndex returns a text index backed by the lsh index and embedder
+func NewTextIndex(l *lsh.LSH, e Embedder) *TextIndex {
+	return &TextIndex{LSH: l, Embedder: e}
+}
+
+// IndexText embeds the text and indexes it under the uid
+func (t *TextIndex) IndexText(ctx context.Context, uid uint64, text string) error {
+	vec, err := t.Embedder.Embed(ctx, text)
+	if err != nil {
+		return err
+	}
+	return t.LSH.Index(document.NewSimple(uid, 0, vec))
+}
+
+// SearchText embeds the text and searches for the most similar indexed texts
+func (t *TextIndex) SearchText(ctx context.Context, text string, s *options.Search) (results.Scores, int, error) {
+	vec, err := t.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, 0, err
+	}
+	return t.LSH.Search(document.NewSimple(0, 0, vec), s)
+}
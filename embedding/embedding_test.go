@@ -0,0 +1,55 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestTextIndex(t *testing.T) {
+	vectors := map[string][]float64{
+		"cat":    {0, 0.1, 5},
+		"kitten": {0, 0.1, 4},
+		"car":    {5, 0.1, 0},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": vectors[req.Input]}},
+		})
+	}))
+	defer srv.Close()
+
+	l, err := lsh.New(configs.NewDefaultLSHConfigs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := NewTextIndex(l, &HTTPEmbedder{URL: srv.URL})
+
+	ctx := context.Background()
+	for uid, text := range []string{"cat", "car"} {
+		if err := ti.IndexText(ctx, uint64(uid), text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := ti.SearchText(ctx, "kitten", so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].UID != 0 {
+		t.Fatalf("expected only uid 0 to match, but got %v", res)
+	}
+}
@@ -0,0 +1,60 @@
+package embedding
+
+import (
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+// VectorIndex is a plain vector similarity index hiding the time series concepts of sample periods,
+// rows and lags
+type VectorIndex struct {
+	LSH *lsh.LSH
+}
+
+// NewVectorIndex returns an index of vectors of the given dimension
+func NewVectorIndex(dim int) (*VectorIndex, error) {
+	return NewVectorIndexWithConfigs(configs.NewEmbeddingLSHConfigs(dim))
+}
+
+// NewVectorIndexWithConfigs returns an index tuned by configs such as those of NewEmbeddingLSHConfigs
+func NewVectorIndexWithConfigs(cfg *configs.LSHConfigs) (*VectorIndex, error) {
+	l, err := lsh.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &VectorIndex{LSH: l}, nil
+}
+
+// Index stores the vector under the uid
+func (v *VectorIndex) Index(uid uint64, vec []float64) error {
+	return v.LSH.Index(document.NewSimple(uid, 0, vec))
+}
+
+// Delete removes the vector of the uid
+func (v *VectorIndex) Delete(uid uint64) error {
+	return v.LSH.Delete(uid)
+}
+
+// Search returns up to k of the most positively correlated vectors
+func (v *VectorIndex) Search(vec []float64, k int) (results.Scores, error) {
+	s, err := options.NewSearch(
+		options.WithTopK(k),
+		options.WithThreshold(0),
+		options.WithSignFilter(options.SignFilter_POS),
+		options.WithAlignmentFree(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return v.SearchWithOptions(vec, s)
+}
+
+// SearchWithOptions searches with custom options. Indexes are always ignored.
+func (v *VectorIndex) SearchWithOptions(vec []float64, s *options.Search) (results.Scores, error) {
+	s.AlignmentFree = true
+	scores, _, err := v.LSH.Search(document.NewSimple(0, 0, vec), s)
+	return scores, err
+}
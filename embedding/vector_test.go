@@ -0,0 +1,47 @@
+package embedding
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestVectorIndex(t *testing.T) {
+	v, err := NewVectorIndex(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := [][]float64{
+		{1, 0, 0, 2},
+		{1, 0.1, 0, 2},
+		{0, 2, 1, 0},
+	}
+	for uid, vec := range vectors {
+		if err := v.Index(uint64(uid), vec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := v.Search([]float64{1, 0, 0, 2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].UID != 0 || res[1].UID != 1 {
+		t.Fatalf("expected uids 0 and 1, but got %v", res)
+	}
+
+	if err := v.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	res, err = v.Search([]float64{1, 0, 0, 2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].UID != 1 {
+		t.Fatalf("expected uid 1, but got %v", res)
+	}
+
+	if _, err := v.Search([]float64{1, 0, 0, 2}, 0); err != options.ErrInvalidNumToReturn {
+		t.Errorf("expected %v, but got %v error", options.ErrInvalidNumToReturn, err)
+	}
+}
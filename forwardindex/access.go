@@ -0,0 +1,84 @@
+package forwardindex
+
+// access records the logical times a uid was last indexed and last returned in search results
+type access struct {
+	indexed uint64
+	matched uint64
+}
+
+// AccessOrder selects which access time ranks documents for eviction
+type AccessOrder int
+
+const (
+	LeastRecentlyIndexed AccessOrder = iota
+	LeastRecentlyMatched             // documents never matched rank by when they were indexed
+)
+
+// at returns the access time ranking the uid for the order
+func (a access) at(order AccessOrder) uint64 {
+	if order == LeastRecentlyMatched {
+		return a.matched
+	}
+	return a.indexed
+}
+
+// excluded returns true if the uid is one of the excluded uids
+func excluded(uid uint64, exclude []uint64) bool {
+	for _, e := range exclude {
+		if uid == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *shard) indexed(uid uint64, now uint64) {
+	markIndexed(s.access, uid, now)
+}
+
+func markIndexed(accesses map[uint64]access, uid uint64, now uint64) {
+	a := accesses[uid]
+	a.indexed = now
+	if a.matched == 0 {
+		a.matched = now
+	}
+	accesses[uid] = a
+}
+
+// Touch records that the uids were returned in search results
+func (i *InMemory) Touch(uids ...uint64) {
+	now := i.clock.Add(1)
+	for _, uid := range uids {
+		s := i.shard(uid)
+		s.Lock()
+		if a, exists := s.access[uid]; exists {
+			a.matched = now
+			s.access[uid] = a
+		}
+		s.Unlock()
+	}
+}
+
+// Oldest returns the uid accessed least recently by the given order skipping the excluded uids. Returns
+// false if the forward index holds no other uid.
+func (i *InMemory) Oldest(order AccessOrder, exclude ...uint64) (uint64, bool) {
+	var (
+		oldestUID  uint64
+		oldestTime uint64
+		found      bool
+	)
+	for _, s := range i.shards {
+		s.RLock()
+		for uid, a := range s.access {
+			if excluded(uid, exclude) {
+				continue
+			}
+			t := a.at(order)
+			if !found || t < oldestTime || (t == oldestTime && uid < oldestUID) {
+				oldestUID, oldestTime, found = uid, t, true
+			}
+		}
+		s.RUnlock()
+	}
+	return oldestUID, found
+}
@@ -0,0 +1,76 @@
+package forwardindex
+
+// arena packs vectors into large contiguous chunks so the garbage collector scans a handful of big
+// slices instead of one small slice per document
+type arena struct {
+	chunkSize int
+	chunks    [][]float64
+
+	allocated int // number of values handed out, including ones since freed
+	live      int // number of values referenced by stored documents
+}
+
+// vecRef locates a document's vector in the arena. It holds no pointers so maps of refs are not
+// scanned by the garbage collector.
+type vecRef struct {
+	index  int64
+	period int64
+	chunk  int
+	offset int
+	length int
+}
+
+func newArena(chunkSize int) *arena {
+	return &arena{chunkSize: chunkSize}
+}
+
+// store copies vec into the arena returning a reference to it
+func (a *arena) store(index, period int64, vec []float64) vecRef {
+	n := len(vec)
+	last := len(a.chunks) - 1
+	if last < 0 || cap(a.chunks[last])-len(a.chunks[last]) < n {
+		size := a.chunkSize
+		if n > size {
+			size = n
+		}
+		a.chunks = append(a.chunks, make([]float64, 0, size))
+		last++
+	}
+
+	chunk := a.chunks[last]
+	offset := len(chunk)
+	a.chunks[last] = append(chunk, vec...)
+	a.allocated += n
+	a.live += n
+	return vecRef{index: index, period: period, chunk: last, offset: offset, length: n}
+}
+
+// vector returns the stored values of a reference. The capacity is capped so appending never
+// overwrites a neighbouring vector.
+func (a *arena) vector(r vecRef) []float64 {
+	return a.chunks[r.chunk][r.offset : r.offset+r.length : r.offset+r.length]
+}
+
+// free marks the values of a reference as garbage. The space is reclaimed by compact.
+func (a *arena) free(r vecRef) {
+	a.live -= r.length
+}
+
+// compact copies the live vectors into fresh chunks returning the updated references
+func (a *arena) compact(refs map[uint64]vecRef) {
+	old := a
+	fresh := newArena(a.chunkSize)
+	for uid, r := range refs {
+		refs[uid] = fresh.store(r.index, r.period, old.vector(r))
+	}
+	*a = *fresh
+}
+
+// capacity returns the number of values the chunks can hold
+func (a *arena) capacity() int {
+	var c int
+	for _, chunk := range a.chunks {
+		c += cap(chunk)
+	}
+	return c
+}
@@ -0,0 +1,536 @@
+package forwardindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+var (
+	ErrNoDiskPath        = errors.New("no path provided for the disk forward index")
+	ErrInvalidDiskFile   = errors.New("not a disk forward index file of a supported version")
+	ErrCorruptDiskRecord = errors.New("disk forward index record is corrupt")
+	ErrDiskMetaTooLong   = errors.New("label or type name of the document exceeds 65535 bytes")
+)
+
+const (
+	diskMagic          = "GOLSHFWD"
+	diskVersion        = uint16(1)
+	diskFileHeaderSize = len(diskMagic) + 2
+	diskHeaderSize     = 36             // checksum, uid, index, sample period, values and metadata length
+	diskTombstone      = math.MaxUint32 // number of values marking the uid of a record as deleted
+)
+
+var diskCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Disk stores the documents in an append-only file keeping only the location of each uid's record in
+// memory so that indices larger than memory can still be scored. Expanding or deleting a document appends
+// a new record leaving the previous one as garbage until Compact rewrites the file. The file is replayed
+// when opened so stored documents survive restarts. Each record is checksummed and carries the owner
+// label and registered type of its document, the latter gob encoded unless it is a Simple document.
+//
+//	file:   magic[8] version[2] records
+//	record: crc[4] uid[8] index[8] period[8] numValues[4] metaLen[4] values meta
+//	meta:   labelLen[2] label typeLen[2] type document, empty for an unlabeled Simple document
+type Disk struct {
+	cfg  *configs.LSHConfigs
+	path string
+
+	mu      sync.RWMutex
+	f       *os.File
+	size    int64 // end of the last complete record
+	garbage int64 // bytes of records superseded by later records
+	refs    map[uint64]diskRef
+	access  map[uint64]access
+	clock   uint64
+
+	errMu sync.Mutex
+	err   error // first error reading a record after the file was opened
+}
+
+// diskRef locates the latest record of a uid
+type diskRef struct {
+	offset int64
+	index  int64
+	period int64
+	n      int
+	meta   int // bytes of the label and type of the document
+}
+
+func (r diskRef) bytes() int64 {
+	return diskHeaderSize + int64(r.n)*bytesPerValue + int64(r.meta)
+}
+
+// OpenDisk opens or creates the file at path replaying any records already written to it
+func OpenDisk(path string, cfg *configs.LSHConfigs) (*Disk, error) {
+	if path == "" {
+		return nil, ErrNoDiskPath
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	d := &Disk{
+		cfg:    cfg,
+		path:   path,
+		f:      f,
+		refs:   make(map[uint64]diskRef),
+		access: make(map[uint64]access),
+	}
+	if err := d.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// replay rebuilds the locations of the stored documents from the records of the file truncating a
+// partially written record left behind by a crash. A record failing its checksum anywhere but at the
+// end of the file is corruption.
+func (d *Disk) replay() error {
+	info, err := d.f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := d.checkFileHeader(info.Size()); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(d.f, d.size, info.Size()-d.size))
+	header := make([]byte, diskHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		uid, ref, deleted := decodeDiskHeader(header, d.size)
+		if d.size+ref.bytes() > info.Size() {
+			break
+		}
+		payload := make([]byte, ref.bytes()-diskHeaderSize)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+		if !validDiskRecord(header, payload) {
+			if d.size+ref.bytes() == info.Size() {
+				break
+			}
+			return fmt.Errorf("%w, uid %d at offset %d", ErrCorruptDiskRecord, uid, d.size)
+		}
+		d.size += ref.bytes()
+		d.apply(uid, ref, deleted)
+	}
+	if info.Size() > d.size {
+		return d.f.Truncate(d.size)
+	}
+	return nil
+}
+
+// checkFileHeader validates the header of a file of the given size writing it to an empty file
+func (d *Disk) checkFileHeader(size int64) error {
+	header := make([]byte, diskFileHeaderSize)
+	if size == 0 {
+		copy(header, diskMagic)
+		binary.LittleEndian.PutUint16(header[len(diskMagic):], diskVersion)
+		if _, err := d.f.WriteAt(header, 0); err != nil {
+			return err
+		}
+		d.size = int64(len(header))
+		return nil
+	}
+	if _, err := d.f.ReadAt(header, 0); err != nil {
+		return ErrInvalidDiskFile
+	}
+	if string(header[:len(diskMagic)]) != diskMagic || binary.LittleEndian.Uint16(header[len(diskMagic):]) != diskVersion {
+		return ErrInvalidDiskFile
+	}
+	d.size = int64(len(header))
+	return nil
+}
+
+// decodeDiskHeader returns the uid and location of the record at the offset and whether it deletes
+// the uid
+func decodeDiskHeader(header []byte, offset int64) (uint64, diskRef, bool) {
+	uid := binary.LittleEndian.Uint64(header[4:])
+	ref := diskRef{
+		offset: offset,
+		index:  int64(binary.LittleEndian.Uint64(header[12:])),
+		period: int64(binary.LittleEndian.Uint64(header[20:])),
+		meta:   int(binary.LittleEndian.Uint32(header[32:])),
+	}
+	n := binary.LittleEndian.Uint32(header[28:])
+	deleted := n == diskTombstone
+	if !deleted {
+		ref.n = int(n)
+	}
+	return uid, ref, deleted
+}
+
+// validDiskRecord reports whether the record matches its checksum
+func validDiskRecord(header, payload []byte) bool {
+	crc := crc32.Update(crc32.Checksum(header[4:], diskCRCTable), diskCRCTable, payload)
+	return crc == binary.LittleEndian.Uint32(header)
+}
+
+// apply points the uid at its latest record
+func (d *Disk) apply(uid uint64, ref diskRef, deleted bool) {
+	if old, exists := d.refs[uid]; exists {
+		d.garbage += old.bytes()
+	}
+	if deleted {
+		d.garbage += ref.bytes()
+		delete(d.refs, uid)
+		delete(d.access, uid)
+		return
+	}
+	d.refs[uid] = ref
+	d.clock++
+	markIndexed(d.access, uid, d.clock)
+}
+
+// write appends a record to the end of the file
+func (d *Disk) write(uid uint64, index, period int64, vec []float64, meta []byte, deleted bool) (diskRef, error) {
+	values := len(vec) * bytesPerValue
+	buf := make([]byte, diskHeaderSize+values+len(meta))
+	binary.LittleEndian.PutUint64(buf[4:], uid)
+	binary.LittleEndian.PutUint64(buf[12:], uint64(index))
+	binary.LittleEndian.PutUint64(buf[20:], uint64(period))
+	n := uint32(len(vec))
+	if deleted {
+		n = diskTombstone
+	}
+	binary.LittleEndian.PutUint32(buf[28:], n)
+	binary.LittleEndian.PutUint32(buf[32:], uint32(len(meta)))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint64(buf[diskHeaderSize+i*bytesPerValue:], math.Float64bits(v))
+	}
+	copy(buf[diskHeaderSize+values:], meta)
+	binary.LittleEndian.PutUint32(buf, crc32.Checksum(buf[4:], diskCRCTable))
+	if _, err := d.f.WriteAt(buf, d.size); err != nil {
+		return diskRef{}, err
+	}
+	ref := diskRef{offset: d.size, index: index, period: period, n: len(vec), meta: len(meta)}
+	d.size += int64(len(buf))
+	return ref, nil
+}
+
+// read returns the document stored by the record after validating its checksum
+func (d *Disk) read(uid uint64, ref diskRef) (document.Document, error) {
+	buf := make([]byte, ref.bytes())
+	if _, err := d.f.ReadAt(buf, ref.offset); err != nil {
+		return nil, err
+	}
+	header, payload := buf[:diskHeaderSize], buf[diskHeaderSize:]
+	if !validDiskRecord(header, payload) {
+		return nil, fmt.Errorf("%w, uid %d at offset %d", ErrCorruptDiskRecord, uid, ref.offset)
+	}
+	vec := make([]float64, ref.n)
+	for i := range vec {
+		vec[i] = math.Float64frombits(binary.LittleEndian.Uint64(payload[i*bytesPerValue:]))
+	}
+	simple := &document.Simple{UID: uid, Index: ref.index, Vector: vec, SamplePeriod: ref.period}
+	return decodeDiskMeta(simple, payload[ref.n*bytesPerValue:])
+}
+
+// encodeDiskMeta returns the label and registered type of the document along with its gob encoding
+// unless it is a Simple document. Documents of unregistered types are stored as Simple documents.
+func encodeDiskMeta(doc document.Document) ([]byte, error) {
+	var label string
+	if lbl, ok := doc.(document.Labeler); ok {
+		label = lbl.GetLabel()
+	}
+	name, err := document.TypeName(doc)
+	if err != nil || name == document.SimpleTypeName {
+		name = ""
+	}
+	if label == "" && name == "" {
+		return nil, nil
+	}
+	if len(label) > math.MaxUint16 || len(name) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w, uid %d", ErrDiskMetaTooLong, doc.GetUID())
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(len(label)))
+	buf.WriteString(label)
+	binary.Write(&buf, binary.LittleEndian, uint16(len(name)))
+	buf.WriteString(name)
+	if name != "" {
+		if err := gob.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDiskMeta returns the document of the record from its values and metadata
+func decodeDiskMeta(simple *document.Simple, meta []byte) (document.Document, error) {
+	if len(meta) == 0 {
+		return simple, nil
+	}
+	field := func() (string, bool) {
+		if len(meta) < 2 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint16(meta))
+		if len(meta) < 2+n {
+			return "", false
+		}
+		f := string(meta[2 : 2+n])
+		meta = meta[2+n:]
+		return f, true
+	}
+	label, ok := field()
+	if !ok {
+		return nil, ErrCorruptDiskRecord
+	}
+	name, ok := field()
+	if !ok {
+		return nil, ErrCorruptDiskRecord
+	}
+	if name == "" {
+		simple.Label = label
+		return simple, nil
+	}
+	ctor, err := document.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	doc := ctor()
+	if err := gob.NewDecoder(bytes.NewReader(meta)).Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (d *Disk) Index(doc document.Document) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// expand current doc of the uid if present
+	uid := doc.GetUID()
+	if ref, exists := d.refs[uid]; exists {
+		currDoc, err := d.read(uid, ref)
+		if err != nil {
+			return err
+		}
+		doc = expand(d.cfg, currDoc, doc)
+	}
+	meta, err := encodeDiskMeta(doc)
+	if err != nil {
+		return err
+	}
+	ref, err := d.write(uid, doc.GetIndex(), document.SamplePeriod(doc, 0), doc.GetVector(), meta, false)
+	if err != nil {
+		return err
+	}
+	d.apply(uid, ref, false)
+	return nil
+}
+
+// GetVector returns nil if the record of the uid cannot be read, which Err reports
+func (d *Disk) GetVector(uid uint64, idx int64) []float64 {
+	doc, exists := d.Exists(uid)
+	if !exists {
+		return nil
+	}
+	return window(d.cfg, doc, idx)
+}
+
+// GetVectorInto implements the BufferedStore interface
+func (d *Disk) GetVectorInto(uid uint64, idx int64, buf []float64) []float64 {
+	doc, exists := d.Exists(uid)
+	if !exists {
+		return nil
+	}
+	return windowInto(d.cfg, doc, idx, buf)
+}
+
+// Err implements the ErrStore interface returning the first error reading a record, e.g. wrapping
+// ErrCorruptDiskRecord if a record fails its checksum
+func (d *Disk) Err() error {
+	d.errMu.Lock()
+	defer d.errMu.Unlock()
+	return d.err
+}
+
+// fail records the error of reading a record unless one was recorded already
+func (d *Disk) fail(err error) {
+	d.errMu.Lock()
+	defer d.errMu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *Disk) Delete(uid uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.refs[uid]; !exists {
+		return nil
+	}
+	ref, err := d.write(uid, 0, 0, nil, nil, true)
+	if err != nil {
+		return err
+	}
+	d.apply(uid, ref, true)
+	return nil
+}
+
+func (d *Disk) Size() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.refs)
+}
+
+func (d *Disk) Exists(uid uint64) (document.Document, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ref, exists := d.refs[uid]
+	if !exists {
+		return nil, false
+	}
+	doc, err := d.read(uid, ref)
+	if err != nil {
+		d.fail(err)
+		return nil, false
+	}
+	return doc, true
+}
+
+// Range skips documents whose record cannot be read, which Err reports
+func (d *Disk) Range(fn func(doc document.Document) bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for uid, ref := range d.refs {
+		doc, err := d.read(uid, ref)
+		if err != nil {
+			d.fail(err)
+			continue
+		}
+		if !fn(doc) {
+			return
+		}
+	}
+}
+
+func (d *Disk) Touch(uids ...uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock++
+	for _, uid := range uids {
+		if a, exists := d.access[uid]; exists {
+			a.matched = d.clock
+			d.access[uid] = a
+		}
+	}
+}
+
+func (d *Disk) Oldest(order AccessOrder, exclude ...uint64) (uint64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var (
+		oldestUID  uint64
+		oldestTime uint64
+		found      bool
+	)
+	for uid, a := range d.access {
+		if excluded(uid, exclude) {
+			continue
+		}
+		t := a.at(order)
+		if !found || t < oldestTime || (t == oldestTime && uid < oldestUID) {
+			oldestUID, oldestTime, found = uid, t, true
+		}
+	}
+	return oldestUID, found
+}
+
+// MemStats reports the bytes of the file since no vectors are held in memory
+func (d *Disk) MemStats() stats.Memory {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return stats.Memory{
+		NumDocs:   len(d.refs),
+		DiskBytes: uint64(d.size),
+		DiskUsed:  uint64(d.size - d.garbage - int64(diskFileHeaderSize)),
+	}
+}
+
+// Compact rewrites the file without the garbage left behind by deleted and expanded documents keeping
+// the current file if the rewrite fails
+func (d *Disk) Compact() {
+	d.CompactFile()
+}
+
+// CompactFile is Compact returning the error of a failed rewrite
+func (d *Disk) CompactFile() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.garbage == 0 {
+		return nil
+	}
+
+	f, err := os.Create(d.path + ".compact")
+	if err != nil {
+		return err
+	}
+	compacted := &Disk{f: f, refs: make(map[uint64]diskRef, len(d.refs))}
+	err = compacted.checkFileHeader(0)
+	if err == nil {
+		err = d.copyTo(compacted)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), d.path); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	d.f.Close()
+	d.f, d.size, d.garbage, d.refs = f, compacted.size, 0, compacted.refs
+	return nil
+}
+
+// copyTo copies the latest record of every uid to the other store syncing its file
+func (d *Disk) copyTo(other *Disk) error {
+	for uid, ref := range d.refs {
+		buf := make([]byte, ref.bytes())
+		if _, err := d.f.ReadAt(buf, ref.offset); err != nil {
+			return err
+		}
+		if !validDiskRecord(buf[:diskHeaderSize], buf[diskHeaderSize:]) {
+			return fmt.Errorf("%w, uid %d at offset %d", ErrCorruptDiskRecord, uid, ref.offset)
+		}
+		if _, err := other.f.WriteAt(buf, other.size); err != nil {
+			return err
+		}
+		ref.offset = other.size
+		other.refs[uid] = ref
+		other.size += int64(len(buf))
+	}
+	return other.f.Sync()
+}
+
+// Close closes the file. The store must not be used afterwards.
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.f.Close()
+}
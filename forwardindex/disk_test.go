@@ -0,0 +1,227 @@
+package forwardindex
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestDisk(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	path := filepath.Join(t.TempDir(), "docs")
+	fi, err := OpenDisk(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for uid := uint64(0); uid < 10; uid++ {
+		if err := fi.Index(document.NewSimple(uid, 0, []float64{1, 2, 3})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expand uid 4 past a missing window so its old record becomes garbage
+	if err := fi.Index(document.NewSimple(4, 360, []float64{4, 5, 6})); err != nil {
+		t.Fatal(err)
+	}
+	for uid := uint64(5); uid < 10; uid++ {
+		if err := fi.Delete(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fi.Size() != 5 {
+		t.Fatalf("expected %d documents, but got %d", 5, fi.Size())
+	}
+	if uid, _ := fi.Oldest(LeastRecentlyIndexed); uid != 0 {
+		t.Errorf("expected oldest uid %d, but got %d", 0, uid)
+	}
+
+	// replaying the file restores the documents along with a partially written record
+	if err := fi.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, diskHeaderSize/2))
+	f.Close()
+	fi, err = OpenDisk(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	if fi.Size() != 5 {
+		t.Fatalf("expected %d documents, but got %d", 5, fi.Size())
+	}
+	m := fi.MemStats()
+	if m.DiskUsed != diskHeaderSize*5+(4*3+9)*bytesPerValue {
+		t.Errorf("expected %d disk bytes used, but got %d", diskHeaderSize*5+(4*3+9)*bytesPerValue, m.DiskUsed)
+	}
+	before := m.DiskBytes
+
+	if err := fi.CompactFile(); err != nil {
+		t.Fatal(err)
+	}
+	m = fi.MemStats()
+	if m.DiskBytes != m.DiskUsed+uint64(diskFileHeaderSize) || m.DiskBytes >= before {
+		t.Errorf("expected compaction to shrink the file below %d bytes, but got %d", before, m.DiskBytes)
+	}
+
+	nan := math.NaN()
+	testData := []struct {
+		uid      uint64
+		index    int64
+		expected []float64
+	}{
+		{4, 0, []float64{1, 2, 3}},
+		{4, 180, []float64{nan, nan, nan}},
+		{4, 360, []float64{4, 5, 6}},
+		{3, 0, []float64{1, 2, 3}},
+		{5, 0, nil},
+	}
+	for _, td := range testData {
+		v := fi.GetVector(td.uid, td.index)
+		if len(v) != len(td.expected) {
+			t.Fatalf("expected %v, but got %v", td.expected, v)
+		}
+		for i := range v {
+			if v[i] != td.expected[i] && !(math.IsNaN(v[i]) && math.IsNaN(td.expected[i])) {
+				t.Errorf("expected %v, but got %v", td.expected, v)
+				break
+			}
+		}
+	}
+}
+
+type zoneDocument struct {
+	document.Simple
+	Zone string
+}
+
+func (z *zoneDocument) Copy() document.Document {
+	next := *z
+	next.Vector = append([]float64(nil), z.Vector...)
+	return &next
+}
+
+func TestDiskRecords(t *testing.T) {
+	if err := document.RegisterType("zone", func() document.Document { return new(zoneDocument) }); err != nil {
+		t.Fatal(err)
+	}
+	cfg := configs.NewDefaultLSHConfigs()
+	path := filepath.Join(t.TempDir(), "docs")
+	fi, err := OpenDisk(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(1, 0, []float64{1, 2, 3}),
+		&document.Simple{UID: 2, Vector: []float64{1, 2, 3}, Label: "a"},
+		&zoneDocument{Simple: document.Simple{UID: 3, Vector: []float64{1, 2, 3}, Label: "b"}, Zone: "us"},
+	}
+	for _, d := range docs {
+		if err := fi.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fi.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the label and type of each document survive reopening the file
+	if fi, err = OpenDisk(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := fi.Exists(2); d.(document.Labeler).GetLabel() != "a" {
+		t.Errorf("expected label %s, but got %+v", "a", d)
+	}
+	if d, ok := fi.Exists(3); !ok {
+		t.Errorf("expected uid %d to be stored", 3)
+	} else if z, ok := d.(*zoneDocument); !ok || z.Zone != "us" || z.Label != "b" || len(z.Vector) != 3 {
+		t.Errorf("expected zone document, but got %+v", d)
+	}
+	if err := fi.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a record damaged while the file is open is reported rather than treated as not stored
+	if fi, err = OpenDisk(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xFF}, int64(diskFileHeaderSize+diskHeaderSize)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := fi.Err(); err != nil {
+		t.Fatalf("expected no error before the damaged record is read, but got %v", err)
+	}
+	if v := fi.GetVector(1, 0); v != nil {
+		t.Errorf("expected no vector for the damaged record, but got %v", v)
+	}
+	var ranged int
+	fi.Range(func(d document.Document) bool {
+		ranged++
+		return true
+	})
+	if ranged != 2 {
+		t.Errorf("expected %d intact documents, but got %d", 2, ranged)
+	}
+	if err := fi.Err(); !errors.Is(err, ErrCorruptDiskRecord) {
+		t.Errorf("expected %v, but got %v", ErrCorruptDiskRecord, err)
+	}
+	if err := fi.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := diskFileHeaderSize + diskHeaderSize
+	testData := []struct {
+		offset  int // offset of the flipped byte
+		err     error
+		numDocs int
+	}{
+		{first, ErrCorruptDiskRecord, 0},
+		{len(data) - 1, nil, 2},
+	}
+	for _, td := range testData {
+		damaged := append([]byte(nil), data...)
+		damaged[td.offset] ^= 0xFF
+		if err := os.WriteFile(path, damaged, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := OpenDisk(path, cfg)
+		if !errors.Is(err, td.err) {
+			t.Fatalf("expected %v, but got %v", td.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if fi.Size() != td.numDocs {
+			t.Errorf("expected torn record to be dropped leaving %d documents, but got %d", td.numDocs, fi.Size())
+		}
+		fi.Close()
+	}
+
+	if err := os.WriteFile(path, []byte("not a forward index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDisk(path, cfg); err != ErrInvalidDiskFile {
+		t.Errorf("expected %v, but got %v", ErrInvalidDiskFile, err)
+	}
+}
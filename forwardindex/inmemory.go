@@ -1,86 +1,254 @@
 package forwardindex
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/aouyang1/go-lsh/configs"
 	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/stats"
 )
 
+// bytesPerValue is the size of a float64 vector value
+const bytesPerValue = 8
+
+// InMemory stores the documents by uid partitioned into shards each guarded by its own lock
 type InMemory struct {
 	cfg *configs.LSHConfigs
 
-	docs map[uint64]document.Document
+	shards []*shard
+	clock  atomic.Uint64 // logical time of index and match accesses
+}
+
+type shard struct {
+	sync.RWMutex
+	docs   map[uint64]document.Document
+	values int // number of vector values held by docs
+
+	// set when vectors are stored in an arena instead of docs
+	arena  *arena
+	refs   map[uint64]vecRef
+	labels map[uint64]string // labels of the labeled documents kept apart so refs hold no pointers
+
+	access map[uint64]access // when each uid was last indexed and matched
+}
+
+func newShard(arenaSize int) *shard {
+	s := &shard{access: make(map[uint64]access)}
+	if arenaSize > 0 {
+		s.arena = newArena(arenaSize)
+		s.refs = make(map[uint64]vecRef)
+		s.labels = make(map[uint64]string)
+		return s
+	}
+	s.docs = make(map[uint64]document.Document)
+	return s
+}
+
+func (s *shard) len() int {
+	if s.arena != nil {
+		return len(s.refs)
+	}
+	return len(s.docs)
+}
+
+func (s *shard) get(uid uint64) (document.Document, bool) {
+	if s.arena != nil {
+		r, exists := s.refs[uid]
+		if !exists {
+			return nil, false
+		}
+		return &document.Simple{UID: uid, Index: r.index, Vector: s.arena.vector(r), SamplePeriod: r.period, Label: s.labels[uid]}, true
+	}
+	d, exists := s.docs[uid]
+	return d, exists
+}
+
+func (s *shard) put(d document.Document) {
+	if s.arena != nil {
+		old, exists := s.refs[d.GetUID()]
+		s.refs[d.GetUID()] = s.arena.store(d.GetIndex(), document.SamplePeriod(d, 0), d.GetVector())
+		if exists {
+			s.arena.free(old)
+		}
+		if label := labelOf(d); label != "" {
+			s.labels[d.GetUID()] = label
+		} else {
+			delete(s.labels, d.GetUID())
+		}
+		return
+	}
+	if old, exists := s.docs[d.GetUID()]; exists {
+		s.values -= len(old.GetVector())
+	}
+	s.values += len(d.GetVector())
+	s.docs[d.GetUID()] = d
+}
+
+func (s *shard) delete(uid uint64) {
+	delete(s.access, uid)
+	if s.arena != nil {
+		if r, exists := s.refs[uid]; exists {
+			s.arena.free(r)
+			delete(s.refs, uid)
+			delete(s.labels, uid)
+		}
+		return
+	}
+	if old, exists := s.docs[uid]; exists {
+		s.values -= len(old.GetVector())
+	}
+	delete(s.docs, uid)
 }
 
 func NewInMemory(cfg *configs.LSHConfigs) *InMemory {
+	numShards := cfg.NumDocShards
+	if numShards < 1 {
+		numShards = 1
+	}
+	shards := make([]*shard, numShards)
+	for i := range shards {
+		shards[i] = newShard(cfg.VectorArenaSize)
+	}
 	return &InMemory{
-		cfg:  cfg,
-		docs: make(map[uint64]document.Document),
+		cfg:    cfg,
+		shards: shards,
 	}
 }
 
+func (i *InMemory) shard(uid uint64) *shard {
+	return i.shards[uid%uint64(len(i.shards))]
+}
+
+// NumShards returns the number of partitions of the forward index
+func (i *InMemory) NumShards() int {
+	return len(i.shards)
+}
+
 func (i *InMemory) Size() int {
-	return len(i.docs)
+	var size int
+	for _, s := range i.shards {
+		s.RLock()
+		size += s.len()
+		s.RUnlock()
+	}
+	return size
 }
 
 func (i *InMemory) Exists(uid uint64) (document.Document, bool) {
-	d, exists := i.docs[uid]
+	s := i.shard(uid)
+	s.RLock()
+	d, exists := s.get(uid)
+	s.RUnlock()
 	return d, exists
 }
 
-func (i *InMemory) Index(d document.Document) {
+func (i *InMemory) Index(d document.Document) error {
+	s := i.shard(d.GetUID())
+	s.Lock()
+	defer s.Unlock()
+
 	// expand current doc of the uid if present
-	if currDoc, exists := i.Exists(d.GetUID()); exists {
-		dIdx := d.GetIndex() / i.cfg.SamplePeriod
-		cdIdx := currDoc.GetIndex() / i.cfg.SamplePeriod
-		offset := int(dIdx - cdIdx)
-
-		origVec := d.GetVector()
-		cdVec := currDoc.GetVector()
-		if offset > 0 {
-			for i := 0; i < len(origVec); i++ {
-				idx := i + offset
-				if idx < len(cdVec) {
-					cdVec[idx] = origVec[i]
-				} else {
-					zeroPad := idx - len(cdVec)
-					if zeroPad > 0 {
-						zeros := make([]float64, zeroPad)
-						cdVec = append(cdVec, zeros...)
-					}
-					cdVec = append(cdVec, origVec[i])
-				}
-			}
-		} else {
-			// not handling docs that are in the past
-		}
-		d = document.NewSimple(currDoc.GetUID(), currDoc.GetIndex(), cdVec)
+	if currDoc, exists := s.get(d.GetUID()); exists {
+		d = expand(i.cfg, currDoc, d)
 	}
-	i.docs[d.GetUID()] = d
+	s.put(d)
+	s.indexed(d.GetUID(), i.clock.Add(1))
+	return nil
 }
 
 func (i *InMemory) GetVector(uid uint64, idx int64) []float64 {
-	doc, exists := i.Exists(uid)
+	s := i.shard(uid)
+	s.RLock()
+	defer s.RUnlock()
+
+	doc, exists := s.get(uid)
 	if !exists || doc == nil {
 		return nil
 	}
-	vec := doc.GetVector()
-	dIdx := doc.GetIndex()
+	return window(i.cfg, doc, idx)
+}
 
-	// just does 0 lag
-	startOffset := int((idx - dIdx) / i.cfg.SamplePeriod)
-	endOffset := startOffset + i.cfg.VectorLength
-	if endOffset > len(vec) {
-		endOffset = len(vec)
+// GetVectorInto implements the BufferedStore interface
+func (i *InMemory) GetVectorInto(uid uint64, idx int64, buf []float64) []float64 {
+	s := i.shard(uid)
+	s.RLock()
+	defer s.RUnlock()
+
+	doc, exists := s.get(uid)
+	if !exists || doc == nil {
+		return nil
 	}
+	return windowInto(i.cfg, doc, idx, buf)
+}
+
+func (i *InMemory) Delete(uid uint64) error {
+	s := i.shard(uid)
+	s.Lock()
+	s.delete(uid)
+	s.Unlock()
+	return nil
+}
 
-	buffer := make([]float64, i.cfg.VectorLength)
-	for i := 0; i < len(buffer); i++ {
-		buffer[i] = 0.0
+// RangeShard calls fn for every document in the n-th shard while holding the shard's read lock.
+// Iteration stops early if fn returns false.
+func (i *InMemory) RangeShard(n int, fn func(d document.Document) bool) bool {
+	s := i.shards[n]
+	s.RLock()
+	defer s.RUnlock()
+	if s.arena != nil {
+		for uid := range s.refs {
+			d, _ := s.get(uid)
+			if !fn(d) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, d := range s.docs {
+		if !fn(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// Range calls fn for every document one shard at a time. Iteration stops early if fn returns false.
+func (i *InMemory) Range(fn func(d document.Document) bool) {
+	for n := range i.shards {
+		if !i.RangeShard(n, fn) {
+			return
+		}
 	}
-	copy(buffer, vec[startOffset:endOffset])
-	return buffer
 }
 
-func (i *InMemory) Delete(uid uint64) {
-	delete(i.docs, uid)
+// Compact reclaims arena space left behind by deleted and expanded documents. Documents previously
+// returned by Exists keep referencing the old arena until released.
+func (i *InMemory) Compact() {
+	for _, s := range i.shards {
+		s.Lock()
+		if s.arena != nil && s.arena.live < s.arena.allocated {
+			s.arena.compact(s.refs)
+		}
+		s.Unlock()
+	}
+}
+
+// MemStats reports the memory held by stored vectors
+func (i *InMemory) MemStats() stats.Memory {
+	var m stats.Memory
+	for _, s := range i.shards {
+		s.RLock()
+		m.NumDocs += s.len()
+		if s.arena != nil {
+			m.ArenaChunks += len(s.arena.chunks)
+			m.ArenaBytes += uint64(s.arena.capacity()) * bytesPerValue
+			m.ArenaUsed += uint64(s.arena.allocated) * bytesPerValue
+			m.VectorBytes += uint64(s.arena.live) * bytesPerValue
+		} else {
+			m.VectorBytes += uint64(s.values) * bytesPerValue
+		}
+		s.RUnlock()
+	}
+	return m
 }
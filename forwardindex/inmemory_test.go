@@ -0,0 +1,147 @@
+package forwardindex
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestInMemoryShards(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumDocShards = 4
+	fi := NewInMemory(cfg)
+	if fi.NumShards() != 4 {
+		t.Fatalf("expected %d shards, but got %d", 4, fi.NumShards())
+	}
+
+	numDocs := 100
+	var wg sync.WaitGroup
+	for i := 0; i < numDocs; i++ {
+		wg.Add(1)
+		go func(uid uint64) {
+			defer wg.Done()
+			fi.Index(document.NewSimple(uid, 0, []float64{1, 2, 3}))
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	if fi.Size() != numDocs {
+		t.Fatalf("expected %d documents, but got %d", numDocs, fi.Size())
+	}
+	for n := 0; n < fi.NumShards(); n++ {
+		fi.RangeShard(n, func(d document.Document) bool {
+			if int(d.GetUID()%4) != n {
+				t.Errorf("expected uid %d in shard %d, but got shard %d", d.GetUID(), d.GetUID()%4, n)
+			}
+			return true
+		})
+	}
+
+	var seen int
+	fi.Range(func(d document.Document) bool {
+		seen++
+		return seen < 10
+	})
+	if seen != 10 {
+		t.Errorf("expected range to stop after %d documents, but got %d", 10, seen)
+	}
+
+	fi.Delete(7)
+	if _, exists := fi.Exists(7); exists {
+		t.Errorf("expected uid 7 to be deleted")
+	}
+	if v := fi.GetVector(8, 0); len(v) != cfg.VectorLength || v[2] != 3 {
+		t.Errorf("expected vector [1 2 3], but got %v", v)
+	}
+	buf := make([]float64, 0, cfg.VectorLength)
+	if v := fi.GetVectorInto(8, 0, buf); len(v) != cfg.VectorLength || v[2] != 3 || &v[0] != &buf[:1][0] {
+		t.Errorf("expected vector [1 2 3] copied into the buffer, but got %v", v)
+	}
+}
+
+func TestInMemoryArena(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumDocShards = 1
+	cfg.VectorArenaSize = 16
+	fi := NewInMemory(cfg)
+
+	for uid := uint64(0); uid < 10; uid++ {
+		fi.Index(document.NewSimple(uid, 0, []float64{1, 2, 3}))
+	}
+	// expand uid 4 by one window so its old vector becomes garbage
+	fi.Index(document.NewSimple(4, 180, []float64{4, 5, 6}))
+	for uid := uint64(5); uid < 10; uid++ {
+		fi.Delete(uid)
+	}
+
+	m := fi.MemStats()
+	if m.NumDocs != 5 {
+		t.Fatalf("expected %d documents, but got %d", 5, m.NumDocs)
+	}
+	if m.VectorBytes != (4*3+6)*bytesPerValue {
+		t.Errorf("expected %d vector bytes, but got %d", (4*3+6)*bytesPerValue, m.VectorBytes)
+	}
+	before := m.ArenaBytes
+
+	fi.Compact()
+	m = fi.MemStats()
+	if m.ArenaBytes >= before {
+		t.Errorf("expected compaction to shrink arena below %d bytes, but got %d", before, m.ArenaBytes)
+	}
+
+	testData := []struct {
+		uid      uint64
+		index    int64
+		expected []float64
+	}{
+		{4, 0, []float64{1, 2, 3}},
+		{4, 180, []float64{4, 5, 6}},
+		{3, 0, []float64{1, 2, 3}},
+		{5, 0, nil},
+	}
+	for _, td := range testData {
+		v := fi.GetVector(td.uid, td.index)
+		if len(v) != len(td.expected) {
+			t.Fatalf("expected %v, but got %v", td.expected, v)
+		}
+		for i := range v {
+			if v[i] != td.expected[i] {
+				t.Errorf("expected %v, but got %v", td.expected, v)
+				break
+			}
+		}
+	}
+}
+
+func TestInMemoryOldest(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	f := NewInMemory(cfg)
+	if _, found := f.Oldest(LeastRecentlyIndexed); found {
+		t.Fatalf("expected no oldest document in an empty index")
+	}
+	for uid := uint64(0); uid < 3; uid++ {
+		f.Index(document.NewSimple(uid, 0, []float64{0, 1, 2}))
+	}
+	f.Touch(0)
+
+	if uid, _ := f.Oldest(LeastRecentlyIndexed); uid != 0 {
+		t.Errorf("expected %d, but got %d", 0, uid)
+	}
+	if uid, _ := f.Oldest(LeastRecentlyMatched); uid != 1 {
+		t.Errorf("expected %d, but got %d", 1, uid)
+	}
+
+	if uid, _ := f.Oldest(LeastRecentlyIndexed, 0); uid != 1 {
+		t.Errorf("expected %d, but got %d", 1, uid)
+	}
+
+	f.Delete(1)
+	if uid, _ := f.Oldest(LeastRecentlyMatched); uid != 2 {
+		t.Errorf("expected %d, but got %d", 2, uid)
+	}
+	if _, found := f.Oldest(LeastRecentlyMatched, 0, 2); found {
+		t.Errorf("expected no oldest document other than the excluded ones")
+	}
+}
@@ -0,0 +1,107 @@
+package forwardindex
+
+import (
+	"sync"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+// Lazy wraps a store filled in by a load function the first time a document is accessed, e.g. so
+// opening a large snapshot doesn't wait for every document to be decoded. If loading fails the store
+// is left as the load function left it, Index and Delete return the error and Err reports it.
+type Lazy struct {
+	store Store
+	load  func(s Store) error
+
+	once sync.Once
+	err  error
+}
+
+// NewLazy returns a store loading the documents of s with load on first use
+func NewLazy(s Store, load func(s Store) error) *Lazy {
+	return &Lazy{store: s, load: load}
+}
+
+// Load fills in the store if it wasn't already returning the error of loading it
+func (l *Lazy) Load() error {
+	l.once.Do(func() {
+		l.err = l.load(l.store)
+	})
+	return l.err
+}
+
+// Err implements the ErrStore interface returning the error of loading the store, or of reading the
+// wrapped store if it reports its own
+func (l *Lazy) Err() error {
+	if l.Load(); l.err != nil {
+		return l.err
+	}
+	if es, ok := l.store.(ErrStore); ok {
+		return es.Err()
+	}
+	return nil
+}
+
+func (l *Lazy) Index(d document.Document) error {
+	if err := l.Load(); err != nil {
+		return err
+	}
+	return l.store.Index(d)
+}
+
+func (l *Lazy) GetVector(uid uint64, idx int64) []float64 {
+	l.Load()
+	return l.store.GetVector(uid, idx)
+}
+
+// GetVectorInto implements the BufferedStore interface if the wrapped store does
+func (l *Lazy) GetVectorInto(uid uint64, idx int64, buf []float64) []float64 {
+	l.Load()
+	if bs, ok := l.store.(BufferedStore); ok {
+		return bs.GetVectorInto(uid, idx, buf)
+	}
+	return l.store.GetVector(uid, idx)
+}
+
+func (l *Lazy) Delete(uid uint64) error {
+	if err := l.Load(); err != nil {
+		return err
+	}
+	return l.store.Delete(uid)
+}
+
+func (l *Lazy) Size() int {
+	l.Load()
+	return l.store.Size()
+}
+
+func (l *Lazy) Exists(uid uint64) (document.Document, bool) {
+	l.Load()
+	return l.store.Exists(uid)
+}
+
+func (l *Lazy) Range(fn func(d document.Document) bool) {
+	l.Load()
+	l.store.Range(fn)
+}
+
+func (l *Lazy) Touch(uids ...uint64) {
+	l.Load()
+	l.store.Touch(uids...)
+}
+
+func (l *Lazy) Oldest(order AccessOrder, exclude ...uint64) (uint64, bool) {
+	l.Load()
+	return l.store.Oldest(order, exclude...)
+}
+
+// MemStats reports the memory of the documents loaded so far without loading them
+func (l *Lazy) MemStats() stats.Memory {
+	return l.store.MemStats()
+}
+
+func (l *Lazy) Compact() {
+	l.Load()
+	l.store.Compact()
+}
@@ -0,0 +1,53 @@
+package forwardindex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestLazy(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	var loads int
+	lazy := NewLazy(NewInMemory(cfg), func(s Store) error {
+		loads++
+		return s.Index(document.NewSimple(1, 0, []float64{1, 2, 3}))
+	})
+	if m := lazy.MemStats(); m.NumDocs != 0 {
+		t.Errorf("expected memory stats not to load documents, but got %d documents", m.NumDocs)
+	}
+	if loads != 0 {
+		t.Fatalf("expected no loads before first use, but got %d", loads)
+	}
+	if v := lazy.GetVectorInto(1, 0, nil); len(v) != cfg.VectorLength || v[2] != 3 {
+		t.Errorf("expected vector [1 2 3], but got %v", v)
+	}
+	if err := lazy.Index(document.NewSimple(2, 0, []float64{4, 5, 6})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lazy.Err(); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+	if lazy.Size() != 2 || loads != 1 {
+		t.Errorf("expected %d documents after %d load, but got %d after %d", 2, 1, lazy.Size(), loads)
+	}
+
+	errLoad := errors.New("load failed")
+	failed := NewLazy(NewInMemory(cfg), func(s Store) error {
+		return errLoad
+	})
+	if err := failed.Index(document.NewSimple(1, 0, []float64{1, 2, 3})); err != errLoad {
+		t.Errorf("expected %v, but got %v", errLoad, err)
+	}
+	if err := failed.Delete(1); err != errLoad {
+		t.Errorf("expected %v, but got %v", errLoad, err)
+	}
+	if err := failed.Err(); err != errLoad {
+		t.Errorf("expected %v, but got %v", errLoad, err)
+	}
+	if failed.Size() != 0 {
+		t.Errorf("expected no documents, but got %d", failed.Size())
+	}
+}
@@ -0,0 +1,146 @@
+package forwardindex
+
+import (
+	"math"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/resample"
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+// Store holds the vectors of the indexed documents by uid so that candidates can be scored. The tables
+// only hold hashes which makes the store the bulk of an index, so it may be kept in memory with InMemory,
+// on disk with Disk or offloaded to a separate system.
+type Store interface {
+	// Index stores the document expanding the document already stored for the uid with its window
+	Index(d document.Document) error
+
+	// GetVector returns the window of the uid starting at idx with the configured vector length and
+	// sample period, or nil if the uid or window is not stored
+	GetVector(uid uint64, idx int64) []float64
+
+	Delete(uid uint64) error
+	Size() int
+	Exists(uid uint64) (document.Document, bool)
+
+	// Range calls fn for every stored document. Iteration stops early if fn returns false.
+	Range(fn func(d document.Document) bool)
+
+	// Touch records that the uids were returned in search results
+	Touch(uids ...uint64)
+
+	// Oldest returns the uid accessed least recently by the given order skipping the excluded uids.
+	// Returns false if the store holds no other uid.
+	Oldest(order AccessOrder, exclude ...uint64) (uint64, bool)
+
+	MemStats() stats.Memory
+
+	// Compact reclaims space left behind by deleted and expanded documents
+	Compact()
+}
+
+// BufferedStore is implemented by stores able to copy a window into a buffer provided by the caller so
+// scoring many candidates reuses a single buffer rather than allocating a vector per candidate
+type BufferedStore interface {
+	// GetVectorInto returns the window like GetVector copied into buf if it has the capacity
+	GetVectorInto(uid uint64, idx int64, buf []float64) []float64
+}
+
+// ErrStore is implemented by stores whose reads can fail. Methods of the Store interface returning no
+// error treat a failed read as a missing document, so callers check Err to tell the two apart.
+type ErrStore interface {
+	// Err returns the first error a read of the store ran into
+	Err() error
+}
+
+// expand returns the document stored for the uid expanded with the window of d at the resolution the
+// uid was first stored at
+func expand(cfg *configs.LSHConfigs, currDoc, d document.Document) document.Document {
+	period := document.SamplePeriod(currDoc, cfg.SamplePeriod)
+	dIdx := d.GetIndex() / period
+	cdIdx := currDoc.GetIndex() / period
+	offset := int(dIdx - cdIdx)
+
+	origVec := d.GetVector()
+	if dPeriod := document.SamplePeriod(d, cfg.SamplePeriod); dPeriod != period {
+		// keep the resolution the uid was first stored at
+		n := int(int64(len(origVec)) * dPeriod / period)
+		origVec = resample.Resample(origVec, dPeriod, period, n)
+	}
+	cdVec := currDoc.GetVector()
+	if offset > 0 {
+		for i := 0; i < len(origVec); i++ {
+			idx := i + offset
+			if idx < len(cdVec) {
+				cdVec[idx] = origVec[i]
+			} else {
+				// gaps between windows are missing samples rather than zeros
+				for gap := idx - len(cdVec); gap > 0; gap-- {
+					cdVec = append(cdVec, math.NaN())
+				}
+				cdVec = append(cdVec, origVec[i])
+			}
+		}
+	} else {
+		// not handling docs that are in the past
+	}
+	// the label of the latest window owns the uid like the access control labels of the index
+	label := labelOf(d)
+	if label == "" {
+		label = labelOf(currDoc)
+	}
+	return &document.Simple{
+		UID:          currDoc.GetUID(),
+		Index:        currDoc.GetIndex(),
+		Vector:       cdVec,
+		SamplePeriod: document.SamplePeriod(currDoc, 0),
+		Label:        label,
+	}
+}
+
+// labelOf returns the access control label of the document if it has one
+func labelOf(d document.Document) string {
+	if lbl, ok := d.(document.Labeler); ok {
+		return lbl.GetLabel()
+	}
+	return ""
+}
+
+// window returns the window of the stored document starting at idx with the configured vector length and
+// sample period padding missing samples with NaN
+func window(cfg *configs.LSHConfigs, doc document.Document, idx int64) []float64 {
+	return windowInto(cfg, doc, idx, nil)
+}
+
+// windowInto returns the window like window copying it into buf when it has the capacity
+func windowInto(cfg *configs.LSHConfigs, doc document.Document, idx int64, buf []float64) []float64 {
+	vec := doc.GetVector()
+	dIdx := doc.GetIndex()
+	period := document.SamplePeriod(doc, cfg.SamplePeriod)
+
+	// just does 0 lag
+	startOffset := int((idx - dIdx) / period)
+	if startOffset < 0 || startOffset >= len(vec) {
+		return nil
+	}
+	if period != cfg.SamplePeriod {
+		// documents stored at their own resolution are resampled to the configured one
+		return resample.Resample(vec[startOffset:], period, cfg.SamplePeriod, cfg.VectorLength)
+	}
+	endOffset := startOffset + cfg.VectorLength
+	if endOffset > len(vec) {
+		endOffset = len(vec)
+	}
+
+	buffer := buf[:0]
+	if cap(buffer) < cfg.VectorLength {
+		buffer = make([]float64, cfg.VectorLength)
+	}
+	buffer = buffer[:cfg.VectorLength]
+	for i := 0; i < len(buffer); i++ {
+		buffer[i] = math.NaN()
+	}
+	copy(buffer, vec[startOffset:endOffset])
+	return buffer
+}
@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/RoaringBitmap/roaring v1.3.0
+	github.com/klauspost/compress v1.16.7
 	gonum.org/v1/gonum v0.13.0
 )
 
@@ -0,0 +1,209 @@
+package hamming
+
+import (
+	"errors"
+	"math/bits"
+	"math/rand"
+
+	"github.com/aouyang1/go-lsh/bitmap"
+	"github.com/aouyang1/go-lsh/lsherrors"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+var (
+	ErrInvalidNumBits        = errors.New("invalid number of fingerprint bits, must be at least 1")
+	ErrInvalidNumTables      = errors.New("invalid number of tables, must be at least 1")
+	ErrInvalidBitsPerTable   = errors.New("invalid bits per table, must be between 1 and 64 and at most the number of fingerprint bits")
+	ErrFingerprintLength     = errors.New("fingerprint length does not match the configured number of bits")
+	ErrInvalidMaxDistance    = errors.New("invalid max distance, must be between 0 and the number of fingerprint bits")
+	ErrInvalidNumToReturn    = errors.New("invalid NumToReturn, must be at least 1")
+	errBitPositionOutOfRange = errors.New("bit position out of range of fingerprint")
+)
+
+// Fingerprint is a binary vector packed into 64 bit words where bit i is stored in word i/64 at
+// position i%64
+type Fingerprint []uint64
+
+// NewFingerprint returns an empty fingerprint able to store numBits
+func NewFingerprint(numBits int) Fingerprint {
+	return make(Fingerprint, (numBits+63)/64)
+}
+
+// Set sets bit i of the fingerprint
+func (f Fingerprint) Set(i int) {
+	f[i/64] |= 1 << uint(i%64)
+}
+
+// Bit returns bit i of the fingerprint as 0 or 1
+func (f Fingerprint) Bit(i int) uint64 {
+	return f[i/64] >> uint(i%64) & 1
+}
+
+// Distance returns the number of differing bits between two fingerprints of equal length
+func Distance(a, b Fingerprint) int {
+	var d int
+	for i := range a {
+		d += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return d
+}
+
+// BitSampler is the bit sampling hash family for hamming space where the hash is the concatenation of
+// a fixed random subset of the fingerprint bits. Two fingerprints at distance d out of n bits collide
+// with probability (1-d/n)^k for k sampled bits.
+type BitSampler struct {
+	Positions []int
+}
+
+// NewBitSampler randomly picks k distinct bit positions out of numBits
+func NewBitSampler(k, numBits int) (*BitSampler, error) {
+	if numBits < 1 {
+		return nil, ErrInvalidNumBits
+	}
+	if k < 1 || k > 64 || k > numBits {
+		return nil, ErrInvalidBitsPerTable
+	}
+	return &BitSampler{Positions: rand.Perm(numBits)[:k]}, nil
+}
+
+// Hash returns the sampled bits of the fingerprint packed into a key
+func (b *BitSampler) Hash(f Fingerprint) (uint64, error) {
+	var key uint64
+	for i, p := range b.Positions {
+		if p/64 >= len(f) {
+			return 0, errBitPositionOutOfRange
+		}
+		key |= f.Bit(p) << uint(i)
+	}
+	return key, nil
+}
+
+// Index stores binary fingerprints in bit sampled tables and scores candidates by hamming distance
+// without converting fingerprints into float vectors.
+type Index struct {
+	NumBits  int
+	Samplers []*BitSampler
+	Tables   []map[uint64]*bitmap.Bitmap // key of sampled bits to bitmap of uids per table
+	Docs     map[uint64]Fingerprint
+}
+
+// New returns a hamming index over fingerprints of numBits using numTables tables each sampling
+// bitsPerTable bits
+func New(numBits, numTables, bitsPerTable int) (*Index, error) {
+	if numBits < 1 {
+		return nil, ErrInvalidNumBits
+	}
+	if numTables < 1 {
+		return nil, ErrInvalidNumTables
+	}
+
+	idx := &Index{
+		NumBits:  numBits,
+		Samplers: make([]*BitSampler, numTables),
+		Tables:   make([]map[uint64]*bitmap.Bitmap, numTables),
+		Docs:     make(map[uint64]Fingerprint),
+	}
+	for i := 0; i < numTables; i++ {
+		s, err := NewBitSampler(bitsPerTable, numBits)
+		if err != nil {
+			return nil, err
+		}
+		idx.Samplers[i] = s
+		idx.Tables[i] = make(map[uint64]*bitmap.Bitmap)
+	}
+	return idx, nil
+}
+
+// Index stores the fingerprint under the uid replacing any fingerprint previously stored
+func (idx *Index) Index(uid uint64, f Fingerprint) error {
+	if len(f) != (idx.NumBits+63)/64 {
+		return ErrFingerprintLength
+	}
+	if _, exists := idx.Docs[uid]; exists {
+		if err := idx.Delete(uid); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range idx.Samplers {
+		key, err := s.Hash(f)
+		if err != nil {
+			return err
+		}
+		rb, exists := idx.Tables[i][key]
+		if !exists {
+			rb = bitmap.New()
+			idx.Tables[i][key] = rb
+		}
+		rb.Add(uid)
+	}
+
+	stored := make(Fingerprint, len(f))
+	copy(stored, f)
+	idx.Docs[uid] = stored
+	return nil
+}
+
+// Delete removes the uid from all tables
+func (idx *Index) Delete(uid uint64) error {
+	f, exists := idx.Docs[uid]
+	if !exists {
+		return lsherrors.DocumentNotStored
+	}
+	for i, s := range idx.Samplers {
+		key, err := s.Hash(f)
+		if err != nil {
+			return err
+		}
+		rb, exists := idx.Tables[i][key]
+		if !exists {
+			continue
+		}
+		rb.CheckedRemove(uid)
+		if rb.IsEmpty() {
+			delete(idx.Tables[i], key)
+		}
+	}
+	delete(idx.Docs, uid)
+	return nil
+}
+
+// Search returns up to numToReturn fingerprints within maxDistance bits of the query. Scores are the
+// fraction of matching bits, 1 - distance/NumBits. The number of candidates scored is also returned.
+func (idx *Index) Search(f Fingerprint, maxDistance, numToReturn int) (results.Scores, int, error) {
+	if len(f) != (idx.NumBits+63)/64 {
+		return nil, 0, ErrFingerprintLength
+	}
+	if maxDistance < 0 || maxDistance > idx.NumBits {
+		return nil, 0, ErrInvalidMaxDistance
+	}
+	if numToReturn < 1 {
+		return nil, 0, ErrInvalidNumToReturn
+	}
+
+	candidates := make(map[uint64]struct{})
+	for i, s := range idx.Samplers {
+		key, err := s.Hash(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		rb, exists := idx.Tables[i][key]
+		if !exists {
+			continue
+		}
+		rb.Lock()
+		for _, uid := range rb.Rb.ToArray() {
+			candidates[uid] = struct{}{}
+		}
+		rb.Unlock()
+	}
+
+	threshold := 1 - float64(maxDistance)/float64(idx.NumBits)
+	res := results.New(numToReturn, threshold, options.SignFilter_POS)
+	for uid := range candidates {
+		dist := Distance(f, idx.Docs[uid])
+		res.Update(results.Score{UID: uid, Score: 1 - float64(dist)/float64(idx.NumBits)})
+	}
+	return res.Fetch(), res.NumScored, nil
+}
@@ -0,0 +1,70 @@
+package hamming
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	a := NewFingerprint(70)
+	b := NewFingerprint(70)
+	a.Set(0)
+	a.Set(69)
+	b.Set(69)
+	b.Set(3)
+	if d := Distance(a, b); d != 2 {
+		t.Fatalf("expected distance %d, but got %d", 2, d)
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	numBits := 128
+	idx, err := New(numBits, 32, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := NewFingerprint(numBits)
+	for i := 0; i < numBits; i++ {
+		if rand.Intn(2) == 1 {
+			query.Set(i)
+		}
+	}
+
+	// uid 0 is the query with 2 bits flipped and uid 1 is the inverse of the query
+	near := make(Fingerprint, len(query))
+	far := make(Fingerprint, len(query))
+	for i := range query {
+		near[i] = query[i]
+		far[i] = ^query[i]
+	}
+	near[0] ^= 3
+	if err := idx.Index(0, near); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Index(1, far); err != nil {
+		t.Fatal(err)
+	}
+
+	res, _, err := idx.Search(query, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].UID != 0 {
+		t.Fatalf("expected only uid 0, but got %v", res)
+	}
+	if expected := 1 - 2.0/float64(numBits); res[0].Score != expected {
+		t.Fatalf("expected score %.4f, but got %.4f", expected, res[0].Score)
+	}
+
+	if err := idx.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err = idx.Search(query, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expected no results after delete, but got %v", res)
+	}
+}
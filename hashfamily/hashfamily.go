@@ -0,0 +1,79 @@
+package hashfamily
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownFamily = errors.New("hash family is not registered")
+)
+
+// Family is a locality sensitive hash function mapping a vector to a bucket key. Keys use the lowest
+// Bits() bits. Families are serialized with their binary marshalers and restored by looking up the
+// constructor registered under Name().
+type Family interface {
+	Name() string
+	Bits() int
+	Hash(vec []float64) (uint64, error)
+
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Negator is implemented by families where the key of a negated vector is the complement of the key of
+// the vector within Bits() bits so both signs of a query can be probed from a single hash
+type Negator interface {
+	NegateKey(key uint64) uint64
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]func() Family)
+)
+
+// Register makes a family constructor available by name for deserialization. Registering the same
+// name twice replaces the previous constructor.
+func Register(name string, fn func() Family) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[name] = fn
+}
+
+// New returns an empty family registered under the name, ready to be unmarshaled into
+func New(name string) (Family, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	fn, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("%w, %s", ErrUnknownFamily, name)
+	}
+	return fn(), nil
+}
+
+// Unmarshal restores a family from its registered name and binary form
+func Unmarshal(name string, data []byte) (Family, error) {
+	f, err := New(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Registered returns the sorted names of all registered families
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
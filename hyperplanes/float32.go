@@ -0,0 +1,156 @@
+package hyperplanes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/aouyang1/go-lsh/hashfamily"
+)
+
+// Float32FamilyName is the name the float32 hyperplanes are registered under as a hash family
+const Float32FamilyName = "hyperplanes32"
+
+func init() {
+	hashfamily.Register(Float32FamilyName, func() hashfamily.Family { return new(Float32) })
+}
+
+// Float32 are hyperplanes stored as float32 coefficients row-major in a single slice, halving the
+// memory of the planes and hashing with float32 dot products
+type Float32 struct {
+	Coefficients []float32
+	Dim          int // length of each plane
+}
+
+// NewFloat32 generates float32 hyperplanes from the random source. A nil source uses the global source.
+func NewFloat32(numHyperplanes, vecLen int, rng *rand.Rand) (*Float32, error) {
+	h, err := NewWithRand(numHyperplanes, vecLen, rng)
+	if err != nil {
+		return nil, err
+	}
+	f := &Float32{Coefficients: make([]float32, len(h.coef)), Dim: vecLen}
+	for i, c := range h.coef {
+		f.Coefficients[i] = float32(c)
+	}
+	return f, nil
+}
+
+// Name implements the hashfamily.Family interface
+func (h *Float32) Name() string {
+	return Float32FamilyName
+}
+
+// Bits returns the number of bits in a key which is one per hyperplane
+func (h *Float32) Bits() int {
+	if h.Dim == 0 {
+		return 0
+	}
+	return len(h.Coefficients) / h.Dim
+}
+
+// NegateKey implements the hashfamily.Negator interface
+func (h *Float32) NegateKey(key uint64) uint64 {
+	return complement(key, h.Bits())
+}
+
+// Hash implements the hashfamily.Family interface converting the vector to float32 before hashing it
+// with HashFloat32
+func (h *Float32) Hash(f []float64) (uint64, error) {
+	return h.HashFloat32(ToFloat32(f))
+}
+
+// ToFloat32 returns the vector converted to float32 for HashFloat32
+func ToFloat32(f []float64) []float32 {
+	v := make([]float32, len(f))
+	for i, c := range f {
+		v[i] = float32(c)
+	}
+	return v
+}
+
+// HashFloat32 hashes a vector already converted to float32 so that it can be converted once and hashed
+// by many tables. The first hyperplane is the most significant of the lowest Bits() bits of the key.
+func (h *Float32) HashFloat32(v []float32) (uint64, error) {
+	if len(v) == 0 {
+		return 0, ErrNoVector
+	}
+	if len(v) != h.Dim {
+		return 0, fmt.Errorf("%v, has length %d when expecting length, %d", ErrVectorLengthMismatch, len(v), h.Dim)
+	}
+	bits := h.Bits()
+	if bits > 64 {
+		return 0, ErrNumHyperplanesExceedHashBits
+	}
+	var key uint64
+	for i := 0; i < bits; i++ {
+		p := h.Coefficients[i*h.Dim : (i+1)*h.Dim]
+		var dot float32
+		for j, c := range p {
+			dot += c * v[j]
+		}
+		key <<= 1
+		if dot > 0 {
+			key |= 1
+		}
+	}
+	return key, nil
+}
+
+// Reorder permutes the hyperplanes like Hyperplanes.Reorder
+func (h *Float32) Reorder(order []int) error {
+	if len(order) != h.Bits() {
+		return ErrInvalidOrder
+	}
+	seen := make([]bool, len(order))
+	coef := make([]float32, len(h.Coefficients))
+	for i, o := range order {
+		if o < 0 || o >= len(order) || seen[o] {
+			return ErrInvalidOrder
+		}
+		seen[o] = true
+		copy(coef[i*h.Dim:(i+1)*h.Dim], h.Coefficients[o*h.Dim:(o+1)*h.Dim])
+	}
+	h.Coefficients = coef
+	return nil
+}
+
+// LearnOrder returns an ordering of the hyperplanes from coarse to fine like Hyperplanes.LearnOrder
+func (h *Float32) LearnOrder(samples [][]float64) []int {
+	return learnOrder(h.Bits(), samples, func(i int, s []float64) float64 {
+		var dot float64
+		for j, c := range h.Coefficients[i*h.Dim : (i+1)*h.Dim] {
+			dot += float64(c) * s[j]
+		}
+		return dot
+	})
+}
+
+// MarshalBinary encodes the number of planes and vector length followed by each coefficient
+func (h *Float32) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 8+4*len(h.Coefficients))
+	binary.BigEndian.PutUint32(buf[0:], uint32(h.Bits()))
+	binary.BigEndian.PutUint32(buf[4:], uint32(h.Dim))
+	for i, c := range h.Coefficients {
+		binary.BigEndian.PutUint32(buf[8+4*i:], math.Float32bits(c))
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes hyperplanes encoded by MarshalBinary
+func (h *Float32) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return ErrInvalidEncoding
+	}
+	numPlanes := int(binary.BigEndian.Uint32(data[0:]))
+	vecLen := int(binary.BigEndian.Uint32(data[4:]))
+	if len(data) != 8+4*numPlanes*vecLen {
+		return ErrInvalidEncoding
+	}
+	h.Dim = vecLen
+	h.Coefficients = make([]float32, numPlanes*vecLen)
+	for i := range h.Coefficients {
+		h.Coefficients[i] = math.Float32frombits(binary.BigEndian.Uint32(data[8+4*i:]))
+	}
+	return nil
+}
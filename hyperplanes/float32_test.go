@@ -0,0 +1,95 @@
+package hyperplanes
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/hashfamily"
+)
+
+func TestFloat32(t *testing.T) {
+	h, err := NewFloat32(8, 10, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h64, err := NewWithRand(8, 10, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Bits() != 8 {
+		t.Fatalf("expected %d bits, but got %d", 8, h.Bits())
+	}
+	if _, err := h.Hash([]float64{1, 2}); err == nil {
+		t.Fatal("expected an error hashing a vector of the wrong length")
+	}
+
+	// keys match the float64 planes the coefficients were generated from
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 100; i++ {
+		v := make([]float64, 10)
+		for j := range v {
+			v[j] = rng.Float64() - 0.5
+		}
+		expected, err := h64.Hash(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := h.Hash(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != expected {
+			t.Errorf("expected %d, but got %d for %v", expected, key, v)
+		}
+	}
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 8+4*8*10 {
+		t.Errorf("expected %d encoded bytes, but got %d", 8+4*8*10, len(data))
+	}
+	f, err := hashfamily.Unmarshal(Float32FamilyName, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := f.(*Float32)
+	if decoded.Dim != h.Dim || len(decoded.Coefficients) != len(h.Coefficients) {
+		t.Fatalf("expected %v, but got %v", h, decoded)
+	}
+	for i, c := range h.Coefficients {
+		if decoded.Coefficients[i] != c {
+			t.Fatalf("expected coefficient %v, but got %v", c, decoded.Coefficients[i])
+		}
+	}
+}
+
+func TestFloat32Reorder(t *testing.T) {
+	h := &Float32{Coefficients: []float32{0, 0, 1, 0, 1, 0, 1, 0, 0}, Dim: 3}
+	if err := h.Reorder([]int{0, 0, 1}); err != ErrInvalidOrder {
+		t.Fatalf("expected %v, but got %v", ErrInvalidOrder, err)
+	}
+
+	// only the last plane splits the samples evenly
+	samples := [][]float64{
+		{1, 1, 1},
+		{-1, 1, 1},
+		{1, 2, 1},
+		{-1, 2, 1},
+	}
+	order := h.LearnOrder(samples)
+	if order[0] != 2 {
+		t.Fatalf("expected plane %d to be the coarsest, but got order %v", 2, order)
+	}
+	if err := h.Reorder(order); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.HashFloat32(ToFloat32([]float64{1, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != 4 {
+		t.Fatalf("expected %d, but got %d", 4, hash)
+	}
+}
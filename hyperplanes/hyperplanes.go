@@ -4,25 +4,49 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 
 	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/hashfamily"
 	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/stat"
 )
 
 var (
 	ErrNumHyperplanesExceedHashBits = errors.New("number of hyperplanes exceeds available bits to encode vector")
 	ErrNoVector                     = errors.New("no vector provided")
 	ErrVectorLengthMismatch         = errors.New("vector length mismatch")
+	ErrInvalidEncoding              = errors.New("invalid binary encoding of hyperplanes")
+	ErrInvalidOrder                 = errors.New("order must be a permutation of the hyperplane indexes")
+	ErrBufferTooSmall               = errors.New("buffer too small to hold the hash")
 )
 
+// FamilyName is the name the hyperplanes are registered under as a hash family
+const FamilyName = "hyperplanes"
+
+func init() {
+	hashfamily.Register(FamilyName, func() hashfamily.Family { return new(Hyperplanes) })
+}
+
 // Hyperplanes is composed of a number of randomly generated unit vectors where the vector length is based on the
-// configured vector length it is to represent.
+// configured vector length it is to represent. Hyperplanes created by New or decoded by UnmarshalBinary
+// store their coefficients row-major in a single slice with Planes viewing each row.
 type Hyperplanes struct {
 	Planes [][]float64
+
+	coef []float64 // contiguous coefficients of every plane when packed
+	dim  int       // length of each plane in coef
 }
 
 func New(numHyperplanes, vecLen int) (*Hyperplanes, error) {
+	return NewWithRand(numHyperplanes, vecLen, nil)
+}
+
+// NewWithRand generates the hyperplanes from the random source so they can be reproduced. A nil
+// source uses the global source.
+func NewWithRand(numHyperplanes, vecLen int, rng *rand.Rand) (*Hyperplanes, error) {
 	if numHyperplanes < 1 {
 		return nil, configs.ErrInvalidNumHyperplanes
 	}
@@ -32,11 +56,17 @@ func New(numHyperplanes, vecLen int) (*Hyperplanes, error) {
 	}
 
 	h := new(Hyperplanes)
+	h.coef = make([]float64, numHyperplanes*vecLen)
+	h.dim = vecLen
 	h.Planes = make([][]float64, numHyperplanes)
 	for i := 0; i < numHyperplanes; i++ {
-		h.Planes[i] = make([]float64, vecLen)
+		h.Planes[i] = h.row(i)
 		for j := 0; j < vecLen; j++ {
-			h.Planes[i][j] = rand.Float64() - 0.5
+			if rng != nil {
+				h.Planes[i][j] = rng.Float64() - 0.5
+			} else {
+				h.Planes[i][j] = rand.Float64() - 0.5
+			}
 		}
 		floats.Scale(1/floats.Norm(h.Planes[i], 2), h.Planes[i])
 	}
@@ -44,66 +74,263 @@ func New(numHyperplanes, vecLen int) (*Hyperplanes, error) {
 	return h, nil
 }
 
-func (h *Hyperplanes) Hash64(f []float64) (uint64, error) {
-	if len(f) == 0 {
-		return 0, ErrNoVector
+// row returns a view of the i-th plane in the contiguous coefficients
+func (h *Hyperplanes) row(i int) []float64 {
+	return h.coef[i*h.dim : (i+1)*h.dim : (i+1)*h.dim]
+}
+
+// packed returns true if Planes are views of the contiguous coefficients
+func (h *Hyperplanes) packed() bool {
+	return h.coef != nil && len(h.coef) == len(h.Planes)*h.dim
+}
+
+// pack copies the planes into one contiguous slice and points Planes at its rows
+func (h *Hyperplanes) pack() {
+	h.dim = 0
+	if len(h.Planes) > 0 {
+		h.dim = len(h.Planes[0])
+	}
+	coef := make([]float64, 0, len(h.Planes)*h.dim)
+	for _, p := range h.Planes {
+		if len(p) != h.dim {
+			// ragged planes can't be strided
+			h.coef = nil
+			return
+		}
+		coef = append(coef, p...)
+	}
+	h.coef = coef
+	for i := range h.Planes {
+		h.Planes[i] = h.row(i)
+	}
+}
+
+// Coefficients returns the coefficients of every plane row-major in a single slice. The slice is
+// shared with Planes when the hyperplanes are packed.
+func (h *Hyperplanes) Coefficients() []float64 {
+	if h.packed() {
+		return h.coef
+	}
+	coef := make([]float64, 0, len(h.Planes)*h.VectorLength())
+	for _, p := range h.Planes {
+		coef = append(coef, p...)
+	}
+	return coef
+}
+
+// VectorLength returns the length of the vectors the planes hash
+func (h *Hyperplanes) VectorLength() int {
+	if len(h.Planes) == 0 {
+		return 0
 	}
-	if len(h.Planes) > 64 {
-		return 0, ErrNumHyperplanesExceedHashBits
+	return len(h.Planes[0])
+}
+
+// Name implements the hashfamily.Family interface
+func (h *Hyperplanes) Name() string {
+	return FamilyName
+}
+
+// Bits returns the number of bits in a key which is one per hyperplane
+func (h *Hyperplanes) Bits() int {
+	return len(h.Planes)
+}
+
+// NegateKey implements the hashfamily.Negator interface. Negating a vector flips the side of every
+// plane it is not orthogonal to so the key is the complement of the key of the vector.
+func (h *Hyperplanes) NegateKey(key uint64) uint64 {
+	return complement(key, h.Bits())
+}
+
+// complement flips the lowest bits of the key
+func complement(key uint64, bits int) uint64 {
+	if bits >= 64 {
+		return ^key
 	}
-	buffer := make([]byte, 8)
-	if err := h.hash(f, buffer); err != nil {
+	return ^key & (1<<uint(bits) - 1)
+}
+
+// Hash implements the hashfamily.Family interface where the first hyperplane is the most significant
+// of the lowest Bits() bits of the key
+func (h *Hyperplanes) Hash(f []float64) (uint64, error) {
+	hash, err := h.Hash64(f)
+	if err != nil {
 		return 0, err
 	}
-	return binary.BigEndian.Uint64(buffer), nil
+	return hash >> uint(64-len(h.Planes)), nil
 }
 
-func (h *Hyperplanes) Hash32(f []float64) (uint32, error) {
-	if len(f) == 0 {
-		return 0, ErrNoVector
+// MarshalBinary encodes the number of planes and vector length followed by each coefficient
+func (h *Hyperplanes) MarshalBinary() ([]byte, error) {
+	coef := h.Coefficients()
+	buf := make([]byte, 8+8*len(coef))
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(h.Planes)))
+	binary.BigEndian.PutUint32(buf[4:], uint32(h.VectorLength()))
+	for i, c := range coef {
+		binary.BigEndian.PutUint64(buf[8+8*i:], math.Float64bits(c))
 	}
-	if len(h.Planes) > 32 {
-		return 0, ErrNumHyperplanesExceedHashBits
+	return buf, nil
+}
+
+// UnmarshalBinary decodes hyperplanes encoded by MarshalBinary
+func (h *Hyperplanes) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return ErrInvalidEncoding
 	}
-	buffer := make([]byte, 4)
-	if err := h.hash(f, buffer); err != nil {
+	numPlanes := int(binary.BigEndian.Uint32(data[0:]))
+	vecLen := int(binary.BigEndian.Uint32(data[4:]))
+	if len(data) != 8+8*numPlanes*vecLen {
+		return ErrInvalidEncoding
+	}
+	h.coef = make([]float64, numPlanes*vecLen)
+	h.dim = vecLen
+	for i := range h.coef {
+		h.coef[i] = math.Float64frombits(binary.BigEndian.Uint64(data[8+8*i:]))
+	}
+	h.Planes = make([][]float64, numPlanes)
+	for i := range h.Planes {
+		h.Planes[i] = h.row(i)
+	}
+	return nil
+}
+
+// Reorder permutes the hyperplanes so that the i-th bit of a hash is produced by the plane previously
+// at order[i]. Earlier planes occupy the higher order bits of the hash.
+func (h *Hyperplanes) Reorder(order []int) error {
+	if len(order) != len(h.Planes) {
+		return ErrInvalidOrder
+	}
+	seen := make([]bool, len(order))
+	planes := make([][]float64, len(order))
+	for i, o := range order {
+		if o < 0 || o >= len(order) || seen[o] {
+			return ErrInvalidOrder
+		}
+		seen[o] = true
+		planes[i] = h.Planes[o]
+	}
+	h.Planes = planes
+	h.pack()
+	return nil
+}
+
+// LearnOrder returns an ordering of the hyperplanes from coarse to fine based on a sample of vectors.
+// Planes that split the samples most evenly are considered coarse and placed first, breaking ties by the
+// larger variance of the projections.
+func (h *Hyperplanes) LearnOrder(samples [][]float64) []int {
+	return learnOrder(len(h.Planes), samples, func(i int, s []float64) float64 {
+		return floats.Dot(h.Planes[i], s)
+	})
+}
+
+// learnOrder orders the planes from coarse to fine by the projections of the samples onto each plane
+func learnOrder(numPlanes int, samples [][]float64, dot func(i int, s []float64) float64) []int {
+	balance := make([]float64, numPlanes)
+	variance := make([]float64, numPlanes)
+	proj := make([]float64, len(samples))
+	for i := 0; i < numPlanes; i++ {
+		var pos int
+		for j, s := range samples {
+			proj[j] = dot(i, s)
+			if proj[j] > 0 {
+				pos++
+			}
+		}
+		if len(samples) > 0 {
+			balance[i] = math.Abs(float64(pos)/float64(len(samples)) - 0.5)
+			variance[i] = stat.Variance(proj, nil)
+		}
+	}
+
+	order := make([]int, numPlanes)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if balance[order[a]] != balance[order[b]] {
+			return balance[order[a]] < balance[order[b]]
+		}
+		return variance[order[a]] > variance[order[b]]
+	})
+	return order
+}
+
+func (h *Hyperplanes) Hash64(f []float64) (uint64, error) {
+	var buffer [8]byte
+	return h.Hash64Into(f, buffer[:])
+}
+
+// Hash64Into hashes into the first 8 bytes of the caller's buffer avoiding an allocation per call
+func (h *Hyperplanes) Hash64Into(f []float64, buffer []byte) (uint64, error) {
+	if err := h.hashInto(f, buffer, 64); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buffer), nil
+}
+
+func (h *Hyperplanes) Hash32(f []float64) (uint32, error) {
+	var buffer [4]byte
+	return h.Hash32Into(f, buffer[:])
+}
+
+// Hash32Into hashes into the first 4 bytes of the caller's buffer avoiding an allocation per call
+func (h *Hyperplanes) Hash32Into(f []float64, buffer []byte) (uint32, error) {
+	if err := h.hashInto(f, buffer, 32); err != nil {
 		return 0, err
 	}
 	return binary.BigEndian.Uint32(buffer), nil
 }
 
 func (h *Hyperplanes) Hash16(f []float64) (uint16, error) {
-	if len(f) == 0 {
-		return 0, ErrNoVector
-	}
-	if len(h.Planes) > 16 {
-		return 0, ErrNumHyperplanesExceedHashBits
-	}
-	buffer := make([]byte, 2)
-	if err := h.hash(f, buffer); err != nil {
+	var buffer [2]byte
+	return h.Hash16Into(f, buffer[:])
+}
+
+// Hash16Into hashes into the first 2 bytes of the caller's buffer avoiding an allocation per call
+func (h *Hyperplanes) Hash16Into(f []float64, buffer []byte) (uint16, error) {
+	if err := h.hashInto(f, buffer, 16); err != nil {
 		return 0, err
 	}
 	return binary.BigEndian.Uint16(buffer), nil
 }
 
 func (h *Hyperplanes) Hash8(f []float64) (uint8, error) {
+	var buffer [1]byte
+	return h.Hash8Into(f, buffer[:])
+}
+
+// Hash8Into hashes into the first byte of the caller's buffer avoiding an allocation per call
+func (h *Hyperplanes) Hash8Into(f []float64, buffer []byte) (uint8, error) {
+	if err := h.hashInto(f, buffer, 8); err != nil {
+		return 0, err
+	}
+	return buffer[0], nil
+}
+
+// hashInto validates the vector and clears the leading bytes of the buffer needed for a hash of the
+// given number of bits before hashing into them
+func (h *Hyperplanes) hashInto(f []float64, buffer []byte, bits int) error {
 	if len(f) == 0 {
-		return 0, ErrNoVector
+		return ErrNoVector
 	}
-	if len(h.Planes) > 8 {
-		return 0, ErrNumHyperplanesExceedHashBits
+	if len(h.Planes) > bits {
+		return ErrNumHyperplanesExceedHashBits
 	}
-	buffer := make([]byte, 1)
-	if err := h.hash(f, buffer); err != nil {
-		return 0, err
+	if len(buffer) < bits/8 {
+		return ErrBufferTooSmall
 	}
-	return buffer[0], nil
+	buffer = buffer[:bits/8]
+	for i := range buffer {
+		buffer[i] = 0
+	}
+	return h.hash(f, buffer)
 }
 
 func (h *Hyperplanes) hash(f []float64, buffer []byte) error {
 	var b byte
 	var bitCnt, byteCnt int
 
+	// planes of packed hyperplanes are adjacent in memory
 	for _, p := range h.Planes {
 		if len(f) != len(p) {
 			return fmt.Errorf("%v, has length %d when expecting length, %d", ErrVectorLengthMismatch, len(f), len(p))
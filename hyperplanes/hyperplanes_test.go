@@ -3,10 +3,12 @@ package hyperplanes
 import (
 	"encoding/binary"
 	"math"
+	"math/rand"
 	"strings"
 	"testing"
 
 	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/hashfamily"
 	"gonum.org/v1/gonum/floats"
 )
 
@@ -84,6 +86,42 @@ func TestHyperplaneHash64(t *testing.T) {
 	}
 }
 
+func TestHyperplaneHashInto(t *testing.T) {
+	h := &Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	if _, err := h.Hash64Into([]float64{0, 0, 1}, make([]byte, 4)); err != ErrBufferTooSmall {
+		t.Fatalf("expected %v, but got %v", ErrBufferTooSmall, err)
+	}
+
+	// buffers are reused across calls without carrying over bits of a previous hash
+	buffer := make([]byte, 8)
+	for _, f := range [][]float64{{1, 1, 1}, {0, 0, 1}, {0, 1, 0}} {
+		expected, err := h.Hash64(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := h.Hash64Into(f, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != expected {
+			t.Errorf("expected %d, but got %d", expected, hash)
+		}
+		hash8, err := h.Hash8Into(f, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(hash8) != expected>>56 {
+			t.Errorf("expected %d, but got %d", expected>>56, hash8)
+		}
+	}
+}
+
 func TestHyperplaneHash32(t *testing.T) {
 	h := &Hyperplanes{
 		Planes: [][]float64{
@@ -201,6 +239,75 @@ func TestHyperplaneHash8(t *testing.T) {
 	}
 }
 
+func TestHyperplaneFamily(t *testing.T) {
+	h := &Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	hash, err := h.Hash([]float64{0, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != 6 {
+		t.Fatalf("expected %d, but got %d", 6, hash)
+	}
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := hashfamily.Unmarshal(h.Name(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Bits() != h.Bits() {
+		t.Fatalf("expected %d bits, but got %d", h.Bits(), f.Bits())
+	}
+	for i, p := range f.(*Hyperplanes).Planes {
+		if !floats.Equal(p, h.Planes[i]) {
+			t.Fatalf("expected plane %v, but got %v", h.Planes[i], p)
+		}
+	}
+}
+
+func TestHyperplaneReorder(t *testing.T) {
+	h := &Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	if err := h.Reorder([]int{0, 0, 1}); err != ErrInvalidOrder {
+		t.Fatalf("expected %v, but got %v", ErrInvalidOrder, err)
+	}
+
+	// only the last plane splits the samples evenly
+	samples := [][]float64{
+		{1, 1, 1},
+		{-1, 1, 1},
+		{1, 2, 1},
+		{-1, 2, 1},
+	}
+	order := h.LearnOrder(samples)
+	if order[0] != 2 {
+		t.Fatalf("expected plane %d to be the coarsest, but got order %v", 2, order)
+	}
+	if err := h.Reorder(order); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Hash([]float64{1, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != 4 {
+		t.Fatalf("expected %d, but got %d", 4, hash)
+	}
+}
+
 func BenchmarkHyperplaneNew(b *testing.B) {
 	numHyperplanes := 8
 	vecLen := 60
@@ -231,6 +338,26 @@ func BenchmarkHyperplaneHash64(b *testing.B) {
 	}
 }
 
+func BenchmarkHyperplaneHash64Into(b *testing.B) {
+	numHyperplanes := 8
+	vecLen := 60
+
+	h, err := New(numHyperplanes, vecLen)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	v := make([]float64, vecLen)
+	buffer := make([]byte, 8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := h.Hash64Into(v, buffer)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkHyperplaneHash32(b *testing.B) {
 	numHyperplanes := 8
 	vecLen := 60
@@ -284,3 +411,71 @@ func BenchmarkHyperplaneHash8(b *testing.B) {
 		}
 	}
 }
+
+func TestHyperplaneCoefficients(t *testing.T) {
+	h, err := New(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coef := h.Coefficients()
+	if len(coef) != 6 || h.VectorLength() != 2 {
+		t.Fatalf("expected %d coefficients of planes of length %d, but got %d and %d", 6, 2, len(coef), h.VectorLength())
+	}
+	// planes are views of the contiguous coefficients
+	coef[3] = 42
+	if h.Planes[1][1] != 42 {
+		t.Fatalf("expected plane to share the coefficients, but got %v", h.Planes[1])
+	}
+
+	if err := h.Reorder([]int{2, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if coef := h.Coefficients(); coef[3] != h.Planes[1][1] || h.Planes[2][1] != 42 {
+		t.Fatalf("expected reordered coefficients to stay row-major, but got %v", coef)
+	}
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(Hyperplanes)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !floats.Equal(decoded.Coefficients(), h.Coefficients()) {
+		t.Errorf("expected %v, but got %v", h.Coefficients(), decoded.Coefficients())
+	}
+
+	// planes set directly are copied out in row-major order
+	literal := &Hyperplanes{Planes: [][]float64{{1, 2}, {3, 4}}}
+	if !floats.Equal(literal.Coefficients(), []float64{1, 2, 3, 4}) {
+		t.Errorf("expected %v, but got %v", []float64{1, 2, 3, 4}, literal.Coefficients())
+	}
+}
+
+func TestHyperplaneNegateKey(t *testing.T) {
+	h, err := NewWithRand(12, 5, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFloat32(12, 5, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec := []float64{0.3, -1.2, 4, 0.5, -2}
+	neg := make([]float64, len(vec))
+	floats.ScaleTo(neg, -1, vec)
+	for _, family := range []hashfamily.Family{h, f} {
+		key, err := family.Hash(vec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := family.Hash(neg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if negated := family.(hashfamily.Negator).NegateKey(key); negated != expected {
+			t.Errorf("expected %b, but got %b for %s", expected, negated, family.Name())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package hyperplanes
+
+import (
+	"errors"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+var ErrInvalidProjection = errors.New("projection output does not match the number of vectors and planes")
+
+// Projector computes the dot products of a batch of vectors with a matrix of planes. Implementations may
+// offload the computation to accelerators such as GPUs.
+type Projector interface {
+	// Project writes the dot product of the i-th vector with the j-th plane to out[i*numPlanes+j].
+	// planes holds numPlanes planes row-major each of the length of the vectors.
+	Project(planes []float64, numPlanes int, vectors [][]float64, out []float64) error
+}
+
+// CPUProjector projects vectors with gonum dot products
+type CPUProjector struct{}
+
+// Project implements the Projector interface
+func (CPUProjector) Project(planes []float64, numPlanes int, vectors [][]float64, out []float64) error {
+	if len(out) != len(vectors)*numPlanes {
+		return ErrInvalidProjection
+	}
+	if numPlanes == 0 {
+		return nil
+	}
+	dim := len(planes) / numPlanes
+	for i, v := range vectors {
+		if len(v) != dim {
+			return ErrVectorLengthMismatch
+		}
+		for j := 0; j < numPlanes; j++ {
+			out[i*numPlanes+j] = floats.Dot(planes[j*dim:(j+1)*dim], v)
+		}
+	}
+	return nil
+}
+
+// HashBatch hashes every vector with every family projecting the vectors against the planes of all
+// families with a single call to the projector. Returns the keys of each family for each vector, where
+// keys match those of Hash.
+func HashBatch(p Projector, families []*Hyperplanes, vectors [][]float64) ([][]uint64, error) {
+	var numPlanes int
+	var planes []float64
+	for _, h := range families {
+		if h.Bits() > 64 {
+			return nil, ErrNumHyperplanesExceedHashBits
+		}
+		numPlanes += h.Bits()
+		planes = append(planes, h.Coefficients()...)
+	}
+	for _, v := range vectors {
+		if len(v) == 0 {
+			return nil, ErrNoVector
+		}
+	}
+
+	proj := make([]float64, len(vectors)*numPlanes)
+	if err := p.Project(planes, numPlanes, vectors, proj); err != nil {
+		return nil, err
+	}
+
+	keys := make([][]uint64, len(families))
+	for f := range keys {
+		keys[f] = make([]uint64, len(vectors))
+	}
+	for i := range vectors {
+		offset := i * numPlanes
+		for f, h := range families {
+			var key uint64
+			for _, dot := range proj[offset : offset+h.Bits()] {
+				key <<= 1
+				if dot > 0 {
+					key |= 1
+				}
+			}
+			keys[f][i] = key
+			offset += h.Bits()
+		}
+	}
+	return keys, nil
+}
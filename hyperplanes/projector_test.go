@@ -0,0 +1,45 @@
+package hyperplanes
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHashBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	families := make([]*Hyperplanes, 3)
+	for i := range families {
+		h, err := NewWithRand(i+2, 5, rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		families[i] = h
+	}
+	vectors := make([][]float64, 20)
+	for i := range vectors {
+		vectors[i] = make([]float64, 5)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float64() - 0.5
+		}
+	}
+
+	keys, err := HashBatch(CPUProjector{}, families, vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, h := range families {
+		for i, v := range vectors {
+			expected, err := h.Hash(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys[f][i] != expected {
+				t.Errorf("expected key %d of family %d and vector %d, but got %d", expected, f, i, keys[f][i])
+			}
+		}
+	}
+
+	if _, err := HashBatch(CPUProjector{}, families, [][]float64{{1, 2}}); err != ErrVectorLengthMismatch {
+		t.Errorf("expected %v, but got %v", ErrVectorLengthMismatch, err)
+	}
+}
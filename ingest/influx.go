@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInfluxQuery      = errors.New("influxdb query failed")
+	ErrNoValueColumn    = errors.New("series does not contain a time and value column")
+	ErrInvalidTimestamp = errors.New("unable to parse timestamp, expected epoch seconds")
+)
+
+// InfluxSource queries the InfluxDB 1.x http api. The statement may reference $start and $end which
+// are substituted with the poll range in epoch seconds, e.g.
+//
+//	SELECT mean("value") FROM "cpu" WHERE time >= $start AND time < $end GROUP BY time(60s), *
+type InfluxSource struct {
+	Addr      string // base url of the influxdb server, e.g. http://localhost:8086
+	Database  string
+	Statement string
+	Client    *http.Client
+}
+
+type influxResponse struct {
+	Results []struct {
+		Series []struct {
+			Name    string            `json:"name"`
+			Tags    map[string]string `json:"tags"`
+			Columns []string          `json:"columns"`
+			Values  [][]interface{}   `json:"values"`
+		} `json:"series"`
+		Error string `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+// Query implements the Source interface
+func (s *InfluxSource) Query(ctx context.Context, start, end int64) ([]Series, error) {
+	q := strings.NewReplacer(
+		"$start", strconv.FormatInt(start, 10)+"s",
+		"$end", strconv.FormatInt(end, 10)+"s",
+	).Replace(s.Statement)
+
+	params := url.Values{}
+	params.Set("db", s.Database)
+	params.Set("q", q)
+	params.Set("epoch", "s")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(s.Addr, "/")+"/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ir influxResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || ir.Error != "" {
+		return nil, fmt.Errorf("%w, status: %d, %s", ErrInfluxQuery, resp.StatusCode, ir.Error)
+	}
+
+	var out []Series
+	for _, r := range ir.Results {
+		if r.Error != "" {
+			return nil, fmt.Errorf("%w, %s", ErrInfluxQuery, r.Error)
+		}
+		for _, is := range r.Series {
+			timeCol, valCol := -1, -1
+			for i, c := range is.Columns {
+				if c == "time" {
+					timeCol = i
+				} else if valCol < 0 {
+					valCol = i
+				}
+			}
+			if timeCol < 0 || valCol < 0 {
+				return nil, ErrNoValueColumn
+			}
+
+			series := Series{Name: is.Name, Tags: is.Tags, Points: make([]Point, 0, len(is.Values))}
+			for _, row := range is.Values {
+				ts, ok := row[timeCol].(float64)
+				if !ok {
+					return nil, ErrInvalidTimestamp
+				}
+				// null values are gaps in the series
+				val, ok := row[valCol].(float64)
+				if !ok {
+					continue
+				}
+				series.Points = append(series.Points, Point{Timestamp: int64(ts), Value: val})
+			}
+			out = append(out, series)
+		}
+	}
+	return out, nil
+}
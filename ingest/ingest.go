@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsh"
+	"github.com/aouyang1/go-lsh/seriesid"
+)
+
+var (
+	ErrNoSource   = errors.New("no source provided to ingester")
+	ErrNoIndexer  = errors.New("no indexer provided to ingester")
+	ErrNoInterval = errors.New("invalid poll interval, must be greater than 0")
+)
+
+// Point is a single sample of a series where the timestamp is in the same units as the document index
+type Point struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Series is a named set of points returned from a source
+type Series struct {
+	Name   string
+	Tags   map[string]string
+	Points []Point
+}
+
+// Source is any system that can be queried for the points of all series within [start, end)
+type Source interface {
+	Query(ctx context.Context, start, end int64) ([]Series, error)
+}
+
+// Indexer is the subset of the LSH api needed to continuously index windows
+type Indexer interface {
+	Index(d document.Document) error
+}
+
+// UIDFunc maps a series to the uid it will be indexed under
+type UIDFunc func(s Series) (uint64, error)
+
+// Ingester periodically queries a source, windows each series into segments of the configured
+// vector length aligned to the sample period and indexes every newly completed window.
+type Ingester struct {
+	Source   Source
+	Indexer  Indexer
+	Cfg      *configs.LSHConfigs
+	UIDFunc  UIDFunc       // defaults to HashUID
+	Interval time.Duration // time between each poll of the source
+	Lookback time.Duration // how far back from now each poll will query
+
+	next map[uint64]int64 // uid to the start of the next window that has not been indexed
+}
+
+// New returns an ingester that polls every minute looking back over the last two windows
+func New(src Source, idx Indexer, cfg *configs.LSHConfigs) *Ingester {
+	span := time.Duration(int64(cfg.VectorLength)*cfg.SamplePeriod) * time.Second
+	return &Ingester{
+		Source:   src,
+		Indexer:  idx,
+		Cfg:      cfg,
+		UIDFunc:  HashUID,
+		Interval: time.Minute,
+		Lookback: 2 * span,
+		next:     make(map[uint64]int64),
+	}
+}
+
+// Poll queries the source for [start, end) and indexes any complete windows that have not already
+// been indexed. Returns the number of windows indexed.
+func (i *Ingester) Poll(ctx context.Context, start, end int64) (int, error) {
+	if i.Source == nil {
+		return 0, ErrNoSource
+	}
+	if i.Indexer == nil {
+		return 0, ErrNoIndexer
+	}
+	series, err := i.Source.Query(ctx, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	// an ingester may be built as a struct literal
+	if i.next == nil {
+		i.next = make(map[uint64]int64)
+	}
+	uidFunc := i.UIDFunc
+	if uidFunc == nil {
+		uidFunc = HashUID
+	}
+	var numIndexed int
+	for _, s := range series {
+		uid, err := uidFunc(s)
+		if err != nil {
+			return numIndexed, err
+		}
+		for _, d := range Windows(uid, s.Points, i.Cfg.VectorLength, i.Cfg.SamplePeriod) {
+			if d.GetIndex() < i.next[uid] {
+				continue
+			}
+			if err := i.Indexer.Index(d); err != nil {
+				// flat windows carry no shape information and are expected in real telemetry
+				if err == lsh.ErrNoVectorComplexity {
+					continue
+				}
+				return numIndexed, err
+			}
+			i.next[uid] = d.GetIndex() + int64(i.Cfg.VectorLength)*i.Cfg.SamplePeriod
+			numIndexed++
+		}
+	}
+	return numIndexed, nil
+}
+
+// Run polls the source every interval until the context is cancelled. Indexes are expected to be
+// seconds from epoch.
+func (i *Ingester) Run(ctx context.Context) error {
+	if i.Interval <= 0 {
+		return ErrNoInterval
+	}
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if _, err := i.Poll(ctx, now.Add(-i.Lookback).Unix(), now.Unix()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Windows segments the points into non-overlapping documents of vecLen samples where each window
+// starts on a multiple of vecLen*samplePeriod. Points falling into the same sample are averaged and
+// windows missing any sample are dropped.
+func Windows(uid uint64, points []Point, vecLen int, samplePeriod int64) []document.Document {
+	span := int64(vecLen) * samplePeriod
+
+	type slot struct {
+		sum   float64
+		count int
+	}
+	windows := make(map[int64][]slot)
+	for _, p := range points {
+		start := floorDiv(p.Timestamp, span) * span
+		w, exists := windows[start]
+		if !exists {
+			w = make([]slot, vecLen)
+			windows[start] = w
+		}
+		idx := (p.Timestamp - start) / samplePeriod
+		w[idx].sum += p.Value
+		w[idx].count++
+	}
+
+	starts := make([]int64, 0, len(windows))
+	for start := range windows {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(a, b int) bool { return starts[a] < starts[b] })
+
+	docs := make([]document.Document, 0, len(starts))
+	for _, start := range starts {
+		vec := make([]float64, vecLen)
+		complete := true
+		for j, s := range windows[start] {
+			if s.count == 0 {
+				complete = false
+				break
+			}
+			vec[j] = s.sum / float64(s.count)
+		}
+		if !complete {
+			continue
+		}
+		docs = append(docs, document.NewSimple(uid, start, vec))
+	}
+	return docs
+}
+
+// HashUID is the default uid mapping using the deterministic series hash of the name and tags
+func HashUID(s Series) (uint64, error) {
+	return seriesid.Hash(s.Name, s.Tags), nil
+}
+
+// MapperUID returns a uid mapping that registers each series with the mapper so that uids can be
+// translated back to series and collisions are reported as errors.
+func MapperUID(m *seriesid.Mapper) UIDFunc {
+	return func(s Series) (uint64, error) {
+		return m.UID(s.Name, s.Tags)
+	}
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+type staticSource []Series
+
+func (s staticSource) Query(ctx context.Context, start, end int64) ([]Series, error) {
+	return s, nil
+}
+
+type recordingIndexer []document.Document
+
+func (r *recordingIndexer) Index(d document.Document) error {
+	*r = append(*r, d)
+	return nil
+}
+
+func TestWindows(t *testing.T) {
+	points := []Point{
+		{0, 1}, {60, 2}, {120, 3},
+		{180, 4}, {200, 6}, {240, 5}, {300, 6},
+		{360, 7}, {480, 9}, // missing sample at 420
+	}
+	docs := Windows(7, points, 3, 60)
+	if len(docs) != 2 {
+		t.Fatalf("expected %d windows, but got %d", 2, len(docs))
+	}
+
+	testData := []struct {
+		index int64
+		vec   []float64
+	}{
+		{0, []float64{1, 2, 3}},
+		{180, []float64{5, 5, 6}},
+	}
+	for i, td := range testData {
+		d := docs[i]
+		if d.GetUID() != 7 {
+			t.Errorf("expected uid %d, but got %d", 7, d.GetUID())
+		}
+		if d.GetIndex() != td.index {
+			t.Errorf("expected index %d, but got %d", td.index, d.GetIndex())
+		}
+		for j, v := range d.GetVector() {
+			if v != td.vec[j] {
+				t.Errorf("expected %v, but got %v", td.vec, d.GetVector())
+				break
+			}
+		}
+	}
+}
+
+func TestIngesterPoll(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	src := staticSource{
+		{Name: "cpu", Tags: map[string]string{"host": "a"}, Points: []Point{{0, 1}, {60, 2}, {120, 3}, {180, 3}, {240, 3}, {300, 3}}},
+		{Name: "cpu", Tags: map[string]string{"host": "b"}, Points: []Point{{0, 3}, {60, 2}, {120, 1}}},
+	}
+	idx := new(recordingIndexer)
+	ing := New(src, idx, cfg)
+
+	n, err := ing.Poll(context.Background(), 0, 360)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected %d windows indexed, but got %d", 3, n)
+	}
+
+	// windows already indexed are not indexed again
+	n, err = ing.Poll(context.Background(), 0, 360)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected %d windows indexed, but got %d", 0, n)
+	}
+
+	// an ingester built as a struct literal tracks the indexed windows all the same
+	idx = new(recordingIndexer)
+	ing = &Ingester{Source: src, Indexer: idx, Cfg: cfg}
+	for _, expected := range []int{3, 0} {
+		n, err := ing.Poll(context.Background(), 0, 360)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Fatalf("expected %d windows indexed, but got %d", expected, n)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLSource queries any database/sql driver such as TimescaleDB. The statement is passed the start and end
+// of the poll range as its two arguments and must return rows of (series name, epoch seconds, value), e.g.
+//
+//	SELECT host, extract(epoch from time_bucket('60s', time))::bigint AS ts, avg(usage)
+//	FROM cpu WHERE time >= to_timestamp($1) AND time < to_timestamp($2) GROUP BY host, ts
+type SQLSource struct {
+	DB        *sql.DB
+	Statement string
+}
+
+// Query implements the Source interface
+func (s *SQLSource) Query(ctx context.Context, start, end int64) ([]Series, error) {
+	rows, err := s.DB.QueryContext(ctx, s.Statement, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Series
+	seriesIdx := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var p Point
+		var val sql.NullFloat64
+		if err := rows.Scan(&name, &p.Timestamp, &val); err != nil {
+			return nil, err
+		}
+		if !val.Valid {
+			continue
+		}
+		p.Value = val.Float64
+
+		idx, exists := seriesIdx[name]
+		if !exists {
+			idx = len(out)
+			seriesIdx[name] = idx
+			out = append(out, Series{Name: name})
+		}
+		out[idx].Points = append(out[idx].Points, p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,115 @@
+package lsh
+
+import (
+	"sync"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/aouyang1/go-lsh/bitmap"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+// acl tracks the owner label of each labeled document along with a bitmap of uids per label so
+// candidates can be restricted to the labels a caller may read
+type acl struct {
+	mu     sync.RWMutex
+	labels map[string]*bitmap.Bitmap
+	uids   map[uint64]string
+}
+
+func newACL() *acl {
+	return &acl{
+		labels: make(map[string]*bitmap.Bitmap),
+		uids:   make(map[uint64]string),
+	}
+}
+
+// index records the label of the document if it has one, moving the uid if it was previously
+// indexed under a different label
+func (a *acl) index(d document.Document) {
+	lbl, ok := d.(document.Labeler)
+	if !ok || lbl.GetLabel() == "" {
+		return
+	}
+	a.set(d.GetUID(), lbl.GetLabel())
+}
+
+// set records the label of the uid moving it from any previous label
+func (a *acl) set(uid uint64, label string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if prev, exists := a.uids[uid]; exists {
+		if prev == label {
+			return
+		}
+		a.removeLocked(uid)
+	}
+	rb, exists := a.labels[label]
+	if !exists {
+		rb = bitmap.New()
+		a.labels[label] = rb
+	}
+	rb.Add(uid)
+	a.uids[uid] = label
+}
+
+func (a *acl) delete(uid uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.removeLocked(uid)
+}
+
+func (a *acl) removeLocked(uid uint64) {
+	label, exists := a.uids[uid]
+	if !exists {
+		return
+	}
+	if rb, exists := a.labels[label]; exists {
+		rb.CheckedRemove(uid)
+		if rb.IsEmpty() {
+			delete(a.labels, label)
+		}
+	}
+	delete(a.uids, uid)
+}
+
+// filter removes any candidate not owned by one of the labels
+func (a *acl) filter(docIds map[uint64]map[int64]struct{}, labels []string) {
+	allowed := roaring64.New()
+	a.mu.RLock()
+	for _, label := range labels {
+		rb, exists := a.labels[label]
+		if !exists {
+			continue
+		}
+		rb.Lock()
+		allowed.Or(rb.Rb)
+		rb.Unlock()
+	}
+	a.mu.RUnlock()
+
+	for uid := range docIds {
+		if !allowed.Contains(uid) {
+			delete(docIds, uid)
+		}
+	}
+}
+
+// snapshot returns the label of every labeled uid, or of the given uids only if any
+func (a *acl) snapshot(uids map[uint64]struct{}) map[uint64]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	labels := make(map[uint64]string)
+	for uid, label := range a.uids {
+		if _, changed := uids[uid]; changed || uids == nil {
+			labels[uid] = label
+		}
+	}
+	return labels
+}
+
+// label returns the owner label of the uid
+func (a *acl) label(uid uint64) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.uids[uid]
+}
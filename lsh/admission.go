@@ -0,0 +1,61 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrOverloaded = errors.New("too many concurrent searches, timed out waiting for a slot")
+
+// admission bounds the number of searches running at once
+type admission struct {
+	slots   chan struct{}
+	timeout time.Duration
+	waiting func() // called when a search starts waiting for a slot
+}
+
+func newAdmission(limit int, timeout time.Duration) *admission {
+	if limit <= 0 {
+		return nil
+	}
+	return &admission{slots: make(chan struct{}, limit), timeout: timeout}
+}
+
+// acquire waits for a free slot returning ErrOverloaded if none frees up before the timeout or the
+// error of the context if it is done first
+func (a *admission) acquire(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if a.waiting != nil {
+		a.waiting()
+	}
+	var timeout <-chan time.Time
+	if a.timeout > 0 {
+		timer := time.NewTimer(a.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrOverloaded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *admission) release() {
+	if a == nil {
+		return
+	}
+	<-a.slots
+}
@@ -0,0 +1,96 @@
+package lsh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+func TestAdmission(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.MaxConcurrentSearches = 1
+	cfg.SearchQueueTimeout = 10 * time.Millisecond
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// occupy the only slot
+	if err := lsh.admit.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var waits int
+	lsh.admit.waiting = func() { waits++ }
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), nil); err != ErrOverloaded {
+		t.Fatalf("expected %v, but got %v error", ErrOverloaded, err)
+	}
+	if waits != 1 {
+		t.Fatalf("expected the search to wait for a slot once, but waited %d times", waits)
+	}
+
+	// a queued search proceeds once the slot is released while it waits without a timeout
+	lsh.admit.timeout = 0
+	lsh.admit.waiting = func() {
+		waits++
+		lsh.admit.release()
+	}
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), nil); err != nil {
+		t.Fatal(err)
+	}
+	if waits != 2 {
+		t.Fatalf("expected the search to wait for a slot, but waited %d times", waits-1)
+	}
+
+	// the slot is free again once the search is done
+	lsh.admit.waiting = func() { t.Fatal("expected a free slot") }
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.MaxConcurrentSearches = -1
+	if _, err := New(cfg); err != configs.ErrInvalidSearchConcurrency {
+		t.Fatalf("expected %v, but got %v error", configs.ErrInvalidSearchConcurrency, err)
+	}
+}
+
+func TestAdmissionGeneration(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.MaxConcurrentSearches = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.admit.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan struct{})
+	lsh.admit.waiting = func() { close(waiting) }
+
+	type searched struct {
+		diag results.Diagnostics
+		err  error
+	}
+	done := make(chan searched)
+	go func() {
+		_, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), nil)
+		done <- searched{diag, err}
+	}()
+
+	// the document is indexed while the search waits for a slot
+	<-waiting
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	lsh.admit.release()
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.diag.Generation != lsh.Generation() || res.diag.NumCandidates == 0 {
+		t.Errorf("expected generation %d with the indexed candidate, but got generation %d with %d candidates", lsh.Generation(), res.diag.Generation, res.diag.NumCandidates)
+	}
+}
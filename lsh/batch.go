@@ -0,0 +1,310 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hashfamily"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+// keyedDocument carries the bucket keys of a document precomputed for each hyperplane family
+type keyedDocument struct {
+	document.Document
+	keys map[hashfamily.Family]uint64
+}
+
+// Key implements the tables.Keyed interface
+func (k *keyedDocument) Key(f hashfamily.Family) (uint64, bool) {
+	key, exists := k.keys[f]
+	return key, exists
+}
+
+// withKeys carries the precomputed keys of from over to the document derived from it
+func withKeys(from, to document.Document) document.Document {
+	kd, ok := from.(*keyedDocument)
+	if !ok || from == to {
+		return to
+	}
+	return &keyedDocument{Document: to, keys: kd.keys}
+}
+
+// withFloat32Keys returns the document carrying the keys of every float32 hyperplane table so its
+// vector is converted to float32 once rather than by each table
+func (l *LSH) withFloat32Keys(d document.Document) (document.Document, error) {
+	var float32Tables bool
+	for _, t := range l.Tables {
+		if _, ok := t.Family.(*hyperplanes.Float32); ok {
+			float32Tables = true
+			break
+		}
+	}
+	if !float32Tables {
+		return d, nil
+	}
+	var keys map[hashfamily.Family]uint64
+	if kd, ok := d.(*keyedDocument); ok {
+		d, keys = kd.Document, kd.keys
+	}
+	added := make(map[hashfamily.Family]uint64, len(keys))
+	for f, key := range keys {
+		added[f] = key
+	}
+	if err := l.float32Keys(d.GetVector(), added); err != nil {
+		return nil, err
+	}
+	if len(added) == 0 {
+		return d, nil
+	}
+	return &keyedDocument{Document: d, keys: added}, nil
+}
+
+// float32Keys adds the keys of the vector for every float32 hyperplane table missing from keys
+func (l *LSH) float32Keys(vec []float64, keys map[hashfamily.Family]uint64) error {
+	var v []float32
+	for _, t := range l.Tables {
+		h, ok := t.Family.(*hyperplanes.Float32)
+		if !ok {
+			continue
+		}
+		if _, exists := keys[h]; exists {
+			continue
+		}
+		if v == nil {
+			v = hyperplanes.ToFloat32(vec)
+		}
+		key, err := h.HashFloat32(v)
+		if err != nil {
+			return err
+		}
+		keys[h] = key
+	}
+	return nil
+}
+
+// batchKeys projects the vectors against the planes of every hyperplane table with a single call to the
+// projector returning the keys of each vector by family. The keys of float32 hyperplane tables are
+// hashed from a single float32 conversion of each vector instead.
+func (l *LSH) batchKeys(vecs [][]float64) ([]map[hashfamily.Family]uint64, error) {
+	var families []*hyperplanes.Hyperplanes
+	for _, t := range l.Tables {
+		if h, ok := t.Family.(*hyperplanes.Hyperplanes); ok {
+			families = append(families, h)
+		}
+	}
+	keys := make([]map[hashfamily.Family]uint64, len(vecs))
+	for i := range keys {
+		keys[i] = make(map[hashfamily.Family]uint64, len(families))
+		if err := l.float32Keys(vecs[i], keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	if len(families) == 0 || len(vecs) == 0 {
+		return keys, nil
+	}
+	familyKeys, err := hyperplanes.HashBatch(l.Projector, families, vecs)
+	if err != nil {
+		return nil, err
+	}
+	for f, h := range families {
+		for i, key := range familyKeys[f] {
+			keys[i][h] = key
+		}
+	}
+	return keys, nil
+}
+
+// IndexBatch indexes the documents like Index. When a Projector is set the documents are hashed by every
+// table with a single batch projection. Every document is attempted and the failures are joined.
+func (l *LSH) IndexBatch(docs []document.Document) error {
+	return l.IndexBatchContext(context.Background(), docs)
+}
+
+// IndexBatchContext indexes the documents like IndexBatch until the context is done. Documents not
+// committed by then are not indexed and the error of the context is joined with the failures.
+func (l *LSH) IndexBatchContext(ctx context.Context, docs []document.Document) error {
+	var errs []error
+	if l.Projector == nil {
+		for _, d := range docs {
+			if err := ctx.Err(); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			if err := l.IndexContext(ctx, d); err != nil {
+				errs = append(errs, fmt.Errorf("uid %d, %w", d.GetUID(), err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	fitted := make([]document.Document, 0, len(docs))
+	enriched := make([]document.Document, 0, len(docs))
+	for _, d := range docs {
+		if err := l.validate(d); err != nil {
+			errs = append(errs, fmt.Errorf("uid %d, %w", d.GetUID(), err))
+			continue
+		}
+		e, err := l.enriched(d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("uid %d, %w", d.GetUID(), err))
+			continue
+		}
+		f, _ := l.fitLength(e)
+		enriched = append(enriched, e)
+		fitted = append(fitted, f)
+	}
+
+	// the batch is prepared and committed under one lock so evictions and duplicates are decided against
+	// the index the batch is committed to
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return errors.Join(append(errs, ErrReadOnly)...)
+	}
+	batch := make([]prepared, 0, len(fitted))
+	vecs := make([][]float64, 0, len(fitted))
+	for i, e := range enriched {
+		p, err := l.prepareIndex(e, fitted[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("uid %d, %w", e.GetUID(), err))
+			continue
+		}
+		batch = append(batch, p)
+		vecs = append(vecs, p.hashed.GetVector())
+	}
+	keys, err := l.batchKeys(vecs)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for i, p := range batch {
+		// documents are only admitted once they are about to be committed so a cancelled batch evicts
+		// nothing for the documents it didn't commit
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		err := l.admitIndex(p)
+		if err == errDuplicateIgnored {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("uid %d, %w", p.d.GetUID(), err))
+			continue
+		}
+		p.hashed = &keyedDocument{Document: p.hashed, keys: keys[i]}
+		if err := l.commitIndex(p); err != nil {
+			errs = append(errs, fmt.Errorf("uid %d, %w", p.d.GetUID(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SearchBatch searches for each query like Search returning the scores of each query. Queries are
+// searched concurrently by up to BatchConcurrency goroutines sharing the buffers candidates are scored
+// in. When a Projector is set the queries are hashed by every table with a single batch projection, the
+// keys of their negations being derived from those keys. Every query is attempted and the failures are
+// joined.
+func (l *LSH) SearchBatch(queries []document.Document, s *options.Search) ([]results.Scores, error) {
+	return l.SearchBatchContext(context.Background(), queries, s)
+}
+
+// SearchBatchContext searches like SearchBatch until the context is done. Queries not searched by then
+// have no scores and the error of the context is joined with the failures.
+func (l *LSH) SearchBatchContext(ctx context.Context, queries []document.Document, s *options.Search) ([]results.Scores, error) {
+	if s == nil {
+		s = options.NewDefaultSearch()
+	}
+	errs := make([]error, len(queries))
+	res := make([]results.Scores, len(queries))
+	keyed := make([]document.Document, len(queries))
+	copy(keyed, queries)
+
+	if l.Projector != nil {
+		var vecs [][]float64
+		var positions []int
+		for i, d := range queries {
+			query, vec, err := l.prepareQuery(d, s)
+			if err != nil {
+				errs[i] = fmt.Errorf("query %d, %w", i, err)
+				keyed[i] = nil
+				continue
+			}
+			vecs = append(vecs, vec)
+			positions = append(positions, i)
+			keyed[i] = query
+		}
+		keys, err := l.batchKeys(vecs)
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+		for j, i := range positions {
+			q := keyed[i].(*fittedQuery)
+			q.Document = &keyedDocument{Document: q.Document, keys: keys[j]}
+		}
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	workers := l.batchWorkers(len(queries))
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				scores, _, err := l.SearchWithDiagnosticsContext(ctx, keyed[i], s)
+				if err != nil {
+					errs[i] = fmt.Errorf("query %d, %w", i, err)
+					continue
+				}
+				res[i] = scores
+			}
+		}()
+	}
+	for i, d := range keyed {
+		if d == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return res, errors.Join(errs...)
+}
+
+// batchWorkers returns the number of goroutines searching the queries of a batch
+func (l *LSH) batchWorkers(numQueries int) int {
+	workers := l.Cfg.BatchConcurrency
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+		if l.Cfg.MaxConcurrentSearches > 0 && l.Cfg.MaxConcurrentSearches < workers {
+			workers = l.Cfg.MaxConcurrentSearches
+		}
+	}
+	if workers > numQueries {
+		workers = numQueries
+	}
+	return workers
+}
+
+// prepareQuery returns the fitted query along with a copy of its vector as it is hashed by a search
+func (l *LSH) prepareQuery(d document.Document, s *options.Search) (*fittedQuery, []float64, error) {
+	query, err := l.fitSearchQuery(d, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	vec := make([]float64, len(query.GetVector()))
+	copy(vec, query.GetVector())
+	l.transform(vec)
+	fillMissing(vec)
+	return query, l.reduce(vec), nil
+}
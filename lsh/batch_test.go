@@ -0,0 +1,225 @@
+package lsh
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+// countingProjector counts the batch projections
+type countingProjector struct {
+	hyperplanes.CPUProjector
+	calls int
+}
+
+func (p *countingProjector) Project(planes []float64, numPlanes int, vectors [][]float64, out []float64) error {
+	p.calls++
+	return p.CPUProjector.Project(planes, numPlanes, vectors, out)
+}
+
+func TestBatchProjection(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	rng := rand.New(rand.NewSource(1))
+	docs := make([]document.Document, 50)
+	for i := range docs {
+		docs[i] = document.NewSimple(uint64(i), 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})
+	}
+	docs = append(docs, document.NewSimple(100, 0, []float64{1, 1, 1}))
+
+	serial, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batched, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &countingProjector{}
+	batched.Projector = p
+
+	for _, d := range docs[:len(docs)-1] {
+		if err := serial.Index(d.Copy()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copied := make([]document.Document, len(docs))
+	for i, d := range docs {
+		copied[i] = d.Copy()
+	}
+	if err := batched.IndexBatch(copied); err == nil {
+		t.Fatal("expected an error indexing a document without complexity")
+	}
+	if p.calls != 1 {
+		t.Fatalf("expected %d projection, but got %d", 1, p.calls)
+	}
+	for i, tbl := range serial.Tables {
+		for uid, hashes := range tbl.Doc2Hash {
+			if batched.Tables[i].Doc2Hash[uid][0] != hashes[0] {
+				t.Fatalf("expected uid %d in bucket %d of table %d, but got %v", uid, hashes[0], i, batched.Tables[i].Doc2Hash[uid])
+			}
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.9
+	queries := []document.Document{docs[0].Copy(), docs[1].Copy(), document.NewSimple(0, 0, []float64{1, 2})}
+	res, err := batched.SearchBatch(queries, so)
+	if err == nil {
+		t.Fatal("expected an error searching a query of the wrong length")
+	}
+	if p.calls != 2 {
+		t.Fatalf("expected %d projections, but got %d", 2, p.calls)
+	}
+	for i, q := range []document.Document{docs[0].Copy(), docs[1].Copy()} {
+		expected, _, err := serial.Search(q, so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(expected.UIDs(), res[i].UIDs()); err != nil {
+			t.Errorf("query %d, %v", i, err)
+		}
+	}
+	if res[2] != nil {
+		t.Errorf("expected no scores for the failed query, but got %v", res[2])
+	}
+}
+
+func TestSearchBatchEnrichment(t *testing.T) {
+	configs.RegisterEnrichment("reverse", func(d document.Document) (document.Document, error) {
+		s, ok := d.(*document.Simple)
+		if !ok {
+			return nil, ErrInvalidDocument
+		}
+		for i, j := 0, len(s.Vector)-1; i < j; i, j = i+1, j-1 {
+			s.Vector[i], s.Vector[j] = s.Vector[j], s.Vector[i]
+		}
+		return s, nil
+	})
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	cfg.Enrichment = "reverse"
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &countingProjector{}
+	lsh.Projector = p
+	vectors := [][]float64{{0, 1, 3}, {3, 1, 0}, {0, 2, 6}, {6, 2, 0}, {1, 3, 2}}
+	for i, vec := range vectors {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.9
+	queries := make([]document.Document, len(vectors))
+	for i, vec := range vectors {
+		queries[i] = document.NewSimple(0, 0, append([]float64(nil), vec...))
+	}
+	res, err := lsh.SearchBatch(queries, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 1 {
+		t.Fatalf("expected %d projection, but got %d", 1, p.calls)
+	}
+	for i, vec := range vectors {
+		expected, _, err := lsh.Search(document.NewSimple(0, 0, vec), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expected) == 0 {
+			t.Fatalf("expected query %d to match, but got no results", i)
+		}
+		if err := compareUint64s(expected.UIDs(), res[i].UIDs()); err != nil {
+			t.Errorf("query %d, %v", i, err)
+		}
+	}
+}
+
+func TestIndexBatchCaps(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	cfg.MaxDocs = 3
+	cfg.DuplicatePolicy = configs.DuplicateConflict
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsh.Projector = &countingProjector{}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(0, 0, []float64{3, 1, 0}),
+		document.NewSimple(1, 0, []float64{0, 2, 6}),
+		document.NewSimple(2, 0, []float64{1, 2, 3}),
+		document.NewSimple(3, 0, []float64{4, 1, 2}),
+	}
+	err = lsh.IndexBatch(docs)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.UID != 0 {
+		t.Errorf("expected a conflict of uid %d, but got %v", 0, err)
+	}
+	if !errors.Is(err, ErrMaxDocsExceeded) {
+		t.Errorf("expected %v, but got %v", ErrMaxDocsExceeded, err)
+	}
+	if lsh.Docs.Size() != cfg.MaxDocs {
+		t.Errorf("expected %d documents, but got %d", cfg.MaxDocs, lsh.Docs.Size())
+	}
+	if _, exists := lsh.Docs.Exists(3); exists {
+		t.Errorf("expected uid %d past the cap not to be indexed", 3)
+	}
+	if vec := lsh.Docs.GetVector(0, 0); vec[0] != 0 {
+		t.Errorf("expected the first window of uid %d to be kept, but got %v", 0, vec)
+	}
+}
+
+func TestSearchBatchConcurrent(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	cfg.BatchConcurrency = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.8
+	queries := make([]document.Document, 40)
+	for i := range queries {
+		queries[i] = document.NewSimple(0, 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})
+	}
+	queries[7] = document.NewSimple(0, 0, []float64{1, 2})
+	res, err := lsh.SearchBatch(queries, so)
+	if err == nil {
+		t.Fatal("expected an error searching a query of the wrong length")
+	}
+	for i, q := range queries {
+		if i == 7 {
+			if res[i] != nil {
+				t.Errorf("expected no scores for the failed query, but got %v", res[i])
+			}
+			continue
+		}
+		expected, _, err := lsh.Search(q, so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(expected.UIDs(), res[i].UIDs()); err != nil {
+			t.Errorf("query %d, %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+// errDuplicateIgnored signals a conflicting window dropped by the ignore duplicate policy
+var errDuplicateIgnored = errors.New("duplicate window ignored")
+
+// ConflictError is returned when a window that is already indexed is indexed again with a different
+// vector
+type ConflictError struct {
+	UID              uint64
+	Index            int64
+	Stored, Received uint64 // checksums of the stored and received windows
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("uid %d at index %d is already indexed with a different vector, checksum %x, received %x", e.UID, e.Index, e.Stored, e.Received)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return lsherrors.DuplicateDocument
+}
+
+// checksums holds the checksum of every indexed window by uid and index
+type checksums struct {
+	mu   sync.RWMutex
+	uids map[uint64]map[int64]uint64
+}
+
+func (c *checksums) get(uid uint64, index int64) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	sum, exists := c.uids[uid][index]
+	return sum, exists
+}
+
+func (c *checksums) set(uid uint64, index int64, sum uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.uids == nil {
+		c.uids = make(map[uint64]map[int64]uint64)
+	}
+	windows, exists := c.uids[uid]
+	if !exists {
+		windows = make(map[int64]uint64)
+		c.uids[uid] = windows
+	}
+	windows[index] = sum
+}
+
+func (c *checksums) delete(uid uint64) {
+	c.mu.Lock()
+	delete(c.uids, uid)
+	c.mu.Unlock()
+}
+
+// setChecksum records the checksum of the window when a duplicate policy needs it
+func (l *LSH) setChecksum(uid uint64, index int64, sum uint64) {
+	if l.Cfg.DuplicatePolicy != configs.DuplicateAllow {
+		l.checksums.set(uid, index, sum)
+	}
+}
+
+// windowChecksum returns a fast hash of the window at the configured sample period
+func windowChecksum(vec []float64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range vec {
+		bits := math.Float64bits(v)
+		if math.IsNaN(v) {
+			bits = math.Float64bits(math.NaN())
+		}
+		for i := range buf {
+			buf[i] = byte(bits >> (8 * i))
+		}
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// checkDuplicate applies the duplicate policy when the window of the uid at the index is stored with
+// a different checksum
+func (l *LSH) checkDuplicate(uid uint64, index int64, sum uint64) error {
+	if l.Cfg.DuplicatePolicy == configs.DuplicateAllow {
+		return nil
+	}
+	stored, exists := l.checksums.get(uid, index)
+	if !exists || stored == sum {
+		return nil
+	}
+	if l.Cfg.DuplicatePolicy == configs.DuplicateIgnore {
+		return errDuplicateIgnored
+	}
+	return &ConflictError{UID: uid, Index: index, Stored: stored, Received: sum}
+}
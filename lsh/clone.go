@@ -0,0 +1,37 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+var ErrReadOnly = errors.New("index is a read-only clone")
+
+// Clone returns an independent copy of the tables and documents of the index, e.g. for analysis jobs
+// such as self joins or clustering that would otherwise hold up indexing. Mutations of the index only
+// wait while it is copied. A read-only clone refuses to index or delete documents with ErrReadOnly. The
+// clone stores its documents in memory and does not carry over the CDC writer, shadow, standing queries
+// or persistence of the index.
+func (l *LSH) Clone(readOnly bool) (*LSH, error) {
+	var buf bytes.Buffer
+	l.mu.RLock()
+	err := l.save(&buf, snapshot.Options{})
+	l.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *l.Cfg
+	c, err := New(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Load(&buf, snapshot.Options{}); err != nil {
+		return nil, err
+	}
+	c.Projector = l.Projector
+	c.readOnly = readOnly
+	return c, nil
+}
@@ -0,0 +1,66 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestClone(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 2.9})); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := lsh.Clone(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Index(document.NewSimple(2, 0, []float64{3, 1, 0})); err != ErrReadOnly {
+		t.Errorf("expected %v, but got %v", ErrReadOnly, err)
+	}
+	if err := clone.Delete(0); err != ErrReadOnly {
+		t.Errorf("expected %v, but got %v", ErrReadOnly, err)
+	}
+
+	// the index keeps ingesting independently of the clone
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{0, 1, 3.1})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	res, _, err := clone.Search(query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{0, 1}, res.UIDs()); err != nil {
+		t.Error(err)
+	}
+	if clone.Generation() != 2 {
+		t.Errorf("expected generation %d, but got %d", 2, clone.Generation())
+	}
+	if c := clone.Counters(); c.TotalIndexed != 2 {
+		t.Errorf("expected %d indexed, but got %d", 2, c.TotalIndexed)
+	}
+
+	clone, err = lsh.Clone(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Index(document.NewSimple(3, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if lsh.Docs.Size() != 2 || clone.Docs.Size() != 3 {
+		t.Errorf("expected %d and %d documents, but got %d and %d", 2, 3, lsh.Docs.Size(), clone.Docs.Size())
+	}
+}
@@ -0,0 +1,62 @@
+package lsh
+
+import "github.com/aouyang1/go-lsh/stats"
+
+// Fragmentation measures the space held by the tables and the forward index that compaction may
+// reclaim
+func (l *LSH) Fragmentation() (stats.Fragmentation, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fragmentation()
+}
+
+func (l *LSH) fragmentation() (stats.Fragmentation, error) {
+	var f stats.Fragmentation
+	for _, t := range l.Tables {
+		tf, err := t.Fragmentation()
+		if err != nil {
+			return f, err
+		}
+		f.EmptyBuckets += tf.EmptyBuckets
+		f.EmptyRows += tf.EmptyRows
+		f.BitmapBytes += tf.BitmapBytes
+		f.BitmapUIDs += tf.BitmapUIDs
+	}
+	if f.BitmapUIDs > 0 {
+		f.BytesPerUID = float64(f.BitmapBytes) / float64(f.BitmapUIDs)
+	}
+
+	m := l.Docs.MemStats()
+	if m.ArenaUsed > m.VectorBytes {
+		f.ArenaGarbage = m.ArenaUsed - m.VectorBytes
+		f.TombstoneRatio = float64(f.ArenaGarbage) / float64(m.ArenaUsed)
+	}
+	f.DiskGarbage = m.DiskBytes - m.DiskUsed
+	return f, nil
+}
+
+// Compact reclaims the space measured by Fragmentation from the tables and the forward index returning
+// the fragmentation before and after. Searches wait for the compaction to finish.
+func (l *LSH) Compact() (stats.CompactionReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var report stats.CompactionReport
+	var err error
+	if report.Before, err = l.fragmentation(); err != nil {
+		return report, err
+	}
+	before := l.memoryUsage()
+	for _, t := range l.Tables {
+		if err := t.Compact(); err != nil {
+			return report, err
+		}
+	}
+	l.Docs.Compact()
+	if report.After, err = l.fragmentation(); err != nil {
+		return report, err
+	}
+	if after := l.memoryUsage(); after < before {
+		report.BytesReclaimed = before - after
+	}
+	return report, nil
+}
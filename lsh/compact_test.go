@@ -0,0 +1,70 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/bitmap"
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestCompact(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 2
+	cfg.NumDocShards = 1
+	cfg.VectorArenaSize = 300
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numDocs := 1000
+	for i := 0; i < numDocs; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < numDocs/2; i++ {
+		if err := lsh.Delete(uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an emptied bucket left behind
+	for rowIndex := range lsh.Tables[0].Table {
+		lsh.Tables[0].Table[rowIndex][1<<15] = bitmap.New()
+	}
+
+	before, err := lsh.Fragmentation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.EmptyBuckets != 1 {
+		t.Errorf("expected %d empty buckets, but got %d", 1, before.EmptyBuckets)
+	}
+	if before.BitmapUIDs != uint64(numDocs) {
+		t.Errorf("expected %d uids across the bitmaps, but got %d", numDocs, before.BitmapUIDs)
+	}
+	if before.TombstoneRatio != 0.5 {
+		t.Errorf("expected tombstone ratio of %.2f, but got %.2f", 0.5, before.TombstoneRatio)
+	}
+
+	report, err := lsh.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Before != before {
+		t.Errorf("expected %v, but got %v", before, report.Before)
+	}
+	after := report.After
+	if after.EmptyBuckets != 0 || after.ArenaGarbage != 0 || after.TombstoneRatio != 0 {
+		t.Errorf("expected no empty buckets or arena garbage after compacting, but got %v", after)
+	}
+	if after.BytesPerUID >= before.BytesPerUID {
+		t.Errorf("expected fewer bytes per uid than %.2f, but got %.2f", before.BytesPerUID, after.BytesPerUID)
+	}
+	if report.BytesReclaimed == 0 {
+		t.Errorf("expected compaction to reclaim bytes")
+	}
+	if stats, err := lsh.Stats(); err != nil || stats.Fragmentation != after {
+		t.Errorf("expected %v, but got %v", after, stats.Fragmentation)
+	}
+}
@@ -0,0 +1,66 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestContext(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lsh.IndexContext(cancelled, document.NewSimple(1, 0, []float64{0, 1, 2})); err != context.Canceled {
+		t.Errorf("expected %v, but got %v", context.Canceled, err)
+	}
+	if err := lsh.IndexBatchContext(cancelled, []document.Document{document.NewSimple(1, 0, []float64{0, 1, 2})}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, but got %v", context.Canceled, err)
+	}
+	if n := lsh.Docs.Size(); n != 1 {
+		t.Errorf("expected nothing indexed after cancellation leaving %d documents, but got %d", 1, n)
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	if _, _, err := lsh.SearchContext(cancelled, query, nil); err != context.Canceled {
+		t.Errorf("expected %v, but got %v", context.Canceled, err)
+	}
+	if _, err := lsh.CountContext(cancelled, query, nil); err != context.Canceled {
+		t.Errorf("expected %v, but got %v", context.Canceled, err)
+	}
+	res, err := lsh.SearchBatchContext(cancelled, []document.Document{query, query}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, but got %v", context.Canceled, err)
+	}
+	for i, scores := range res {
+		if scores != nil {
+			t.Errorf("expected no scores for query %d, but got %v", i, scores)
+		}
+	}
+
+	// a search waiting indefinitely for a slot gives up at the deadline
+	cfg.MaxConcurrentSearches = 1
+	lsh, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.admit.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := lsh.SearchContext(ctx, query, nil); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+}
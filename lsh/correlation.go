@@ -0,0 +1,60 @@
+package lsh
+
+import "math"
+
+// queryMoments holds the moments of a search query computed once so that scoring each candidate only
+// passes over the candidate rather than recomputing the mean and deviation of the query every time
+type queryMoments struct {
+	vec      []float64
+	centered []float64 // query minus its mean, nil if the query has missing samples
+	norm     float64   // square root of the summed squared deviations of the query
+}
+
+func newQueryMoments(x []float64) queryMoments {
+	q := queryMoments{vec: x}
+	var mean float64
+	for _, v := range x {
+		if math.IsNaN(v) {
+			return q
+		}
+		mean += v
+	}
+	mean /= float64(len(x))
+
+	q.centered = make([]float64, len(x))
+	var ss float64
+	for i, v := range x {
+		d := v - mean
+		q.centered[i] = d
+		ss += d * d
+	}
+	q.norm = math.Sqrt(ss)
+	return q
+}
+
+// correlation returns the Pearson correlation of the query with the candidate over the samples present
+// in both. Returns false if fewer than minOverlap samples are present in both.
+func (q queryMoments) correlation(y []float64, minOverlap int) (float64, bool) {
+	if q.centered == nil || len(y) != len(q.centered) {
+		return maskedCorrelation(q.vec, y, minOverlap)
+	}
+	var mean float64
+	for _, v := range y {
+		if math.IsNaN(v) {
+			return maskedCorrelation(q.vec, y, minOverlap)
+		}
+		mean += v
+	}
+	mean /= float64(len(y))
+
+	// the deviations of the query sum to zero so only the candidate needs centering
+	var cov, ss float64
+	for i, v := range y {
+		d := v - mean
+		cov += q.centered[i] * d
+		ss += d * d
+	}
+	// rounding may push perfectly correlated vectors just past the bounds
+	r := cov / (q.norm * math.Sqrt(ss))
+	return math.Max(-1, math.Min(1, r)), len(y) >= minOverlap
+}
@@ -0,0 +1,79 @@
+package lsh
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestQueryMomentsCorrelation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vec := func(n int) []float64 {
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+	x := vec(60)
+	withMissing := vec(60)
+	withMissing[3] = math.NaN()
+
+	testData := []struct {
+		x, y []float64
+		ok   bool
+	}{
+		{x, x, true},
+		{x, vec(60), true},
+		{x, withMissing, true},
+		{withMissing, x, true},
+		{x, make([]float64, 60), true},
+		{[]float64{1, 2, 3}, []float64{math.NaN(), math.NaN(), 1}, false},
+	}
+	for i, td := range testData {
+		// compared with gonum over the samples present in both
+		expected, _ := maskedCorrelation(td.x, td.y, minCorrelationOverlap)
+		score, ok := newQueryMoments(td.x).correlation(td.y, minCorrelationOverlap)
+		if ok != td.ok {
+			t.Errorf("expected %t, but got %t for case %d", td.ok, ok, i)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.IsNaN(expected) != math.IsNaN(score) || (!math.IsNaN(expected) && math.Abs(expected-score) > 1e-12) {
+			t.Errorf("expected %v, but got %v for case %d", expected, score, i)
+		}
+	}
+}
+
+func BenchmarkQueryMomentsCorrelation(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	x := make([]float64, 60)
+	ys := make([][]float64, 1000)
+	for i := range x {
+		x[i] = rng.NormFloat64()
+	}
+	for i := range ys {
+		ys[i] = make([]float64, len(x))
+		for j := range ys[i] {
+			ys[i][j] = rng.NormFloat64()
+		}
+	}
+
+	b.Run("moments", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			q := newQueryMoments(x)
+			for _, y := range ys {
+				q.correlation(y, minCorrelationOverlap)
+			}
+		}
+	})
+	b.Run("masked", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, y := range ys {
+				maskedCorrelation(x, y, minCorrelationOverlap)
+			}
+		}
+	})
+}
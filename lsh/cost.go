@@ -0,0 +1,141 @@
+package lsh
+
+import (
+	"math"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/stats"
+	"github.com/aouyang1/go-lsh/tables"
+	"gonum.org/v1/gonum/floats"
+)
+
+// costSteps is the number of angles the collision probability is integrated over
+const costSteps = 1000
+
+// EstimateCandidates predicts the number of candidates a search pass of one sign produces over a corpus
+// of numDocs documents at the threshold. Stored vectors are modeled at uniformly distributed angles to
+// the query and collide with it in a table with the probability of falling on the same side of every
+// hyperplane.
+func (l *LSH) EstimateCandidates(numDocs int, threshold float64) stats.CandidateEstimate {
+	return estimateCandidates(numDocs, threshold, l.Tables)
+}
+
+func estimateCandidates(numDocs int, threshold float64, tbls []*tables.Table) stats.CandidateEstimate {
+	maxAngle := math.Acos(threshold)
+	var all, matches float64
+	step := math.Pi / costSteps
+	for i := 0; i < costSteps; i++ {
+		angle := (float64(i) + 0.5) * step
+		p := collision(angle, tbls) * step / math.Pi
+		all += p
+		if angle <= maxAngle {
+			matches += p
+		}
+	}
+
+	n := float64(numDocs)
+	return stats.CandidateEstimate{
+		Threshold:          threshold,
+		ExpectedCandidates: n * all,
+		ExpectedMatches:    n * matches,
+		CollisionRate:      all,
+	}
+}
+
+// collision returns the probability a vector at the angle to the query collides with it in any table
+func collision(angle float64, tbls []*tables.Table) float64 {
+	psame := 1 - angle/math.Pi
+	miss := 1.0
+	for _, t := range tbls {
+		miss *= 1 - math.Pow(psame, float64(t.Family.Bits()))
+	}
+	return 1 - miss
+}
+
+// SearchEstimate is the cost of a search computed from the buckets it would probe without scoring
+type SearchEstimate struct {
+	Probes       []tables.Probe `json:"probes"`
+	TablesProbed int            `json:"tables_probed"`
+
+	// Candidates sums the cardinalities of the probed buckets. Uids colliding in several tables or with
+	// both signs are counted once per bucket making it an upper bound on the uids filtered.
+	Candidates uint64 `json:"candidates"`
+}
+
+// EstimateSearch returns the buckets Search would probe for the query along with their summed
+// cardinality so expensive queries can be rejected or reshaped before running them. Nothing is scored
+// and the table statistics used to rank tables are left untouched. Access control labels are not
+// applied.
+func (l *LSH) EstimateSearch(d document.Document, s *options.Search) (SearchEstimate, error) {
+	var est SearchEstimate
+	if s == nil {
+		s = options.NewDefaultSearch()
+	} else {
+		if err := s.Validate(); err != nil {
+			return est, err
+		}
+	}
+	query, vec, err := l.prepareQuery(d, s)
+	if err != nil {
+		return est, err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	tbls := l.rankedForSearch(s)
+	q := document.NewSimple(query.GetUID(), query.GetIndex(), vec)
+	if s.SignFilter == options.SignFilter_ANY || s.SignFilter == options.SignFilter_POS {
+		if err := l.estimateSign(q, s, tbls, &est); err != nil {
+			return est, err
+		}
+	}
+	if s.SignFilter == options.SignFilter_ANY || s.SignFilter == options.SignFilter_NEG {
+		neg := make([]float64, len(vec))
+		floats.ScaleTo(neg, -1, vec)
+		if err := l.estimateSign(document.NewSimple(query.GetUID(), query.GetIndex(), neg), s, tbls, &est); err != nil {
+			return est, err
+		}
+	}
+	return est, nil
+}
+
+// estimateSign adds the buckets probed by a search pass of one sign falling back to the remaining
+// tables like filterDocsByLag when the first tables hold too few candidates
+func (l *LSH) estimateSign(d document.Document, s *options.Search, tbls []*tables.Table, est *SearchEstimate) error {
+	first, limit := probeLimits(s, len(tbls))
+	var candidates uint64
+	probed := first
+	for i, t := range tbls[:limit] {
+		if i == first {
+			if candidates >= uint64(s.NumToReturn) {
+				break
+			}
+			probed = limit
+		}
+		probes, err := probe(t, d, s)
+		if err != nil {
+			return err
+		}
+		for _, p := range probes {
+			est.Probes = append(est.Probes, p)
+			candidates += p.Cardinality
+		}
+	}
+	est.Candidates += candidates
+	if probed > est.TablesProbed {
+		est.TablesProbed = probed
+	}
+	return nil
+}
+
+// probe returns the buckets of the table read by a search
+func probe(t *tables.Table, d document.Document, s *options.Search) ([]tables.Probe, error) {
+	switch {
+	case s.AlignmentFree:
+		return t.ProbeAll(d)
+	case s.TimeRange != nil:
+		return t.ProbeRange(d, s.TimeRange.Start, s.TimeRange.End)
+	default:
+		return t.Probe(d, s.MaxLag)
+	}
+}
@@ -0,0 +1,117 @@
+package lsh
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestEstimateCandidates(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 1
+	cfg.NumHyperplanes = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single hyperplane splits uniformly distributed vectors in half
+	est := lsh.EstimateCandidates(1000, 0)
+	if math.Abs(est.ExpectedCandidates-500) > 1 {
+		t.Errorf("expected %v candidates, but got %v", 500, est.ExpectedCandidates)
+	}
+	// vectors within 90 degrees collide with probability 1 - angle/pi averaging 3/4 of the half
+	if math.Abs(est.ExpectedMatches-375) > 1 {
+		t.Errorf("expected %v matches, but got %v", 375, est.ExpectedMatches)
+	}
+
+	cfg = configs.NewDefaultLSHConfigs()
+	lsh, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, high := lsh.EstimateCandidates(1000, 0.6), lsh.EstimateCandidates(1000, 0.9)
+	if low.ExpectedCandidates != high.ExpectedCandidates {
+		t.Errorf("expected candidates independent of the threshold, but got %v and %v", low.ExpectedCandidates, high.ExpectedCandidates)
+	}
+	if high.ExpectedMatches >= low.ExpectedMatches {
+		t.Errorf("expected fewer matches at a higher threshold, but got %v and %v", high.ExpectedMatches, low.ExpectedMatches)
+	}
+	if double := lsh.EstimateCandidates(2000, 0.6); math.Abs(double.ExpectedCandidates-2*low.ExpectedCandidates) > 1e-9 {
+		t.Errorf("expected candidates to scale with the corpus, but got %v and %v", double.ExpectedCandidates, low.ExpectedCandidates)
+	}
+
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	s, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.CandidateEstimates) != len(s.FalseNegativeErrors) {
+		t.Fatalf("expected %d candidate estimates, but got %d", len(s.FalseNegativeErrors), len(s.CandidateEstimates))
+	}
+	for i, e := range s.CandidateEstimates {
+		if e.Threshold != s.FalseNegativeErrors[i].Threshold {
+			t.Errorf("expected threshold %v, but got %v", s.FalseNegativeErrors[i].Threshold, e.Threshold)
+		}
+		if e.ExpectedCandidates <= 0 || e.ExpectedCandidates > 1 {
+			t.Errorf("expected between 0 and 1 candidates for a single document, but got %v", e.ExpectedCandidates)
+		}
+	}
+}
+
+func TestEstimateSearch(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 1
+	cfg.NumHyperplanes = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{1, 3, 0}),
+		document.NewSimple(2, 0, []float64{3, 1, 0}),
+		document.NewSimple(3, 0, []float64{0, 3, 1}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	est, err := lsh.EstimateSearch(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(lsh.Tables[0].HitRate(), 1) {
+		t.Errorf("expected estimating not to count as a filter of the table, but got hit rate %v", lsh.Tables[0].HitRate())
+	}
+	if len(est.Probes) != 1 || est.TablesProbed != 1 {
+		t.Fatalf("expected a single bucket of a single table to be probed, but got %+v", est)
+	}
+	_, diag, err := lsh.SearchWithDiagnostics(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Candidates != uint64(diag.NumCandidates) {
+		t.Errorf("expected %d candidates, but got %d", diag.NumCandidates, est.Candidates)
+	}
+
+	// both signs probe both buckets of the single hyperplane
+	so.SignFilter = options.SignFilter_ANY
+	est, err = lsh.EstimateSearch(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Candidates != uint64(len(docs)) {
+		t.Errorf("expected %d candidates, but got %d", len(docs), est.Candidates)
+	}
+}
@@ -0,0 +1,89 @@
+package lsh
+
+import (
+	"sync/atomic"
+
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+// counters tracks cumulative totals of operations performed on the index
+type counters struct {
+	indexed    atomic.Uint64
+	deleted    atomic.Uint64
+	evicted    atomic.Uint64
+	searches   atomic.Uint64
+	candidates atomic.Uint64
+
+	lengthAdjusted atomic.Uint64
+
+	candidateSizes sizeHistogram
+	scoredSizes    sizeHistogram
+}
+
+// numSizeBuckets is the number of power of two buckets of a sizeHistogram, the last bounding sizes up
+// to about a million
+const numSizeBuckets = 21
+
+// sizeHistogram counts per query sizes in power of two buckets
+type sizeHistogram struct {
+	buckets [numSizeBuckets]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Uint64
+}
+
+func (h *sizeHistogram) observe(n int) {
+	h.count.Add(1)
+	h.sum.Add(uint64(n))
+	for i := range h.buckets {
+		if uint64(n) <= 1<<i {
+			h.buckets[i].Add(1)
+			return
+		}
+	}
+}
+
+func (h *sizeHistogram) snapshot() stats.SizeHistogram {
+	s := stats.SizeHistogram{
+		Buckets: make([]stats.SizeBucket, numSizeBuckets),
+		Count:   h.count.Load(),
+		Sum:     h.sum.Load(),
+	}
+	var cumulative uint64
+	for i := range h.buckets {
+		cumulative += h.buckets[i].Load()
+		s.Buckets[i] = stats.SizeBucket{UpperBound: 1 << i, Count: cumulative}
+	}
+	return s
+}
+
+func (c *counters) snapshot() stats.Counters {
+	return stats.Counters{
+		TotalIndexed:    c.indexed.Load(),
+		TotalDeleted:    c.deleted.Load(),
+		TotalEvicted:    c.evicted.Load(),
+		TotalSearches:   c.searches.Load(),
+		TotalCandidates: c.candidates.Load(),
+
+		TotalLengthAdjusted: c.lengthAdjusted.Load(),
+	}
+}
+
+func (c *counters) restore(s stats.Counters) {
+	c.indexed.Store(s.TotalIndexed)
+	c.deleted.Store(s.TotalDeleted)
+	c.evicted.Store(s.TotalEvicted)
+	c.searches.Store(s.TotalSearches)
+	c.candidates.Store(s.TotalCandidates)
+	c.lengthAdjusted.Store(s.TotalLengthAdjusted)
+}
+
+// Counters returns the cumulative operation counters of the index
+func (l *LSH) Counters() stats.Counters {
+	return l.counters.snapshot()
+}
+
+// RestoreCounters sets the cumulative operation counters, used when restoring an index from a
+// snapshot so capacity trends survive restarts
+func (l *LSH) RestoreCounters(c stats.Counters) {
+	l.counters.restore(c)
+}
@@ -0,0 +1,67 @@
+package lsh
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+func TestCounters(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 0, 5}),
+		document.NewSimple(1, 0, []float64{0, 0.1, 3}),
+		document.NewSimple(2, 0, []float64{0, 0.1, 2}),
+		document.NewSimple(3, 0, []float64{0, 0.1, 1}),
+		document.NewSimple(4, 0, []float64{0, -0.1, -4}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Delete(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 0, 5}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Counters
+	if c.TotalIndexed != 5 || c.TotalDeleted != 1 || c.TotalSearches != 1 || c.TotalCandidates == 0 {
+		t.Fatalf("expected %d indexed, %d deleted and %d search with candidates, but got %+v", 5, 1, 1, c)
+	}
+
+	// counters are carried in snapshots rather than counted again from the restored documents
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Counters(); got != c {
+		t.Fatalf("expected %+v, but got %+v counters", c, got)
+	}
+
+	lsh.RestoreCounters(stats.Counters{TotalIndexed: 100})
+	if got := lsh.Counters(); got.TotalIndexed != 100 || got.TotalSearches != 0 {
+		t.Fatalf("expected restored counters, but got %+v", got)
+	}
+}
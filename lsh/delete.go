@@ -0,0 +1,104 @@
+package lsh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+// DeleteReport describes what deleting a uid removed from the index
+type DeleteReport struct {
+	TablesAffected int
+	BucketsEmptied int
+	BytesFreed     uint64 // estimated bytes of the tables and forward index
+}
+
+// NotStoredError lists the uids of a batch that were not stored in the index
+type NotStoredError struct {
+	UIDs []uint64
+}
+
+func (e *NotStoredError) Error() string {
+	return fmt.Sprintf("%d document ids are not stored, %v", len(e.UIDs), e.UIDs)
+}
+
+func (e *NotStoredError) Unwrap() error {
+	return lsherrors.DocumentNotStored
+}
+
+// DeleteBatch removes the uids from the tables and the document map grouping the bucket removals of
+// each table so every bucket is visited once. The uids that are stored are deleted even if some are
+// not, which are reported in a NotStoredError.
+func (l *LSH) DeleteBatch(uids []uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	windows := make(map[uint64][]int64, len(uids))
+	for _, uid := range uids {
+		windows[uid] = l.Tables[0].Timestamps.Get(uid)
+	}
+	var notStored []uint64
+	for i, t := range l.Tables {
+		missing, err := t.DeleteBatch(uids)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			notStored = missing
+		}
+	}
+	if l.shadow != nil {
+		for _, t := range l.shadow.lsh.Tables {
+			if _, err := t.DeleteBatch(uids); err != nil {
+				return err
+			}
+		}
+	}
+
+	missing := make(map[uint64]struct{}, len(notStored))
+	for _, uid := range notStored {
+		missing[uid] = struct{}{}
+	}
+	for _, uid := range uids {
+		if err := l.Docs.Delete(uid); err != nil {
+			return err
+		}
+		l.acl.delete(uid)
+		if _, exists := missing[uid]; exists {
+			continue
+		}
+		l.rows.remove(l.rowStarts(windows[uid]), time.Now())
+		l.checksums.delete(uid)
+		l.counters.deleted.Add(1)
+		if err := l.capture(cdc.Mutation{Op: cdc.OpDelete, UID: uid}); err != nil {
+			return err
+		}
+	}
+	if len(notStored) > 0 {
+		return &NotStoredError{UIDs: notStored}
+	}
+	return nil
+}
+
+// DeleteWhere removes every document the predicate returns true for returning the number deleted.
+// Documents indexed while the predicate is evaluated are not considered.
+func (l *LSH) DeleteWhere(pred func(d document.Document) bool) (int, error) {
+	var uids []uint64
+	l.mu.RLock()
+	l.Docs.Range(func(d document.Document) bool {
+		if pred(d) {
+			uids = append(uids, d.GetUID())
+		}
+		return true
+	})
+	l.mu.RUnlock()
+	if len(uids) == 0 {
+		return 0, nil
+	}
+	return len(uids), l.DeleteBatch(uids)
+}
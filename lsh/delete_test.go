@@ -0,0 +1,101 @@
+package lsh
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+func TestDeleteBatch(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vecs := [][]float64{{0, 1, 3}, {1, 3, 3}, {3, 3, 0}, {1, 2, 3}, {3, 0, 1}}
+	for uid, vec := range vecs {
+		if err := lsh.Index(document.NewSimple(uint64(uid), int64(uid)*cfg.SamplePeriod, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = lsh.DeleteBatch([]uint64{0, 1, 7, 9})
+	var notStored *NotStoredError
+	if !errors.As(err, &notStored) || !errors.Is(err, lsherrors.DocumentNotStored) {
+		t.Fatalf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+	if err := compareUint64s([]uint64{7, 9}, notStored.UIDs); err != nil {
+		t.Fatal(err)
+	}
+	if lsh.Docs.Size() != 3 {
+		t.Fatalf("expected %d documents, but got %d", 3, lsh.Docs.Size())
+	}
+	if c := lsh.Counters(); c.TotalDeleted != 2 {
+		t.Errorf("expected %d deleted, but got %d", 2, c.TotalDeleted)
+	}
+
+	// documents indexed at later timestamps
+	n, err := lsh.DeleteWhere(func(d document.Document) bool {
+		return d.GetIndex() >= 3*cfg.SamplePeriod
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected %d deleted, but got %d", 2, n)
+	}
+	if _, exists := lsh.Docs.Exists(2); !exists || lsh.Docs.Size() != 1 {
+		t.Errorf("expected only uid 2 to remain")
+	}
+	for _, tbl := range lsh.Tables {
+		if len(tbl.Doc2Hash) != 1 {
+			t.Fatalf("expected %d uid in table %s, but got %d", 1, tbl.Name, len(tbl.Doc2Hash))
+		}
+	}
+}
+
+func TestDeleteWithReport(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	used := lsh.MemoryUsage()
+
+	report, err := lsh.DeleteWithReport(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the only document leaves every bucket it was in empty
+	if report.TablesAffected != 4 || report.BucketsEmptied != 4 {
+		t.Errorf("expected 4 tables and buckets affected, but got %+v", report)
+	}
+	if report.BytesFreed != used {
+		t.Errorf("expected %d bytes freed, but got %d", used, report.BytesFreed)
+	}
+
+	if _, err := lsh.DeleteWithReport(0); err != lsherrors.DocumentNotStored {
+		t.Fatalf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+
+	// a uid missing from some tables reports each inconsistency
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	delete(lsh.Tables[1].Doc2Hash, 1)
+	delete(lsh.Tables[2].Doc2Hash, 1)
+	report, err = lsh.DeleteWithReport(1)
+	if !errors.Is(err, lsherrors.DocumentNotStored) {
+		t.Fatalf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+	if report.TablesAffected != 2 {
+		t.Errorf("expected %d tables affected, but got %d", 2, report.TablesAffected)
+	}
+}
@@ -0,0 +1,89 @@
+package lsh
+
+import (
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+// DryRunReport describes where a document would be indexed and what it would cost
+type DryRunReport struct {
+	Placements []tables.Placement `json:"placements"`
+	NewBuckets int                `json:"new_buckets"`
+	TableBytes uint64             `json:"table_bytes"` // estimated growth of the tables
+	DocBytes   uint64             `json:"doc_bytes"`   // estimated growth of the forward index
+
+	// ExceedsLimits is set when indexing the document would exceed MaxDocs or MemoryBudget which evicts
+	// documents under an eviction policy and is refused otherwise
+	ExceedsLimits bool `json:"exceeds_limits"`
+}
+
+// IndexDryRun returns the buckets of every table the document would be indexed into along with the
+// estimated marginal memory cost without modifying the index. The document is checked like Index.
+func (l *LSH) IndexDryRun(d document.Document) (DryRunReport, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var report DryRunReport
+	if err := l.validate(d); err != nil {
+		return report, err
+	}
+	d, err := l.enriched(d)
+	if err != nil {
+		return report, err
+	}
+	fitted, _ := l.fitLength(d)
+	hashed, err := l.atSamplePeriod(fitted)
+	if err != nil {
+		return report, err
+	}
+	vec := make([]float64, len(hashed.GetVector()))
+	copy(vec, hashed.GetVector())
+	uid, index := hashed.GetUID(), hashed.GetIndex()
+	if err := l.checkDuplicate(uid, index, windowChecksum(vec)); err != nil && err != errDuplicateIgnored {
+		return report, err
+	}
+	if err := l.checkComplexity(vec); err != nil {
+		return report, err
+	}
+	hashed = document.NewSimple(uid, index, l.reduce(l.Cfg.TFunc(vec)))
+
+	report.Placements = make([]tables.Placement, 0, len(l.Tables))
+	for _, t := range l.Tables {
+		p, err := t.Place(hashed)
+		if err != nil {
+			return report, err
+		}
+		if p.NewBucket {
+			report.NewBuckets++
+		}
+		report.TableBytes += p.EstimatedBytes
+		report.Placements = append(report.Placements, p)
+	}
+	report.DocBytes = l.docGrowth(fitted)
+
+	if _, exists := l.Docs.Exists(uid); !exists && l.Cfg.MaxDocs > 0 && l.Docs.Size() >= l.Cfg.MaxDocs {
+		report.ExceedsLimits = true
+	}
+	if l.Cfg.MemoryBudget > 0 && l.memoryUsage()+report.TableBytes+report.DocBytes >= l.Cfg.MemoryBudget {
+		report.ExceedsLimits = true
+	}
+	return report, nil
+}
+
+// docGrowth estimates the bytes the forward index would grow by storing the document. Windows of a
+// stored uid only grow its vector by the samples past its end.
+func (l *LSH) docGrowth(d document.Document) uint64 {
+	stored, exists := l.Docs.Exists(d.GetUID())
+	if !exists {
+		return uint64(len(d.GetVector())) * 8 // float64 values
+	}
+	period := document.SamplePeriod(stored, l.Cfg.SamplePeriod)
+	offset := (d.GetIndex() - stored.GetIndex()) / period
+	if offset <= 0 {
+		return 0
+	}
+	samples := int64(len(d.GetVector())) * document.SamplePeriod(d, period) / period
+	if grown := offset + samples - int64(len(stored.GetVector())); grown > 0 {
+		return uint64(grown) * 8
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestIndexDryRun(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	cfg.MaxDocs = 2
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	usage := lsh.MemoryUsage()
+
+	// the same shape lands in the buckets of the stored document
+	report, err := lsh.IndexDryRun(document.NewSimple(2, 0, []float64{0, 2, 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Placements) != cfg.NumTables || report.NewBuckets != 0 || report.ExceedsLimits {
+		t.Fatalf("expected placements in the existing buckets, but got %+v", report)
+	}
+	for _, p := range report.Placements {
+		if p.BucketSize != 1 {
+			t.Errorf("expected bucket of 1 uid, but got %+v", p)
+		}
+	}
+	if report.DocBytes != 3*8 || report.TableBytes == 0 {
+		t.Errorf("expected growth of the tables and 24 document bytes, but got %+v", report)
+	}
+	if lsh.Docs.Size() != 1 || lsh.MemoryUsage() != usage {
+		t.Fatalf("expected the index to be unchanged by the dry run")
+	}
+
+	// the next window of the stored uid only grows its vector by one sample
+	report, err = lsh.IndexDryRun(document.NewSimple(1, 60, []float64{1, 3, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DocBytes != 8 {
+		t.Errorf("expected %d document bytes, but got %d", 8, report.DocBytes)
+	}
+
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{0, 2, 6})); err != nil {
+		t.Fatal(err)
+	}
+	report, err = lsh.IndexDryRun(document.NewSimple(3, 0, []float64{3, 1, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.ExceedsLimits {
+		t.Errorf("expected max docs to be exceeded, but got %+v", report)
+	}
+
+	if _, err := lsh.IndexDryRun(document.NewSimple(3, 0, []float64{3, 3, 3})); err != ErrNoVectorComplexity {
+		t.Errorf("expected %v, but got %v", ErrNoVectorComplexity, err)
+	}
+}
@@ -0,0 +1,438 @@
+package lsh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/wal"
+)
+
+var (
+	ErrPersisted    = errors.New("index is already persisted to a directory")
+	ErrNotPersisted = errors.New("index is not persisted to a directory")
+	ErrNoSnapshot   = errors.New("no full snapshot found in the persistence directory")
+
+	// ErrNotDurable is returned by a mutation of a persisted index applied to the index but not written
+	// to the write-ahead log, so it is lost if the index is recovered
+	ErrNotDurable = errors.New("mutation applied but not written to the write-ahead log")
+	// ErrCheckpointFailed is returned by a mutation of a persisted index applied and written to the
+	// write-ahead log when the checkpoint it triggered failed. The checkpoint is attempted again by the
+	// next mutation.
+	ErrCheckpointFailed = errors.New("mutation applied and logged but the checkpoint failed")
+)
+
+// defaultFullEvery is the number of incremental snapshots written between full snapshots if unset
+const defaultFullEvery = 8
+
+// Files of a persistence directory
+const (
+	configFile     = "config.json"
+	walDir         = "wal"
+	fullPrefix     = "full-"
+	incrPrefix     = "incr-"
+	snapshotSuffix = ".snap"
+)
+
+// PersistOptions configure the snapshots and write-ahead log of a persisted index
+type PersistOptions struct {
+	Snapshot snapshot.Options
+	WAL      wal.Options
+
+	// FullEvery is the number of incremental snapshots written by checkpoints before the next
+	// checkpoint writes a full snapshot bounding the snapshots read on recovery. 0 uses 8.
+	FullEvery int
+
+	// CheckpointEvery checkpoints automatically after the given number of mutations. 0 leaves
+	// checkpointing to the caller.
+	CheckpointEvery int
+}
+
+// durable appends every mutation to the write-ahead log and tracks the uids changed since the last
+// checkpoint
+type durable struct {
+	mu         sync.Mutex
+	dir        string
+	opts       PersistOptions
+	log        *wal.Log
+	dirty      map[uint64]struct{} // uids indexed or deleted since the last checkpoint
+	pending    int                 // mutations since the last checkpoint
+	increments int                 // incremental snapshots since the last full snapshot
+	replaying  bool                // mutations are read from the log rather than appended
+}
+
+// Persist writes the configuration and a full snapshot of the index to dir and appends every following
+// mutation to a write-ahead log so the index can be recovered with Recover after a crash up to the last
+// mutation applied. Checkpoint bounds the log by writing snapshots of the documents changed since the
+// previous checkpoint. Mutations are applied before they are logged so a failure to log them is
+// reported with ErrNotDurable.
+func (l *LSH) Persist(dir string, opts PersistOptions) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.durable != nil {
+		return ErrPersisted
+	}
+	if _, err := os.Stat(filepath.Join(dir, configFile)); err == nil {
+		return fmt.Errorf("%w, %s", ErrPersisted, dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	d := &durable{dir: dir, opts: opts, dirty: make(map[uint64]struct{})}
+	if err := d.writeFull(l); err != nil {
+		return err
+	}
+	// the configuration marks the directory as recoverable once the snapshot is in place
+	cfg, err := json.MarshalIndent(l.Cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, configFile), func(w io.Writer) error {
+		_, err := w.Write(cfg)
+		return err
+	}); err != nil {
+		return err
+	}
+	if d.log, err = wal.Open(filepath.Join(dir, walDir), opts.WAL); err != nil {
+		return err
+	}
+	l.durable = d
+	return nil
+}
+
+// Recover restores an index persisted to dir from its latest full snapshot, the incremental snapshots
+// written after it and the mutations of the write-ahead log. The recovered index keeps appending to the
+// log. Validator and Hooks are not persisted and need to be set again.
+func Recover(dir string) (*LSH, error) {
+	return RecoverWithOptions(dir, PersistOptions{})
+}
+
+// RecoverWithOptions recovers like Recover with the options the index was persisted with
+func RecoverWithOptions(dir string, opts PersistOptions) (*LSH, error) {
+	cfg, err := configs.FromFile(filepath.Join(dir, configFile))
+	if err != nil {
+		return nil, err
+	}
+	l, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	full, incrs, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	if full == nil {
+		return nil, fmt.Errorf("%w, %s", ErrNoSnapshot, dir)
+	}
+	if err := readFile(full.path, func(r io.Reader) error {
+		return l.Load(r, opts.Snapshot)
+	}); err != nil {
+		return nil, err
+	}
+	for _, incr := range incrs {
+		if err := readFile(incr.path, func(r io.Reader) error {
+			sr, err := snapshot.NewReader(r, opts.Snapshot)
+			if err != nil {
+				return err
+			}
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			return l.loadSections(sr, true)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &durable{dir: dir, opts: opts, dirty: make(map[uint64]struct{}), increments: len(incrs)}
+	// repair a torn record ahead of replaying so the log ends at the last intact mutation
+	if d.log, err = wal.Open(filepath.Join(dir, walDir), opts.WAL); err != nil {
+		return nil, err
+	}
+	src, err := wal.NewReader(filepath.Join(dir, walDir), opts.WAL)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	d.replaying = true
+	l.durable = d
+	if _, err := NewStandby(l, src).CatchUp(); err != nil {
+		d.log.Close()
+		return nil, err
+	}
+	d.replaying = false
+	return l, nil
+}
+
+// Checkpoint writes a snapshot of the documents indexed or deleted since the last checkpoint, or a full
+// snapshot every FullEvery checkpoints, and removes the write-ahead log segments it covers. Mutations
+// wait for the checkpoint to be written.
+func (l *LSH) Checkpoint() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	d := l.durable
+	if d == nil {
+		return ErrNotPersisted
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.checkpoint(l)
+}
+
+// Close closes the write-ahead log of a persisted index
+func (l *LSH) Close() error {
+	if l.durable == nil {
+		return nil
+	}
+	return l.durable.log.Close()
+}
+
+// capture assigns the next sequence number to the mutation and appends it to the log. The log is
+// locked while assigning so mutations are appended in sequence. Errors are reported with ErrNotDurable
+// or ErrCheckpointFailed since the mutation is already applied.
+func (d *durable) capture(l *LSH, m cdc.Mutation) (cdc.Mutation, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m.Seq = l.seq.Add(1)
+	d.dirty[m.UID] = struct{}{}
+	d.pending++
+	if d.replaying {
+		return m, nil
+	}
+	m.Time = time.Now()
+	if err := d.log.Write(m); err != nil {
+		return m, fmt.Errorf("%w, %w", ErrNotDurable, err)
+	}
+	if d.opts.CheckpointEvery > 0 && d.pending >= d.opts.CheckpointEvery {
+		if err := d.checkpoint(l); err != nil {
+			return m, fmt.Errorf("%w, %w", ErrCheckpointFailed, err)
+		}
+	}
+	return m, nil
+}
+
+func (d *durable) checkpoint(l *LSH) error {
+	if d.pending == 0 {
+		return nil
+	}
+	fullEvery := d.opts.FullEvery
+	if fullEvery <= 0 {
+		fullEvery = defaultFullEvery
+	}
+	seq := l.seq.Load()
+	if d.increments >= fullEvery {
+		if err := d.writeFull(l); err != nil {
+			return err
+		}
+	} else {
+		if err := writeFile(d.snapshotPath(incrPrefix, seq), func(w io.Writer) error {
+			return l.saveIncrement(w, d.dirty, d.opts.Snapshot)
+		}); err != nil {
+			return err
+		}
+		d.increments++
+	}
+	d.dirty = make(map[uint64]struct{})
+	d.pending = 0
+
+	if d.log == nil {
+		return nil
+	}
+	if err := d.log.Rotate(); err != nil {
+		return err
+	}
+	return d.log.Truncate(seq)
+}
+
+// writeFull writes a full snapshot removing the snapshots it supersedes
+func (d *durable) writeFull(l *LSH) error {
+	seq := l.seq.Load()
+	if err := writeFile(d.snapshotPath(fullPrefix, seq), func(w io.Writer) error {
+		return l.save(w, d.opts.Snapshot)
+	}); err != nil {
+		return err
+	}
+	d.increments = 0
+
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		prefix, snapSeq, ok := parseSnapshotName(e.Name())
+		if !ok || (prefix == fullPrefix && snapSeq == seq) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(d.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *durable) snapshotPath(prefix string, seq uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%s%020d%s", prefix, seq, snapshotSuffix))
+}
+
+// saveIncrement writes the uids deleted and the documents stored of the uids changed since the previous
+// snapshot
+func (l *LSH) saveIncrement(w io.Writer, uids map[uint64]struct{}, opts snapshot.Options) error {
+	sorted := make([]uint64, 0, len(uids))
+	for uid := range uids {
+		sorted = append(sorted, uid)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var deleted []uint64
+	docs := newDocumentWriter()
+	for _, uid := range sorted {
+		d, exists := l.Docs.Exists(uid)
+		if !exists {
+			deleted = append(deleted, uid)
+			continue
+		}
+		if err := docs.write(d, l.Tables[0].Timestamps.Get(uid)); err != nil {
+			return err
+		}
+	}
+	// a document failing to be read must not be recorded as deleted
+	if err := l.docsErr(); err != nil {
+		return err
+	}
+
+	sw, err := snapshot.NewWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(deleted); err != nil {
+		return err
+	}
+	if err := sw.WriteSection(sectionDeleted, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := docs.writeSections(sw); err != nil {
+		return err
+	}
+	if err := l.writeACL(sw, uids); err != nil {
+		return err
+	}
+	if err := l.writeSequence(sw); err != nil {
+		return err
+	}
+	if err := l.writeCounters(sw); err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+type snapshotFile struct {
+	path string
+	seq  uint64
+}
+
+// listSnapshots returns the latest full snapshot of dir and the incremental snapshots following it in
+// order
+func listSnapshots(dir string) (*snapshotFile, []snapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		full  *snapshotFile
+		incrs []snapshotFile
+	)
+	for _, e := range entries {
+		prefix, seq, ok := parseSnapshotName(e.Name())
+		if !ok {
+			continue
+		}
+		f := snapshotFile{path: filepath.Join(dir, e.Name()), seq: seq}
+		switch prefix {
+		case fullPrefix:
+			if full == nil || seq > full.seq {
+				full = &f
+			}
+		case incrPrefix:
+			incrs = append(incrs, f)
+		}
+	}
+	if full == nil {
+		return nil, nil, nil
+	}
+	following := incrs[:0]
+	for _, f := range incrs {
+		if f.seq > full.seq {
+			following = append(following, f)
+		}
+	}
+	sort.Slice(following, func(i, j int) bool { return following[i].seq < following[j].seq })
+	return full, following, nil
+}
+
+func parseSnapshotName(name string) (string, uint64, bool) {
+	if !strings.HasSuffix(name, snapshotSuffix) {
+		return "", 0, false
+	}
+	for _, prefix := range []string{fullPrefix, incrPrefix} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), snapshotSuffix), 10, 64)
+		if err != nil {
+			return "", 0, false
+		}
+		return prefix, seq, true
+	}
+	return "", 0, false
+}
+
+// writeFile writes to a temporary file renamed over path once synced so a crash never leaves a partial
+// file at path
+func writeFile(path string, fn func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	err = fn(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readFile(path string, fn func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fn(bufio.NewReader(f))
+}
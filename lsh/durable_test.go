@@ -0,0 +1,224 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestRecoverEnrichment(t *testing.T) {
+	configs.RegisterEnrichment("append_last", func(d document.Document) (document.Document, error) {
+		s, ok := d.(*document.Simple)
+		if !ok {
+			return nil, ErrInvalidDocument
+		}
+		s.Vector = append(s.Vector, s.Vector[len(s.Vector)-1])
+		return s, nil
+	})
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 4
+	cfg.Enrichment = "append_last"
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := lsh.Persist(dir, PersistOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// only logged to the write-ahead log so recovering replays the enriched documents
+	vectors := [][]float64{{0, 1, 3}, {3, 1, 0}, {1, 2, 4}}
+	for i, vec := range vectors {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := Recover(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	for uid := range vectors {
+		expected := lsh.Docs.GetVector(uint64(uid), 0)
+		if vec := recovered.Docs.GetVector(uint64(uid), 0); !reflect.DeepEqual(vec, expected) {
+			t.Errorf("expected %v, but got %v for uid %d", expected, vec, uid)
+		}
+	}
+}
+
+func TestPersistRecover(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := [][]float64{{0, 1, 3}, {0, 2, 6}, {3, 1, 0}, {1, 2, 3}, {4, 1, 2}}
+	index := func(uid uint64, idx int64, vec []float64) {
+		t.Helper()
+		if err := lsh.Index(document.NewSimple(uid, idx, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remove := func(uid uint64) {
+		t.Helper()
+		if err := lsh.Delete(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, vec := range vectors {
+		index(uint64(i+1), 0, vec)
+	}
+
+	dir := t.TempDir()
+	opts := PersistOptions{FullEvery: 2}
+	if err := lsh.Persist(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Persist(dir, opts); err != ErrPersisted {
+		t.Errorf("expected %v, but got %v", ErrPersisted, err)
+	}
+
+	index(6, 0, []float64{0, 1, 2})
+	index(1, 60, []float64{3, 4, 5})
+	remove(2)
+	if err := lsh.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	index(7, 0, []float64{2, 1, 3})
+	remove(3)
+	if err := lsh.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// only logged to the write-ahead log
+	index(8, 0, []float64{0, 1, 4})
+	index(1, 120, []float64{6, 7, 8})
+	remove(4)
+
+	// tear a record as a crash mid write would
+	segments, err := filepath.Glob(filepath.Join(dir, walDir, "*.wal"))
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("expected write-ahead log segments, but got %v, %v", segments, err)
+	}
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	recovered, err := RecoverWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.Generation() != lsh.Generation() {
+		t.Errorf("expected generation %d, but got %d", lsh.Generation(), recovered.Generation())
+	}
+	if recovered.Docs.Size() != lsh.Docs.Size() {
+		t.Errorf("expected %d documents, but got %d", lsh.Docs.Size(), recovered.Docs.Size())
+	}
+	for uid := uint64(1); uid <= 8; uid++ {
+		expected, expectedExists := lsh.Docs.Exists(uid)
+		d, exists := recovered.Docs.Exists(uid)
+		if exists != expectedExists {
+			t.Errorf("expected uid %d to exist %t, but got %t", uid, expectedExists, exists)
+			continue
+		}
+		if exists && !reflect.DeepEqual(d.GetVector(), expected.GetVector()) {
+			t.Errorf("expected %v, but got %v for uid %d", expected.GetVector(), d.GetVector(), uid)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.5
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	expected, _, err := lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores, _, err := recovered.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scores, expected) {
+		t.Errorf("expected %v, but got %v", expected, scores)
+	}
+
+	// the recovered index keeps logging and the next checkpoint is a full snapshot
+	lsh = recovered
+	index(9, 0, []float64{5, 1, 0})
+	if err := lsh.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	full, incrs, err := listSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full == nil || full.seq != lsh.Generation() || len(incrs) != 0 {
+		t.Errorf("expected a single full snapshot at %d, but got %+v and %d incremental", lsh.Generation(), full, len(incrs))
+	}
+	if err := lsh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err = Recover(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := recovered.Docs.Exists(9); !exists || recovered.Docs.Size() != lsh.Docs.Size() {
+		t.Errorf("expected %d documents including uid 9, but got %d", lsh.Docs.Size(), recovered.Docs.Size())
+	}
+	recovered.Close()
+}
+
+func TestCaptureNotDurable(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := lsh.Persist(dir, PersistOptions{CheckpointEvery: 2}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	lsh.CDC = cdc.NewJSONWriter(&buf)
+
+	// the checkpoint fails once the directory is gone while the open segment is still logged to
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{3, 1, 0})); !errors.Is(err, ErrCheckpointFailed) {
+		t.Errorf("expected %v, but got %v", ErrCheckpointFailed, err)
+	}
+
+	if err := lsh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(3, 0, []float64{1, 2, 4})); !errors.Is(err, ErrNotDurable) {
+		t.Errorf("expected %v, but got %v", ErrNotDurable, err)
+	}
+	if lsh.Docs.Size() != 3 {
+		t.Errorf("expected the mutations to be applied leaving %d documents, but got %d", 3, lsh.Docs.Size())
+	}
+	r := cdc.NewJSONReader(&buf)
+	for seq := lsh.Generation() - 2; seq <= lsh.Generation(); seq++ {
+		if m, err := r.Next(); err != nil || m.Seq != seq {
+			t.Errorf("expected mutation %d in the change stream, but got %+v with error %v", seq, m, err)
+		}
+	}
+}
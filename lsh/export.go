@@ -0,0 +1,97 @@
+package lsh
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/aouyang1/go-lsh/tables"
+	"gonum.org/v1/gonum/stat"
+)
+
+// bucketHeader names the columns written by ExportBuckets
+var bucketHeader = []string{"uid", "table", "hash", "windows", "bucket_size", "centroid_score"}
+
+// ExportBuckets writes a csv row of every uid and bucket hash it is assigned to in each table for
+// offline visualization of the hash space. Each row holds the number of windows of the uid with the
+// hash, the number of uids sharing the hash across rows and, when buckets are sampled, the correlation
+// of the uid's first window with the hash to the centroid of the bucket sample.
+func (l *LSH) ExportBuckets(w io.Writer) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(bucketHeader); err != nil {
+		return err
+	}
+	for _, t := range l.Tables {
+		if err := l.exportTable(cw, t); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (l *LSH) exportTable(cw *csv.Writer, t *tables.Table) error {
+	if err := t.Materialize(); err != nil {
+		return err
+	}
+	bucketSizes := make(map[uint64]uint64)
+	for _, row := range t.Table {
+		for hash, rb := range row {
+			bucketSizes[hash] += rb.Cardinality()
+		}
+	}
+
+	uids := make([]uint64, 0, len(t.Doc2Hash))
+	for uid := range t.Doc2Hash {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+
+	for _, uid := range uids {
+		hashes := t.Doc2Hash[uid]
+		timestamps := t.Timestamps.Get(uid)
+		windows := make(map[uint64]int)
+		first := make(map[uint64]int64)
+		for i, hash := range hashes {
+			if _, exists := first[hash]; !exists && i < len(timestamps) {
+				first[hash] = timestamps[i]
+			}
+			windows[hash]++
+		}
+
+		unique := make([]uint64, 0, len(windows))
+		for hash := range windows {
+			unique = append(unique, hash)
+		}
+		sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+
+		for _, hash := range unique {
+			var score string
+			r, err := t.BucketSample(hash)
+			if err != nil {
+				return err
+			}
+			if r != nil {
+				centroid := r.Centroid()
+				if vec := l.hashedVector(uid, first[hash]); len(vec) == len(centroid) {
+					score = strconv.FormatFloat(stat.Correlation(vec, centroid, nil), 'f', -1, 64)
+				}
+			}
+			record := []string{
+				strconv.FormatUint(uid, 10),
+				t.Name,
+				strconv.FormatUint(uint64(hash), 10),
+				strconv.Itoa(windows[hash]),
+				strconv.FormatUint(bucketSizes[hash], 10),
+				score,
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestExportBuckets(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 2
+	cfg.BucketSampleSize = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(0, 180, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := lsh.ExportBuckets(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a header followed by one row per uid and table
+	if len(records) != 5 {
+		t.Fatalf("expected %d records, but got %d: %v", 5, len(records), records)
+	}
+	for _, record := range records[1:] {
+		uid := record[0]
+		windows, _ := strconv.Atoi(record[3])
+		if (uid == "0" && windows != 2) || (uid == "1" && windows != 1) {
+			t.Errorf("expected 2 windows for uid 0 and 1 for uid 1, but got %v", record)
+		}
+		if record[4] != "2" {
+			t.Errorf("expected a bucket size of %d, but got %v", 2, record)
+		}
+		score, err := strconv.ParseFloat(record[5], 64)
+		if err != nil || score < 0.99 {
+			t.Errorf("expected identical vectors to correlate with the centroid, but got %v", record)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/forwardindex"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+// LoadFile restores a snapshot of the given size written by Save like Load without decoding the tables
+// and documents up front. Each table is decoded the first time it is searched or modified and the
+// documents the first time one is accessed, so r must stay open while the index is in use. Documents
+// are decoded up front when the shadow tables or the duplicate policy need their windows. Tables of
+// snapshots holding every table in the tables section are decoded up front too. Materialize decodes
+// whatever wasn't decoded yet returning the first error.
+func (l *LSH) LoadFile(r io.ReaderAt, size int64, opts snapshot.Options) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if l.Docs.Size() > 0 {
+		return ErrIndexNotEmpty
+	}
+	f, err := snapshot.Open(r, size, opts)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sl         = newSectionLoader(l, false)
+		lazyTables bool
+		lazyDocs   = l.shadow == nil && l.Cfg.DuplicatePolicy == configs.DuplicateAllow
+	)
+	for _, s := range f.Sections() {
+		if _, ok := tablePosition(s.Name); ok && lazyTables {
+			continue
+		}
+		if s.Name == sectionDocuments && lazyDocs && !sl.rehash {
+			if sl.ctors == nil {
+				return ErrNoDocumentTypes
+			}
+			if err := sl.restoreTables(); err != nil {
+				return err
+			}
+			l.Docs = forwardindex.NewLazy(l.Docs, documentLoader(s, sl.ctors))
+			continue
+		}
+
+		payload, err := s.Load()
+		if err != nil {
+			return err
+		}
+		s.Release()
+		if s.Name == sectionTables {
+			saved, err := decodeTables(payload)
+			if err != nil {
+				return err
+			}
+			if saved.Version != 1 {
+				if err := l.restoreLazyTables(f, saved); err != nil {
+					return err
+				}
+				lazyTables, sl.rehash = true, false
+				continue
+			}
+		}
+		if err := sl.load(s.Name, payload); err != nil {
+			return err
+		}
+	}
+	return sl.finish()
+}
+
+// restoreLazyTables replaces the tables of the index with tables decoding their sections of the file
+// on first use
+func (l *LSH) restoreLazyTables(f *snapshot.File, saved *savedTables) error {
+	loaders := make([]tables.Loader, len(saved.Tables))
+	for i := range saved.Tables {
+		s, err := f.Section(tableSection(i))
+		if err != nil {
+			return err
+		}
+		loaders[i] = func() (tables.State, error) {
+			var state tables.State
+			payload, err := s.Load()
+			if err != nil {
+				return state, err
+			}
+			defer s.Release()
+			err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&state)
+			return state, err
+		}
+	}
+	restored, err := tables.RestoreLazy(l.Cfg, saved.Tables, loaders, saved.Timestamps)
+	if err != nil {
+		return err
+	}
+	l.setTables(restored)
+	return nil
+}
+
+// documentLoader returns the load function of a lazy store storing the documents of the section
+func documentLoader(s *snapshot.Section, ctors []document.Constructor) func(store forwardindex.Store) error {
+	return func(store forwardindex.Store) error {
+		payload, err := s.Load()
+		if err != nil {
+			return err
+		}
+		defer s.Release()
+		return decodeDocuments(payload, ctors, func(d document.Document, windows []int64) error {
+			return store.Index(d)
+		})
+	}
+}
+
+// Materialize decodes the tables and documents of an index restored by LoadFile that weren't decoded
+// yet returning the first error
+func (l *LSH) Materialize() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, t := range l.Tables {
+		if err := t.Materialize(); err != nil {
+			return err
+		}
+	}
+	return l.docsErr()
+}
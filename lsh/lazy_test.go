@@ -0,0 +1,160 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+func TestLoadFile(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := [][]float64{{0, 1, 3}, {0, 2, 6}, {3, 1, 0}, {1, 2, 3}}
+	for i, vec := range vectors {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Index(document.NewSimple(0, 60, []float64{3, 4, 5})); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	restored, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.LoadFile(bytes.NewReader(saved), int64(len(saved)), snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range restored.Tables {
+		if n := tbl.SizeInBytes(); n != 0 {
+			t.Errorf("expected table %s not to be decoded, but got %d bytes", tbl.Name, n)
+		}
+	}
+	if m := restored.Docs.MemStats(); m.NumDocs != 0 {
+		t.Errorf("expected documents not to be decoded, but got %d", m.NumDocs)
+	}
+	if !reflect.DeepEqual(restored.Counters(), lsh.Counters()) {
+		t.Errorf("expected counters %+v, but got %+v", lsh.Counters(), restored.Counters())
+	}
+
+	so := options.NewDefaultSearch()
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	expected, _, err := lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := restored.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Index(document.NewSimple(4, 0, []float64{4, 1, 2})); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Materialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+	if restored.Docs.Size() != len(vectors) {
+		t.Errorf("expected %d documents, but got %d", len(vectors), restored.Docs.Size())
+	}
+
+	// a corrupt table is only noticed once it is decoded
+	f, err := snapshot.Open(bytes.NewReader(saved), int64(len(saved)), snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := f.Sections()
+	for i, s := range sections {
+		if s.Name == tableSection(1) {
+			saved[sections[i+1].Offset-1] ^= 0xFF
+		}
+	}
+	corrupt, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := corrupt.LoadFile(bytes.NewReader(saved), int64(len(saved)), snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var ce *snapshot.CorruptionError
+	if _, _, err := corrupt.Search(query, so); !errors.As(err, &ce) || ce.Section != tableSection(1) {
+		t.Errorf("expected search to fail with corruption of section %s, but got %v", tableSection(1), err)
+	}
+	if _, err := corrupt.Stats(); !errors.As(err, &ce) {
+		t.Errorf("expected stats to fail with corruption, but got %v", err)
+	}
+	if err := corrupt.Materialize(); !errors.As(err, &ce) || ce.Section != tableSection(1) {
+		t.Errorf("expected corruption of section %s, but got %v", tableSection(1), err)
+	}
+}
+
+func TestLoadFileCorruptDocuments(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := [][]float64{{0, 1, 3}, {0, 2, 6}, {3, 1, 0}}
+	for i, vec := range vectors {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+	f, err := snapshot.Open(bytes.NewReader(saved), int64(len(saved)), snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := f.Sections()
+	for i, s := range sections {
+		if s.Name == sectionDocuments {
+			saved[sections[i+1].Offset-1] ^= 0xFF
+		}
+	}
+
+	corrupt, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := corrupt.LoadFile(bytes.NewReader(saved), int64(len(saved)), snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var ce *snapshot.CorruptionError
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	if _, _, err := corrupt.Search(query, options.NewDefaultSearch()); !errors.As(err, &ce) || ce.Section != sectionDocuments {
+		t.Errorf("expected search to fail with corruption of section %s, but got %v", sectionDocuments, err)
+	}
+	if err := corrupt.Materialize(); !errors.As(err, &ce) || ce.Section != sectionDocuments {
+		t.Errorf("expected corruption of section %s, but got %v", sectionDocuments, err)
+	}
+}
@@ -0,0 +1,39 @@
+package lsh
+
+import (
+	"math"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+// fitLength pads or truncates the vector of a document at the configured sample period to the
+// configured vector length according to the LengthPolicy. Returns the document to use along with the
+// number of samples padded if positive or truncated if negative.
+func (l *LSH) fitLength(d document.Document) (document.Document, int) {
+	if l.Cfg.LengthPolicy == configs.LengthStrict {
+		return d, 0
+	}
+	if document.SamplePeriod(d, l.Cfg.SamplePeriod) != l.Cfg.SamplePeriod {
+		return d, 0
+	}
+	vec := d.GetVector()
+	adj := l.Cfg.VectorLength - len(vec)
+	if adj == 0 || len(vec) == 0 {
+		return d, 0
+	}
+	if max := l.Cfg.MaxLengthAdjustment; max > 0 && (adj > max || -adj > max) {
+		return d, 0
+	}
+
+	pad := 0.0
+	if l.Cfg.LengthPolicy == configs.LengthPadMissing {
+		pad = math.NaN()
+	}
+	fitted := make([]float64, l.Cfg.VectorLength)
+	n := copy(fitted, vec)
+	for i := n; i < len(fitted); i++ {
+		fitted[i] = pad
+	}
+	return document.NewSimple(d.GetUID(), d.GetIndex(), fitted), adj
+}
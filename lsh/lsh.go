@@ -1,19 +1,28 @@
 package lsh
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/aouyang1/go-lsh/cdc"
 	"github.com/aouyang1/go-lsh/configs"
 	"github.com/aouyang1/go-lsh/document"
 	"github.com/aouyang1/go-lsh/forwardindex"
+	"github.com/aouyang1/go-lsh/hashfamily"
 	"github.com/aouyang1/go-lsh/hyperplanes"
+	"github.com/aouyang1/go-lsh/lsherrors"
 	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/resample"
 	"github.com/aouyang1/go-lsh/results"
 	"github.com/aouyang1/go-lsh/stats"
 	"github.com/aouyang1/go-lsh/tables"
-	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/stat"
 )
 
@@ -21,66 +30,430 @@ var (
 	ErrInvalidDocument    = errors.New("vector length does not match with the configured options")
 	ErrNoOptions          = errors.New("no options set for LSH")
 	ErrNoVectorComplexity = errors.New("vector does not have enough complexity with a standard deviation of 0")
+	ErrIndexNotEmpty      = errors.New("operation requires an empty index")
+	ErrNoACL              = errors.New("search must provide the access control labels of the caller")
+	ErrDocumentRejected   = errors.New("document rejected by the configured validator")
 )
 
 // LSH represents the locality sensitive hash struct that stores the multiple tables containing
 // the configured number of hyperplanes along with the documents currently indexed.
+//
+// An LSH is safe for concurrent use. Searches and other reads share a read lock while indexing,
+// deleting, compacting and loading hold the write lock, so mutations are applied one at a time and are
+// never observed partially by a search. The exported fields must not be reassigned once in use.
 type LSH struct {
-	Cfg    *configs.LSHConfigs
-	Tables []*tables.Table        // N tables each using a different randomly generated set of hyperplanes
-	Docs   *forwardindex.InMemory // forward index which may be offloaded to a separate system
+	Cfg      *configs.LSHConfigs
+	Tables   []*tables.Table    // N tables each using a different randomly generated set of hyperplanes
+	Docs     forwardindex.Store // forward index which may be offloaded to a separate system
+	CDC      cdc.Writer         // optional stream of every mutation applied to the index
+	QueryLog *QueryLog          // optional log of every search for replay
+
+	// Projector optionally computes the hyperplane projections of IndexBatch and SearchBatch, e.g. on
+	// an accelerator
+	Projector hyperplanes.Projector
+
+	mu        sync.RWMutex // guards the tables and the forward index as a whole
+	counters  counters
+	seq       atomic.Uint64 // sequence number of the last mutation
+	acl       *acl
+	admit     *admission
+	shadow    *shadow // optional alternative tables searches are mirrored against
+	standing  standing
+	rows      rowWindows
+	checksums checksums
+	enrich    configs.EnrichFunc // resolved from the configured enrichment name
+	durable   *durable           // write-ahead log and checkpoints of a persisted index
+	readOnly  bool               // refuses mutations of a read-only clone
 }
 
 // New returns a new Locality Sensitive Hash struct ready for indexing and searching
 func New(cfg *configs.LSHConfigs) (*LSH, error) {
+	families, err := newFamilies(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithFamilies(cfg, families)
+}
+
+// NewWithStore returns a new Locality Sensitive Hash struct storing the indexed vectors in the provided
+// forward index, e.g. a forwardindex.Disk for indices larger than memory
+func NewWithStore(cfg *configs.LSHConfigs, store forwardindex.Store) (*LSH, error) {
+	families, err := newFamilies(cfg)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewWithFamilies(cfg, families)
+	if err != nil {
+		return nil, err
+	}
+	if store.Size() > 0 {
+		return nil, ErrIndexNotEmpty
+	}
+	l.Docs = store
+	return l, nil
+}
+
+// newFamilies generates the hyperplanes of every table
+func newFamilies(cfg *configs.LSHConfigs) ([]hashfamily.Family, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
-	l := new(LSH)
-	l.Cfg = cfg
 
-	hyperplaneTables := make([]*hyperplanes.Hyperplanes, 0, cfg.NumTables)
+	var rng *rand.Rand
+	if cfg.Seed != 0 {
+		rng = rand.New(rand.NewSource(cfg.Seed))
+	}
+	hyperplaneTables := make([]hashfamily.Family, 0, cfg.NumTables)
 	for i := 0; i < cfg.NumTables; i++ {
-		ht, err := hyperplanes.New(l.Cfg.NumHyperplanes, l.Cfg.VectorLength)
+		var ht hashfamily.Family
+		var err error
+		if cfg.Float32Planes {
+			ht, err = hyperplanes.NewFloat32(cfg.HyperplanesForTable(i), cfg.HashLength(), rng)
+		} else {
+			ht, err = hyperplanes.NewWithRand(cfg.HyperplanesForTable(i), cfg.HashLength(), rng)
+		}
 		if err != nil {
 			return nil, err
 		}
 		hyperplaneTables = append(hyperplaneTables, ht)
 	}
-	tables, err := tables.New(l.Cfg, hyperplaneTables)
+	return hyperplaneTables, nil
+}
+
+// NewWithFamilies returns a new Locality Sensitive Hash struct where each table uses the provided hash
+// family. Families of different types or widths may be mixed across tables.
+func NewWithFamilies(cfg *configs.LSHConfigs, families []hashfamily.Family) (*LSH, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	l := new(LSH)
+	l.Cfg = cfg
+	if cfg.Enrichment != "" {
+		enrich, err := configs.EnrichmentByName(cfg.Enrichment)
+		if err != nil {
+			return nil, err
+		}
+		l.enrich = enrich
+	}
+
+	tables, err := tables.New(l.Cfg, families)
 	if err != nil {
 		return nil, err
 	}
 	l.Tables = tables
 
 	l.Docs = forwardindex.NewInMemory(l.Cfg)
+	l.acl = newACL()
+	l.admit = newAdmission(cfg.MaxConcurrentSearches, cfg.SearchQueueTimeout)
+	for _, t := range l.Tables {
+		t.Vectors = l.hashedVector
+	}
 	return l, nil
 }
 
+// hashedVector returns the stored vector of the uid at the index with the configured transform
+// applied so that it is in the same space as the vectors hashed into the tables
+func (l *LSH) hashedVector(uid uint64, index int64) []float64 {
+	vec := l.Docs.GetVector(uid, index)
+	if vec == nil {
+		return nil
+	}
+	fillMissing(vec)
+	return l.reduce(l.Cfg.TFunc(vec))
+}
+
+// ReorderBits learns an ordering of the hyperplane bits of every hyperplane table from the sample
+// vectors so that coarse bits occupy the high order positions of each hash. Must be called before any
+// documents are indexed since reordering changes the hash of every vector.
+func (l *LSH) ReorderBits(samples [][]float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if l.Docs.Size() > 0 {
+		return ErrIndexNotEmpty
+	}
+	transformed := make([][]float64, 0, len(samples))
+	for _, s := range samples {
+		if len(s) != l.Cfg.VectorLength {
+			return ErrInvalidDocument
+		}
+		vec := make([]float64, len(s))
+		copy(vec, s)
+		transformed = append(transformed, l.reduce(l.Cfg.TFunc(vec)))
+	}
+
+	for _, t := range l.Tables {
+		h, ok := t.Family.(bitOrderer)
+		if !ok {
+			continue
+		}
+		if err := h.Reorder(h.LearnOrder(transformed)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bitOrderer is implemented by the hyperplane families whose bits can be reordered
+type bitOrderer interface {
+	LearnOrder(samples [][]float64) []int
+	Reorder(order []int) error
+}
+
 // Index stores the document in the LSH data structure. Returns an error if the document
 // is already present.
 func (l *LSH) Index(d document.Document) error {
-	origDoc := d.Copy()
-	vec := d.GetVector()
-	if len(vec) != l.Cfg.VectorLength {
-		return ErrInvalidDocument
+	return l.IndexContext(context.Background(), d)
+}
+
+// IndexContext stores the document like Index unless the context is done before the document is
+// committed to the tables in which case the error of the context is returned and nothing is indexed
+func (l *LSH) IndexContext(ctx context.Context, d document.Document) error {
+	_, err := l.indexWithHook(ctx, d)
+	return err
+}
+
+// IndexWithAdjustment stores the document like Index returning the number of samples the configured
+// LengthPolicy padded onto the vector if positive or truncated from it if negative
+func (l *LSH) IndexWithAdjustment(d document.Document) (int, error) {
+	return l.indexWithHook(context.Background(), d)
+}
+
+func (l *LSH) indexWithHook(ctx context.Context, d document.Document) (int, error) {
+	hook := l.Cfg.Hooks.OnIndex
+	if hook == nil {
+		return l.indexDocument(ctx, d)
+	}
+	start := time.Now()
+	adj, err := l.indexDocument(ctx, d)
+	hook(configs.IndexEvent{UID: d.GetUID(), Index: d.GetIndex(), Duration: time.Since(start), Err: err})
+	return adj, err
+}
+
+func (l *LSH) indexDocument(ctx context.Context, d document.Document) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := l.validate(d); err != nil {
+		return 0, err
+	}
+	d, err := l.enriched(d)
+	if err != nil {
+		return 0, err
+	}
+	fitted, adj := l.fitLength(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return 0, ErrReadOnly
+	}
+	p, err := l.prepareIndex(d, fitted)
+	if err != nil {
+		return 0, err
+	}
+	// the document is either committed entirely or not at all, and nothing is evicted for it if not
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	err = l.admitIndex(p)
+	if err == errDuplicateIgnored {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := l.commitIndex(p); err != nil {
+		return adj, err
+	}
+	if adj != 0 {
+		l.counters.lengthAdjusted.Add(1)
+	}
+	return adj, nil
+}
+
+// replayIndex applies an index mutation of the write-ahead log or change data capture stream. The
+// logged document was already validated, enriched and fitted when it was first indexed so it is only
+// prepared and committed.
+func (l *LSH) replayIndex(d document.Document) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	p, err := l.prepareIndex(d, d)
+	if err != nil {
+		return err
+	}
+	err = l.admitIndex(p)
+	if err == errDuplicateIgnored {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return l.commitIndex(p)
+}
+
+// validate runs the configured validator on the document as provided
+func (l *LSH) validate(d document.Document) error {
+	if l.Cfg.Validator == nil {
+		return nil
+	}
+	if err := l.Cfg.Validator(d); err != nil {
+		return fmt.Errorf("%w, %w", ErrDocumentRejected, err)
+	}
+	return nil
+}
+
+// enriched returns the document with the configured enrichment applied to a copy of it
+func (l *LSH) enriched(d document.Document) (document.Document, error) {
+	if l.enrich == nil {
+		return d, nil
+	}
+	return l.enrich(d.Copy())
+}
+
+// prepared is a document validated and transformed for indexing
+type prepared struct {
+	d        document.Document // document as provided after enrichment
+	origDoc  document.Document // copy of the fitted document stored in the forward index
+	hashed   document.Document // document hashed into the tables
+	vec      []float64         // transformed vector before any reduction
+	checksum uint64            // checksum of the window at the configured sample period
+}
+
+// prepareIndex validates the fitted document and transforms it for hashing
+func (l *LSH) prepareIndex(d, fitted document.Document) (prepared, error) {
+	origDoc := fitted.Copy()
+	hashed, err := l.atSamplePeriod(fitted)
+	if err != nil {
+		return prepared{}, err
+	}
+	vec := hashed.GetVector()
+	checksum := windowChecksum(vec)
+	if err := l.checkComplexity(vec); err != nil {
+		return prepared{}, err
+	}
+
+	vec = l.Cfg.TFunc(vec)
+	hashed = document.NewSimple(hashed.GetUID(), hashed.GetIndex(), l.reduce(vec))
+	return prepared{d: d, origDoc: origDoc, hashed: hashed, vec: vec, checksum: checksum}, nil
+}
+
+// checkComplexity returns an error if the vector has too few samples present or no variation. Missing
+// samples are filled in place.
+func (l *LSH) checkComplexity(vec []float64) error {
+	if len(vec)-len(fillMissing(vec)) < l.minOverlap() {
+		return ErrNoVectorComplexity
 	}
 	if stat.StdDev(vec, nil) == 0 {
 		return ErrNoVectorComplexity
 	}
+	return nil
+}
 
-	vec = l.Cfg.TFunc(vec)
+// admitIndex applies the duplicate policy to the prepared document and makes room for it. It runs right
+// before the document is committed so the documents of a batch committed before it count toward the
+// caps and the duplicate policy.
+func (l *LSH) admitIndex(p prepared) error {
+	uid, index := p.hashed.GetUID(), p.hashed.GetIndex()
+	if err := l.checkDuplicate(uid, index, p.checksum); err != nil {
+		return err
+	}
+	return l.makeRoom(uid)
+}
 
-	if err := l.index(d); err != nil {
+// commitIndex stores the prepared document in the tables and forward index
+func (l *LSH) commitIndex(p prepared) error {
+	d, origDoc, hashed := p.d, p.origDoc, p.hashed
+	reindexed := l.windowIndexed(hashed.GetUID(), hashed.GetIndex())
+
+	// the forward index is written first as a store may fail on I/O which must not leave the tables
+	// hashing a window that was never stored. Expands the current doc of the uid if present.
+	if err := l.Docs.Index(origDoc); err != nil {
+		return err
+	}
+	if err := l.index(hashed); err != nil {
 		return err
 	}
+	if !reindexed {
+		l.rows.add(l.rowStart(hashed.GetIndex()), time.Now())
+	}
+	l.setChecksum(hashed.GetUID(), hashed.GetIndex(), p.checksum)
+	if l.shadow != nil {
+		if err := l.shadow.index(hashed.GetUID(), hashed.GetIndex(), p.vec); err != nil {
+			return err
+		}
+	}
+	l.acl.index(d)
+	l.counters.indexed.Add(1)
+	m := cdc.Mutation{
+		Op:           cdc.OpIndex,
+		UID:          origDoc.GetUID(),
+		Index:        origDoc.GetIndex(),
+		Vector:       origDoc.GetVector(),
+		SamplePeriod: document.SamplePeriod(origDoc, 0),
+	}
+	if lbl, ok := d.(document.Labeler); ok {
+		m.Label = lbl.GetLabel()
+	}
+	err := l.capture(m)
+	l.notify(hashed.GetUID(), hashed.GetIndex())
+	return err
+}
 
-	// expand current doc of the uid if present
-	l.Docs.Index(origDoc)
-	return nil
+// atSamplePeriod returns the document resampled to the configured sample period if the document was
+// sampled at its own period. The vector must span the same duration as VectorLength samples at the
+// configured period.
+func (l *LSH) atSamplePeriod(d document.Document) (document.Document, error) {
+	vec := d.GetVector()
+	period := document.SamplePeriod(d, l.Cfg.SamplePeriod)
+	if period == l.Cfg.SamplePeriod {
+		if len(vec) != l.Cfg.VectorLength {
+			return nil, ErrInvalidDocument
+		}
+		return d, nil
+	}
+	if int64(len(vec))*period != int64(l.Cfg.VectorLength)*l.Cfg.SamplePeriod {
+		return nil, ErrInvalidDocument
+	}
+	resampled := resample.Resample(vec, period, l.Cfg.SamplePeriod, l.Cfg.VectorLength)
+	return document.NewSimple(d.GetUID(), d.GetIndex(), resampled), nil
+}
+
+// reduce returns the piecewise aggregate approximation of the vector if configured, otherwise the
+// vector itself
+func (l *LSH) reduce(vec []float64) []float64 {
+	if l.Cfg.PAASegments == 0 || l.Cfg.PAASegments == len(vec) {
+		return vec
+	}
+	return resample.PAA(vec, l.Cfg.PAASegments)
+}
+
+// fitQuery resamples the query vector to the configured vector length
+func (l *LSH) fitQuery(d document.Document, method options.Resample) (document.Document, error) {
+	vec := d.GetVector()
+	if len(vec) == 0 {
+		return nil, ErrInvalidDocument
+	}
+	var fitted []float64
+	switch method {
+	case options.Resample_LTTB:
+		fitted = resample.LTTB(vec, l.Cfg.VectorLength)
+	default:
+		fitted = resample.Linear(vec, l.Cfg.VectorLength)
+	}
+	return document.NewSimple(d.GetUID(), d.GetIndex(), fitted), nil
 }
 
 func (l *LSH) index(d document.Document) error {
+	d, err := l.withFloat32Keys(d)
+	if err != nil {
+		return err
+	}
 	for _, t := range l.Tables {
 		if err := t.Index(d); err != nil {
 			return err
@@ -91,197 +464,711 @@ func (l *LSH) index(d document.Document) error {
 
 // Delete attempts to remove the uid from the tables and also the document map
 func (l *LSH) Delete(uid uint64) error {
-	var err error
+	_, err := l.DeleteWithReport(uid)
+	return err
+}
+
+// DeleteWithReport removes the uid like Delete additionally reporting what was removed. If the uid is
+// not stored in any table lsherrors.DocumentNotStored is returned, otherwise the failures of every
+// table are joined.
+func (l *LSH) DeleteWithReport(uid uint64) (DeleteReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return DeleteReport{}, ErrReadOnly
+	}
+	return l.deleteWithReport(uid)
+}
+
+// deleteWithReport deletes like DeleteWithReport with the write lock held
+func (l *LSH) deleteWithReport(uid uint64) (DeleteReport, error) {
+	var (
+		report    DeleteReport
+		errs      []error
+		notStored int
+	)
+	timestampBytes := l.Tables[0].Timestamps.SizeInBytes()
+	windows := l.Tables[0].Timestamps.Get(uid)
 	for _, t := range l.Tables {
-		if e := t.Delete(uid); e != nil {
-			err = e
+		r, err := t.DeleteWithReport(uid)
+		switch {
+		case err == lsherrors.DocumentNotStored:
+			notStored++
+			continue
+		case err != nil:
+			errs = append(errs, fmt.Errorf("table %s, %w", t.Name, err))
 		}
+		report.TablesAffected++
+		report.BucketsEmptied += r.BucketsEmptied
+		report.BytesFreed += r.BytesFreed
 	}
-	l.Docs.Delete(uid)
-	return err
+	if after := l.Tables[0].Timestamps.SizeInBytes(); after < timestampBytes {
+		report.BytesFreed += timestampBytes - after
+	}
+	if l.shadow != nil {
+		l.shadow.delete(uid)
+	}
+	if d, exists := l.Docs.Exists(uid); exists {
+		report.BytesFreed += uint64(len(d.GetVector())) * 8 // float64 values
+	}
+	if err := l.Docs.Delete(uid); err != nil {
+		errs = append(errs, err)
+	}
+	l.acl.delete(uid)
+	if notStored == len(l.Tables) {
+		return report, lsherrors.DocumentNotStored
+	}
+	l.rows.remove(l.rowStarts(windows), time.Now())
+	l.checksums.delete(uid)
+	if notStored > 0 {
+		errs = append(errs, fmt.Errorf("%w in %d tables", lsherrors.DocumentNotStored, notStored))
+	}
+	if len(errs) > 0 {
+		return report, errors.Join(errs...)
+	}
+	l.counters.deleted.Add(1)
+	return report, l.capture(cdc.Mutation{Op: cdc.OpDelete, UID: uid})
+}
+
+// Generation returns the sequence number of the last mutation applied to the index
+func (l *LSH) Generation() uint64 {
+	return l.seq.Load()
+}
+
+// capture assigns the next sequence number to a mutation that has been applied and writes it to the
+// write-ahead log of a persisted index and the change data capture stream if configured. An error
+// means the mutation was applied but the log or stream has diverged from the index. The stream is
+// written even if the log failed since it follows the mutations applied.
+func (l *LSH) capture(m cdc.Mutation) error {
+	var durableErr error
+	if l.durable != nil {
+		m, durableErr = l.durable.capture(l, m)
+	} else {
+		m.Seq = l.seq.Add(1)
+	}
+	if l.CDC == nil {
+		return durableErr
+	}
+	m.Time = time.Now()
+	return errors.Join(durableErr, l.CDC.Write(m))
 }
 
 // Search looks through and merges results from all tables to find the nearest neighbors to the
 // provided vector
 func (l *LSH) Search(d document.Document, s *options.Search) (results.Scores, int, error) {
-	v := d.GetVector()
-	if len(v) != l.Cfg.VectorLength {
-		return nil, 0, ErrInvalidDocument
+	return l.SearchContext(context.Background(), d, s)
+}
+
+// SearchContext searches like Search until the context is done. Waiting for a search slot, filtering
+// the tables and scoring the candidates stop early returning the error of the context.
+func (l *LSH) SearchContext(ctx context.Context, d document.Document, s *options.Search) (results.Scores, int, error) {
+	scores, diag, err := l.SearchWithDiagnosticsContext(ctx, d, s)
+	return scores, diag.NumScored, err
+}
+
+// SearchWithDiagnostics searches like Search additionally describing how much of the index was
+// probed and the estimated recall achieved for the threshold with the probed tables
+func (l *LSH) SearchWithDiagnostics(d document.Document, s *options.Search) (results.Scores, results.Diagnostics, error) {
+	return l.SearchWithDiagnosticsContext(context.Background(), d, s)
+}
+
+// SearchWithDiagnosticsContext searches like SearchWithDiagnostics until the context is done
+func (l *LSH) SearchWithDiagnosticsContext(ctx context.Context, d document.Document, s *options.Search) (results.Scores, results.Diagnostics, error) {
+	return l.searchWithHooks(ctx, d, s, nil)
+}
+
+// searchWithHooks searches calling the configured search hooks around it. Candidates are scored
+// through the cache of the searcher if one is provided.
+func (l *LSH) searchWithHooks(ctx context.Context, d document.Document, s *options.Search, searcher *Searcher) (results.Scores, results.Diagnostics, error) {
+	hooks := l.Cfg.Hooks
+	if hooks.OnSearchStart == nil && hooks.OnSearchEnd == nil && l.QueryLog == nil {
+		return l.search(ctx, d, s, searcher)
+	}
+	if hooks.OnSearchStart != nil {
+		hooks.OnSearchStart()
+	}
+	var logged LoggedQuery
+	if l.QueryLog != nil {
+		orig := d
+		if q, ok := d.(*fittedQuery); ok {
+			orig = q.orig
+		}
+		// the query vector may be transformed in place by the search
+		logged.RecordedQuery = RecordedQuery{UID: orig.GetUID(), Index: orig.GetIndex(), Search: s}
+		logged.Vector = append([]float64(nil), orig.GetVector()...)
+	}
+	start := time.Now()
+	scores, diag, err := l.search(ctx, d, s, searcher)
+	latency := time.Since(start)
+	if l.QueryLog != nil && err == nil {
+		logged.Expected, logged.Time, logged.Latency = scores, start, latency
+		l.QueryLog.write(logged)
 	}
-	l.Cfg.TFunc(v)
+	if hooks.OnSearchEnd != nil {
+		hooks.OnSearchEnd(configs.SearchEvent{
+			Duration:      latency,
+			NumCandidates: diag.NumCandidates,
+			NumScored:     diag.NumScored,
+			NumResults:    len(scores),
+			TablesProbed:  diag.TablesProbed,
+			Err:           err,
+		})
+	}
+	return scores, diag, err
+}
 
+func (l *LSH) search(ctx context.Context, d document.Document, s *options.Search, searcher *Searcher) (results.Scores, results.Diagnostics, error) {
+	var diag results.Diagnostics
+	start := time.Now()
 	if s == nil {
 		s = options.NewDefaultSearch()
 	} else {
 		if err := s.Validate(); err != nil {
+			return nil, diag, err
+		}
+	}
+
+	d, adj, err := l.searchQuery(d, s)
+	if err != nil {
+		return nil, diag, err
+	}
+	diag.LengthAdjustment = adj
+
+	if err := l.admit.acquire(ctx); err != nil {
+		return nil, diag, err
+	}
+	defer l.admit.release()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// mutations wait for the lock so the generation is the one searched
+	diag.Generation = l.Generation()
+
+	docIds, probed, err := l.filter(ctx, d, s)
+	if err != nil {
+		return nil, diag, err
+	}
+	diag.NumCandidates = numCandidates(docIds)
+	diag.TablesProbed = len(probed)
+	diag.EstimatedRecall = 1 - falseNegative(s.Threshold, probed)
+	l.counters.searches.Add(1)
+	l.counters.candidates.Add(uint64(diag.NumCandidates))
+	l.counters.candidateSizes.observe(diag.NumCandidates)
+	if s.MaxCandidates > 0 && diag.NumCandidates > s.MaxCandidates {
+		diag.Seed = s.Seed
+		for diag.Seed == 0 {
+			diag.Seed = rand.Int63()
+		}
+		docIds = sampleCandidates(docIds, s.MaxCandidates, diag.Seed)
+	}
+
+	if s.CandidatesOnly {
+		return candidateScores(docIds, d.GetIndex()), diag, nil
+	}
+
+	res := l.newResults(s)
+	if err := l.score(ctx, d, docIds, res, searcher.cache(d.GetVector(), l.seq.Load())); err != nil {
+		return nil, diag, err
+	}
+	l.counters.scoredSizes.observe(res.NumScored)
+	scores := l.fetch(s, res, &diag)
+	if s.CountOnly {
+		return nil, diag, nil
+	}
+	uids := make([]uint64, len(scores))
+	for i, score := range scores {
+		uids[i] = score.UID
+	}
+	l.Docs.Touch(uids...)
+
+	if l.shadow != nil {
+		l.shadow.mirror(d, s, scores, time.Since(start))
+	}
+
+	return scores, diag, nil
+}
+
+// searchQuery returns the query searched for the document, transformed and fit to the configured
+// length and sample period, along with the samples its length was adjusted by. Queries fitted by
+// fitSearchQuery already are only transformed.
+func (l *LSH) searchQuery(d document.Document, s *options.Search) (document.Document, int, error) {
+	q, fitted := d.(*fittedQuery)
+	if !fitted {
+		var err error
+		if q, err = l.fitSearchQuery(d, s); err != nil {
 			return nil, 0, err
 		}
 	}
+	d = q.Document
+	l.transform(d.GetVector())
+	if l.Cfg.EnforceACL && len(s.ACL) == 0 {
+		return nil, 0, ErrNoACL
+	}
+	return d, q.adj, nil
+}
 
-	docIds, err := l.filterDocs(d, s)
+// fittedQuery is a query enriched and fit to the configured length and sample period before it is
+// searched
+type fittedQuery struct {
+	document.Document
+	orig document.Document // query as provided, recorded by the query log
+	adj  int               // samples the length of the query was adjusted by
+}
+
+// fitSearchQuery enriches the query and fits it to the configured length and sample period keeping
+// the precomputed keys of the query
+func (l *LSH) fitSearchQuery(d document.Document, s *options.Search) (*fittedQuery, error) {
+	e, err := l.enriched(d)
+	if err != nil {
+		return nil, err
+	}
+	fitted, adj := l.fitLength(e)
+	query, err := l.atSamplePeriod(fitted)
+	if err == ErrInvalidDocument && s.Resample != options.Resample_NONE {
+		query, err = l.fitQuery(e, s.Resample)
+	}
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	return &fittedQuery{Document: withKeys(d, query), orig: d, adj: adj}, nil
+}
+
+// newResults returns the results the candidates of a search are scored into
+func (l *LSH) newResults(s *options.Search) *results.Results {
+	numToReturn, threshold := resultLimits(s)
+	res := results.New(numToReturn, threshold, s.SignFilter)
+	res.Trend = s.ReturnTrend
+	res.Precision = s.ScorePrecision
+	res.MaxPerUID = s.MaxPerUID
+	if s.TargetResults == nil {
+		res.NegativeThreshold = s.NegativeThreshold
+	}
+	res.HalfLife = s.RecencyBoost
+	res.Group = l.group(s.GroupBy)
+	res.CountOnly = s.CountOnly
+	if s.HistogramBins > 0 {
+		res.Histogram = results.NewHistogram(s.HistogramBins)
+	}
+	return res
+}
+
+// fetch records the scored results in the diagnostics and returns the labelled scores of the search.
+// Count only searches return no scores.
+func (l *LSH) fetch(s *options.Search, res *results.Results, diag *results.Diagnostics) results.Scores {
+	diag.NumScored = res.NumScored
+	diag.NumMatched = res.NumMatched
+	diag.Histogram = res.Histogram
+	diag.Threshold = s.Threshold
+	if s.CountOnly {
+		return nil
+	}
+
+	scores := res.Fetch()
+	if s.TargetResults != nil {
+		scores, diag.Threshold = results.Adapt(scores, *s.TargetResults, s.Threshold)
+		diag.NumMatched = len(scores)
+	}
+	for i, score := range scores {
+		scores[i].Label = l.acl.label(score.UID)
+	}
+	return scores
+}
+
+// resultLimits returns the number of results to keep and the threshold they must pass. Searches
+// targeting a number of results keep one more than the target at any threshold so the threshold can be
+// adapted once every candidate is scored.
+func resultLimits(s *options.Search) (int, float64) {
+	if s.TargetResults != nil && !s.CountOnly {
+		return s.TargetResults.Max + 1, 0
+	}
+	return s.NumToReturn, s.Threshold
+}
+
+// Count returns the number of stored windows matching the query like Search without building the
+// results
+func (l *LSH) Count(d document.Document, s *options.Search) (int, error) {
+	return l.CountContext(context.Background(), d, s)
+}
+
+// CountContext counts like Count until the context is done
+func (l *LSH) CountContext(ctx context.Context, d document.Document, s *options.Search) (int, error) {
+	if s == nil {
+		s = options.NewDefaultSearch()
 	}
-	res := results.New(s.NumToReturn, s.Threshold, s.SignFilter)
-	l.score(d, docIds, res)
+	so := *s
+	so.CountOnly = true
+	_, diag, err := l.SearchWithDiagnosticsContext(ctx, d, &so)
+	return diag.NumMatched, err
+}
 
-	return res.Fetch(), res.NumScored, nil
+// Filter returns a set of document ids along with their matching indexes that collide with the given
+// vector in any table. The vector is expected to already be transformed by the configured TFunc as is
+// done by Search. Missing samples marked as NaN are filled before hashing. Callers may prune or
+// augment the candidates before passing them to Score.
+func (l *LSH) Filter(d document.Document, s *options.Search) (map[uint64]map[int64]struct{}, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	docIds, _, err := l.filter(context.Background(), d, s)
+	return docIds, err
 }
 
-// Filter returns a set of document ids that match the given vector and search options
-func (l *LSH) filterDocs(d document.Document, s *options.Search) (map[uint64]map[int64]struct{}, error) {
+// filter returns the candidates along with the tables that were probed
+func (l *LSH) filter(ctx context.Context, d document.Document, s *options.Search) (map[uint64]map[int64]struct{}, []*tables.Table, error) {
+	keyed := d
+	d = withKeys(keyed, withoutMissing(d))
 	vec := d.GetVector()
 	if len(vec) != l.Cfg.VectorLength {
-		return nil, ErrInvalidDocument
+		return nil, nil, ErrInvalidDocument
+	}
+	if l.Cfg.PAASegments > 0 {
+		vec = l.reduce(vec)
+		d = withKeys(keyed, document.NewSimple(d.GetUID(), d.GetIndex(), vec))
+	}
+	d, err := l.withFloat32Keys(d)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if s == nil {
 		s = options.NewDefaultSearch()
 	} else {
 		if err := s.Validate(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	docIds := make(map[uint64]map[int64]struct{})
-	// search for positively correlated results
-	if s.SignFilter == options.SignFilter_ANY || s.SignFilter == options.SignFilter_POS {
-		dids := l.filterDocsByLag(d, s.MaxLag)
-		for uid, indexes := range dids {
-			for index := range indexes {
-				uidIndexes, exists := docIds[uid]
-				if !exists {
-					uidIndexes = make(map[int64]struct{})
-					docIds[uid] = uidIndexes
-				}
-				uidIndexes[index] = struct{}{}
-			}
-		}
+	// both signs are filtered in a single pass deriving the keys of the negated query from the keys of
+	// the query
+	docIds, probed, err := l.filterDocsByLag(ctx, d, s, l.rankedForSearch(s))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// search for negatively correlated results
-	if s.SignFilter == options.SignFilter_ANY || s.SignFilter == options.SignFilter_NEG {
-		floats.Scale(-1, vec)
-		dids := l.filterDocsByLag(d, s.MaxLag)
-		floats.Scale(-1, vec) // undo negation
-		for uid, indexes := range dids {
-			for index := range indexes {
-				uidIndexes, exists := docIds[uid]
-				if !exists {
-					uidIndexes = make(map[int64]struct{})
-					docIds[uid] = uidIndexes
-				}
-				uidIndexes[index] = struct{}{}
-			}
-		}
+	if len(s.ACL) > 0 || l.Cfg.EnforceACL {
+		l.acl.filter(docIds, s.ACL)
 	}
+	return docIds, probed, nil
+}
 
-	return docIds, nil
+// filterDocsByLag probes the tables in order returning the candidates and the prefix of tables probed
+func (l *LSH) filterDocsByLag(ctx context.Context, d document.Document, s *options.Search, tbls []*tables.Table) (map[uint64]map[int64]struct{}, []*tables.Table, error) {
+	first, limit := probeLimits(s, len(tbls))
+
+	// consult the most productive tables first and only fall back to the rest if they don't produce
+	// enough candidates
+	mergedRes, err := l.filterTables(ctx, d, s, tbls[:first])
+	if err != nil {
+		return nil, nil, err
+	}
+	if first == limit || numCandidates(mergedRes) >= s.NumToReturn {
+		return mergedRes, tbls[:first], nil
+	}
+	rest, err := l.filterTables(ctx, d, s, tbls[first:limit])
+	if err != nil {
+		return nil, nil, err
+	}
+	mergeCandidates(mergedRes, rest)
+	return mergedRes, tbls[:limit], nil
 }
 
-func (l *LSH) filterDocsByLag(d document.Document, maxLag int64) map[uint64]map[int64]struct{} {
+// probeLimits returns the number of tables probed first and the number of tables that may be probed
+// when the first do not produce enough candidates
+func probeLimits(s *options.Search, numTables int) (int, int) {
+	limit := numTables
+	if s.ProbeBudget > 0 && s.ProbeBudget < limit {
+		limit = s.ProbeBudget
+	}
+	first := limit
+	if s.MaxTables > 0 && s.MaxTables < first {
+		first = s.MaxTables
+	}
+	return first, limit
+}
+
+// rankedForSearch returns the tables in the order the search probes them
+func (l *LSH) rankedForSearch(s *options.Search) []*tables.Table {
+	if (s.MaxTables > 0 && s.MaxTables < len(l.Tables)) || (s.ProbeBudget > 0 && s.ProbeBudget < len(l.Tables)) {
+		return l.rankedTables()
+	}
+	return l.Tables
+}
+
+// filterTables merges the candidates of the tables. Tables not filtered yet are skipped once the
+// context is done or a table fails to load.
+func (l *LSH) filterTables(ctx context.Context, d document.Document, s *options.Search, tbls []*tables.Table) (map[uint64]map[int64]struct{}, error) {
 	mergedRes := make(map[uint64]map[int64]struct{})
-	var resLock sync.Mutex
-	var wg sync.WaitGroup
-	wg.Add(len(l.Tables))
+	filter := func(tbl *tables.Table) (map[uint64]map[int64]struct{}, error) {
+		switch {
+		case s.AlignmentFree:
+			return tbl.FilterAllSigned(d, s.SignFilter)
+		case s.TimeRange != nil:
+			return tbl.FilterRangeSigned(d, s.TimeRange.Start, s.TimeRange.End, s.SignFilter)
+		default:
+			return tbl.FilterSigned(d, s.MaxLag, s.SignFilter)
+		}
+	}
 
-	for _, t := range l.Tables {
-		go func(tbl *tables.Table) {
+	workers := len(tbls)
+	if l.Cfg.FilterConcurrency > 0 && l.Cfg.FilterConcurrency < workers {
+		workers = l.Cfg.FilterConcurrency
+	}
+	if workers <= 1 || l.Docs.Size() < l.Cfg.SequentialFilterDocs {
+		for _, t := range tbls {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			docToIndex, err := filter(t)
+			if err != nil {
+				return nil, err
+			}
+			mergeCandidates(mergedRes, docToIndex)
+		}
+		return mergedRes, nil
+	}
+
+	var (
+		resLock  sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	wg.Add(workers)
+	next := make(chan *tables.Table)
+	for i := 0; i < workers; i++ {
+		go func() {
 			defer wg.Done()
-			docToIndex := tbl.Filter(d, maxLag)
-			resLock.Lock()
-			for uid, indexes := range docToIndex {
-				for index := range indexes {
-					uidIndexes, exists := mergedRes[uid]
-					if !exists {
-						uidIndexes = make(map[int64]struct{})
-						mergedRes[uid] = uidIndexes
-					}
-					uidIndexes[index] = struct{}{}
+			for tbl := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+				docToIndex, err := filter(tbl)
+				resLock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
 				}
+				mergeCandidates(mergedRes, docToIndex)
+				resLock.Unlock()
 			}
-			resLock.Unlock()
-		}(t)
+		}()
 	}
+	for _, t := range tbls {
+		next <- t
+	}
+	close(next)
 	wg.Wait()
 
-	return mergedRes
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return mergedRes, nil
 }
 
-// Score takes a set of document ids and scores them against a provided search query
-func (l *LSH) score(d document.Document, docIds map[uint64]map[int64]struct{}, res *results.Results) {
-	for uid, indexes := range docIds {
+// rankedTables returns the tables ordered by their historical hit rate with tables that have not
+// been queried yet first
+func (l *LSH) rankedTables() []*tables.Table {
+	ranked := make([]*tables.Table, len(l.Tables))
+	copy(ranked, l.Tables)
+	rates := make(map[*tables.Table]float64, len(ranked))
+	for _, t := range ranked {
+		rates[t] = t.HitRate()
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return rates[ranked[i]] > rates[ranked[j]]
+	})
+	return ranked
+}
+
+func mergeCandidates(dst, src map[uint64]map[int64]struct{}) {
+	for uid, indexes := range src {
 		for index := range indexes {
-			currDocVec := l.Docs.GetVector(uid, index)
-			if currDocVec == nil {
-				continue
+			uidIndexes, exists := dst[uid]
+			if !exists {
+				uidIndexes = make(map[int64]struct{})
+				dst[uid] = uidIndexes
 			}
-			l.Cfg.TFunc(currDocVec)
-			score := stat.Correlation(d.GetVector(), currDocVec, nil)
-			res.Update(results.Score{UID: uid, Index: index, Score: score})
+			uidIndexes[index] = struct{}{}
 		}
 	}
 }
 
-// TODO: this needs more thought
-// Save takes a filepath and a document interface representing the indexed documents
-// and saves the lsh index to disk. Only one type of document is currently supported
-// which will be registered with gob to encode and save to disk.
-/*
-func (l *LSH) Save(filepath string, d document.Document) error {
-	f, err := os.Create(filepath)
-	if err != nil {
-		return err
+// candidateScores lists the candidates as unscored results ordered by uid then index
+func candidateScores(docIds map[uint64]map[int64]struct{}, queryIndex int64) results.Scores {
+	scores := make(results.Scores, 0, numCandidates(docIds))
+	for uid, indexes := range docIds {
+		for index := range indexes {
+			scores = append(scores, results.Score{UID: uid, Index: index, Lag: index - queryIndex})
+		}
 	}
-	defer f.Close()
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].UID != scores[j].UID {
+			return scores[i].UID < scores[j].UID
+		}
+		return scores[i].Index < scores[j].Index
+	})
+	return scores
+}
 
-	enc := gob.NewEncoder(f)
-	d.Register()
+func numCandidates(docIds map[uint64]map[int64]struct{}) int {
+	var n int
+	for _, indexes := range docIds {
+		n += len(indexes)
+	}
+	return n
+}
 
-	if err := enc.Encode(l); err != nil {
-		return err
+// group returns the key partitioning scores for the grouping or nil if scores are not grouped
+func (l *LSH) group(g options.GroupBy) func(results.Score) string {
+	switch g {
+	case options.GroupBy_SIGN:
+		return func(s results.Score) string {
+			if s.Score < 0 {
+				return "neg"
+			}
+			return "pos"
+		}
+	case options.GroupBy_LABEL:
+		return func(s results.Score) string {
+			return l.acl.label(s.UID)
+		}
 	}
 	return nil
 }
 
-func (l *LSH) Load(filepath string) error {
-	f, err := os.Open(filepath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// Score takes a set of document ids and scores them against a provided search query recording each
+// score in res. The vector is expected to already be transformed by the configured TFunc. Scores are
+// computed over the samples present in both vectors skipping pairs overlapping less than MinOverlap.
+func (l *LSH) Score(d document.Document, docIds map[uint64]map[int64]struct{}, res *results.Results) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	l.score(context.Background(), d, docIds, res, nil)
+}
 
-	dec := gob.NewDecoder(f)
+// scoreCheckInterval is the number of candidates scored between checks of the context
+const scoreCheckInterval = 256
 
-	var lsh LSH
-	if err := dec.Decode(&lsh); err != nil {
-		return err
+// score scores the candidates like Score returning the error of the context if it is done before
+// every candidate is scored. Scores are read from and recorded in the cache if one is provided.
+func (l *LSH) score(ctx context.Context, d document.Document, docIds map[uint64]map[int64]struct{}, res *results.Results, cache *scoreCache) error {
+	var scored int
+	buf := scoreBuffers.Get().(*[]float64)
+	defer scoreBuffers.Put(buf)
+	query := newQueryMoments(d.GetVector())
+	minOverlap := l.minOverlap()
+	for uid, indexes := range docIds {
+		for index := range indexes {
+			if scored++; scored%scoreCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			c, cached := cache.get(uid, index, res.Trend)
+			if !cached {
+				c = l.scoreCandidate(query, uid, index, buf, res.Trend, minOverlap)
+				cache.put(uid, index, c)
+			}
+			if !c.ok {
+				continue
+			}
+			res.Update(results.Score{UID: uid, Index: index, Lag: index - d.GetIndex(), Score: c.score, Trend: c.trend})
+		}
 	}
+	return l.docsErr()
+}
 
-	*l = lsh
+// docsErr returns the error reading the forward index ran into if it reports read errors, since
+// candidates whose window failed to read are otherwise skipped like missing ones
+func (l *LSH) docsErr() error {
+	if es, ok := l.Docs.(forwardindex.ErrStore); ok {
+		return es.Err()
+	}
 	return nil
 }
-*/
+
+// scoreCandidate correlates the stored window of a candidate with the query along with its trend if
+// requested. The score is not ok if the window is not stored or overlaps the query too little.
+func (l *LSH) scoreCandidate(query queryMoments, uid uint64, index int64, buf *[]float64, trend bool, minOverlap int) cachedScore {
+	vec := l.candidateVector(uid, index, buf)
+	if vec == nil {
+		return cachedScore{}
+	}
+	var c cachedScore
+	if trend {
+		c.trend, _ = configs.LinearTrend(vec)
+		c.hasTrend = true
+	}
+	l.transform(vec)
+	c.score, c.ok = query.correlation(vec, minOverlap)
+	return c
+}
+
+// scoreBuffers are scratch buffers candidate windows are copied into while scoring so each candidate
+// doesn't allocate a vector
+var scoreBuffers = sync.Pool{
+	New: func() interface{} {
+		return new([]float64)
+	},
+}
+
+// candidateVector returns the stored window of a candidate copied into the buffer if the forward index
+// supports it
+func (l *LSH) candidateVector(uid uint64, index int64, buf *[]float64) []float64 {
+	bs, ok := l.Docs.(forwardindex.BufferedStore)
+	if !ok {
+		return l.Docs.GetVector(uid, index)
+	}
+	vec := bs.GetVectorInto(uid, index, *buf)
+	if cap(vec) > cap(*buf) {
+		*buf = vec
+	}
+	return vec
+}
 
 // Stats returns the current statistics about the configured LSH struct.
-func (l *LSH) Stats() *stats.Statistics {
+func (l *LSH) Stats() (*stats.Statistics, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	s := new(stats.Statistics)
 	s.NumDocs = l.Docs.Size()
+	s.Counters = l.Counters()
+	s.Memory = l.Docs.MemStats()
+	s.Memory.TableBytes = l.tableBytes()
+	var err error
+	if s.Fragmentation, err = l.fragmentation(); err != nil {
+		return nil, err
+	}
+	s.RowWindows = l.RowWindows()
+	s.CandidateSizes = l.counters.candidateSizes.snapshot()
+	s.ScoredSizes = l.counters.scoredSizes.snapshot()
+	if l.shadow != nil {
+		s.Shadow = l.shadow.stats()
+	}
 
 	thetaInc := 0.05
 	thetaStart := 0.60
 	thetaEnd := 1.0
 
-	// compute false negative errors for various thresholds
+	// compute false negative errors and the expected search cost for various thresholds
 	s.FalseNegativeErrors = make([]stats.FalseNegativeError, 0, int((thetaEnd-thetaStart)/thetaInc))
+	s.CandidateEstimates = make([]stats.CandidateEstimate, 0, int((thetaEnd-thetaStart)/thetaInc))
 	for theta := thetaStart; theta < thetaEnd; theta += thetaInc {
-		pdiff := 2 / math.Pi * math.Acos(theta)
-		psame := 1 - pdiff
+		fnegErr := stats.FalseNegativeError{Threshold: theta, Probability: falseNegative(theta, l.Tables)}
+		s.FalseNegativeErrors = append(s.FalseNegativeErrors, fnegErr)
+		s.CandidateEstimates = append(s.CandidateEstimates, estimateCandidates(s.NumDocs, theta, l.Tables))
+	}
+	return s, nil
+}
 
-		fneg := math.Pow((1 - math.Pow(psame, float64(l.Cfg.NumHyperplanes))), float64(l.Cfg.NumTables))
+// falseNegative returns the probability that a document correlated with the query at the threshold
+// collides with it in none of the tables. Each table misses independently based on its own number of
+// bits.
+func falseNegative(threshold float64, tbls []*tables.Table) float64 {
+	pdiff := 2 / math.Pi * math.Acos(threshold)
+	psame := 1 - pdiff
 
-		fnegErr := stats.FalseNegativeError{Threshold: theta, Probability: fneg}
-		s.FalseNegativeErrors = append(s.FalseNegativeErrors, fnegErr)
+	fneg := 1.0
+	for _, t := range tbls {
+		fneg *= 1 - math.Pow(psame, float64(t.Family.Bits()))
 	}
-	return s
+	return fneg
 }
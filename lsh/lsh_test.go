@@ -1,18 +1,28 @@
 package lsh
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aouyang1/go-lsh/cdc"
 	"github.com/aouyang1/go-lsh/configs"
 	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/forwardindex"
+	"github.com/aouyang1/go-lsh/hyperplanes"
 	"github.com/aouyang1/go-lsh/lsherrors"
 	"github.com/aouyang1/go-lsh/options"
 	"github.com/aouyang1/go-lsh/results"
+	"github.com/aouyang1/go-lsh/snapshot"
 	"github.com/aouyang1/go-lsh/stats"
 	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/stat"
@@ -129,63 +139,92 @@ func TestLSHSearch(t *testing.T) {
 
 }
 
-/* Needs more though to serializing and deserializing the index
 func TestSaveLoadLSH(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 10
+	cfg.NumHyperplanes = 1
+	cfg.NumTables = 2
+	cfg.MaxBucketSize = 4
+	cfg.BucketSampleSize = 2
 	lsh, err := New(cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	docs := []document.Document{
-		document.NewSimple(0, 0, []float64{0, 0, 5}),
-		document.NewSimple(1, 0, []float64{0, 0.1, 3}),
-		document.NewSimple(2, 0, []float64{0, 0.1, 2}),
-		document.NewSimple(3, 0, []float64{0, 0.1, 1}),
-	}
-	for _, d := range docs {
-		if err := lsh.Index(d); err != nil {
+	numDocs := 50
+	vectors := make([][]float64, numDocs)
+	for i := range vectors {
+		vectors[i] = make([]float64, cfg.VectorLength)
+		for j := range vectors[i] {
+			vectors[i][j] = rand.Float64() - 0.5
+		}
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vectors[i])); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	so := options.NewDefaultSearch()
-	so.NumToReturn = 3
-	so.SignFilter = options.SignFilter_POS
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
 
-	d := document.Simple{Vector: []float64{0, 0, 0.1}}
-	scores, _, err := lsh.Search(d, so)
+	// the restored index starts with different random hyperplanes which are replaced by the saved ones
+	restored, err := New(cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expected := []uint64{0, 1, 2}
-	if err := compareUint64s(expected, scores.UIDs()); err != nil {
+	if err := restored.Load(&buf, snapshot.Options{}); err != nil {
 		t.Fatal(err)
 	}
-
-	lshFile := "test.lsh"
-	if err := lsh.Save(lshFile, document.Simple{}); err != nil {
-		os.Remove(lshFile)
-		t.Fatal(err)
+	for i, tbl := range lsh.Tables {
+		expected, _ := tbl.Family.MarshalBinary()
+		got, _ := restored.Tables[i].Family.MarshalBinary()
+		if !bytes.Equal(expected, got) {
+			t.Errorf("expected table %d to restore its hyperplanes", i)
+		}
+		if !reflect.DeepEqual(tbl.Doc2Hash, restored.Tables[i].Doc2Hash) {
+			t.Errorf("expected %v, but got %v for table %d hashes", tbl.Doc2Hash, restored.Tables[i].Doc2Hash, i)
+		}
+		if s0, s1 := len(tbl.Splits[0]), len(restored.Tables[i].Splits[0]); s0 != s1 {
+			t.Errorf("expected table %d to have %d split buckets, but got %d", i, s0, s1)
+		}
+		if s0, s1 := len(tbl.Samples), len(restored.Tables[i].Samples); s0 != s1 {
+			t.Errorf("expected table %d to have %d bucket samples, but got %d", i, s0, s1)
+		}
+		if b0, b1 := tbl.SizeInBytes(), restored.Tables[i].SizeInBytes(); b0 != b1 {
+			t.Errorf("expected table %d to hold %d bytes, but got %d", i, b0, b1)
+		}
 	}
-	defer os.Remove(lshFile)
 
-	newLsh := new(LSH)
-	if err := newLsh.Load(lshFile); err != nil {
-		t.Fatal(err)
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.99
+	for _, vec := range vectors {
+		expected, escored, err := lsh.Search(document.NewSimple(0, 0, vec), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, nscored, err := restored.Search(document.NewSimple(0, 0, vec), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+			t.Fatal(err)
+		}
+		if nscored != escored {
+			t.Fatalf("expected %d scored documents, but got %d", escored, nscored)
+		}
 	}
-	newLsh.Cfg.TFunc = configs.NewDefaultTransformFunc
-	d = document.Simple{Vector: []float64{0, 0, 0.1}}
-	scores, _, err = newLsh.Search(d, so)
-	if err != nil {
-		t.Fatal(err)
+
+	for i := range vectors {
+		if err := restored.Delete(uint64(i)); err != nil {
+			t.Fatal(err)
+		}
 	}
-	expected = []uint64{0, 1, 2}
-	if err := compareUint64s(expected, scores.UIDs()); err != nil {
-		t.Fatal(err)
+	if len(restored.Tables[0].Splits[0]) != 0 {
+		t.Fatal("expected restored splits to be removed with their buckets")
 	}
 }
-*/
 
 func TestIndexSimple(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
@@ -210,6 +249,78 @@ func TestIndexSimple(t *testing.T) {
 	}
 }
 
+func TestSearchDiskStore(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	store, err := forwardindex.OpenDisk(filepath.Join(t.TempDir(), "docs"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	lsh, err := NewWithStore(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 0, 5}),
+		document.NewSimple(1, 0, []float64{0, 0.1, 3}),
+		document.NewSimple(2, 0, []float64{0, 0.1, 2}),
+		document.NewSimple(3, 0, []float64{0, -0.1, -4}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	scores, _, err := lsh.Search(document.Simple{Vector: []float64{0, 0, 0.1}}, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{0, 1}, scores.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWithStore(cfg, store); err != ErrIndexNotEmpty {
+		t.Errorf("expected %v, but got %v", ErrIndexNotEmpty, err)
+	}
+}
+
+// failingStore fails to store any document as a disk store would on I/O errors
+type failingStore struct {
+	forwardindex.Store
+}
+
+var errStoreFailed = errors.New("store failed")
+
+func (f failingStore) Index(d document.Document) error {
+	return errStoreFailed
+}
+
+func TestIndexStoreFailure(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := NewWithStore(cfg, failingStore{forwardindex.NewInMemory(cfg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 0, 5})); !errors.Is(err, errStoreFailed) {
+		t.Fatalf("expected %v, but got %v", errStoreFailed, err)
+	}
+	if err := lsh.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range lsh.Tables {
+		if len(tbl.Doc2Hash) != 0 {
+			t.Fatalf("expected no windows hashed into table %s, but got %d uids", tbl.Name, len(tbl.Doc2Hash))
+		}
+	}
+}
+
 func TestDelete(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
 	lsh, err := New(cfg)
@@ -239,8 +350,93 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestCDC(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	lsh.CDC = cdc.NewJSONWriter(&buf)
+
+	if err := lsh.Index(document.NewSimple(0, 60, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	r := cdc.NewJSONReader(&buf)
+	expected := []cdc.Mutation{
+		{Seq: 1, Op: cdc.OpIndex, UID: 0, Index: 60, Vector: []float64{0, 1, 3}},
+		{Seq: 2, Op: cdc.OpDelete, UID: 0},
+	}
+	for _, e := range expected {
+		m, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Seq != e.Seq || m.Op != e.Op || m.UID != e.UID || m.Index != e.Index || !floats.Equal(m.Vector, e.Vector) {
+			t.Fatalf("expected %+v, but got %+v", e, m)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected %v, but got %v", io.EOF, err)
+	}
+}
+
+func TestSearchACL(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.EnforceACL = true
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []*document.Simple{
+		{UID: 0, Vector: []float64{0, 1, 3}, Label: "alice"},
+		{UID: 1, Vector: []float64{0, 1, 3}, Label: "bob"},
+		{UID: 2, Vector: []float64{0, 1, 3}},
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so); err != ErrNoACL {
+		t.Fatalf("expected %v, but got %v error", ErrNoACL, err)
+	}
+
+	so.ACL = []string{"alice"}
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{0}, res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	// relabeling a document moves it to the new owner
+	if err := lsh.Index(&document.Simple{UID: 1, Vector: []float64{0, 1, 3}, Label: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err = lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids := res.UIDs()
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	if err := compareUint64s([]uint64{0, 1}, uids); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestSearch(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
 	lsh, err := New(cfg)
 	if err != nil {
 		t.Fatal(err)
@@ -382,6 +578,18 @@ func TestSearchAcrossTime(t *testing.T) {
 	if err := compareScores(res, expected); err != nil {
 		t.Fatalf("%v, res: %v, expected: %v", err, res, expected)
 	}
+
+	// lags are relative to the index of the query
+	so.MaxLag = -1
+	res, _, err = lsh.Search(d, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res {
+		if r.Lag != r.Index-d.Index {
+			t.Errorf("expected lag %d, but got %d for %v", r.Index-d.Index, r.Lag, r)
+		}
+	}
 }
 
 func TestLSHError(t *testing.T) {
@@ -470,7 +678,10 @@ func TestLSHStats(t *testing.T) {
 		}
 	}
 
-	s := lsh.Stats()
+	s, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
 	expectedS := &stats.Statistics{
 		NumDocs: len(docs),
 		FalseNegativeErrors: []stats.FalseNegativeError{
@@ -499,311 +710,1653 @@ func TestLSHStats(t *testing.T) {
 		}
 	}
 }
-func compareUint64s(expected, uids []uint64) error {
-	if len(uids) != len(expected) {
-		return fmt.Errorf("expected %d results, but got %d", len(expected), len(uids))
+
+func TestSearchMaxTables(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for i, uid := range uids {
-		if uid != expected[i] {
-			return fmt.Errorf("expected %v, but got %v", expected, uids)
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{1, 3, 3}),
+		document.NewSimple(2, 0, []float64{3, 3, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return nil
-}
 
-func compareScores(res, expected results.Scores) error {
-	if len(res) != len(expected) {
-		return fmt.Errorf("expected %d scores, but got %d", len(expected), len(res))
-	}
-	sort.Sort(res)
-	sort.Sort(expected)
-	for i, s := range expected {
-		if s.UID != res[i].UID {
-			return fmt.Errorf("expected uid %d, but got %d", s.UID, res[i].UID)
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.NumToReturn = 1
+	so.MaxTables = 4
+	so.Threshold = 0.99
+	for i := 0; i < 3; i++ {
+		res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{1, 3, 3}), so)
+		if err != nil {
+			t.Fatal(err)
 		}
-		if math.Abs(s.Score-res[i].Score) > 0.01 {
-			return fmt.Errorf("expected score %.2f, but got %.2f", s.Score, res[i].Score)
+		if err := compareUint64s([]uint64{1}, res.UIDs()); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return nil
+
+	ranked := lsh.rankedTables()
+	for i := 1; i < len(ranked); i++ {
+		if ranked[i-1].HitRate() < ranked[i].HitRate() {
+			t.Fatalf("expected tables ranked by descending hit rate")
+		}
+	}
+
+	so.MaxTables = -1
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{1, 3, 3}), so); err != options.ErrInvalidMaxTables {
+		t.Fatalf("expected %v, but got %v error", options.ErrInvalidMaxTables, err)
+	}
 }
 
-func BenchmarkLSHIndex(b *testing.B) {
+func TestFilterScore(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	for i := 0; i < b.N; i++ {
-		vec := make([]float64, cfg.VectorLength)
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] = rand.Float64()
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(2, 0, []float64{3, 3, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
 		}
+	}
 
-		doc := document.NewSimple(uint64(i), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
-		}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	d := document.NewSimple(0, 0, []float64{0, 1, 3})
+	cfg.TFunc(d.GetVector())
+
+	docIds, err := lsh.Filter(d, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := docIds[0]; !exists {
+		t.Fatalf("expected uid 0 in candidates, but got %v", docIds)
+	}
+
+	// drop a candidate between the stages
+	delete(docIds, 0)
+	res := results.New(so.NumToReturn, so.Threshold, so.SignFilter)
+	lsh.Score(d, docIds, res)
+	if err := compareUint64s([]uint64{1}, res.Fetch().UIDs()); err != nil {
+		t.Fatal(err)
 	}
 }
 
-func BenchmarkLSHSearchSingleHyperplane(b *testing.B) {
+func TestSearchCandidatesOnly(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
-	cfg.NumHyperplanes = 1
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	numDocuments := 10000
-	for n := 0; n < numDocuments; n++ {
-		vec := make([]float64, cfg.VectorLength)
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] = rand.Float64()
-		}
-
-		doc := document.NewSimple(uint64(n), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
+	docs := []document.Document{
+		document.NewSimple(2, 60, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(0, 0, []float64{3, 3, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
 		}
 	}
+	// vectors are not needed to return candidates
+	lsh.Docs.Delete(1)
 
-	query := make([]float64, cfg.VectorLength)
-	for j := 0; j < cfg.VectorLength; j++ {
-		query[j] = rand.Float64()
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.CandidatesOnly = true
+	res, numScored, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
 	}
-	d := document.Simple{Vector: query}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_, _, err := lsh.Search(d, nil)
-		if err != nil {
-			b.Fatal(err)
+	if numScored != 0 {
+		t.Errorf("expected no scored candidates, but got %d", numScored)
+	}
+	found := make(map[uint64]int64)
+	for i, r := range res {
+		if i > 0 && res[i-1].UID > r.UID {
+			t.Fatalf("expected candidates in uid order, but got %v", res)
 		}
+		found[r.UID] = r.Index
+	}
+	if index, exists := found[1]; !exists || index != 0 {
+		t.Errorf("expected candidate uid 1 at index 0, but got %v", res)
+	}
+	if index, exists := found[2]; !exists || index != 60 {
+		t.Errorf("expected candidate uid 2 at index 60, but got %v", res)
 	}
 }
 
-func BenchmarkLSHSearchPositive(b *testing.B) {
+func TestSamplePeriodOverride(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	numDocuments := 10000
-	for n := 0; n < numDocuments; n++ {
-		vec := make([]float64, cfg.VectorLength)
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] = rand.Float64()
-		}
+	// 10s samples averaging to [0, 1, 3] at the configured 60s period
+	fine := &document.Simple{
+		UID:          0,
+		Vector:       []float64{-1, 1, -1, 1, -1, 1, 0, 2, 0, 2, 0, 2, 2, 4, 2, 4, 2, 4},
+		SamplePeriod: 10,
+	}
+	if err := lsh.Index(fine); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{3, 3, 0})); err != nil {
+		t.Fatal(err)
+	}
 
-		doc := document.NewSimple(uint64(n), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
-		}
+	bad := &document.Simple{UID: 2, Vector: []float64{1, 2, 3, 4}, SamplePeriod: 10}
+	if err := lsh.Index(bad); err != ErrInvalidDocument {
+		t.Fatalf("expected %v, but got %v error", ErrInvalidDocument, err)
 	}
 
-	query := make([]float64, cfg.VectorLength)
-	for j := 0; j < cfg.VectorLength; j++ {
-		query[j] = rand.Float64()
+	if v := lsh.Docs.GetVector(0, 0); len(v) != 3 || v[0] != 0 || v[1] != 1 || v[2] != 3 {
+		t.Fatalf("expected stored vector resampled to [0 1 3], but got %v", v)
 	}
-	d := document.Simple{Vector: query}
+
 	so := options.NewDefaultSearch()
 	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareScores(res, results.Scores{{UID: 0, Score: 1}}); err != nil {
+		t.Fatal(err)
+	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_, _, err := lsh.Search(d, so)
+	// queries may be sampled at their own period as well
+	query := &document.Simple{Vector: []float64{0, 0, 1, 1, 3, 3}, SamplePeriod: 30}
+	res, _, err = lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareScores(res, results.Scores{{UID: 0, Score: 1}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchResample(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 4, 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	query := []float64{0, 1, 4, 2, 1}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, query), so); err != ErrInvalidDocument {
+		t.Fatalf("expected %v, but got %v error", ErrInvalidDocument, err)
+	}
+
+	for _, method := range []options.Resample{options.Resample_LINEAR, options.Resample_LTTB} {
+		so.Resample = method
+		res, _, err := lsh.Search(document.NewSimple(0, 0, query), so)
 		if err != nil {
-			b.Fatal(err)
+			t.Fatal(err)
+		}
+		if err := compareScores(res, results.Scores{{UID: 0, Score: 1}}); err != nil {
+			t.Fatalf("%v for resample method %d", err, method)
 		}
 	}
 }
 
-func BenchmarkLSHSearchRealistic(b *testing.B) {
+func TestSearchMissingValues(t *testing.T) {
+	nan := math.NaN()
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
+	cfg.VectorLength = 5
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	waveforms := make(map[string][]float64)
-	spike := make([]float64, cfg.VectorLength)
-	spike[cfg.VectorLength/2] = 1.0
-	waveforms["spike"] = spike
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{1, 2, nan, 4, 5}),
+		document.NewSimple(1, 0, []float64{5, 4, 3, 2, 1}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{nan, nan, nan, nan, 1})); err != ErrNoVectorComplexity {
+		t.Fatalf("expected %v, but got %v error", ErrNoVectorComplexity, err)
+	}
 
-	risingstep := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
-		risingstep[i] = 1.0
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{1, 2, 3, nan, 5}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareScores(res, results.Scores{{UID: 0, Score: 1}}); err != nil {
+		t.Fatal(err)
 	}
-	waveforms["risingstep"] = risingstep
 
-	loweringstep := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
-		loweringstep[i] = -1.0
+	// uid 0 only overlaps the query on 3 samples
+	cfg.MinOverlap = 4
+	res, _, err = lsh.Search(document.NewSimple(0, 0, []float64{1, 2, 3, nan, 5}), so)
+	if err != nil {
+		t.Fatal(err)
 	}
-	waveforms["loweringstep"] = loweringstep
+	if len(res) != 0 {
+		t.Fatalf("expected no results, but got %v", res)
+	}
+}
 
-	triangle := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
-		triangle[i] = 1 * float64(i-cfg.VectorLength/4)
+func TestSearchDetrend(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 6
+	cfg.TFunc = configs.NewDetrendTransformFunc
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
-		triangle[i] = -1*float64(i-cfg.VectorLength/2) + 1
+
+	// same shape riding on different trends
+	vecs := [][]float64{
+		{0, 12, 4, 16, 8, 20},
+		{0, 2, -6, -4, -12, -10},
+	}
+	for uid, v := range vecs {
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, append([]float64(nil), v...))); err != nil {
+			t.Fatal(err)
+		}
 	}
-	waveforms["triangle"] = triangle
 
-	dip := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
-		dip[i] = -1 * float64(i-cfg.VectorLength/4)
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.ReturnTrend = true
+	so.Threshold = 0.99
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 10, 0, 10, 0, 10}), so)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
-		dip[i] = 1*float64(i-cfg.VectorLength/2) - 1
+	if err := compareScores(res, results.Scores{{UID: 0, Score: 1}, {UID: 1, Score: 1}}); err != nil {
+		t.Fatal(err)
 	}
-	waveforms["dip"] = dip
+	for _, r := range res {
+		slope, _ := configs.LinearTrend(vecs[r.UID])
+		if math.Abs(r.Trend-slope) > 1e-9 {
+			t.Errorf("expected trend %.2f for uid %d, but got %.2f", slope, r.UID, r.Trend)
+		}
+	}
+}
 
-	waveNames := []string{"spike", "risingstep", "loweringstep", "triangle", "dip"}
+func TestPAA(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	cfg.PAASegments = 6
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	numDocuments := 100000
-	for n := 0; n < numDocuments; n++ {
+	r := rand.New(rand.NewSource(1))
+	vecs := make([][]float64, 10)
+	for uid := range vecs {
 		vec := make([]float64, cfg.VectorLength)
-		copy(vec, waveforms[waveNames[n%len(waveNames)]])
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] += rand.Float64()
+		for i := 1; i < len(vec); i++ {
+			vec[i] = vec[i-1] + r.NormFloat64()
 		}
-		doc := document.NewSimple(uint64(n), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
+		vecs[uid] = vec
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, append([]float64(nil), vec...))); err != nil {
+			t.Fatal(err)
 		}
 	}
 
-	query := waveforms["risingstep"]
-	d := document.Simple{Vector: query}
-
 	so := options.NewDefaultSearch()
 	so.SignFilter = options.SignFilter_POS
-	so.NumToReturn = 30000
-	so.Threshold = 0.65
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		res, _, err := lsh.Search(d, so)
+	so.NumToReturn = 1
+	for uid, vec := range vecs {
+		res, _, err := lsh.Search(document.NewSimple(0, 0, append([]float64(nil), vec...)), so)
 		if err != nil {
-			b.Fatal(err)
+			t.Fatal(err)
 		}
-		if len(res) != 20000 {
-			b.Fatalf("unexpected number of results, %d", len(res))
+		if err := compareScores(res, results.Scores{{UID: uint64(uid), Score: 1}}); err != nil {
+			t.Fatal(err)
 		}
 	}
+
+	cfg.PAASegments = 61
+	if _, err := New(cfg); err != configs.ErrInvalidPAASegments {
+		t.Fatalf("expected %v, but got %v error", configs.ErrInvalidPAASegments, err)
+	}
 }
 
-func BenchmarkLSHSearchRealisticSingleHyperplane(b *testing.B) {
+func TestSearchProbeBudget(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
-	cfg.NumHyperplanes = 1
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
-
-	waveforms := make(map[string][]float64)
-	spike := make([]float64, cfg.VectorLength)
-	spike[cfg.VectorLength/2] = 1.0
-	waveforms["spike"] = spike
-
-	risingstep := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
-		risingstep[i] = 1.0
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
 	}
-	waveforms["risingstep"] = risingstep
 
-	loweringstep := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
-		loweringstep[i] = -1.0
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	_, full, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.TablesProbed != cfg.NumTables {
+		t.Errorf("expected %d tables probed, but got %d", cfg.NumTables, full.TablesProbed)
 	}
-	waveforms["loweringstep"] = loweringstep
 
-	triangle := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
-		triangle[i] = 1 * float64(i-cfg.VectorLength/4)
+	so.ProbeBudget = 4
+	res, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
-		triangle[i] = -1*float64(i-cfg.VectorLength/2) + 1
+	if diag.TablesProbed != 4 {
+		t.Errorf("expected %d tables probed, but got %d", 4, diag.TablesProbed)
 	}
-	waveforms["triangle"] = triangle
-
-	dip := make([]float64, cfg.VectorLength)
-	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
-		dip[i] = -1 * float64(i-cfg.VectorLength/4)
+	expected := 1 - falseNegative(so.Threshold, lsh.Tables[:4])
+	if math.Abs(diag.EstimatedRecall-expected) > 1e-9 {
+		t.Errorf("expected recall %.4f, but got %.4f", expected, diag.EstimatedRecall)
 	}
-	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
-		dip[i] = 1*float64(i-cfg.VectorLength/2) - 1
+	if diag.EstimatedRecall >= full.EstimatedRecall {
+		t.Errorf("expected lower recall than %.4f with a budget, but got %.4f", full.EstimatedRecall, diag.EstimatedRecall)
+	}
+	if diag.NumScored != len(res) {
+		t.Errorf("expected %d scored, but got %d", len(res), diag.NumScored)
 	}
-	waveforms["dip"] = dip
-
-	waveNames := []string{"spike", "risingstep", "loweringstep", "triangle", "dip"}
 
-	numDocuments := 100000
-	for n := 0; n < numDocuments; n++ {
-		vec := make([]float64, cfg.VectorLength)
-		copy(vec, waveforms[waveNames[n%len(waveNames)]])
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] += rand.Float64()
-		}
+	so.ProbeBudget = -1
+	if _, _, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so); err != options.ErrInvalidProbeBudget {
+		t.Fatalf("expected %v, but got %v error", options.ErrInvalidProbeBudget, err)
+	}
+}
 
-		doc := document.NewSimple(uint64(n), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
+func TestLSHMixedTables(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	cfg.TableHyperplanes = []int{4, 4, 8, 8}
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tbl := range lsh.Tables {
+		if tbl.Family.Bits() != cfg.TableHyperplanes[i] {
+			t.Errorf("expected %d bits, but got %d for table %d", cfg.TableHyperplanes[i], tbl.Family.Bits(), i)
 		}
 	}
 
-	query := waveforms["risingstep"]
-	d := document.Simple{Vector: query}
-
-	so := options.NewDefaultSearch()
-	so.SignFilter = options.SignFilter_POS
+	psame := 1 - 2/math.Pi*math.Acos(0.60)
+	expected := math.Pow(1-math.Pow(psame, 4), 2) * math.Pow(1-math.Pow(psame, 8), 2)
+	s, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fne := s.FalseNegativeErrors[0]; math.Abs(fne.Probability-expected) > 1e-9 {
+		t.Fatalf("expected %.03f, but got %.03f probability", expected, fne.Probability)
+	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_, _, err := lsh.Search(d, so)
-		if err != nil {
-			b.Fatal(err)
-		}
+	cfg.TableHyperplanes = []int{4, 8}
+	if _, err := New(cfg); err != configs.ErrTableHyperplanesMismatch {
+		t.Fatalf("expected %v, but got %v error", configs.ErrTableHyperplanesMismatch, err)
 	}
 }
-func BenchmarkLSHDelete(b *testing.B) {
+
+func TestLSHBucketSplitting(t *testing.T) {
 	cfg := configs.NewDefaultLSHConfigs()
-	cfg.VectorLength = 60
+	cfg.VectorLength = 10
+	cfg.NumHyperplanes = 1
+	cfg.NumTables = 2
+	cfg.MaxBucketSize = 4
 	lsh, err := New(cfg)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
 
-	numDocuments := 10000
-	for n := 0; n < numDocuments; n++ {
-		vec := make([]float64, cfg.VectorLength)
-		for j := 0; j < cfg.VectorLength; j++ {
-			vec[j] = rand.Float64()
+	numDocs := 50
+	vectors := make([][]float64, numDocs)
+	for i := range vectors {
+		vectors[i] = make([]float64, cfg.VectorLength)
+		for j := range vectors[i] {
+			vectors[i][j] = rand.Float64() - 0.5
 		}
-
-		doc := document.NewSimple(uint64(n), 0, vec)
-		if err := lsh.Index(doc); err != nil {
-			b.Fatal(err)
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vectors[i])); err != nil {
+			t.Fatal(err)
 		}
 	}
+	if len(lsh.Tables[0].Splits[0]) == 0 {
+		t.Fatal("expected oversized buckets to be split")
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.99
+	for i, vec := range vectors {
+		res, nscored, err := lsh.Search(document.NewSimple(0, 0, vec), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0].UID != uint64(i) {
+			t.Fatalf("expected to find uid %d, but got %v", i, res)
+		}
+		if nscored >= numDocs {
+			t.Fatalf("expected split buckets to score fewer than %d documents, but scored %d", numDocs, nscored)
+		}
+	}
+
+	for i := range vectors {
+		if err := lsh.Delete(uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(lsh.Tables[0].Splits[0]) != 0 {
+		t.Fatal("expected splits to be removed with their buckets")
+	}
+}
+
+func compareUint64s(expected, uids []uint64) error {
+	if len(uids) != len(expected) {
+		return fmt.Errorf("expected %d results, but got %d", len(expected), len(uids))
+	}
+	for i, uid := range uids {
+		if uid != expected[i] {
+			return fmt.Errorf("expected %v, but got %v", expected, uids)
+		}
+	}
+	return nil
+}
+
+func compareScores(res, expected results.Scores) error {
+	if len(res) != len(expected) {
+		return fmt.Errorf("expected %d scores, but got %d", len(expected), len(res))
+	}
+	// expected scores are rounded so compare by uid rather than rank
+	sort.Slice(res, func(i, j int) bool { return res[i].UID < res[j].UID })
+	sort.Slice(expected, func(i, j int) bool { return expected[i].UID < expected[j].UID })
+	for i, s := range expected {
+		if s.UID != res[i].UID {
+			return fmt.Errorf("expected uid %d, but got %d", s.UID, res[i].UID)
+		}
+		if math.Abs(s.Score-res[i].Score) > 0.01 {
+			return fmt.Errorf("expected score %.2f, but got %.2f", s.Score, res[i].Score)
+		}
+	}
+	return nil
+}
+
+func BenchmarkLSHIndex(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := lsh.Delete(uint64(i))
+		vec := make([]float64, cfg.VectorLength)
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] = rand.Float64()
+		}
+
+		doc := document.NewSimple(uint64(i), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLSHSearchSingleHyperplane(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	cfg.NumHyperplanes = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	numDocuments := 10000
+	for n := 0; n < numDocuments; n++ {
+		vec := make([]float64, cfg.VectorLength)
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] = rand.Float64()
+		}
+
+		doc := document.NewSimple(uint64(n), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	query := make([]float64, cfg.VectorLength)
+	for j := 0; j < cfg.VectorLength; j++ {
+		query[j] = rand.Float64()
+	}
+	d := document.Simple{Vector: query}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := lsh.Search(d, nil)
 		if err != nil {
-			if err == lsherrors.DocumentNotStored {
-				continue
-			}
 			b.Fatal(err)
 		}
 	}
 }
+
+func BenchmarkLSHSearchPositive(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	numDocuments := 10000
+	for n := 0; n < numDocuments; n++ {
+		vec := make([]float64, cfg.VectorLength)
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] = rand.Float64()
+		}
+
+		doc := document.NewSimple(uint64(n), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	query := make([]float64, cfg.VectorLength)
+	for j := 0; j < cfg.VectorLength; j++ {
+		query[j] = rand.Float64()
+	}
+	d := document.Simple{Vector: query}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := lsh.Search(d, so)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLSHSearchRealistic(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	waveforms := make(map[string][]float64)
+	spike := make([]float64, cfg.VectorLength)
+	spike[cfg.VectorLength/2] = 1.0
+	waveforms["spike"] = spike
+
+	risingstep := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
+		risingstep[i] = 1.0
+	}
+	waveforms["risingstep"] = risingstep
+
+	loweringstep := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
+		loweringstep[i] = -1.0
+	}
+	waveforms["loweringstep"] = loweringstep
+
+	triangle := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
+		triangle[i] = 1 * float64(i-cfg.VectorLength/4)
+	}
+	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
+		triangle[i] = -1*float64(i-cfg.VectorLength/2) + 1
+	}
+	waveforms["triangle"] = triangle
+
+	dip := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
+		dip[i] = -1 * float64(i-cfg.VectorLength/4)
+	}
+	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
+		dip[i] = 1*float64(i-cfg.VectorLength/2) - 1
+	}
+	waveforms["dip"] = dip
+
+	waveNames := []string{"spike", "risingstep", "loweringstep", "triangle", "dip"}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	numDocuments := 100000
+	for n := 0; n < numDocuments; n++ {
+		vec := make([]float64, cfg.VectorLength)
+		copy(vec, waveforms[waveNames[n%len(waveNames)]])
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] += rng.Float64()
+		}
+		doc := document.NewSimple(uint64(n), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	query := waveforms["risingstep"]
+	d := document.Simple{Vector: query}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.NumToReturn = 30000
+	so.Threshold = 0.65
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, _, err := lsh.Search(d, so)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(res) != 20000 {
+			b.Fatalf("unexpected number of results, %d", len(res))
+		}
+	}
+}
+
+func BenchmarkLSHSearchRealisticSingleHyperplane(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	cfg.Seed = 1
+	cfg.NumHyperplanes = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	waveforms := make(map[string][]float64)
+	spike := make([]float64, cfg.VectorLength)
+	spike[cfg.VectorLength/2] = 1.0
+	waveforms["spike"] = spike
+
+	risingstep := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
+		risingstep[i] = 1.0
+	}
+	waveforms["risingstep"] = risingstep
+
+	loweringstep := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 2; i < cfg.VectorLength; i++ {
+		loweringstep[i] = -1.0
+	}
+	waveforms["loweringstep"] = loweringstep
+
+	triangle := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
+		triangle[i] = 1 * float64(i-cfg.VectorLength/4)
+	}
+	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
+		triangle[i] = -1*float64(i-cfg.VectorLength/2) + 1
+	}
+	waveforms["triangle"] = triangle
+
+	dip := make([]float64, cfg.VectorLength)
+	for i := cfg.VectorLength / 4; i < cfg.VectorLength/2; i++ {
+		dip[i] = -1 * float64(i-cfg.VectorLength/4)
+	}
+	for i := cfg.VectorLength / 2; i < 3*cfg.VectorLength/4; i++ {
+		dip[i] = 1*float64(i-cfg.VectorLength/2) - 1
+	}
+	waveforms["dip"] = dip
+
+	waveNames := []string{"spike", "risingstep", "loweringstep", "triangle", "dip"}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	numDocuments := 100000
+	for n := 0; n < numDocuments; n++ {
+		vec := make([]float64, cfg.VectorLength)
+		copy(vec, waveforms[waveNames[n%len(waveNames)]])
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] += rng.Float64()
+		}
+
+		doc := document.NewSimple(uint64(n), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	query := waveforms["risingstep"]
+	d := document.Simple{Vector: query}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := lsh.Search(d, so)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+func BenchmarkLSHDelete(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 60
+	lsh, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	numDocuments := 10000
+	for n := 0; n < numDocuments; n++ {
+		vec := make([]float64, cfg.VectorLength)
+		for j := 0; j < cfg.VectorLength; j++ {
+			vec[j] = rand.Float64()
+		}
+
+		doc := document.NewSimple(uint64(n), 0, vec)
+		if err := lsh.Index(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := lsh.Delete(uint64(i))
+		if err != nil {
+			if err == lsherrors.DocumentNotStored {
+				continue
+			}
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSearchHistogram(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, vec := range [][]float64{{0, 1, 3}, {0, 1, 2.9}, {3, 1, 0}} {
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.NumToReturn = 1
+	_, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diag.Histogram != nil {
+		t.Fatalf("expected no histogram unless requested")
+	}
+
+	so.HistogramBins = 10
+	res, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected %d result, but got %d", 1, len(res))
+	}
+	if diag.Histogram == nil || diag.Histogram.Total() != diag.NumScored {
+		t.Errorf("expected every scored candidate in the histogram, but got %+v with %d scored", diag.Histogram, diag.NumScored)
+	}
+	if diag.NumScored < 2 {
+		t.Errorf("expected at least %d scored, but got %d", 2, diag.NumScored)
+	}
+}
+
+func TestSearchTimeRange(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 86400, []float64{0, 1, 3}),
+		document.NewSimple(2, 86400+cfg.RowSize, []float64{0, 1, 3}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	query := document.NewSimple(0, 500000, []float64{0, 1, 3})
+	res, _, err := lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expected no results near the query index, but got %v", res)
+	}
+
+	so.TimeRange = &options.TimeRange{Start: 80000, End: 86400 + cfg.RowSize - 1}
+	res, _, err = lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{1}, res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Index != 86400 {
+		t.Errorf("expected index %d, but got %d", 86400, res[0].Index)
+	}
+
+	so.TimeRange = &options.TimeRange{Start: 10, End: 0}
+	if _, _, err := lsh.Search(query, so); err != options.ErrInvalidTimeRange {
+		t.Errorf("expected %v, but got %v error", options.ErrInvalidTimeRange, err)
+	}
+}
+
+func TestSearchAlignmentFree(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, -3600, []float64{0, 1, 3}),
+		document.NewSimple(1, 86400, []float64{0, 1, 3}),
+		document.NewSimple(1, 2*86400, []float64{0, 1, 3}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.AlignmentFree = true
+	so.TimeRange = &options.TimeRange{Start: 0, End: 0}
+	res, _, err := lsh.Search(document.NewSimple(0, 500000, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every window of every uid matches including those with negative indexes
+	if len(res) != 3 {
+		t.Fatalf("expected %d results, but got %v", 3, res)
+	}
+	indexes := make(map[int64]bool)
+	for _, r := range res {
+		indexes[r.Index] = true
+	}
+	for _, index := range []int64{-3600, 86400, 2 * 86400} {
+		if !indexes[index] {
+			t.Errorf("expected window at index %d in %v", index, res)
+		}
+	}
+}
+
+func TestLSHSeed(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 10
+	cfg.NumHyperplanes = 2
+	cfg.NumTables = 4
+	cfg.MaxBucketSize = 4
+	cfg.Seed = 7
+
+	rng := rand.New(rand.NewSource(1))
+	vectors := make([][]float64, 50)
+	for i := range vectors {
+		vectors[i] = make([]float64, cfg.VectorLength)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float64() - 0.5
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.5
+
+	var lshs [2]*LSH
+	var scored [2]int
+	var found [2]results.Scores
+	for n := range lshs {
+		l, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, vec := range vectors {
+			if err := l.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res, nscored, err := l.Search(document.NewSimple(0, 0, vectors[0]), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lshs[n], scored[n], found[n] = l, nscored, res
+	}
+
+	for i := range lshs[0].Tables {
+		i0, _ := lshs[0].Tables[i].Info()
+		i1, _ := lshs[1].Tables[i].Info()
+		if i0.Checksum != i1.Checksum {
+			t.Errorf("expected table %d hyperplane checksum %d, but got %d", i, i0.Checksum, i1.Checksum)
+		}
+		if s0, s1 := len(lshs[0].Tables[i].Splits[0]), len(lshs[1].Tables[i].Splits[0]); s0 != s1 {
+			t.Errorf("expected table %d to have %d split buckets, but got %d", i, s0, s1)
+		}
+	}
+	if scored[0] != scored[1] {
+		t.Errorf("expected %d scored candidates, but got %d", scored[0], scored[1])
+	}
+	if len(found[0]) != len(found[1]) {
+		t.Fatalf("expected %v, but got %v", found[0], found[1])
+	}
+	for i := range found[0] {
+		if found[0][i].UID != found[1][i].UID || found[0][i].Index != found[1][i].Index {
+			t.Errorf("expected %v, but got %v", found[0], found[1])
+			break
+		}
+	}
+}
+
+func TestSearchGroupBy(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []*document.Simple{
+		{UID: 0, Vector: []float64{0, 1, 3}, Label: "us-east"},
+		{UID: 1, Vector: []float64{0, 1, 3}, Label: "us-east"},
+		{UID: 2, Vector: []float64{0, 1, 3}, Label: "us-east"},
+		{UID: 3, Vector: []float64{0, 1, 3}, Label: "eu-west"},
+		{UID: 4, Vector: []float64{0, 1, 3}, Label: "eu-west"},
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.NumToReturn = 1
+	so.GroupBy = options.GroupBy_LABEL
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{0, 3}, res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchGeneration(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+
+	expected := []uint64{1, 2, 2}
+	for i, expectedGen := range expected {
+		switch i {
+		case 0:
+			err = lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3}))
+		case 1:
+			err = lsh.Delete(0)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, diag, err := lsh.SearchWithDiagnostics(query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diag.Generation != expectedGen {
+			t.Errorf("expected generation %d, but got %d", expectedGen, diag.Generation)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	var indexed []configs.IndexEvent
+	var started int
+	var searched []configs.SearchEvent
+	cfg.Hooks = configs.Hooks{
+		OnIndex:       func(e configs.IndexEvent) { indexed = append(indexed, e) },
+		OnSearchStart: func() { started++ },
+		OnSearchEnd:   func(e configs.SearchEvent) { searched = append(searched, e) },
+	}
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lsh.Index(document.NewSimple(1, 60, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{1, 1, 1})); err != ErrNoVectorComplexity {
+		t.Fatalf("expected %v, but got %v", ErrNoVectorComplexity, err)
+	}
+	if len(indexed) != 2 || indexed[0].UID != 1 || indexed[0].Index != 60 || indexed[0].Err != nil {
+		t.Fatalf("expected index events of uids 1 and 2, but got %v", indexed)
+	}
+	if indexed[1].Err != ErrNoVectorComplexity {
+		t.Errorf("expected %v, but got %v", ErrNoVectorComplexity, indexed[1].Err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, nscored, err := lsh.Search(document.NewSimple(0, 60, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started != 1 || len(searched) != 1 {
+		t.Fatalf("expected %d search start and end, but got %d and %d", 1, started, len(searched))
+	}
+	if e := searched[0]; e.NumResults != len(res) || e.NumScored != nscored || e.TablesProbed == 0 || e.Err != nil {
+		t.Errorf("expected %d results and %d scored, but got %v", len(res), nscored, e)
+	}
+}
+
+func TestFilterConcurrency(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := make([][]float64, 200)
+	for i := range vectors {
+		vectors[i] = []float64{rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+
+	testData := []struct {
+		concurrency    int
+		sequentialDocs int
+	}{
+		{0, 0},
+		{2, 0},
+		{1, 0},
+		{0, 1000},
+	}
+	var expected map[uint64]map[int64]struct{}
+	for _, td := range testData {
+		cfg := configs.NewDefaultLSHConfigs()
+		cfg.Seed = 1
+		cfg.FilterConcurrency = td.concurrency
+		cfg.SequentialFilterDocs = td.sequentialDocs
+		lsh, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, vec := range vectors {
+			if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		query := document.NewSimple(0, 0, vectors[0])
+		lsh.transform(query.GetVector())
+		docIds, err := lsh.Filter(query, options.NewDefaultSearch())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			expected = docIds
+			continue
+		}
+		if len(docIds) != len(expected) {
+			t.Errorf("expected %d candidates, but got %d with concurrency %d and sequential docs %d",
+				len(expected), len(docIds), td.concurrency, td.sequentialDocs)
+		}
+		for uid := range expected {
+			if _, exists := docIds[uid]; !exists {
+				t.Errorf("expected candidate uid %d with concurrency %d and sequential docs %d",
+					uid, td.concurrency, td.sequentialDocs)
+			}
+		}
+	}
+}
+
+func TestLSHFloat32Planes(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Float32Planes = true
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := lsh.Tables[0].Family.Name(); name != hyperplanes.Float32FamilyName {
+		t.Fatalf("expected %s family, but got %s", hyperplanes.Float32FamilyName, name)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{1}, res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the vector is converted once with the keys of every table carried by the document
+	keyed, err := lsh.withFloat32Keys(document.NewSimple(0, 0, []float64{0, 1, 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kd, ok := keyed.(*keyedDocument)
+	if !ok || len(kd.keys) != len(lsh.Tables) {
+		t.Fatalf("expected keys of %d tables, but got %+v", len(lsh.Tables), keyed)
+	}
+	for _, tbl := range lsh.Tables {
+		expected, err := tbl.Family.Hash([]float64{0, 1, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key, _ := kd.Key(tbl.Family); key != expected {
+			t.Errorf("expected key %d for table %s, but got %d", expected, tbl.Name, key)
+		}
+	}
+
+	// bits are reordered and batches hashed like the float64 hyperplanes
+	cfg.Seed = 3
+	serial, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batched, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batched.Projector = &countingProjector{}
+	rng := rand.New(rand.NewSource(1))
+	samples := make([][]float64, 20)
+	for i := range samples {
+		samples[i] = []float64{rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+	for _, l := range []*LSH{serial, batched} {
+		if err := l.ReorderBits(samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plain, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(serial.Tables[0].Family, plain.Tables[0].Family) {
+		t.Errorf("expected the planes to be reordered")
+	}
+	docs := make([]document.Document, len(samples))
+	for i, vec := range samples {
+		docs[i] = document.NewSimple(uint64(i), 0, vec)
+		if err := serial.Index(docs[i].Copy()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batched.IndexBatch(docs); err != nil {
+		t.Fatal(err)
+	}
+	for i, tbl := range serial.Tables {
+		if !reflect.DeepEqual(tbl.Doc2Hash, batched.Tables[i].Doc2Hash) {
+			t.Fatalf("expected batched windows hashed like serial ones in table %s", tbl.Name)
+		}
+	}
+}
+
+func TestLengthPolicy(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 4
+	cfg.LengthPolicy = configs.LengthPadMissing
+	cfg.MaxLengthAdjustment = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		uid         uint64
+		vec         []float64
+		expectedAdj int
+		expectedErr error
+	}{
+		{0, []float64{0, 1, 3, 2}, 0, nil},
+		{1, []float64{0, 1, 3}, 1, nil},
+		{2, []float64{0, 1, 3, 2, 5}, -1, nil},
+		{3, []float64{0, 1}, 0, ErrInvalidDocument},
+	}
+	for _, td := range testData {
+		adj, err := lsh.IndexWithAdjustment(document.NewSimple(td.uid, 0, td.vec))
+		if err != td.expectedErr {
+			t.Fatalf("expected %v, but got %v error for uid %d", td.expectedErr, err, td.uid)
+		}
+		if adj != td.expectedAdj {
+			t.Errorf("expected adjustment %d, but got %d for uid %d", td.expectedAdj, adj, td.uid)
+		}
+	}
+	if vec := lsh.Docs.GetVector(1, 0); len(vec) != 4 || !math.IsNaN(vec[3]) {
+		t.Errorf("expected vector padded with NaN, but got %v", vec)
+	}
+	if n := lsh.Counters().TotalLengthAdjusted; n != 2 {
+		t.Errorf("expected 2 adjusted documents, but got %d", n)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	_, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(10, 0, []float64{0, 1, 3, 2, 7}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diag.LengthAdjustment != -1 {
+		t.Errorf("expected query adjustment -1, but got %d", diag.LengthAdjustment)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	errNegative := errors.New("negative values are not allowed")
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Validator = func(d document.Document) error {
+		if d.GetUID() >= 100 {
+			return ErrInvalidDocument
+		}
+		for _, v := range d.GetVector() {
+			if v < 0 {
+				return errNegative
+			}
+		}
+		return nil
+	}
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		doc         document.Document
+		expectedErr error
+	}{
+		{document.NewSimple(1, 0, []float64{0, 1, 3}), nil},
+		{document.NewSimple(2, 0, []float64{0, -1, 3}), errNegative},
+		{document.NewSimple(100, 0, []float64{0, 1, 3}), ErrInvalidDocument},
+	}
+	for _, td := range testData {
+		err := lsh.Index(td.doc)
+		if !errors.Is(err, td.expectedErr) {
+			t.Errorf("expected %v, but got %v for uid %d", td.expectedErr, err, td.doc.GetUID())
+		}
+		if td.expectedErr != nil && !errors.Is(err, ErrDocumentRejected) {
+			t.Errorf("expected %v, but got %v for uid %d", ErrDocumentRejected, err, td.doc.GetUID())
+		}
+	}
+	if n := lsh.Docs.Size(); n != 1 {
+		t.Errorf("expected %d document, but got %d", 1, n)
+	}
+}
+
+func TestEnrichment(t *testing.T) {
+	configs.RegisterEnrichment("append_max", func(d document.Document) (document.Document, error) {
+		s, ok := d.(*document.Simple)
+		if !ok {
+			return nil, ErrInvalidDocument
+		}
+		s.Vector = append(s.Vector, floats.Max(s.Vector))
+		return s, nil
+	})
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 4
+	cfg.Enrichment = "append_max"
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := document.NewSimple(1, 0, []float64{0, 1, 3})
+	if err := lsh.Index(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Vector) != 3 {
+		t.Errorf("expected the indexed document to be left as is, but got %v", d.Vector)
+	}
+	if vec := lsh.Docs.GetVector(1, 0); len(vec) != 4 || vec[3] != 3 {
+		t.Errorf("expected enriched vector, but got %v", vec)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s([]uint64{1}, res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Enrichment = "missing"
+	if _, err := New(cfg); !errors.Is(err, configs.ErrUnknownEnrichment) {
+		t.Errorf("expected %v, but got %v", configs.ErrUnknownEnrichment, err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(2, 0, []float64{0, 2, 6}),
+		document.NewSimple(3, 0, []float64{3, 1, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.NumToReturn = 1
+	res, diag, err := lsh.SearchWithDiagnostics(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || diag.NumMatched != 2 {
+		t.Fatalf("expected 1 result of 2 matches, but got %d results of %d matches", len(res), diag.NumMatched)
+	}
+
+	so.NumToReturn = 0
+	n, err := lsh.Count(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != diag.NumMatched {
+		t.Errorf("expected %d, but got %d", diag.NumMatched, n)
+	}
+}
+
+func TestSearchMaxCandidates(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid := uint64(1); uid <= 20; uid++ {
+		if err := lsh.Index(document.NewSimple(uid, 0, []float64{0, 1, 3 + float64(uid)/100})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.NumToReturn = 20
+	so.MaxCandidates = 5
+	res, diag, err := lsh.SearchWithDiagnostics(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 5 || diag.Seed == 0 {
+		t.Fatalf("expected 5 sampled results with a seed, but got %d results with seed %d", len(res), diag.Seed)
+	}
+
+	// replaying the reported seed samples the same candidates
+	so.Seed = diag.Seed
+	for i := 0; i < 3; i++ {
+		replayed, _, err := lsh.SearchWithDiagnostics(query, so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(res.UIDs(), replayed.UIDs()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStatsSizeHistograms(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid := uint64(1); uid <= 3; uid++ {
+		if err := lsh.Index(document.NewSimple(uid, 0, []float64{0, 1, 3 + float64(uid)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	var candidates uint64
+	for i := 0; i < 2; i++ {
+		_, diag, err := lsh.SearchWithDiagnostics(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates += uint64(diag.NumCandidates)
+	}
+
+	s, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CandidateSizes.Count != 2 || s.CandidateSizes.Sum != candidates {
+		t.Errorf("expected 2 searches with %d candidates, but got %+v", candidates, s.CandidateSizes)
+	}
+	if last := s.ScoredSizes.Buckets[len(s.ScoredSizes.Buckets)-1]; last.Count != 2 {
+		t.Errorf("expected 2 scored searches in the last bucket, but got %+v", last)
+	}
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	testData := []struct {
+		policy      string
+		expectedErr error
+		expectedVec []float64
+	}{
+		{configs.DuplicateConflict, lsherrors.DuplicateDocument, []float64{0, 1, 3}},
+		{configs.DuplicateIgnore, nil, []float64{0, 1, 3}},
+	}
+	for _, td := range testData {
+		cfg := configs.NewDefaultLSHConfigs()
+		cfg.DuplicatePolicy = td.policy
+		lsh, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+		// identical windows are always reindexed
+		if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+
+		err = lsh.Index(document.NewSimple(1, 0, []float64{3, 1, 0}))
+		if !errors.Is(err, td.expectedErr) {
+			t.Fatalf("expected %v, but got %v for policy %q", td.expectedErr, err, td.policy)
+		}
+		var conflict *ConflictError
+		if td.expectedErr != nil && (!errors.As(err, &conflict) || conflict.UID != 1 || conflict.Index != 0) {
+			t.Errorf("expected conflict of uid 1 at index 0, but got %v", err)
+		}
+		if vec := lsh.Docs.GetVector(1, 0); !floats.Equal(vec, td.expectedVec) {
+			t.Errorf("expected %v, but got %v for policy %q", td.expectedVec, vec, td.policy)
+		}
+
+		// deleting the uid forgets the checksums of its windows
+		if err := lsh.Delete(1); err != nil {
+			t.Fatal(err)
+		}
+		if err := lsh.Index(document.NewSimple(1, 0, []float64{3, 1, 0})); err != nil {
+			t.Errorf("expected %v, but got %v for policy %q", nil, err, td.policy)
+		}
+	}
+}
+
+func TestSearchTargetResults(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 1
+	cfg.NumHyperplanes = 1
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(2, 0, []float64{0, 1.2, 3}),
+		document.NewSimple(3, 0, []float64{0, 1.5, 3}),
+		document.NewSimple(4, 0, []float64{0, 2, 3}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.9999
+	so.TargetResults = &options.ResultRange{Min: 3, Max: 3}
+	res, diag, err := lsh.SearchWithDiagnostics(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 || diag.NumMatched != 3 {
+		t.Fatalf("expected the threshold to be lowered to 3 results, but got %v", res)
+	}
+	if diag.Threshold >= so.Threshold || diag.Threshold != res[2].Score {
+		t.Errorf("expected threshold %v, but got %v", res[2].Score, diag.Threshold)
+	}
+
+	so.Threshold = 0
+	so.TargetResults = &options.ResultRange{Min: 1, Max: 2}
+	res, diag, err = lsh.SearchWithDiagnostics(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || diag.Threshold != res[1].Score {
+		t.Fatalf("expected the threshold to be raised to 2 results, but got %v at %v", res, diag.Threshold)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 100; i++ {
+				uid := uint64(w*100 + i)
+				d := document.NewSimple(uid, 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})
+				if err := lsh.Index(d); err != nil {
+					errs <- err
+					return
+				}
+				if i%3 == 0 {
+					if err := lsh.Delete(uid); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w + 10)))
+			for i := 0; i < 100; i++ {
+				query := document.NewSimple(0, 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})
+				if _, _, err := lsh.Search(query, nil); err != nil {
+					errs <- err
+					return
+				}
+				lsh.MemoryUsage()
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// 34 of every 100 documents indexed by each writer are deleted
+	if lsh.Docs.Size() != 4*66 {
+		t.Errorf("expected %d documents, but got %d", 4*66, lsh.Docs.Size())
+	}
+}
+
+func TestWideKeys(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	cfg.VectorLength = 64
+	cfg.NumHyperplanes = 40
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	vecs := make([][]float64, 100)
+	for i := range vecs {
+		vecs[i] = make([]float64, cfg.VectorLength)
+		for j := range vecs[i] {
+			vecs[i][j] = rng.NormFloat64()
+		}
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vecs[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Load(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.99
+	for _, l := range []*LSH{lsh, restored} {
+		res, _, err := l.Search(document.NewSimple(0, 0, vecs[42]), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s([]uint64{42}, res.UIDs()); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package lsh
+
+import (
+	"errors"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/forwardindex"
+)
+
+var (
+	ErrMemoryBudgetExceeded = errors.New("memory budget exceeded, refusing to index more documents")
+	ErrMaxDocsExceeded      = errors.New("max number of documents reached, refusing to index more documents")
+)
+
+// MemoryUsage returns the estimated bytes held by the tables and the forward index
+func (l *LSH) MemoryUsage() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.memoryUsage()
+}
+
+func (l *LSH) memoryUsage() uint64 {
+	size := l.tableBytes()
+	m := l.Docs.MemStats()
+	if m.ArenaBytes > 0 {
+		return size + m.ArenaBytes
+	}
+	return size + m.VectorBytes
+}
+
+// tableBytes returns the estimated bytes held by the tables and the timestamps they share
+func (l *LSH) tableBytes() uint64 {
+	var size uint64
+	for _, t := range l.Tables {
+		size += t.SizeInBytes()
+	}
+	return size + l.Tables[0].Timestamps.SizeInBytes()
+}
+
+// makeRoom ensures a new document of the uid fits within the configured caps evicting documents other
+// than the uid per the eviction policy or returning an error if there is no policy
+func (l *LSH) makeRoom(uid uint64) error {
+	if _, exists := l.Docs.Exists(uid); !exists && l.Cfg.MaxDocs > 0 {
+		for l.Docs.Size() >= l.Cfg.MaxDocs {
+			if err := l.evictOldest(uid, ErrMaxDocsExceeded); err != nil {
+				return err
+			}
+		}
+	}
+	if l.Cfg.MemoryBudget > 0 {
+		for l.memoryUsage() >= l.Cfg.MemoryBudget {
+			if err := l.evictOldest(uid, ErrMemoryBudgetExceeded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evictOldest deletes the document other than the uid ranked last by the eviction policy. Returns the
+// exhausted error if there is no policy or nothing left to evict, or the error deleting the document.
+func (l *LSH) evictOldest(uid uint64, exhausted error) error {
+	var order forwardindex.AccessOrder
+	switch l.Cfg.EvictionPolicy {
+	case configs.EvictLeastRecentlyIndexed:
+		order = forwardindex.LeastRecentlyIndexed
+	case configs.EvictLeastRecentlyMatched:
+		order = forwardindex.LeastRecentlyMatched
+	default:
+		return exhausted
+	}
+	oldest, found := l.Docs.Oldest(order, uid)
+	if !found {
+		return exhausted
+	}
+	if _, err := l.deleteWithReport(oldest); err != nil {
+		return err
+	}
+	l.counters.evicted.Add(1)
+	return nil
+}
@@ -0,0 +1,202 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/forwardindex"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	used := lsh.MemoryUsage()
+	if used == 0 {
+		t.Fatalf("expected memory usage to be tracked")
+	}
+	if s, _ := lsh.Stats(); s.Memory.TableBytes == 0 || s.Memory.VectorBytes != 3*8 {
+		t.Errorf("expected table and vector bytes in stats, but got %+v", s.Memory)
+	}
+
+	// room for the first document only
+	cfg.MemoryBudget = used
+	lsh, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{3, 1, 0})); err != ErrMemoryBudgetExceeded {
+		t.Fatalf("expected %v, but got %v error", ErrMemoryBudgetExceeded, err)
+	}
+
+	// deleting frees room
+	if err := lsh.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{3, 1, 0})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	testData := []struct {
+		policy   string
+		expected []uint64 // uids remaining after indexing uid 3
+		err      error
+	}{
+		{configs.EvictNone, []uint64{0, 1, 2}, ErrMaxDocsExceeded},
+		{configs.EvictLeastRecentlyIndexed, []uint64{1, 2, 3}, nil},
+		{configs.EvictLeastRecentlyMatched, []uint64{0, 2, 3}, nil},
+	}
+
+	for _, td := range testData {
+		cfg := configs.NewDefaultLSHConfigs()
+		cfg.NumTables = 4
+		cfg.MaxDocs = 3
+		cfg.EvictionPolicy = td.policy
+		lsh, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecs := [][]float64{{0, 1, 3}, {3, 1, 0}, {1, 0, 3}, {0, 3, 1}}
+		for uid, vec := range vecs[:3] {
+			if err := lsh.Index(document.NewSimple(uint64(uid), 0, vec)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// uid 0 is matched so uid 1 becomes the least recently matched
+		lsh.Docs.Touch(0)
+
+		if err := lsh.Index(document.NewSimple(3, 0, vecs[3])); err != td.err {
+			t.Fatalf("expected %v, but got %v error for policy %q", td.err, err, td.policy)
+		}
+		if lsh.Docs.Size() != len(td.expected) {
+			t.Fatalf("expected %d documents, but got %d for policy %q", len(td.expected), lsh.Docs.Size(), td.policy)
+		}
+		for _, uid := range td.expected {
+			if _, exists := lsh.Docs.Exists(uid); !exists {
+				t.Errorf("expected uid %d to remain for policy %q", uid, td.policy)
+			}
+		}
+	}
+}
+
+func TestEvictionCancelled(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	cfg.MaxDocs = 2
+	cfg.EvictionPolicy = configs.EvictLeastRecentlyIndexed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, vec := range [][]float64{{0, 1, 3}, {3, 1, 0}} {
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the context is cancelled once the documents are checked and before they would be admitted
+	lsh.Cfg.Validator = func(d document.Document) error {
+		cancel()
+		return nil
+	}
+
+	if err := lsh.IndexContext(ctx, document.NewSimple(2, 0, []float64{1, 0, 3})); err != context.Canceled {
+		t.Fatalf("expected %v, but got %v", context.Canceled, err)
+	}
+	lsh.Projector = &countingProjector{}
+	docs := []document.Document{
+		document.NewSimple(2, 0, []float64{1, 0, 3}),
+		document.NewSimple(3, 0, []float64{0, 3, 1}),
+	}
+	if err := lsh.IndexBatchContext(ctx, docs); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, but got %v", context.Canceled, err)
+	}
+	if lsh.Docs.Size() != cfg.MaxDocs {
+		t.Errorf("expected %d documents, but got %d", cfg.MaxDocs, lsh.Docs.Size())
+	}
+	for uid := uint64(0); uid < 2; uid++ {
+		if _, exists := lsh.Docs.Exists(uid); !exists {
+			t.Errorf("expected uid %d not to be evicted", uid)
+		}
+	}
+}
+
+// deleteFailingStore fails to delete any document
+type deleteFailingStore struct {
+	forwardindex.Store
+}
+
+func (f deleteFailingStore) Delete(uid uint64) error {
+	return errStoreFailed
+}
+
+func TestEvictionExcludesIncoming(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, vec := range [][]float64{{0, 1, 3}, {3, 1, 0}} {
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// room for the two documents only so expanding uid 0 evicts uid 1 even though uid 0 is older
+	cfg.MemoryBudget = lsh.MemoryUsage()
+	cfg.EvictionPolicy = configs.EvictLeastRecentlyIndexed
+	lsh, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, vec := range [][]float64{{0, 1, 3}, {3, 1, 0}} {
+		if err := lsh.Index(document.NewSimple(uint64(uid), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Index(document.NewSimple(0, 60, []float64{1, 0, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := lsh.Docs.Exists(1); exists {
+		t.Errorf("expected uid %d to be evicted", 1)
+	}
+	indexes, err := lsh.Timestamps(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(indexes, []int64{0, 60}) {
+		t.Errorf("expected %v, but got %v", []int64{0, 60}, indexes)
+	}
+
+	// the error of evicting a document is returned rather than the cap
+	cfg.MemoryBudget = 0
+	cfg.MaxDocs = 1
+	lsh, err = NewWithStore(cfg, deleteFailingStore{forwardindex.NewInMemory(cfg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{3, 1, 0})); !errors.Is(err, errStoreFailed) {
+		t.Errorf("expected %v, but got %v", errStoreFailed, err)
+	}
+}
@@ -0,0 +1,97 @@
+package lsh
+
+import (
+	"math"
+
+	"github.com/aouyang1/go-lsh/document"
+	"gonum.org/v1/gonum/stat"
+)
+
+// minCorrelationOverlap is the fewest mutually present samples a correlation can be computed over
+const minCorrelationOverlap = 2
+
+// fillMissing replaces NaN samples with the mean of the present samples so the vector can be hashed
+// and transformed. Returns the positions of the missing samples.
+func fillMissing(vec []float64) []int {
+	var missing []int
+	var sum float64
+	for i, v := range vec {
+		if math.IsNaN(v) {
+			missing = append(missing, i)
+			continue
+		}
+		sum += v
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var mean float64
+	if present := len(vec) - len(missing); present > 0 {
+		mean = sum / float64(present)
+	}
+	for _, i := range missing {
+		vec[i] = mean
+	}
+	return missing
+}
+
+// withoutMissing returns the document with any missing samples filled in a copy of its vector
+func withoutMissing(d document.Document) document.Document {
+	for _, v := range d.GetVector() {
+		if math.IsNaN(v) {
+			vec := make([]float64, len(d.GetVector()))
+			copy(vec, d.GetVector())
+			fillMissing(vec)
+			return document.NewSimple(d.GetUID(), d.GetIndex(), vec)
+		}
+	}
+	return d
+}
+
+// transform applies the configured transform to the present samples keeping missing samples as NaN
+func (l *LSH) transform(vec []float64) []float64 {
+	missing := fillMissing(vec)
+	vec = l.Cfg.TFunc(vec)
+	for _, i := range missing {
+		vec[i] = math.NaN()
+	}
+	return vec
+}
+
+// minOverlap returns the configured number of mutually present samples required to score a pair
+func (l *LSH) minOverlap() int {
+	if l.Cfg.MinOverlap < minCorrelationOverlap {
+		return minCorrelationOverlap
+	}
+	return l.Cfg.MinOverlap
+}
+
+// maskedCorrelation computes the correlation over the samples present in both vectors. Returns false
+// if fewer than minOverlap samples are present in both.
+func maskedCorrelation(x, y []float64, minOverlap int) (float64, bool) {
+	complete := true
+	for i := range x {
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			complete = false
+			break
+		}
+	}
+	if complete {
+		return stat.Correlation(x, y, nil), len(x) >= minOverlap
+	}
+
+	xs := make([]float64, 0, len(x))
+	ys := make([]float64, 0, len(y))
+	for i := range x {
+		if math.IsNaN(x[i]) || math.IsNaN(y[i]) {
+			continue
+		}
+		xs = append(xs, x[i])
+		ys = append(ys, y[i])
+	}
+	if len(xs) < minOverlap {
+		return 0, false
+	}
+	return stat.Correlation(xs, ys, nil), true
+}
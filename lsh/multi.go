@@ -0,0 +1,107 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+var (
+	ErrNoVectorLengths         = errors.New("no vector lengths provided")
+	ErrUnsupportedVectorLength = errors.New("no table group is configured for the vector length")
+)
+
+// Multi holds a separate group of tables for each configured window length so short and long
+// patterns can be indexed and searched in one deployment. Documents and queries are routed to the
+// group matching their vector length.
+type Multi struct {
+	Groups map[int]*LSH // vector length to the index of windows of that length
+
+	cfg     *configs.LSHConfigs
+	lengths []int
+}
+
+// NewMulti creates a group of tables for every vector length sharing the remaining configs
+func NewMulti(cfg *configs.LSHConfigs, lengths []int) (*Multi, error) {
+	if len(lengths) == 0 {
+		return nil, ErrNoVectorLengths
+	}
+	m := &Multi{Groups: make(map[int]*LSH, len(lengths)), cfg: cfg}
+	for _, length := range lengths {
+		if _, exists := m.Groups[length]; exists {
+			continue
+		}
+		groupCfg := *cfg
+		groupCfg.VectorLength = length
+		l, err := New(&groupCfg)
+		if err != nil {
+			return nil, fmt.Errorf("vector length %d, %w", length, err)
+		}
+		m.Groups[length] = l
+		m.lengths = append(m.lengths, length)
+	}
+	sort.Ints(m.lengths)
+	return m, nil
+}
+
+// Lengths returns the configured vector lengths in ascending order
+func (m *Multi) Lengths() []int {
+	return m.lengths
+}
+
+// route returns the group for the document's vector length at the configured sample period
+func (m *Multi) route(d document.Document) (*LSH, error) {
+	period := document.SamplePeriod(d, m.cfg.SamplePeriod)
+	length := int(int64(len(d.GetVector())) * period / m.cfg.SamplePeriod)
+	l, exists := m.Groups[length]
+	if !exists {
+		return nil, fmt.Errorf("%w, %d", ErrUnsupportedVectorLength, length)
+	}
+	return l, nil
+}
+
+// Index stores the document in the group matching its vector length
+func (m *Multi) Index(d document.Document) error {
+	l, err := m.route(d)
+	if err != nil {
+		return err
+	}
+	return l.Index(d)
+}
+
+// Search looks for neighbors of the query among windows of the same length
+func (m *Multi) Search(d document.Document, s *options.Search) (results.Scores, int, error) {
+	l, err := m.route(d)
+	if err != nil {
+		return nil, 0, err
+	}
+	return l.Search(d, s)
+}
+
+// Delete removes the uid from every group. Returns lsherrors.DocumentNotStored only if no group had
+// the uid.
+func (m *Multi) Delete(uid uint64) error {
+	var firstErr error
+	found := false
+	for _, length := range m.lengths {
+		err := m.Groups[length].Delete(uid)
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, lsherrors.DocumentNotStored):
+		case firstErr == nil:
+			found = true
+			firstErr = err
+		}
+	}
+	if !found {
+		return lsherrors.DocumentNotStored
+	}
+	return firstErr
+}
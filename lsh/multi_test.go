@@ -0,0 +1,64 @@
+package lsh
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+func TestMulti(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	m, err := NewMulti(cfg, []int{6, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lengths := m.Lengths(); len(lengths) != 2 || lengths[0] != 3 || lengths[1] != 6 {
+		t.Fatalf("expected lengths [3 6], but got %v", lengths)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 0, []float64{0, 1, 3, 3, 1, 0}),
+		// 6 samples at 30s span the same 3 windows as the configured 60s period
+		&document.Simple{UID: 2, Vector: []float64{0, 0, 1, 1, 3, 3}, SamplePeriod: 30},
+	}
+	for _, d := range docs {
+		if err := m.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Index(document.NewSimple(3, 0, []float64{1, 2, 3, 4})); !errors.Is(err, ErrUnsupportedVectorLength) {
+		t.Fatalf("expected %v, but got %v error", ErrUnsupportedVectorLength, err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	testData := []struct {
+		query    []float64
+		expected results.Scores
+	}{
+		{[]float64{0, 1, 3}, results.Scores{{UID: 0, Score: 1}, {UID: 2, Score: 1}}},
+		{[]float64{0, 1, 3, 3, 1, 0}, results.Scores{{UID: 1, Score: 1}}},
+	}
+	for _, td := range testData {
+		res, _, err := m.Search(document.NewSimple(0, 0, td.query), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareScores(res, td.expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(1); err != lsherrors.DocumentNotStored {
+		t.Fatalf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+}
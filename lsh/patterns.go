@@ -0,0 +1,63 @@
+package lsh
+
+import (
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+// PatternLibrary indexes a library of pattern vectors rather than the corpus so each new document can
+// be matched against every registered pattern with a single search
+type PatternLibrary struct {
+	LSH *LSH
+}
+
+// NewPatternLibrary returns an empty library of patterns of the configured vector length
+func NewPatternLibrary(cfg *configs.LSHConfigs) (*PatternLibrary, error) {
+	l, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &PatternLibrary{LSH: l}, nil
+}
+
+// Register stores the pattern under the id replacing any previous pattern of the id
+func (p *PatternLibrary) Register(id uint64, pattern []float64) error {
+	if _, exists := p.LSH.Docs.Exists(id); exists {
+		if err := p.LSH.Delete(id); err != nil {
+			return err
+		}
+	}
+	return p.LSH.Index(document.NewSimple(id, 0, pattern))
+}
+
+// Unregister removes the pattern of the id
+func (p *PatternLibrary) Unregister(id uint64) error {
+	return p.LSH.Delete(id)
+}
+
+// Len returns the number of registered patterns
+func (p *PatternLibrary) Len() int {
+	return p.LSH.Docs.Size()
+}
+
+// Match returns the patterns the document matches under the search options with the uid of each score
+// being the pattern id. Patterns match on shape alone so the index of the document is only carried on
+// to the index of each score.
+func (p *PatternLibrary) Match(d document.Document, s *options.Search) (results.Scores, error) {
+	if s == nil {
+		s = options.NewDefaultSearch()
+	}
+	so := *s
+	so.AlignmentFree = true
+	scores, _, err := p.LSH.Search(d, &so)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		scores[i].Index = d.GetIndex()
+		scores[i].Lag = 0
+	}
+	return scores, nil
+}
@@ -0,0 +1,57 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestPatternLibrary(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.VectorLength = 4
+	p, err := NewPatternLibrary(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns := map[uint64][]float64{
+		10: {0, 0, 1, 1}, // rising step
+		20: {1, 1, 0, 0}, // lowering step
+		30: {0, 1, 0, 0}, // spike
+	}
+	for id, pattern := range patterns {
+		if err := p.Register(id, pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Len() != len(patterns) {
+		t.Fatalf("expected %d patterns, but got %d", len(patterns), p.Len())
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.9
+	res, err := p.Match(document.NewSimple(1, 86400, []float64{0, 0.1, 2, 2}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].UID != 10 || res[0].Index != 86400 {
+		t.Fatalf("expected pattern 10 at index %d, but got %v", 86400, res)
+	}
+
+	// re-registering replaces the pattern
+	if err := p.Register(10, []float64{0, 1, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = p.Match(document.NewSimple(1, 86400, []float64{0, 0.1, 2, 2}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Errorf("expected no patterns to match, but got %v", res)
+	}
+	if so.AlignmentFree {
+		t.Errorf("expected the search options of the caller to be left unchanged")
+	}
+}
@@ -0,0 +1,163 @@
+package lsh
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+var ErrConfigMismatch = errors.New("config must have the same vector length and sample period as the index")
+
+// LoggedQuery is a search recorded by a query log along with when it ran and how long it took
+type LoggedQuery struct {
+	RecordedQuery
+	Time    time.Time     `json:"time"`
+	Latency time.Duration `json:"latency"`
+}
+
+// QueryLog writes every successful Search of an index, including those of a Searcher, as json lines of
+// the query document, its search options and results so the searches can be replayed with Replay, e.g.
+// against an index rebuilt with more hyperplanes or tables. Batch searches and sessions are not logged.
+// A QueryLog is safe for concurrent use.
+type QueryLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // first error writing to the log
+}
+
+// NewQueryLog returns a query log writing to w
+func NewQueryLog(w io.Writer) *QueryLog {
+	return &QueryLog{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing to the log. Searches are not failed by the log and once a write
+// fails nothing else is written.
+func (ql *QueryLog) Err() error {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	return ql.err
+}
+
+func (ql *QueryLog) write(q LoggedQuery) {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	if ql.err != nil {
+		return
+	}
+	ql.err = ql.enc.Encode(q)
+}
+
+// ReadQueryLog reads the searches written by a query log
+func ReadQueryLog(r io.Reader) ([]LoggedQuery, error) {
+	var queries []LoggedQuery
+	err := decodeJSONLines(r, func(dec *json.Decoder) error {
+		var q LoggedQuery
+		if err := dec.Decode(&q); err != nil {
+			return err
+		}
+		queries = append(queries, q)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// ReplayReport compares the replayed searches of a query log with those logged
+type ReplayReport struct {
+	QueriesReplayed int           `json:"queries_replayed"`
+	Errors          int           `json:"errors"`      // replayed searches that failed
+	Recall          float64       `json:"recall"`      // mean fraction of the logged results also replayed
+	NumResults      int           `json:"num_results"` // results replayed minus those logged
+	LoggedLatency   time.Duration `json:"logged_latency"`
+	Latency         time.Duration `json:"latency"`
+}
+
+// LatencyDelta returns the mean latency of the replayed searches minus that of the logged searches
+func (r ReplayReport) LatencyDelta() time.Duration {
+	return r.Latency - r.LoggedLatency
+}
+
+// Replay re-executes the logged searches against the index reporting the recall of the logged results
+// along with the mean latencies of the logged and replayed searches. Results are matched by uid and
+// index. Searches that logged no results count as fully recalled and failed searches are left out of the
+// recall and latencies.
+func Replay(l *LSH, queries []LoggedQuery) ReplayReport {
+	var report ReplayReport
+	var recall float64
+	var logged, replayed time.Duration
+	for _, q := range queries {
+		report.QueriesReplayed++
+		vec := make([]float64, len(q.Vector))
+		copy(vec, q.Vector)
+		start := time.Now()
+		got, _, err := l.Search(document.NewSimple(q.UID, q.Index, vec), q.Search)
+		latency := time.Since(start)
+		if err != nil {
+			report.Errors++
+			continue
+		}
+		recall += recalled(q.Expected, got)
+		report.NumResults += len(got) - len(q.Expected)
+		logged += q.Latency
+		replayed += latency
+	}
+	if n := report.QueriesReplayed - report.Errors; n > 0 {
+		report.Recall = recall / float64(n)
+		report.LoggedLatency = logged / time.Duration(n)
+		report.Latency = replayed / time.Duration(n)
+	}
+	return report
+}
+
+// recalled returns the fraction of the expected windows found in the results
+func recalled(expected, got results.Scores) float64 {
+	if len(expected) == 0 {
+		return 1
+	}
+	found := make(map[windowKey]struct{}, len(got))
+	for _, s := range got {
+		found[windowKey{s.UID, s.Index}] = struct{}{}
+	}
+	var n int
+	for _, s := range expected {
+		if _, exists := found[windowKey{s.UID, s.Index}]; exists {
+			n++
+		}
+	}
+	return float64(n) / float64(len(expected))
+}
+
+// Rebuild returns a new index with the configuration holding a copy of every document of the index
+// hashed into new tables, e.g. to replay a query log against more hyperplanes or tables. The transforms
+// of the index are kept so scores remain comparable. The configuration must share the vector length and
+// sample period of the index.
+func (l *LSH) Rebuild(cfg *configs.LSHConfigs) (*LSH, error) {
+	if cfg.VectorLength != l.Cfg.VectorLength || cfg.SamplePeriod != l.Cfg.SamplePeriod {
+		return nil, ErrConfigMismatch
+	}
+	c := *cfg
+	c.TFunc, c.Transform = l.Cfg.TFunc, l.Cfg.Transform
+	r, err := New(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	l.Docs.Range(func(d document.Document) bool {
+		err = r.restore(d.Copy(), l.Tables[0].Timestamps.Get(d.GetUID()), true)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
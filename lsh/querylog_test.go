@@ -0,0 +1,83 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestQueryLog(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), int64(i%3)*60, []float64{rng.Float64(), rng.Float64(), rng.Float64()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	lsh.QueryLog = NewQueryLog(&buf)
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.9
+	for i := 0; i < 5; i++ {
+		if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()}), so); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := lsh.Search(document.NewSimple(0, 0, []float64{1, 2}), so); err == nil {
+		t.Fatal("expected search of an invalid query to fail")
+	}
+	if err := lsh.QueryLog.Err(); err != nil {
+		t.Fatal(err)
+	}
+	lsh.QueryLog = nil
+
+	queries, err := ReadQueryLog(&buf)
+	if err != nil || len(queries) != 5 {
+		t.Fatalf("expected %d logged queries, but got %d, %v", 5, len(queries), err)
+	}
+	for _, q := range queries {
+		if len(q.Vector) != 3 || q.Search == nil || q.Time.IsZero() || q.Latency <= 0 {
+			t.Errorf("expected a complete logged query, but got %+v", q)
+		}
+	}
+
+	report := Replay(lsh, queries)
+	if report.QueriesReplayed != 5 || report.Errors != 0 || report.Recall != 1 || report.NumResults != 0 {
+		t.Errorf("expected %d queries fully recalled, but got %+v", 5, report)
+	}
+
+	wide := configs.NewDefaultLSHConfigs()
+	wide.NumHyperplanes = 2 * cfg.NumHyperplanes
+	wide.Seed = 5
+	rebuilt, err := lsh.Rebuild(wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Docs.Size() != 100 || rebuilt.Cfg.NumHyperplanes != wide.NumHyperplanes {
+		t.Fatalf("expected %d docs hashed with %d hyperplanes, but got %d docs with %d", 100, wide.NumHyperplanes, rebuilt.Docs.Size(), rebuilt.Cfg.NumHyperplanes)
+	}
+	if err := rebuilt.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	report = Replay(rebuilt, queries)
+	if report.QueriesReplayed != 5 || report.Errors != 0 || report.Recall < 0 || report.Recall > 1 {
+		t.Errorf("expected %d queries replayed with a recall between 0 and 1, but got %+v", 5, report)
+	}
+
+	mismatched := configs.NewDefaultLSHConfigs()
+	mismatched.VectorLength = 4
+	if _, err := lsh.Rebuild(mismatched); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("expected %v, but got %v", ErrConfigMismatch, err)
+	}
+}
@@ -0,0 +1,100 @@
+package lsh
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+// rowWindows tracks the number of windows indexed into each row window of the tables and when each
+// row was last updated
+type rowWindows struct {
+	mu   sync.Mutex
+	rows map[int64]*stats.RowWindow
+}
+
+// add records a window indexed into the row starting at start
+func (r *rowWindows) add(start int64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rows == nil {
+		r.rows = make(map[int64]*stats.RowWindow)
+	}
+	row, exists := r.rows[start]
+	if !exists {
+		row = &stats.RowWindow{Start: start}
+		r.rows[start] = row
+	}
+	row.NumDocs++
+	row.LastUpdated = now
+}
+
+// remove records windows deleted from the rows starting at each start dropping rows left empty
+func (r *rowWindows) remove(starts []int64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, start := range starts {
+		row, exists := r.rows[start]
+		if !exists {
+			continue
+		}
+		row.NumDocs--
+		row.LastUpdated = now
+		if row.NumDocs <= 0 {
+			delete(r.rows, start)
+		}
+	}
+}
+
+// list returns the row windows ordered by start
+func (r *rowWindows) list() []stats.RowWindow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := make([]stats.RowWindow, 0, len(r.rows))
+	for _, row := range r.rows {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Start < rows[j].Start
+	})
+	return rows
+}
+
+// restore sets the last updated time of the rows still holding windows from saved row windows
+func (r *rowWindows) restore(saved []stats.RowWindow) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range saved {
+		if row, exists := r.rows[s.Start]; exists {
+			row.LastUpdated = s.LastUpdated
+		}
+	}
+}
+
+// RowWindows returns the number of windows indexed into each row window of the tables and when each
+// row was last updated ordered by the start of the row
+func (l *LSH) RowWindows() []stats.RowWindow {
+	return l.rows.list()
+}
+
+// rowStart returns the start of the row window the index is stored in
+func (l *LSH) rowStart(index int64) int64 {
+	return index / l.Cfg.RowSize * l.Cfg.RowSize
+}
+
+// rowStarts returns the start of the row window of each index
+func (l *LSH) rowStarts(indexes []int64) []int64 {
+	starts := make([]int64, len(indexes))
+	for i, index := range indexes {
+		starts[i] = l.rowStart(index)
+	}
+	return starts
+}
+
+// windowIndexed returns whether the window of the uid at the index is already in the tables
+func (l *LSH) windowIndexed(uid uint64, index int64) bool {
+	_, indexes := l.Tables[0].Timestamps.Between(uid, index, index)
+	return len(indexes) > 0
+}
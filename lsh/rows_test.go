@@ -0,0 +1,72 @@
+package lsh
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+func TestRowWindows(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 60, []float64{1, 3, 2}),
+		document.NewSimple(1, 60, []float64{1, 3, 2}), // reindexing a window isn't counted twice
+		document.NewSimple(2, 7200, []float64{0, 2, 6}),
+		document.NewSimple(3, 7260, []float64{3, 1, 0}),
+		document.NewSimple(4, 14400, []float64{3, 1, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Delete(4); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		start   int64
+		numDocs int
+	}{
+		{0, 2},
+		{7200, 2},
+	}
+	rows := lsh.RowWindows()
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, but got %+v", len(expected), rows)
+	}
+	for i, e := range expected {
+		if rows[i].Start != e.start || rows[i].NumDocs != e.numDocs || rows[i].LastUpdated.IsZero() {
+			t.Errorf("expected row %d with %d docs, but got %+v", e.start, e.numDocs, rows[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Load(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	restoredRows := restored.RowWindows()
+	if len(restoredRows) != len(rows) {
+		t.Fatalf("expected %+v, but got %+v", rows, restoredRows)
+	}
+	for i := range rows {
+		if restoredRows[i].NumDocs != rows[i].NumDocs || !restoredRows[i].LastUpdated.Equal(rows[i].LastUpdated) {
+			t.Errorf("expected %+v, but got %+v", rows[i], restoredRows[i])
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package lsh
+
+import "math/rand"
+
+// sampleCandidates returns a uniform random sample of n of the candidates. The candidates are sampled
+// in uid then index order so the same seed picks the same candidates regardless of map order.
+func sampleCandidates(docIds map[uint64]map[int64]struct{}, n int, seed int64) map[uint64]map[int64]struct{} {
+	candidates := candidateScores(docIds, 0)
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		j := i + rng.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+
+	sampled := make(map[uint64]map[int64]struct{})
+	for _, c := range candidates[:n] {
+		indexes, exists := sampled[c.UID]
+		if !exists {
+			indexes = make(map[int64]struct{})
+			sampled[c.UID] = indexes
+		}
+		indexes[c.Index] = struct{}{}
+	}
+	return sampled
+}
@@ -0,0 +1,546 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/stats"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+var (
+	ErrNoDocumentTypes          = errors.New("snapshot documents precede the document types header")
+	ErrUnsupportedTablesVersion = errors.New("unsupported version of the snapshot tables section")
+)
+
+// tablesVersion is the version of the tables section written by Save. Version 1 holds every table,
+// version 2 only the names and hash families of the tables and their timestamps with each table in a
+// section of its own.
+const tablesVersion = 2
+
+// Snapshot section names written by Save
+const (
+	sectionDocumentTypes = "document_types"
+	sectionTables        = "tables"
+	sectionDocuments     = "documents"
+	sectionRowWindows    = "row_windows"
+	sectionSequence      = "sequence"
+	sectionCounters      = "counters"
+	sectionACL           = "acl"
+	sectionDeleted       = "deleted" // uids deleted since the previous snapshot of an incremental snapshot
+)
+
+// savedTables is the tables section holding the hash families and buckets of every table
+type savedTables struct {
+	Version    int
+	Tables     []tables.State     // name and hash family of each table only from version 2
+	Timestamps map[uint64][]int64 // indexes of the windows of each uid shared by the tables
+}
+
+// tableSection returns the name of the section holding the table at position i
+func tableSection(i int) string {
+	return fmt.Sprintf("%s/%d", sectionTables, i)
+}
+
+// tablePosition returns the position of the table held by the named section if it is a table section
+func tablePosition(name string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, sectionTables+"/")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(suffix)
+	return i, err == nil
+}
+
+// savedDocument precedes each gob encoded document in the documents section
+type savedDocument struct {
+	Type    int     // position of the document type name in the document types header
+	Windows []int64 // indexes of the windows hashed into the tables
+}
+
+// Save writes the tables and stored documents to a snapshot. The names of the registered document
+// types present are written as a header section ahead of the documents so documents of different and
+// custom types can be restored by Load as long as their types are registered under the same names.
+// Mutations wait for the snapshot to be written.
+func (l *LSH) Save(w io.Writer, opts snapshot.Options) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.save(w, opts)
+}
+
+func (l *LSH) save(w io.Writer, opts snapshot.Options) error {
+	var rangeErr error
+	docs := newDocumentWriter()
+	l.Docs.Range(func(d document.Document) bool {
+		rangeErr = docs.write(d, l.Tables[0].Timestamps.Get(d.GetUID()))
+		return rangeErr == nil
+	})
+	if rangeErr != nil {
+		return rangeErr
+	}
+	// documents failing to be read are skipped by Range
+	if err := l.docsErr(); err != nil {
+		return err
+	}
+
+	sw, err := snapshot.NewWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if err := l.writeTables(sw); err != nil {
+		return err
+	}
+	if err := docs.writeSections(sw); err != nil {
+		return err
+	}
+	if err := l.writeACL(sw, nil); err != nil {
+		return err
+	}
+	rows, err := json.Marshal(l.RowWindows())
+	if err != nil {
+		return err
+	}
+	if err := sw.WriteSection(sectionRowWindows, rows); err != nil {
+		return err
+	}
+	if err := l.writeSequence(sw); err != nil {
+		return err
+	}
+	if err := l.writeCounters(sw); err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+// writeTables writes the names and hash families of the tables and their timestamps followed by a
+// section per table encoded concurrently
+func (l *LSH) writeTables(sw *snapshot.Writer) error {
+	states, timestamps, err := tables.Snapshot(l.Tables)
+	if err != nil {
+		return err
+	}
+	headers := make([]tables.State, len(states))
+	for i, s := range states {
+		headers[i] = tables.State{Name: s.Name, Family: s.Family, FamilyData: s.FamilyData}
+	}
+	var tbls bytes.Buffer
+	saved := savedTables{Version: tablesVersion, Tables: headers, Timestamps: timestamps}
+	if err := gob.NewEncoder(&tbls).Encode(saved); err != nil {
+		return err
+	}
+	if err := sw.WriteSection(sectionTables, tbls.Bytes()); err != nil {
+		return err
+	}
+
+	sections := make([]snapshot.SectionEncoder, len(states))
+	for i := range states {
+		state := states[i]
+		sections[i] = snapshot.SectionEncoder{
+			Name: tableSection(i),
+			Encode: func() ([]byte, error) {
+				var buf bytes.Buffer
+				if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
+			},
+		}
+	}
+	return sw.WriteSections(sections, 0)
+}
+
+// documentWriter gob encodes documents each preceded by the position of its type name in the document
+// types header
+type documentWriter struct {
+	names []string
+	types map[string]int
+	buf   bytes.Buffer
+	enc   *gob.Encoder
+}
+
+func newDocumentWriter() *documentWriter {
+	w := &documentWriter{types: make(map[string]int)}
+	w.enc = gob.NewEncoder(&w.buf)
+	return w
+}
+
+func (w *documentWriter) write(d document.Document, windows []int64) error {
+	name, err := document.TypeName(d)
+	if err != nil {
+		return err
+	}
+	typ, exists := w.types[name]
+	if !exists {
+		typ = len(w.names)
+		w.types[name] = typ
+		w.names = append(w.names, name)
+	}
+	if err := w.enc.Encode(savedDocument{Type: typ, Windows: windows}); err != nil {
+		return err
+	}
+	return w.enc.Encode(d)
+}
+
+// writeSections writes the document types header followed by the documents
+func (w *documentWriter) writeSections(sw *snapshot.Writer) error {
+	header, err := json.Marshal(w.names)
+	if err != nil {
+		return err
+	}
+	if err := sw.WriteSection(sectionDocumentTypes, header); err != nil {
+		return err
+	}
+	return sw.WriteSection(sectionDocuments, w.buf.Bytes())
+}
+
+// writeSequence writes the sequence number of the last mutation included in the snapshot
+func (l *LSH) writeSequence(sw *snapshot.Writer) error {
+	seq, err := json.Marshal(l.seq.Load())
+	if err != nil {
+		return err
+	}
+	return sw.WriteSection(sectionSequence, seq)
+}
+
+// writeACL writes the access control label of every labeled uid, or of the given uids only, after the
+// documents so loading the documents of an incremental snapshot doesn't drop the labels
+func (l *LSH) writeACL(sw *snapshot.Writer, uids map[uint64]struct{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(l.acl.snapshot(uids)); err != nil {
+		return err
+	}
+	return sw.WriteSection(sectionACL, buf.Bytes())
+}
+
+// writeCounters writes the cumulative operation counters of the index
+func (l *LSH) writeCounters(sw *snapshot.Writer) error {
+	counters, err := json.Marshal(l.Counters())
+	if err != nil {
+		return err
+	}
+	return sw.WriteSection(sectionCounters, counters)
+}
+
+// Load restores the tables and documents of a snapshot written by Save into an empty index along with
+// the access control label of each document, the last updated time of each row window, the sequence
+// number of the last mutation included and the cumulative operation counters. The tables replace those
+// of the index so the hash families of the snapshot are used regardless of the configured seed.
+// Snapshots without a tables section are restored by rehashing every window that was indexed. Unknown
+// sections are skipped.
+func (l *LSH) Load(r io.Reader, opts snapshot.Options) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if l.Docs.Size() > 0 {
+		return ErrIndexNotEmpty
+	}
+	sr, err := snapshot.NewReader(r, opts)
+	if err != nil {
+		return err
+	}
+	return l.loadSections(sr, false)
+}
+
+// loadSections restores every section of the snapshot. Documents of an incremental snapshot replace
+// the stored document of the same uid.
+func (l *LSH) loadSections(sr *snapshot.Reader, incremental bool) error {
+	sl := newSectionLoader(l, incremental)
+	for {
+		name, payload, err := sr.Next()
+		if err == io.EOF {
+			return sl.finish()
+		}
+		if err != nil {
+			return err
+		}
+		if err := sl.load(name, payload); err != nil {
+			return err
+		}
+	}
+}
+
+// sectionLoader restores the sections of a snapshot in the order they were written. Tables split
+// across sections are restored once the documents are reached and saved counters once every document
+// is loaded as restoring documents counts them again.
+type sectionLoader struct {
+	l           *LSH
+	incremental bool
+	ctors       []document.Constructor
+	rehash      bool
+	pending     *savedTables // tables waiting for their table sections
+	decoded     []bool       // table sections of the pending tables decoded
+	counters    *stats.Counters
+}
+
+func newSectionLoader(l *LSH, incremental bool) *sectionLoader {
+	return &sectionLoader{l: l, incremental: incremental, rehash: true}
+}
+
+func (sl *sectionLoader) load(name string, payload []byte) error {
+	l := sl.l
+	switch name {
+	case sectionDocumentTypes:
+		var names []string
+		if err := json.Unmarshal(payload, &names); err != nil {
+			return err
+		}
+		sl.ctors = make([]document.Constructor, len(names))
+		for i, name := range names {
+			var err error
+			if sl.ctors[i], err = document.Lookup(name); err != nil {
+				return err
+			}
+		}
+	case sectionTables:
+		saved, err := decodeTables(payload)
+		if err != nil {
+			return err
+		}
+		sl.setTables(saved)
+	case sectionDocuments:
+		if sl.ctors == nil {
+			return ErrNoDocumentTypes
+		}
+		if err := sl.restoreTables(); err != nil {
+			return err
+		}
+		return l.loadDocuments(payload, sl.ctors, sl.rehash, sl.incremental)
+	case sectionDeleted:
+		var uids []uint64
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&uids); err != nil {
+			return err
+		}
+		for _, uid := range uids {
+			if _, err := l.deleteWithReport(uid); err != nil && !errors.Is(err, lsherrors.DocumentNotStored) {
+				return err
+			}
+		}
+	case sectionACL:
+		var labels map[uint64]string
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&labels); err != nil {
+			return err
+		}
+		for uid, label := range labels {
+			l.acl.set(uid, label)
+		}
+	case sectionRowWindows:
+		var rows []stats.RowWindow
+		if err := json.Unmarshal(payload, &rows); err != nil {
+			return err
+		}
+		l.rows.restore(rows)
+	case sectionSequence:
+		var seq uint64
+		if err := json.Unmarshal(payload, &seq); err != nil {
+			return err
+		}
+		l.seq.Store(seq)
+	case sectionCounters:
+		sl.counters = new(stats.Counters)
+		if err := json.Unmarshal(payload, sl.counters); err != nil {
+			return err
+		}
+	default:
+		i, ok := tablePosition(name)
+		if !ok || sl.pending == nil {
+			return nil
+		}
+		if sl.pending.Version == 1 || i < 0 || i >= len(sl.pending.Tables) {
+			return fmt.Errorf("%w, unexpected section %s", snapshot.ErrCorrupt, name)
+		}
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&sl.pending.Tables[i]); err != nil {
+			return err
+		}
+		sl.decoded[i] = true
+	}
+	return nil
+}
+
+// setTables holds the decoded tables section until its tables are restored replacing any pending
+// tables
+func (sl *sectionLoader) setTables(saved *savedTables) {
+	sl.pending = saved
+	sl.decoded = make([]bool, len(saved.Tables))
+	for i := range sl.decoded {
+		sl.decoded[i] = saved.Version == 1
+	}
+	sl.rehash = false
+}
+
+// restoreTables replaces the tables of the index with the pending tables if any
+func (sl *sectionLoader) restoreTables() error {
+	if sl.pending == nil {
+		return nil
+	}
+	for i, decoded := range sl.decoded {
+		if !decoded {
+			return fmt.Errorf("%w, missing section %s", snapshot.ErrCorrupt, tableSection(i))
+		}
+	}
+	restored, err := tables.Restore(sl.l.Cfg, sl.pending.Tables, sl.pending.Timestamps)
+	if err != nil {
+		return err
+	}
+	sl.l.setTables(restored)
+	sl.pending, sl.decoded = nil, nil
+	return nil
+}
+
+// finish restores the tables of a snapshot without documents and the saved counters
+func (sl *sectionLoader) finish() error {
+	if err := sl.restoreTables(); err != nil {
+		return err
+	}
+	if sl.counters != nil {
+		sl.l.RestoreCounters(*sl.counters)
+	}
+	return nil
+}
+
+// decodeTables decodes the tables section
+func decodeTables(payload []byte) (*savedTables, error) {
+	var saved savedTables
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Version != 1 && saved.Version != tablesVersion {
+		return nil, fmt.Errorf("%w, %d", ErrUnsupportedTablesVersion, saved.Version)
+	}
+	return &saved, nil
+}
+
+// ReadTables reads the tables at the given positions from a snapshot of the given size without
+// reading the documents or the other tables
+func ReadTables(r io.ReaderAt, size int64, opts snapshot.Options, positions ...int) ([]tables.State, error) {
+	f, err := snapshot.Open(r, size, opts)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := f.Section(sectionTables)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := payload.Load()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := decodeTables(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(positions))
+	for i, pos := range positions {
+		if pos < 0 || pos >= len(saved.Tables) {
+			return nil, fmt.Errorf("%w, position %d of %d", ErrTableNotFound, pos, len(saved.Tables))
+		}
+		names[i] = tableSection(pos)
+	}
+	states := make([]tables.State, len(positions))
+	if saved.Version == 1 {
+		for i, pos := range positions {
+			states[i] = saved.Tables[pos]
+		}
+		return states, nil
+	}
+	loaded, err := f.LoadSections(names, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if err := gob.NewDecoder(bytes.NewReader(loaded[name])).Decode(&states[i]); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// setTables replaces the tables of the index with restored tables
+func (l *LSH) setTables(restored []*tables.Table) {
+	for _, t := range restored {
+		t.Vectors = l.hashedVector
+	}
+	l.Tables = restored
+}
+
+// loadDocuments decodes the documents section restoring each document and its windows. Documents
+// already stored are deleted first when replacing.
+func (l *LSH) loadDocuments(payload []byte, ctors []document.Constructor, rehash, replace bool) error {
+	return decodeDocuments(payload, ctors, func(d document.Document, windows []int64) error {
+		if _, exists := l.Docs.Exists(d.GetUID()); exists && replace {
+			if _, err := l.deleteWithReport(d.GetUID()); err != nil {
+				return err
+			}
+		}
+		return l.restore(d, windows, rehash)
+	})
+}
+
+// decodeDocuments calls fn with each document of the documents section and the indexes of its windows
+// hashed into the tables
+func decodeDocuments(payload []byte, ctors []document.Constructor, fn func(d document.Document, windows []int64) error) error {
+	dec := gob.NewDecoder(bytes.NewReader(payload))
+	for {
+		var saved savedDocument
+		if err := dec.Decode(&saved); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if saved.Type < 0 || saved.Type >= len(ctors) {
+			return snapshot.ErrCorrupt
+		}
+		d := ctors[saved.Type]()
+		if err := dec.Decode(d); err != nil {
+			return err
+		}
+		if err := fn(d, saved.Windows); err != nil {
+			return err
+		}
+	}
+}
+
+// restore stores the document and hashes each of its windows into the tables unless the tables were
+// already restored
+func (l *LSH) restore(d document.Document, windows []int64, rehash bool) error {
+	uid := d.GetUID()
+	now := time.Now()
+	if err := l.Docs.Index(d); err != nil {
+		return err
+	}
+	l.acl.index(d)
+	for _, index := range windows {
+		vec := l.Docs.GetVector(uid, index)
+		if vec == nil {
+			continue
+		}
+		l.setChecksum(uid, index, windowChecksum(vec))
+		fillMissing(vec)
+		vec = l.Cfg.TFunc(vec)
+		if rehash {
+			if err := l.index(document.NewSimple(uid, index, l.reduce(vec))); err != nil {
+				return err
+			}
+		}
+		if l.shadow != nil {
+			if err := l.shadow.index(uid, index, vec); err != nil {
+				return err
+			}
+		}
+		l.rows.add(l.rowStart(index), now)
+		l.counters.indexed.Add(1)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package lsh
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+type regionDocument struct {
+	document.Simple
+	Region string
+}
+
+func (r *regionDocument) Copy() document.Document {
+	next := *r
+	next.Vector = append([]float64(nil), r.Vector...)
+	return &next
+}
+
+func TestSaveLoad(t *testing.T) {
+	if err := document.RegisterType("region", func() document.Document { return new(regionDocument) }); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(1, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, 60, []float64{3, math.NaN(), 4}),
+		&regionDocument{Simple: document.Simple{UID: 2, Index: 0, Vector: []float64{0, 2, 6}, Label: "a"}, Region: "us"},
+		document.NewSimple(3, 0, []float64{3, 1, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	restored, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Load(bytes.NewReader(saved), snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := restored.Counters().TotalIndexed; n != 4 {
+		t.Errorf("expected %d restored windows, but got %d", 4, n)
+	}
+	d, exists := restored.Docs.Exists(2)
+	if !exists {
+		t.Fatal("expected uid 2 to be restored")
+	}
+	if r, ok := d.(*regionDocument); !ok || r.Region != "us" {
+		t.Errorf("expected region document, but got %+v", d)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.ACL = []string{"a"}
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	expected, _, err := lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) == 0 {
+		t.Fatal("expected search results before saving")
+	}
+	res, _, err := restored.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.Load(bytes.NewReader(saved), snapshot.Options{}); err != ErrIndexNotEmpty {
+		t.Errorf("expected %v, but got %v", ErrIndexNotEmpty, err)
+	}
+
+	var unknown bytes.Buffer
+	sw, err := snapshot.NewWriter(&unknown, snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.WriteSection(sectionDocumentTypes, []byte(`["missing"]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := empty.Load(&unknown, snapshot.Options{}); !errors.Is(err, document.ErrUnknownType) {
+		t.Errorf("expected %v, but got %v", document.ErrUnknownType, err)
+	}
+}
+
+func TestSaveLoadACL(t *testing.T) {
+	testData := []struct {
+		name      string
+		arenaSize int
+	}{
+		{"slices", 0},
+		{"arena", 16},
+	}
+
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			cfg := configs.NewDefaultLSHConfigs()
+			cfg.Seed = 1
+			cfg.EnforceACL = true
+			cfg.VectorArenaSize = td.arenaSize
+			lsh, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			docs := []document.Document{
+				&document.Simple{UID: 0, Index: 0, Vector: []float64{0, 1, 3}, Label: "alice"},
+				&document.Simple{UID: 0, Index: 60, Vector: []float64{0, 2, 6}, Label: "alice"},
+				&document.Simple{UID: 1, Index: 0, Vector: []float64{0, 1, 3}, Label: "bob"},
+				&document.Simple{UID: 2, Index: 0, Vector: []float64{0, 1, 3}, Label: "alice"},
+			}
+			for _, d := range docs {
+				if err := lsh.Index(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := restored.Load(&buf, snapshot.Options{}); err != nil {
+				t.Fatal(err)
+			}
+			d, exists := restored.Docs.Exists(0)
+			if !exists {
+				t.Fatal("expected uid 0 to be restored")
+			}
+			if label := d.(document.Labeler).GetLabel(); label != "alice" {
+				t.Errorf("expected label %q, but got %q", "alice", label)
+			}
+
+			clone, err := restored.Clone(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			so := options.NewDefaultSearch()
+			so.SignFilter = options.SignFilter_POS
+			so.ACL = []string{"alice"}
+			query := document.NewSimple(0, 0, []float64{0, 1, 3})
+			for name, l := range map[string]*LSH{"original": lsh, "restored": restored, "clone": clone} {
+				res, _, err := l.Search(query, so)
+				if err != nil {
+					t.Fatal(err)
+				}
+				uids := res.UIDs()
+				sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+				if err := compareUint64s([]uint64{0, 0, 2}, uids); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveLoadTableSections(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 1
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := [][]float64{{0, 1, 3}, {0, 2, 6}, {3, 1, 0}, {1, 2, 3}}
+	for i, vec := range vectors {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, vec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	so := options.NewDefaultSearch()
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	expected, _, err := lsh.Search(query, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := lsh.Save(&buf, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := snapshot.Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range lsh.Tables {
+		if _, err := f.Section(tableSection(i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// a version 1 snapshot holds every table in the tables section
+	var v1 bytes.Buffer
+	sw, err := snapshot.NewWriter(&v1, snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, timestamps, err := tables.Snapshot(lsh.Tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tbls bytes.Buffer
+	if err := gob.NewEncoder(&tbls).Encode(savedTables{Version: 1, Tables: states, Timestamps: timestamps}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.WriteSection(sectionTables, tbls.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	docs := newDocumentWriter()
+	lsh.Docs.Range(func(d document.Document) bool {
+		err = docs.write(d, lsh.Tables[0].Timestamps.Get(d.GetUID()))
+		return err == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := docs.writeSections(sw); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		name     string
+		snapshot []byte
+	}{
+		{"sections", buf.Bytes()},
+		{"version 1", v1.Bytes()},
+	}
+
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			restored, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := restored.Load(bytes.NewReader(td.snapshot), snapshot.Options{}); err != nil {
+				t.Fatal(err)
+			}
+			res, _, err := restored.Search(query, so)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+				t.Fatal(err)
+			}
+
+			r := bytes.NewReader(td.snapshot)
+			states, err := ReadTables(r, r.Size(), snapshot.Options{}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(states) != 1 || states[0].Name != lsh.Tables[1].Name {
+				t.Fatalf("expected table %s, but got %+v", lsh.Tables[1].Name, states)
+			}
+			if len(states[0].Doc2Hash) != len(vectors) {
+				t.Errorf("expected %d hashed uids, but got %d", len(vectors), len(states[0].Doc2Hash))
+			}
+			if _, err := ReadTables(r, r.Size(), snapshot.Options{}, len(lsh.Tables)); !errors.Is(err, ErrTableNotFound) {
+				t.Errorf("expected %v, but got %v", ErrTableNotFound, err)
+			}
+		})
+	}
+}
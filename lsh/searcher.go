@@ -0,0 +1,134 @@
+package lsh
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+	"gonum.org/v1/gonum/floats"
+)
+
+// Searcher searches an index caching the score of every candidate scored for each query, e.g. for an
+// interactive session issuing the same query with different thresholds or numbers of results. Repeated
+// queries only filter the tables again scoring just the candidates not seen before. Queries are told
+// apart by a fingerprint of their transformed vector and the cached scores are dropped once the index is
+// mutated. A Searcher is safe for concurrent use.
+type Searcher struct {
+	lsh        *LSH
+	maxQueries int
+
+	mu         sync.Mutex
+	generation uint64                 // generation of the index the cached scores were computed at
+	queries    map[uint64]*scoreCache // keyed by the fingerprint of the query
+	order      []uint64               // fingerprints from the least recently added
+}
+
+// NewSearcher returns a searcher of the index caching the scores of up to maxQueries queries dropping
+// the oldest first. A maxQueries of 0 caches every query.
+func NewSearcher(l *LSH, maxQueries int) *Searcher {
+	return &Searcher{lsh: l, maxQueries: maxQueries, queries: make(map[uint64]*scoreCache)}
+}
+
+// Search searches the index like LSH.Search
+func (s *Searcher) Search(d document.Document, so *options.Search) (results.Scores, int, error) {
+	return s.SearchContext(context.Background(), d, so)
+}
+
+// SearchContext searches the index like LSH.SearchContext
+func (s *Searcher) SearchContext(ctx context.Context, d document.Document, so *options.Search) (results.Scores, int, error) {
+	scores, diag, err := s.lsh.searchWithHooks(ctx, d, so, s)
+	return scores, diag.NumScored, err
+}
+
+// SearchWithDiagnostics searches the index like LSH.SearchWithDiagnostics. Candidates read from the
+// cache count as scored.
+func (s *Searcher) SearchWithDiagnostics(d document.Document, so *options.Search) (results.Scores, results.Diagnostics, error) {
+	return s.lsh.searchWithHooks(context.Background(), d, so, s)
+}
+
+// Reset drops every cached score
+func (s *Searcher) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = make(map[uint64]*scoreCache)
+	s.order = nil
+}
+
+// cache returns the scores cached for the transformed query vector at the generation of the index,
+// dropping every cached score if the index has been mutated since they were computed. Returns nil for a
+// nil searcher.
+func (s *Searcher) cache(query []float64, generation uint64) *scoreCache {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation != s.generation {
+		s.queries = make(map[uint64]*scoreCache)
+		s.order = nil
+		s.generation = generation
+	}
+
+	fingerprint := windowChecksum(query)
+	if c, exists := s.queries[fingerprint]; exists && floats.Same(c.query, query) {
+		return c
+	}
+	c := &scoreCache{query: append([]float64(nil), query...), scores: make(map[uint64]map[int64]cachedScore)}
+	if _, exists := s.queries[fingerprint]; !exists {
+		s.order = append(s.order, fingerprint)
+	}
+	s.queries[fingerprint] = c
+	if s.maxQueries > 0 && len(s.order) > s.maxQueries {
+		delete(s.queries, s.order[0])
+		s.order = s.order[1:]
+	}
+	return c
+}
+
+// cachedScore is the score of a candidate window against a query
+type cachedScore struct {
+	score    float64
+	trend    float64
+	hasTrend bool // the trend was computed along with the score
+	ok       bool // the window is stored and overlaps the query enough to be scored
+}
+
+// scoreCache holds the scores of the candidates of a query
+type scoreCache struct {
+	query []float64
+
+	mu     sync.RWMutex
+	scores map[uint64]map[int64]cachedScore
+}
+
+// get returns the cached score of the candidate window. A score cached without its trend is missing
+// when the trend is requested.
+func (c *scoreCache) get(uid uint64, index int64, trend bool) (cachedScore, bool) {
+	if c == nil {
+		return cachedScore{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	score, exists := c.scores[uid][index]
+	if !exists || (trend && score.ok && !score.hasTrend) {
+		return cachedScore{}, false
+	}
+	return score, true
+}
+
+// put caches the score of the candidate window
+func (c *scoreCache) put(uid uint64, index int64, score cachedScore) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	indexes, exists := c.scores[uid]
+	if !exists {
+		indexes = make(map[int64]cachedScore)
+		c.scores[uid] = indexes
+	}
+	indexes[index] = score
+}
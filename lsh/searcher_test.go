@@ -0,0 +1,82 @@
+package lsh
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestSearcher(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	searcher := NewSearcher(lsh, 1)
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	var cached *scoreCache
+	for _, threshold := range []float64{0.95, 0.8, 0.65} {
+		so := options.NewDefaultSearch()
+		so.Threshold = threshold
+		so.NumToReturn = 20
+		expected, _, err := lsh.Search(query.Copy(), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _, err := searcher.Search(query.Copy(), so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+			t.Errorf("threshold %v, %v", threshold, err)
+		}
+		if len(searcher.queries) != 1 {
+			t.Fatalf("expected %d cached query, but got %d", 1, len(searcher.queries))
+		}
+		for _, c := range searcher.queries {
+			if cached != nil && c != cached {
+				t.Errorf("expected the scores of the query to be reused at threshold %v", threshold)
+			}
+			cached = c
+		}
+	}
+	if len(cached.scores) == 0 {
+		t.Fatal("expected candidate scores to be cached")
+	}
+
+	// a different query is cached in place of the oldest
+	if _, _, err := searcher.Search(document.NewSimple(0, 0, []float64{3, 1, 0}), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := searcher.queries[windowChecksum(cached.query)]; exists || len(searcher.queries) != 1 {
+		t.Errorf("expected only the latest query to be cached, but got %d queries", len(searcher.queries))
+	}
+
+	// mutating the index drops the cached scores
+	if err := lsh.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := searcher.Search(query.Copy(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range res.UIDs() {
+		if uid == 0 {
+			t.Errorf("expected deleted uid %d not to be returned from the cache", uid)
+		}
+	}
+	if searcher.generation != lsh.Generation() {
+		t.Errorf("expected generation %d, but got %d", lsh.Generation(), searcher.generation)
+	}
+}
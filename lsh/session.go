@@ -0,0 +1,134 @@
+package lsh
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+// Session holds the candidates of a query along with their scores so the results can be refined
+// interactively, e.g. by changing the threshold, number of results or filters, without filtering the
+// tables or scoring the candidates again. The candidates are those of the index when the session was
+// created. A Session is safe for concurrent use.
+type Session struct {
+	lsh        *LSH
+	query      document.Document // transformed query the candidates are scored against
+	candidates map[uint64]map[int64]struct{}
+	scores     *scoreCache
+	diag       results.Diagnostics // diagnostics of filtering the candidates
+}
+
+// NewSession filters the candidates of the query like Search and scores every one of them. The
+// candidates are filtered for both signs regardless of the sign filter so it may be changed by Refine.
+// MaxLag, MaxTables, ProbeBudget, AlignmentFree and MaxCandidates of the search options are fixed for
+// the session.
+func (l *LSH) NewSession(d document.Document, s *options.Search) (*Session, error) {
+	return l.NewSessionContext(context.Background(), d, s)
+}
+
+// NewSessionContext creates a session like NewSession until the context is done
+func (l *LSH) NewSessionContext(ctx context.Context, d document.Document, s *options.Search) (*Session, error) {
+	if s == nil {
+		s = options.NewDefaultSearch()
+	} else if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	query, adj, err := l.searchQuery(d, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.admit.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.admit.release()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	sess := &Session{lsh: l, query: query}
+	sess.diag.Generation = l.Generation()
+	sess.diag.LengthAdjustment = adj
+	so := *s
+	so.SignFilter = options.SignFilter_ANY
+	docIds, probed, err := l.filter(ctx, query, &so)
+	if err != nil {
+		return nil, err
+	}
+	sess.diag.NumCandidates = numCandidates(docIds)
+	sess.diag.TablesProbed = len(probed)
+	sess.diag.EstimatedRecall = 1 - falseNegative(s.Threshold, probed)
+	if s.MaxCandidates > 0 && sess.diag.NumCandidates > s.MaxCandidates {
+		sess.diag.Seed = s.Seed
+		for sess.diag.Seed == 0 {
+			sess.diag.Seed = rand.Int63()
+		}
+		docIds = sampleCandidates(docIds, s.MaxCandidates, sess.diag.Seed)
+	}
+	sess.candidates = docIds
+
+	// every candidate is scored along with its trend so refining never reads the index
+	sess.scores = &scoreCache{scores: make(map[uint64]map[int64]cachedScore)}
+	res := results.New(1, 0, options.SignFilter_ANY)
+	res.Trend = true
+	if err := l.score(ctx, query, docIds, res, sess.scores); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// NumCandidates returns the number of candidate windows of the session
+func (sess *Session) NumCandidates() int {
+	return sess.diag.NumCandidates
+}
+
+// Refine returns the results of the session's candidates for the search options like
+// SearchWithDiagnostics. The time range and access control labels only narrow the candidates of the
+// session while the filtering options fixed by NewSession are ignored.
+func (sess *Session) Refine(s *options.Search) (results.Scores, results.Diagnostics, error) {
+	l := sess.lsh
+	diag := sess.diag
+	if s == nil {
+		s = options.NewDefaultSearch()
+	} else if err := s.Validate(); err != nil {
+		return nil, diag, err
+	}
+	if l.Cfg.EnforceACL && len(s.ACL) == 0 {
+		return nil, diag, ErrNoACL
+	}
+
+	docIds := sess.narrow(s)
+	diag.NumCandidates = numCandidates(docIds)
+	if s.CandidatesOnly {
+		return candidateScores(docIds, sess.query.GetIndex()), diag, nil
+	}
+	res := l.newResults(s)
+	if err := l.score(context.Background(), sess.query, docIds, res, sess.scores); err != nil {
+		return nil, diag, err
+	}
+	return l.fetch(s, res, &diag), diag, nil
+}
+
+// narrow returns the candidates of the session within the time range and access control labels of
+// the search options
+func (sess *Session) narrow(s *options.Search) map[uint64]map[int64]struct{} {
+	docIds := make(map[uint64]map[int64]struct{}, len(sess.candidates))
+	for uid, indexes := range sess.candidates {
+		narrowed := make(map[int64]struct{}, len(indexes))
+		for index := range indexes {
+			if tr := s.TimeRange; tr != nil && (index < tr.Start || index > tr.End) {
+				continue
+			}
+			narrowed[index] = struct{}{}
+		}
+		if len(narrowed) > 0 {
+			docIds[uid] = narrowed
+		}
+	}
+	if len(s.ACL) > 0 || sess.lsh.Cfg.EnforceACL {
+		sess.lsh.acl.filter(docIds, s.ACL)
+	}
+	return docIds
+}
@@ -0,0 +1,102 @@
+package lsh
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestSession(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), int64(i%10), []float64{rng.Float64(), rng.Float64(), rng.Float64()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{0, 1, 3})
+	so := options.NewDefaultSearch()
+	so.MaxLag = options.AllLags
+	sess, err := lsh.NewSession(query.Copy(), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.NumCandidates() == 0 {
+		t.Fatal("expected the session to hold candidates")
+	}
+
+	testData := []struct {
+		threshold   float64
+		numToReturn int
+		signFilter  options.SignFilter
+	}{
+		{0.95, 10, options.SignFilter_POS},
+		{0.8, 20, options.SignFilter_POS},
+		{0.65, 5, options.SignFilter_ANY},
+		{0.65, 50, options.SignFilter_ANY},
+	}
+	for _, td := range testData {
+		refined := *so
+		refined.Threshold = td.threshold
+		refined.NumToReturn = td.numToReturn
+		refined.SignFilter = td.signFilter
+		expected, _, err := lsh.Search(query.Copy(), &refined)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, diag, err := sess.Refine(&refined)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+			t.Errorf("threshold %v, %v", td.threshold, err)
+		}
+		if diag.NumScored != sess.NumCandidates() {
+			t.Errorf("expected %d scored candidates, but got %d", sess.NumCandidates(), diag.NumScored)
+		}
+	}
+
+	refined := *so
+	refined.Threshold = 0
+	refined.NumToReturn = 1000
+	refined.SignFilter = options.SignFilter_ANY
+	refined.TimeRange = &options.TimeRange{Start: 2, End: 3}
+	res, _, err := sess.Refine(&refined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) == 0 {
+		t.Fatal("expected results within the time range")
+	}
+	for _, r := range res {
+		if r.Index < 2 || r.Index > 3 {
+			t.Errorf("expected index within [2, 3], but got %d", r.Index)
+		}
+	}
+
+	// refining reads the candidates of the session rather than the index
+	refined.TimeRange = nil
+	before, _, err := sess.Refine(&refined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Delete(before[0].UID); err != nil {
+		t.Fatal(err)
+	}
+	after, _, err := sess.Refine(&refined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s(before.UIDs(), after.UIDs()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,141 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+var ErrShadowMismatch = errors.New("shadow configs must have the same vector length and sample period as the index")
+
+// shadow is an alternative set of tables sharing the forward index of the index. Searches are mirrored
+// against it to compare recall and latency without affecting served results.
+type shadow struct {
+	lsh *LSH
+
+	mu       sync.Mutex
+	searches uint64
+	recall   float64       // sum of the fraction of served results also found by the shadow
+	primary  time.Duration // sum of served search latencies
+	mirrored time.Duration // sum of shadow search latencies
+}
+
+// SetShadow builds shadow tables with the alternative hash parameters of cfg from the documents already
+// indexed and mirrors every following search against them. The shadow shares the forward index and
+// transform of the index. A nil cfg removes the shadow.
+func (l *LSH) SetShadow(cfg *configs.LSHConfigs) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cfg == nil {
+		l.shadow = nil
+		return nil
+	}
+	if cfg.VectorLength != l.Cfg.VectorLength || cfg.SamplePeriod != l.Cfg.SamplePeriod {
+		return ErrShadowMismatch
+	}
+	c := *cfg
+	c.TFunc, c.Transform = l.Cfg.TFunc, l.Cfg.Transform
+	sl, err := New(&c)
+	if err != nil {
+		return err
+	}
+	sl.Docs = l.Docs
+
+	// the timestamps of every indexed window are shared by the tables
+	l.Tables[0].Timestamps.Range(func(uid uint64, indexes []int64) bool {
+		for _, index := range indexes {
+			vec := sl.hashedVector(uid, index)
+			if vec == nil {
+				continue
+			}
+			if err = sl.index(document.NewSimple(uid, index, vec)); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	l.shadow = &shadow{lsh: sl}
+	return nil
+}
+
+// index hashes the transformed vector into the shadow tables
+func (s *shadow) index(uid uint64, index int64, transformed []float64) error {
+	return s.lsh.index(document.NewSimple(uid, index, s.lsh.reduce(transformed)))
+}
+
+func (s *shadow) delete(uid uint64) {
+	for _, t := range s.lsh.Tables {
+		t.Delete(uid)
+	}
+}
+
+// mirror searches the shadow tables with the transformed query and records how the results and latency
+// compare to the served results
+func (s *shadow) mirror(d document.Document, so *options.Search, served results.Scores, latency time.Duration) {
+	start := time.Now()
+	docIds, _, err := s.lsh.filter(context.Background(), d, so)
+	if err != nil {
+		return
+	}
+	numToReturn, threshold := resultLimits(so)
+	res := results.New(numToReturn, threshold, so.SignFilter)
+	res.Precision = so.ScorePrecision
+	res.MaxPerUID = so.MaxPerUID
+	if so.TargetResults == nil {
+		res.NegativeThreshold = so.NegativeThreshold
+	}
+	res.HalfLife = so.RecencyBoost
+	res.Group = s.lsh.group(so.GroupBy)
+	s.lsh.Score(d, docIds, res)
+	found := res.Fetch()
+	if so.TargetResults != nil {
+		found, _ = results.Adapt(found, *so.TargetResults, so.Threshold)
+	}
+	elapsed := time.Since(start)
+
+	recall := 1.0
+	if len(served) > 0 {
+		shadowed := make(map[uint64]struct{}, len(found))
+		for _, score := range found {
+			shadowed[score.UID] = struct{}{}
+		}
+		var hits int
+		for _, score := range served {
+			if _, exists := shadowed[score.UID]; exists {
+				hits++
+			}
+		}
+		recall = float64(hits) / float64(len(served))
+	}
+
+	s.mu.Lock()
+	s.searches++
+	s.recall += recall
+	s.primary += latency
+	s.mirrored += elapsed
+	s.mu.Unlock()
+}
+
+func (s *shadow) stats() *stats.Shadow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &stats.Shadow{
+		NumTables: s.lsh.Cfg.NumTables,
+		Searches:  s.searches,
+	}
+	if s.searches > 0 {
+		st.MeanRecall = s.recall / float64(s.searches)
+		st.MeanLatencyDelta = (s.mirrored - s.primary) / time.Duration(s.searches)
+	}
+	return st
+}
@@ -0,0 +1,78 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestShadow(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(0, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	shadowCfg := configs.NewDefaultLSHConfigs()
+	shadowCfg.VectorLength = 4
+	if err := lsh.SetShadow(shadowCfg); err != ErrShadowMismatch {
+		t.Fatalf("expected %v, but got %v error", ErrShadowMismatch, err)
+	}
+
+	shadowCfg = configs.NewDefaultLSHConfigs()
+	shadowCfg.NumTables = 32
+	shadowCfg.NumHyperplanes = 4
+	if err := lsh.SetShadow(shadowCfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 2.9})); err != nil {
+		t.Fatal(err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected %d results, but got %d", 2, len(res))
+	}
+
+	st, err := lsh.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := st.Shadow
+	if s == nil {
+		t.Fatalf("expected shadow stats")
+	}
+	if s.Searches != 1 || s.NumTables != 32 {
+		t.Errorf("expected 1 search over 32 tables, but got %+v", s)
+	}
+	// the backfilled and newly indexed documents are both found by the shadow
+	if s.MeanRecall != 1 {
+		t.Errorf("expected recall of %v, but got %v", 1.0, s.MeanRecall)
+	}
+
+	if err := lsh.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range lsh.shadow.lsh.Tables {
+		if _, exists := tbl.Doc2Hash[1]; exists {
+			t.Fatalf("expected deleted uid to be removed from the shadow tables")
+		}
+	}
+
+	if err := lsh.SetShadow(nil); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := lsh.Stats(); st.Shadow != nil {
+		t.Errorf("expected no shadow stats after removing the shadow")
+	}
+}
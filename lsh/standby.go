@@ -0,0 +1,111 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/cdc"
+)
+
+var (
+	ErrMutationGap = errors.New("mutation stream skipped a sequence number")
+	ErrPromoted    = errors.New("standby has already been promoted")
+)
+
+// Standby keeps a warm copy of a primary index by applying the mutations of its change data capture
+// stream. The standby index is created or restored with the same hash families as the primary so that
+// promoting it serves the same results.
+type Standby struct {
+	mu       sync.Mutex
+	lsh      *LSH
+	src      cdc.Reader
+	promoted bool
+}
+
+// NewStandby tails the mutations of src into l. Mutations up to the last sequence number already
+// applied to l, such as those included in the snapshot it was restored from, are skipped.
+func NewStandby(l *LSH, src cdc.Reader) *Standby {
+	return &Standby{lsh: l, src: src}
+}
+
+// Seq returns the sequence number of the last mutation applied
+func (s *Standby) Seq() uint64 {
+	return s.lsh.seq.Load()
+}
+
+// Apply applies a single mutation of the primary. Mutations already applied are ignored and a gap in
+// the sequence numbers is an error since the standby would silently diverge from the primary.
+func (s *Standby) Apply(m cdc.Mutation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.promoted {
+		return ErrPromoted
+	}
+	return s.apply(m)
+}
+
+func (s *Standby) apply(m cdc.Mutation) error {
+	applied := s.lsh.seq.Load()
+	if m.Seq <= applied {
+		return nil
+	}
+	if m.Seq != applied+1 {
+		return fmt.Errorf("%w, expected %d but got %d", ErrMutationGap, applied+1, m.Seq)
+	}
+
+	var err error
+	switch m.Op {
+	case cdc.OpIndex:
+		err = s.lsh.replayIndex(m.Document())
+	case cdc.OpDelete:
+		err = s.lsh.Delete(m.UID)
+	}
+	// the primary only captures mutations it applied so the standby follows its sequence regardless
+	s.lsh.seq.Store(m.Seq)
+	return err
+}
+
+// CatchUp applies mutations from the stream until it is exhausted returning the number applied
+func (s *Standby) CatchUp() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.promoted {
+		return 0, ErrPromoted
+	}
+	return s.catchUp()
+}
+
+func (s *Standby) catchUp() (int, error) {
+	var n int
+	for {
+		m, err := s.src.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := s.apply(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Promote applies any remaining mutations of the stream and stops tailing it, returning the index to be
+// served. Mutations of the promoted index continue the sequence numbers of the primary once its CDC
+// writer is set.
+func (s *Standby) Promote() (*LSH, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.promoted {
+		return nil, ErrPromoted
+	}
+	if _, err := s.catchUp(); err != nil {
+		return nil, err
+	}
+	s.promoted = true
+	return s.lsh, nil
+}
@@ -0,0 +1,92 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hashfamily"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestStandby(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	primary, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	primary.CDC = cdc.NewJSONWriter(&buf)
+
+	families := make([]hashfamily.Family, len(primary.Tables))
+	for i, tbl := range primary.Tables {
+		families[i] = tbl.Family
+	}
+	replica, err := NewWithFamilies(cfg, families)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standby := NewStandby(replica, cdc.NewJSONReader(&buf))
+
+	docs := []*document.Simple{
+		{UID: 0, Vector: []float64{0, 1, 3}},
+		{UID: 1, Vector: []float64{0, 1, 2.9}, Label: "alice"},
+		{UID: 2, Vector: []float64{0, 1, 2.8}},
+	}
+	for _, d := range docs {
+		if err := primary.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := primary.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := standby.CatchUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || standby.Seq() != 4 {
+		t.Fatalf("expected %d mutations applied, but got %d up to seq %d", 4, n, standby.Seq())
+	}
+
+	// replayed mutations are ignored and gaps are rejected
+	if err := standby.Apply(cdc.Mutation{Seq: 4, Op: cdc.OpDelete, UID: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := standby.Apply(cdc.Mutation{Seq: 6, Op: cdc.OpDelete, UID: 0}); !errors.Is(err, ErrMutationGap) {
+		t.Fatalf("expected %v, but got %v error", ErrMutationGap, err)
+	}
+
+	if err := primary.Index(document.NewSimple(3, 0, []float64{0, 1, 2.7})); err != nil {
+		t.Fatal(err)
+	}
+	promoted, err := standby.Promote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := standby.CatchUp(); err != ErrPromoted {
+		t.Fatalf("expected %v, but got %v error", ErrPromoted, err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	query := []float64{0, 1, 3}
+	expected, _, err := primary.Search(document.NewSimple(0, 0, query), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := promoted.Search(document.NewSimple(0, 0, query), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareUint64s(expected.UIDs(), res.UIDs()); err != nil {
+		t.Fatal(err)
+	}
+	if label := promoted.acl.uids[1]; label != "alice" {
+		t.Errorf("expected label %q to be replicated, but got %q", "alice", label)
+	}
+}
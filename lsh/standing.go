@@ -0,0 +1,112 @@
+package lsh
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+)
+
+var ErrSubscriptionNotFound = errors.New("standing query subscription not found")
+
+// Match is a newly indexed window scoring above the threshold of a standing query
+type Match struct {
+	Subscription uint64        `json:"subscription"`
+	Score        results.Score `json:"score"`
+}
+
+// standingQuery is a transformed query vector scored against every window as it is indexed
+type standingQuery struct {
+	id     uint64
+	query  document.Document
+	search *options.Search
+	notify func(Match)
+}
+
+// standing holds the registered standing queries
+type standing struct {
+	mu      sync.RWMutex
+	next    uint64
+	queries map[uint64]*standingQuery
+}
+
+// Subscribe registers a standing query that is scored against every window indexed from now on and
+// returns the id of the subscription. fn is called with each window scoring above the threshold and
+// passing the sign filter, ACL and time range of the search options. Standing queries match on shape
+// alone so MaxLag is ignored. fn is called synchronously by Index while the index is locked and should
+// neither block nor call back into the index.
+func (l *LSH) Subscribe(d document.Document, s *options.Search, fn func(Match)) (uint64, error) {
+	if s == nil {
+		s = options.NewDefaultSearch()
+	} else if err := s.Validate(); err != nil {
+		return 0, err
+	}
+	d, err := l.enriched(d)
+	if err != nil {
+		return 0, err
+	}
+	query, err := l.atSamplePeriod(d)
+	if err == ErrInvalidDocument && s.Resample != options.Resample_NONE {
+		query, err = l.fitQuery(d, s.Resample)
+	}
+	if err != nil {
+		return 0, err
+	}
+	l.transform(query.GetVector())
+	if l.Cfg.EnforceACL && len(s.ACL) == 0 {
+		return 0, ErrNoACL
+	}
+
+	l.standing.mu.Lock()
+	defer l.standing.mu.Unlock()
+	if l.standing.queries == nil {
+		l.standing.queries = make(map[uint64]*standingQuery)
+	}
+	l.standing.next++
+	q := &standingQuery{id: l.standing.next, query: query, search: s, notify: fn}
+	l.standing.queries[q.id] = q
+	return q.id, nil
+}
+
+// Unsubscribe removes the standing query
+func (l *LSH) Unsubscribe(id uint64) error {
+	l.standing.mu.Lock()
+	defer l.standing.mu.Unlock()
+	if _, exists := l.standing.queries[id]; !exists {
+		return ErrSubscriptionNotFound
+	}
+	delete(l.standing.queries, id)
+	return nil
+}
+
+// notify scores the newly indexed window of the uid against every standing query
+func (l *LSH) notify(uid uint64, index int64) {
+	l.standing.mu.RLock()
+	queries := make([]*standingQuery, 0, len(l.standing.queries))
+	for _, q := range l.standing.queries {
+		queries = append(queries, q)
+	}
+	l.standing.mu.RUnlock()
+
+	for _, q := range queries {
+		if tr := q.search.TimeRange; tr != nil && (index < tr.Start || index > tr.End) {
+			continue
+		}
+		docIds := map[uint64]map[int64]struct{}{uid: {index: struct{}{}}}
+		if len(q.search.ACL) > 0 {
+			l.acl.filter(docIds, q.search.ACL)
+		}
+		res := results.New(1, q.search.Threshold, q.search.SignFilter)
+		res.Trend = q.search.ReturnTrend
+		res.Precision = q.search.ScorePrecision
+		res.NegativeThreshold = q.search.NegativeThreshold
+		l.score(context.Background(), q.query, docIds, res, nil)
+		for _, score := range res.Fetch() {
+			score.Label = l.acl.label(uid)
+			q.notify(Match{Subscription: q.id, Score: score})
+		}
+	}
+}
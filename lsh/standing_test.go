@@ -0,0 +1,62 @@
+package lsh
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestStandingQuery(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matches []Match
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	so.Threshold = 0.9
+	id, err := lsh.Subscribe(document.NewSimple(0, 0, []float64{0, 1, 3}), so, func(m Match) {
+		matches = append(matches, m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(1, 3600, []float64{0, 1, 3}),
+		document.NewSimple(2, 7200, []float64{3, 1, 0}),
+		document.NewSimple(3, 0, []float64{0, 2, 6}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []uint64{1, 3}
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, but got %v", len(expected), matches)
+	}
+	for i, m := range matches {
+		if m.Subscription != id || m.Score.UID != expected[i] {
+			t.Errorf("expected uid %d for subscription %d, but got %v", expected[i], id, m)
+		}
+	}
+
+	if err := lsh.Unsubscribe(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(4, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != len(expected) {
+		t.Errorf("expected no matches after unsubscribing, but got %v", matches[len(expected):])
+	}
+	if err := lsh.Unsubscribe(id); err != ErrSubscriptionNotFound {
+		t.Errorf("expected %v, but got %v", ErrSubscriptionNotFound, err)
+	}
+}
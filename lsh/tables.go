@@ -0,0 +1,37 @@
+package lsh
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aouyang1/go-lsh/stats"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+var ErrTableNotFound = errors.New("table not found")
+
+// TablesInfo describes every table of the index in order
+func (l *LSH) TablesInfo() ([]stats.Table, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	infos := make([]stats.Table, len(l.Tables))
+	for i, t := range l.Tables {
+		var err error
+		if infos[i], err = t.Info(); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+// TableByName returns the table with the name
+func (l *LSH) TableByName(name string) (*tables.Table, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, t := range l.Tables {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, %s", ErrTableNotFound, name)
+}
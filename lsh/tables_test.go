@@ -0,0 +1,57 @@
+package lsh
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+func TestTablesInfo(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 4
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 3}),
+		document.NewSimple(1, cfg.RowSize, []float64{3, 1, 0}),
+	}
+	for _, d := range docs {
+		if err := lsh.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := lsh.TablesInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 4 {
+		t.Fatalf("expected %d tables, but got %d", 4, len(infos))
+	}
+	for _, info := range infos {
+		if info.Rows != 2 || info.Buckets != 2 || info.Docs != 2 || info.Bits != cfg.NumHyperplanes {
+			t.Errorf("expected 2 rows, buckets and docs with %d bits, but got %+v", cfg.NumHyperplanes, info)
+		}
+		if info.Checksum == 0 || info.Bytes == 0 {
+			t.Errorf("expected a checksum and size, but got %+v", info)
+		}
+	}
+	if infos[0].Checksum == infos[1].Checksum {
+		t.Errorf("expected different hyperplanes to have different checksums")
+	}
+
+	tbl, err := lsh.TableByName(infos[2].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl != lsh.Tables[2] {
+		t.Errorf("expected table %s", infos[2].Name)
+	}
+	if _, err := lsh.TableByName("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("expected %v, but got %v error", ErrTableNotFound, err)
+	}
+}
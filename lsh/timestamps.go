@@ -0,0 +1,28 @@
+package lsh
+
+import (
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+// Timestamps returns the sorted timestamps of the windows indexed for the uid
+func (l *LSH) Timestamps(uid uint64) ([]int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	indexes := l.Tables[0].Timestamps.Get(uid)
+	if indexes == nil {
+		return nil, lsherrors.DocumentNotStored
+	}
+	return indexes, nil
+}
+
+// TimestampsInRange returns the sorted timestamps of the windows indexed for the uid between start and
+// end inclusive
+func (l *LSH) TimestampsInRange(uid uint64, start, end int64) ([]int64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.Tables[0].Timestamps.Get(uid) == nil {
+		return nil, lsherrors.DocumentNotStored
+	}
+	_, indexes := l.Tables[0].Timestamps.Between(uid, start, end)
+	return indexes, nil
+}
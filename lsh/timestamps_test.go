@@ -0,0 +1,69 @@
+package lsh
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+func TestTimestamps(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int64{600, 0, 300} {
+		if err := lsh.Index(document.NewSimple(0, index, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indexes, err := lsh.Timestamps(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareInt64s([]int64{0, 300, 600}, indexes); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		start, end int64
+		expected   []int64
+	}{
+		{0, 600, []int64{0, 300, 600}},
+		{1, 600, []int64{300, 600}},
+		{100, 200, nil},
+		{300, 300, []int64{300}},
+	}
+	for _, td := range testData {
+		indexes, err := lsh.TimestampsInRange(0, td.start, td.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compareInt64s(td.expected, indexes); err != nil {
+			t.Errorf("%v for range %d to %d", err, td.start, td.end)
+		}
+	}
+
+	if _, err := lsh.Timestamps(1); err != lsherrors.DocumentNotStored {
+		t.Errorf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+	if _, err := lsh.TimestampsInRange(1, 0, 600); err != lsherrors.DocumentNotStored {
+		t.Errorf("expected %v, but got %v error", lsherrors.DocumentNotStored, err)
+	}
+}
+
+func compareInt64s(expected, indexes []int64) error {
+	if len(indexes) != len(expected) {
+		return fmt.Errorf("expected %v, but got %v", expected, indexes)
+	}
+	for i, index := range indexes {
+		if index != expected[i] {
+			return fmt.Errorf("expected %v, but got %v", expected, indexes)
+		}
+	}
+	return nil
+}
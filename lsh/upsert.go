@@ -0,0 +1,80 @@
+package lsh
+
+import (
+	"errors"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/lsherrors"
+)
+
+// Upsert indexes the document replacing every window previously indexed under its uid. The document is
+// checked like Index before anything is removed so a rejected document leaves the stored windows in
+// place, and searches never observe the uid partially replaced. The duplicate policy does not apply
+// since the stored windows are replaced on purpose. The replacement is captured as a delete of the uid
+// followed by the index of the document. If the document fails to be committed once the stored windows
+// are removed they are indexed again.
+func (l *LSH) Upsert(d document.Document) error {
+	if err := l.validate(d); err != nil {
+		return err
+	}
+	d, err := l.enriched(d)
+	if err != nil {
+		return err
+	}
+	fitted, adj := l.fitLength(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	p, err := l.prepareIndex(d, fitted)
+	if err != nil {
+		return err
+	}
+	uid := d.GetUID()
+	staged := l.storedWindows(uid)
+	if _, err := l.deleteWithReport(uid); err != nil && !errors.Is(err, lsherrors.DocumentNotStored) {
+		l.restoreWindows(uid, staged)
+		return err
+	}
+	// room is made once the replaced windows no longer count toward the caps
+	err = l.makeRoom(uid)
+	if err == nil {
+		err = l.commitIndex(p)
+	}
+	if err != nil {
+		l.restoreWindows(uid, staged)
+		return err
+	}
+	if adj != 0 {
+		l.counters.lengthAdjusted.Add(1)
+	}
+	return nil
+}
+
+// storedWindows returns the windows stored for the uid at the configured sample period so they can be
+// indexed again if replacing them fails
+func (l *LSH) storedWindows(uid uint64) []document.Document {
+	var windows []document.Document
+	label := l.acl.label(uid)
+	for _, index := range l.Tables[0].Timestamps.Get(uid) {
+		vec := l.Docs.GetVector(uid, index)
+		if vec == nil {
+			continue
+		}
+		windows = append(windows, &document.Simple{UID: uid, Index: index, Vector: vec, Label: label})
+	}
+	return windows
+}
+
+// restoreWindows indexes the windows of the uid again removing whatever a failed replacement left
+// behind. Windows failing to be indexed again are dropped.
+func (l *LSH) restoreWindows(uid uint64, windows []document.Document) {
+	l.deleteWithReport(uid)
+	for _, w := range windows {
+		if p, err := l.prepareIndex(w, w); err == nil {
+			l.commitIndex(p)
+		}
+	}
+}
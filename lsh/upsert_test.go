@@ -0,0 +1,147 @@
+package lsh
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/forwardindex"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestUpsert(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.DuplicatePolicy = configs.DuplicateConflict
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int64{0, 5} {
+		if err := lsh.Index(document.NewSimple(1, index, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.Index(document.NewSimple(2, 0, []float64{3, 1, 0})); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rejected document leaves the stored windows in place
+	if err := lsh.Upsert(document.NewSimple(1, 2, []float64{1, 1, 1})); err != ErrNoVectorComplexity {
+		t.Fatalf("expected %v, but got %v", ErrNoVectorComplexity, err)
+	}
+	indexes, err := lsh.Timestamps(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(indexes, []int64{0, 5}) {
+		t.Fatalf("expected %v, but got %v", []int64{0, 5}, indexes)
+	}
+
+	// the duplicate policy does not refuse a replaced window
+	if err := lsh.Upsert(document.NewSimple(1, 0, []float64{3, 2, 0})); err != nil {
+		t.Fatal(err)
+	}
+	indexes, err = lsh.Timestamps(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(indexes, []int64{0}) {
+		t.Fatalf("expected %v, but got %v", []int64{0}, indexes)
+	}
+	if vec := lsh.Docs.GetVector(1, 0); !reflect.DeepEqual(vec, []float64{3, 2, 0}) {
+		t.Errorf("expected %v, but got %v", []float64{3, 2, 0}, vec)
+	}
+	so := options.NewDefaultSearch()
+	so.SignFilter = options.SignFilter_POS
+	res, _, err := lsh.Search(document.NewSimple(0, 0, []float64{0, 1, 3}), so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range res.UIDs() {
+		if uid == 1 {
+			t.Errorf("expected the replaced windows of uid %d not to be found", uid)
+		}
+	}
+
+	// a uid not stored yet is indexed
+	if err := lsh.Upsert(document.NewSimple(3, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if lsh.Docs.Size() != 3 {
+		t.Errorf("expected %d documents, but got %d", 3, lsh.Docs.Size())
+	}
+}
+
+// indexFailingStore fails to store the windows starting at the index
+type indexFailingStore struct {
+	forwardindex.Store
+	index int64
+}
+
+func (f indexFailingStore) Index(d document.Document) error {
+	if d.GetIndex() == f.index {
+		return errStoreFailed
+	}
+	return f.Store.Index(d)
+}
+
+func TestUpsertStoreFailure(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := NewWithStore(cfg, indexFailingStore{forwardindex.NewInMemory(cfg), 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int64{0, 5} {
+		if err := lsh.Index(document.NewSimple(1, index, []float64{0, 1, 3})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := lsh.Upsert(document.NewSimple(1, 2, []float64{3, 2, 0})); !errors.Is(err, errStoreFailed) {
+		t.Fatalf("expected %v, but got %v", errStoreFailed, err)
+	}
+	indexes, err := lsh.Timestamps(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(indexes, []int64{0, 5}) {
+		t.Fatalf("expected %v, but got %v", []int64{0, 5}, indexes)
+	}
+	for _, index := range indexes {
+		if vec := lsh.Docs.GetVector(1, index); !reflect.DeepEqual(vec, []float64{0, 1, 3}) {
+			t.Errorf("expected %v at index %d, but got %v", []float64{0, 1, 3}, index, vec)
+		}
+	}
+	if err := lsh.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpsertMemoryBudget(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	// room for a single window which the replacement takes over
+	cfg.MemoryBudget = lsh.MemoryUsage()
+	lsh, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Index(document.NewSimple(1, 0, []float64{0, 1, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if err := lsh.Upsert(document.NewSimple(1, 0, []float64{3, 2, 0})); err != nil {
+		t.Fatal(err)
+	}
+	if vec := lsh.Docs.GetVector(1, 0); !reflect.DeepEqual(vec, []float64{3, 2, 0}) {
+		t.Errorf("expected %v, but got %v", []float64{3, 2, 0}, vec)
+	}
+}
@@ -0,0 +1,227 @@
+package lsh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/results"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+var (
+	ErrInvariantViolated = errors.New("index invariant violated")
+	ErrVerifyFailed      = errors.New("recorded queries returned different results")
+)
+
+// defaultVerifyTolerance is the absolute difference allowed between a recorded and a replayed score
+const defaultVerifyTolerance = 1e-9
+
+// CheckInvariants verifies that the tables, the timestamps of the indexed windows and the forward
+// index agree with each other returning every inconsistency found
+func (l *LSH) CheckInvariants() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var errs []error
+	for _, t := range l.Tables {
+		if err := t.Check(); err != nil {
+			errs = append(errs, fmt.Errorf("%w, table %s, %w", ErrInvariantViolated, t.Name, err))
+		}
+	}
+	var numUIDs int
+	l.Tables[0].Timestamps.Range(func(uid uint64, indexes []int64) bool {
+		numUIDs++
+		for _, index := range indexes {
+			if l.Docs.GetVector(uid, index) == nil {
+				errs = append(errs, fmt.Errorf("%w, window of uid %d at index %d is not stored", ErrInvariantViolated, uid, index))
+				return true
+			}
+		}
+		return true
+	})
+	if n := l.Docs.Size(); n != numUIDs {
+		errs = append(errs, fmt.Errorf("%w, %d documents are stored for %d indexed uids", ErrInvariantViolated, n, numUIDs))
+	}
+	return errors.Join(errs...)
+}
+
+// RecordedQuery is a query along with the results it returned so a restored index can be verified by
+// replaying it
+type RecordedQuery struct {
+	UID      uint64          `json:"uid"`
+	Index    int64           `json:"index"`
+	Vector   []float64       `json:"vector"`
+	Search   *options.Search `json:"search,omitempty"`
+	Expected results.Scores  `json:"expected"`
+}
+
+// RecordQuery searches for the document returning the query along with its results
+func (l *LSH) RecordQuery(d document.Document, s *options.Search) (RecordedQuery, error) {
+	q := RecordedQuery{UID: d.GetUID(), Index: d.GetIndex(), Search: s}
+	q.Vector = make([]float64, len(d.GetVector()))
+	copy(q.Vector, d.GetVector())
+	scores, _, err := l.Search(d, s)
+	if err != nil {
+		return q, err
+	}
+	q.Expected = scores
+	return q, nil
+}
+
+// WriteRecordedQueries writes the queries as json lines
+func WriteRecordedQueries(w io.Writer, queries []RecordedQuery) error {
+	enc := json.NewEncoder(w)
+	for _, q := range queries {
+		if err := enc.Encode(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecordedQueries reads queries written by WriteRecordedQueries
+func ReadRecordedQueries(r io.Reader) ([]RecordedQuery, error) {
+	var queries []RecordedQuery
+	err := decodeJSONLines(r, func(dec *json.Decoder) error {
+		var q RecordedQuery
+		if err := dec.Decode(&q); err != nil {
+			return err
+		}
+		queries = append(queries, q)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// decodeJSONLines calls decode with a decoder of the json lines of r until it returns io.EOF
+func decodeJSONLines(r io.Reader, decode func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		if err := decode(dec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// VerifyOptions configure the verification of a snapshot
+type VerifyOptions struct {
+	Snapshot   snapshot.Options
+	Queries    []RecordedQuery
+	SampleSize int     // number of queries replayed drawn at random, 0 replays every query
+	Seed       int64   // seed of the query sample
+	Tolerance  float64 // absolute difference allowed between recorded and replayed scores, 0 means 1e-9
+}
+
+// VerifyReport describes the verification of a snapshot
+type VerifyReport struct {
+	NumDocs         int             `json:"num_docs"`
+	Invariants      string          `json:"invariants,omitempty"` // violated invariants, empty if none
+	QueriesReplayed int             `json:"queries_replayed"`
+	Mismatches      []QueryMismatch `json:"mismatches,omitempty"`
+}
+
+// QueryMismatch is a recorded query whose replayed results differ from those recorded
+type QueryMismatch struct {
+	Query    int            `json:"query"` // position of the query in the recorded queries
+	Expected results.Scores `json:"expected"`
+	Got      results.Scores `json:"got"`
+	Err      string         `json:"err,omitempty"`
+}
+
+// Verify loads the snapshot into a new index with the configuration, checks its invariants and replays a
+// sample of the recorded queries comparing their results with those recorded, e.g. to validate a backup
+// before it is needed. Results are compared by uid and index regardless of their order. An error
+// wrapping ErrInvariantViolated or ErrVerifyFailed is returned along with the report if the snapshot
+// fails verification.
+func Verify(cfg *configs.LSHConfigs, r io.Reader, opts VerifyOptions) (VerifyReport, error) {
+	var report VerifyReport
+	l, err := New(cfg)
+	if err != nil {
+		return report, err
+	}
+	if err := l.Load(r, opts.Snapshot); err != nil {
+		return report, err
+	}
+	report.NumDocs = l.Docs.Size()
+	invariantErr := l.CheckInvariants()
+	if invariantErr != nil {
+		report.Invariants = invariantErr.Error()
+	}
+
+	tolerance := opts.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultVerifyTolerance
+	}
+	for _, i := range sampleQueries(len(opts.Queries), opts.SampleSize, opts.Seed) {
+		q := opts.Queries[i]
+		report.QueriesReplayed++
+		vec := make([]float64, len(q.Vector))
+		copy(vec, q.Vector)
+		got, _, err := l.Search(document.NewSimple(q.UID, q.Index, vec), q.Search)
+		if err != nil {
+			report.Mismatches = append(report.Mismatches, QueryMismatch{Query: i, Expected: q.Expected, Err: err.Error()})
+			continue
+		}
+		if !sameScores(q.Expected, got, tolerance) {
+			report.Mismatches = append(report.Mismatches, QueryMismatch{Query: i, Expected: q.Expected, Got: got})
+		}
+	}
+
+	if len(report.Mismatches) > 0 {
+		err := fmt.Errorf("%w, %d of %d queries", ErrVerifyFailed, len(report.Mismatches), report.QueriesReplayed)
+		return report, errors.Join(invariantErr, err)
+	}
+	return report, invariantErr
+}
+
+// sampleQueries returns the sorted positions of up to size of n queries drawn at random with the seed
+func sampleQueries(n, size int, seed int64) []int {
+	if size <= 0 || size >= n {
+		positions := make([]int, n)
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions
+	}
+	positions := rand.New(rand.NewSource(seed)).Perm(n)[:size]
+	sort.Ints(positions)
+	return positions
+}
+
+// windowKey identifies the window of a result by its uid and index
+type windowKey struct {
+	uid   uint64
+	index int64
+}
+
+// sameScores reports whether both results hold the same windows with scores within the tolerance
+func sameScores(expected, got results.Scores, tolerance float64) bool {
+	if len(expected) != len(got) {
+		return false
+	}
+	scores := make(map[windowKey]float64, len(expected))
+	for _, s := range expected {
+		scores[windowKey{s.UID, s.Index}] = s.Score
+	}
+	for _, s := range got {
+		score, exists := scores[windowKey{s.UID, s.Index}]
+		if !exists || math.Abs(score-s.Score) > tolerance {
+			return false
+		}
+	}
+	return true
+}
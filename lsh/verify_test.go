@@ -0,0 +1,82 @@
+package lsh
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+	"github.com/aouyang1/go-lsh/snapshot"
+	"github.com/aouyang1/go-lsh/tables"
+)
+
+func TestVerify(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.Seed = 3
+	lsh, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		if err := lsh.Index(document.NewSimple(uint64(i), int64(i%3)*60, []float64{rng.Float64(), rng.Float64(), rng.Float64()})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lsh.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	so := options.NewDefaultSearch()
+	so.Threshold = 0.9
+	queries := make([]RecordedQuery, 5)
+	for i := range queries {
+		if queries[i], err = lsh.RecordQuery(document.NewSimple(0, 0, []float64{rng.Float64(), rng.Float64(), rng.Float64()}), so); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := WriteRecordedQueries(&buf, queries); err != nil {
+		t.Fatal(err)
+	}
+	if queries, err = ReadRecordedQueries(&buf); err != nil || len(queries) != 5 {
+		t.Fatalf("expected %d recorded queries, but got %d, %v", 5, len(queries), err)
+	}
+
+	var snap bytes.Buffer
+	if err := lsh.Save(&snap, snapshot.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Verify(cfg, bytes.NewReader(snap.Bytes()), VerifyOptions{Queries: queries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NumDocs != 100 || report.QueriesReplayed != 5 {
+		t.Errorf("expected %d docs and %d queries, but got %+v", 100, 5, report)
+	}
+	report, err = Verify(cfg, bytes.NewReader(snap.Bytes()), VerifyOptions{Queries: queries, SampleSize: 2})
+	if err != nil || report.QueriesReplayed != 2 {
+		t.Errorf("expected %d queries replayed, but got %d, %v", 2, report.QueriesReplayed, err)
+	}
+
+	queries[3].Expected = append(queries[3].Expected, queries[3].Expected[0])
+	queries[3].Expected[0].Score -= 0.01
+	report, err = Verify(cfg, bytes.NewReader(snap.Bytes()), VerifyOptions{Queries: queries})
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Fatalf("expected %v, but got %v", ErrVerifyFailed, err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Query != 3 {
+		t.Errorf("expected query %d to mismatch, but got %+v", 3, report.Mismatches)
+	}
+
+	// a window missing from its bucket violates the invariants
+	row := lsh.Tables[0].Timestamps.Get(7)[0] / cfg.RowSize * cfg.RowSize
+	lsh.Tables[0].Table[row][lsh.Tables[0].Doc2Hash[7][0]].CheckedRemove(7)
+	err = lsh.CheckInvariants()
+	if !errors.Is(err, ErrInvariantViolated) || !errors.Is(err, tables.ErrInconsistent) {
+		t.Errorf("expected %v, but got %v", tables.ErrInconsistent, err)
+	}
+}
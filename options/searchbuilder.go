@@ -0,0 +1,171 @@
+package options
+
+// SearchOption sets a single parameter of a search
+type SearchOption func(*Search)
+
+// NewSearch applies the options on top of the defaults from NewDefaultSearch and validates the result
+func NewSearch(opts ...SearchOption) (*Search, error) {
+	s := NewDefaultSearch()
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// WithTopK sets the maximum number of results to return
+func WithTopK(k int) SearchOption {
+	return func(s *Search) {
+		s.NumToReturn = k
+	}
+}
+
+// WithThreshold sets the minimum absolute correlation of a result
+func WithThreshold(threshold float64) SearchOption {
+	return func(s *Search) {
+		s.Threshold = threshold
+	}
+}
+
+// WithSignFilter restricts results to positive, negative or any correlation
+func WithSignFilter(sf SignFilter) SearchOption {
+	return func(s *Search) {
+		s.SignFilter = sf
+	}
+}
+
+// WithMaxLag sets how far from the query index a result may be, AllLags searches every index
+func WithMaxLag(maxLag int64) SearchOption {
+	return func(s *Search) {
+		s.MaxLag = maxLag
+	}
+}
+
+// WithMaxTables consults only the n tables with the highest hit rates
+func WithMaxTables(n int) SearchOption {
+	return func(s *Search) {
+		s.MaxTables = n
+	}
+}
+
+// WithACL sets the labels the caller is allowed to read
+func WithACL(labels ...string) SearchOption {
+	return func(s *Search) {
+		s.ACL = labels
+	}
+}
+
+// WithCandidatesOnly returns colliding candidates without scoring them
+func WithCandidatesOnly() SearchOption {
+	return func(s *Search) {
+		s.CandidatesOnly = true
+	}
+}
+
+// WithResample fits queries of any length to the configured vector length with the given method
+func WithResample(r Resample) SearchOption {
+	return func(s *Search) {
+		s.Resample = r
+	}
+}
+
+// WithTrend returns the linear trend slope of each stored vector with its result
+func WithTrend() SearchOption {
+	return func(s *Search) {
+		s.ReturnTrend = true
+	}
+}
+
+// WithProbeBudget caps the number of table buckets probed for each sign
+func WithProbeBudget(n int) SearchOption {
+	return func(s *Search) {
+		s.ProbeBudget = n
+	}
+}
+
+// WithHistogram returns a histogram of all candidate scores with the given number of bins
+func WithHistogram(bins int) SearchOption {
+	return func(s *Search) {
+		s.HistogramBins = bins
+	}
+}
+
+// WithTimeRange restricts candidates to windows starting between start and end inclusive
+func WithTimeRange(start, end int64) SearchOption {
+	return func(s *Search) {
+		s.TimeRange = &TimeRange{Start: start, End: end}
+	}
+}
+
+// WithAlignmentFree ignores indexes matching every stored window purely on shape
+func WithAlignmentFree() SearchOption {
+	return func(s *Search) {
+		s.AlignmentFree = true
+	}
+}
+
+// WithScorePrecision rounds scores to the given number of decimal places
+func WithScorePrecision(decimals int) SearchOption {
+	return func(s *Search) {
+		s.ScorePrecision = decimals
+	}
+}
+
+// WithGroupBy returns up to NumToReturn scores from each group
+func WithGroupBy(g GroupBy) SearchOption {
+	return func(s *Search) {
+		s.GroupBy = g
+	}
+}
+
+// WithRecencyBoost decays scores of older matches with the given half-life in index units
+func WithRecencyBoost(halfLife int64) SearchOption {
+	return func(s *Search) {
+		s.RecencyBoost = halfLife
+	}
+}
+
+// WithNegativeThreshold sets the magnitude negatively correlated results must reach separately from the
+// threshold of positive results
+func WithNegativeThreshold(threshold float64) SearchOption {
+	return func(s *Search) {
+		s.NegativeThreshold = threshold
+	}
+}
+
+// WithMaxPerUID limits the number of windows of the same uid returned
+func WithMaxPerUID(n int) SearchOption {
+	return func(s *Search) {
+		s.MaxPerUID = n
+	}
+}
+
+// WithCountOnly returns only the number of candidates and matches in the search diagnostics
+func WithCountOnly() SearchOption {
+	return func(s *Search) {
+		s.CountOnly = true
+	}
+}
+
+// WithMaxCandidates scores a random sample of at most n candidates
+func WithMaxCandidates(n int) SearchOption {
+	return func(s *Search) {
+		s.MaxCandidates = n
+	}
+}
+
+// WithSeed seeds the candidate sample so the search can be replayed
+func WithSeed(seed int64) SearchOption {
+	return func(s *Search) {
+		s.Seed = seed
+	}
+}
+
+// WithTargetResults adapts the threshold to return between min and max results
+func WithTargetResults(min, max int) SearchOption {
+	return func(s *Search) {
+		s.TargetResults = &ResultRange{Min: min, Max: max}
+	}
+}
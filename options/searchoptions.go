@@ -8,6 +8,19 @@ var (
 	ErrInvalidNumToReturn = errors.New("invalid NumToReturn, must be at least 1")
 	ErrInvalidThreshold   = errors.New("invalid threshold, must be between 0 and 1 inclusive")
 	ErrInvalidSignFilter  = errors.New("invalid sign filter, must be any, neg, or pos")
+	ErrInvalidMaxTables   = errors.New("invalid MaxTables, must be at least 0")
+	ErrInvalidResample    = errors.New("invalid resample method, must be none, linear, or lttb")
+	ErrInvalidProbeBudget = errors.New("invalid ProbeBudget, must be at least 0")
+	ErrInvalidHistogram   = errors.New("invalid HistogramBins, must be at least 0")
+	ErrInvalidTimeRange   = errors.New("invalid time range, start must not be after end")
+	ErrInvalidPrecision   = errors.New("invalid ScorePrecision, must be at least 0")
+	ErrInvalidGroupBy     = errors.New("invalid group by, must be none, sign, or label")
+	ErrInvalidRecency     = errors.New("invalid RecencyBoost, must be at least 0")
+	ErrInvalidNegative    = errors.New("invalid negative threshold, must be between 0 and 1 inclusive")
+	ErrInvalidMaxPerUID   = errors.New("invalid MaxPerUID, must be at least 0")
+	ErrInvalidCandidates  = errors.New("invalid MaxCandidates, must be at least 0")
+	ErrInvalidTarget      = errors.New("invalid target results, min must be at least 1 and not exceed max")
+	ErrTargetGrouped      = errors.New("target results can not be combined with GroupBy")
 )
 
 const (
@@ -22,28 +35,186 @@ const (
 	SignFilter_ANY = 0
 )
 
+// Resample is the method used to fit query vectors of the wrong length to the configured vector length
+type Resample int
+
+const (
+	Resample_NONE   = 0 // queries of the wrong length are rejected
+	Resample_LINEAR = 1 // linearly interpolate the query to the vector length
+	Resample_LTTB   = 2 // downsample preserving peaks and troughs, upsampling falls back to linear
+)
+
+// GroupBy partitions the results into groups that each return up to NumToReturn of their own top scores
+type GroupBy int
+
+const (
+	GroupBy_NONE  = 0
+	GroupBy_SIGN  = 1 // positively and negatively correlated results
+	GroupBy_LABEL = 2 // access control label of the owner of each document
+)
+
+// TimeRange is an absolute range of indexes inclusive of both ends
+type TimeRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ResultRange is a desired number of results inclusive of both ends
+type ResultRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
 // SearchOptions represent a set of parameters to be used to customize search results
 type Search struct {
 	NumToReturn int        `json:"num_to_return"`
 	Threshold   float64    `json:"threshold"`
 	SignFilter  SignFilter `json:"sign_filter"`
-	MaxLag      int64      `json:"max_lag"` // -1 means any lag
+	MaxLag      int64      `json:"max_lag"`    // -1 means any lag
+	MaxTables   int        `json:"max_tables"` // consult only the K tables with the highest hit rates unless too few candidates are found, 0 means all tables
+	ACL         []string   `json:"acl"`        // labels the caller is allowed to read, empty means unrestricted unless enforced by the index
+
+	// CandidatesOnly returns every colliding uid and index without scoring them against the forward
+	// index. NumToReturn and Threshold are ignored.
+	CandidatesOnly bool `json:"candidates_only"`
+
+	// CountOnly scores the candidates without keeping any results so only the number of candidates and
+	// matches passing the threshold are returned in the search diagnostics. NumToReturn is ignored and
+	// may be 0.
+	CountOnly bool `json:"count_only"`
+
+	// Resample fits a query vector of any length to the configured vector length before hashing
+	Resample Resample `json:"resample"`
+
+	// ReturnTrend sets the linear trend slope of each stored vector on its result which is otherwise
+	// removed by detrending transforms
+	ReturnTrend bool `json:"return_trend"`
+
+	// ProbeBudget caps the number of table buckets probed for each sign, favoring the tables with the
+	// highest hit rates, trading recall for latency. 0 probes every table.
+	ProbeBudget int `json:"probe_budget"`
+
+	// HistogramBins returns a histogram of every candidate score, not just the top results, with this
+	// many equal width bins between -1 and 1 in the search diagnostics. 0 disables the histogram.
+	HistogramBins int `json:"histogram_bins"`
+
+	// TimeRange restricts candidates to windows starting within the range regardless of the index of
+	// the query. MaxLag is ignored when set.
+	TimeRange *TimeRange `json:"time_range,omitempty"`
+
+	// AlignmentFree ignores the index of the query and the stored windows scoring every stored window
+	// purely on shape, for corpora where indexes are not timestamps. MaxLag and TimeRange are ignored
+	// when set.
+	AlignmentFree bool `json:"alignment_free"`
+
+	// ScorePrecision rounds scores to this many decimal places before they are thresholded, ranked and
+	// returned so floating point noise between near identical scores doesn't change the order. 0 keeps
+	// full precision.
+	ScorePrecision int `json:"score_precision"`
+
+	// GroupBy returns a balanced result set of up to NumToReturn scores from each group instead of
+	// NumToReturn scores overall
+	GroupBy GroupBy `json:"group_by"`
+
+	// RecencyBoost is a half-life in index units. Scores passing the threshold are multiplied by a
+	// factor halving for every RecencyBoost the matched index is older than the query index so fresher
+	// matches rank above equally similar stale ones. 0 disables the boost.
+	RecencyBoost int64 `json:"recency_boost"`
+
+	// NegativeThreshold is the magnitude negatively correlated results must reach, e.g. 0.95 returns
+	// negatives at or below -0.95, while Threshold then applies to positive results only. 0 applies
+	// Threshold to both signs.
+	NegativeThreshold float64 `json:"negative_threshold"`
+
+	// MaxPerUID limits the number of windows of the same uid returned so a single series can't take
+	// every result. 0 leaves the windows of a uid unlimited.
+	MaxPerUID int `json:"max_per_uid"`
+
+	// MaxCandidates scores a uniform random sample of this many candidates when more collide with the
+	// query, trading recall for latency. 0 scores every candidate.
+	MaxCandidates int `json:"max_candidates"`
+
+	// Seed makes the candidate sample reproducible. 0 uses a random seed which is reported in the
+	// search diagnostics so the search can be replayed exactly.
+	Seed int64 `json:"seed"`
+
+	// TargetResults adapts the threshold so that between Min and Max results are returned when enough
+	// candidates are scored. Threshold is the starting point which is lowered when fewer than Min results
+	// pass it and raised when more than Max do. The threshold used is reported in the search diagnostics.
+	// NumToReturn and NegativeThreshold are ignored when set.
+	TargetResults *ResultRange `json:"target_results,omitempty"`
 }
 
 // Validate returns an error if any of the input options are invalid
 func (s *Search) Validate() error {
-	if s.NumToReturn < 1 {
+	if s.NumToReturn < 1 && !s.CountOnly && s.TargetResults == nil {
 		return ErrInvalidNumToReturn
 	}
 	if s.Threshold < 0 || s.Threshold > 1 {
 		return ErrInvalidThreshold
 	}
+	if s.NegativeThreshold < 0 || s.NegativeThreshold > 1 {
+		return ErrInvalidNegative
+	}
 	switch s.SignFilter {
 	case SignFilter_ANY, SignFilter_NEG, SignFilter_POS:
 	default:
 		return ErrInvalidSignFilter
 	}
 
+	if s.MaxTables < 0 {
+		return ErrInvalidMaxTables
+	}
+
+	if s.ProbeBudget < 0 {
+		return ErrInvalidProbeBudget
+	}
+
+	if s.HistogramBins < 0 {
+		return ErrInvalidHistogram
+	}
+
+	if s.ScorePrecision < 0 {
+		return ErrInvalidPrecision
+	}
+
+	if s.MaxCandidates < 0 {
+		return ErrInvalidCandidates
+	}
+
+	if s.MaxPerUID < 0 {
+		return ErrInvalidMaxPerUID
+	}
+
+	if s.RecencyBoost < 0 {
+		return ErrInvalidRecency
+	}
+
+	if s.TimeRange != nil && s.TimeRange.Start > s.TimeRange.End {
+		return ErrInvalidTimeRange
+	}
+
+	switch s.GroupBy {
+	case GroupBy_NONE, GroupBy_SIGN, GroupBy_LABEL:
+	default:
+		return ErrInvalidGroupBy
+	}
+
+	if t := s.TargetResults; t != nil {
+		if t.Min < 1 || t.Min > t.Max {
+			return ErrInvalidTarget
+		}
+		if s.GroupBy != GroupBy_NONE {
+			return ErrTargetGrouped
+		}
+	}
+
+	switch s.Resample {
+	case Resample_NONE, Resample_LINEAR, Resample_LTTB:
+	default:
+		return ErrInvalidResample
+	}
+
 	if s.MaxLag < AllLags {
 		s.MaxLag = AllLags
 	}
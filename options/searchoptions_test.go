@@ -28,3 +28,62 @@ func TestSearchOptionsValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestNewSearch(t *testing.T) {
+	s, err := NewSearch(
+		WithTopK(50),
+		WithThreshold(0.9),
+		WithSignFilter(SignFilter_NEG),
+		WithMaxLag(AllLags),
+		WithMaxTables(8),
+		WithACL("team-a", "team-b"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NumToReturn != 50 || s.Threshold != 0.9 || s.SignFilter != SignFilter_NEG ||
+		s.MaxLag != AllLags || s.MaxTables != 8 || len(s.ACL) != 2 {
+		t.Errorf("expected all options to be applied, but got %+v", s)
+	}
+
+	s, err = NewSearch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := NewDefaultSearch()
+	if s.NumToReturn != def.NumToReturn || s.Threshold != def.Threshold || s.MaxLag != def.MaxLag {
+		t.Errorf("expected default search, but got %+v", s)
+	}
+
+	testData := []struct {
+		opt         SearchOption
+		expectedErr error
+	}{
+		{WithTopK(0), ErrInvalidNumToReturn},
+		{WithThreshold(1.1), ErrInvalidThreshold},
+		{WithSignFilter(SignFilter(2)), ErrInvalidSignFilter},
+		{WithMaxTables(-1), ErrInvalidMaxTables},
+		{WithHistogram(-1), ErrInvalidHistogram},
+		{WithTimeRange(10, 0), ErrInvalidTimeRange},
+		{WithScorePrecision(-1), ErrInvalidPrecision},
+		{WithGroupBy(GroupBy(3)), ErrInvalidGroupBy},
+		{WithRecencyBoost(-1), ErrInvalidRecency},
+		{WithNegativeThreshold(1.5), ErrInvalidNegative},
+		{WithMaxPerUID(-1), ErrInvalidMaxPerUID},
+		{WithMaxCandidates(-1), ErrInvalidCandidates},
+		{WithTargetResults(0, 5), ErrInvalidTarget},
+		{WithTargetResults(6, 5), ErrInvalidTarget},
+	}
+	for _, td := range testData {
+		if _, err := NewSearch(td.opt); err != td.expectedErr {
+			t.Errorf("expected %v, but got %v for error", td.expectedErr, err)
+		}
+	}
+
+	if _, err := NewSearch(WithTopK(0), WithCountOnly()); err != nil {
+		t.Errorf("expected count only search to allow 0 results, but got %v", err)
+	}
+	if _, err := NewSearch(WithTargetResults(1, 5), WithGroupBy(GroupBy_SIGN)); err != ErrTargetGrouped {
+		t.Errorf("expected %v, but got %v for error", ErrTargetGrouped, err)
+	}
+}
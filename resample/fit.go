@@ -0,0 +1,97 @@
+package resample
+
+import "math"
+
+// Linear stretches or shrinks vec to n samples spanning the same duration by linearly interpolating
+// between neighbouring samples
+func Linear(vec []float64, n int) []float64 {
+	out := make([]float64, n)
+	if len(vec) == 0 || n == 0 {
+		return out
+	}
+	if len(vec) == 1 || n == 1 {
+		for i := range out {
+			out[i] = vec[0]
+		}
+		return out
+	}
+
+	step := float64(len(vec)-1) / float64(n-1)
+	for k := range out {
+		pos := float64(k) * step
+		i := int(pos)
+		if i >= len(vec)-1 {
+			out[k] = vec[len(vec)-1]
+			continue
+		}
+		frac := pos - float64(i)
+		out[k] = vec[i] + frac*(vec[i+1]-vec[i])
+	}
+	return out
+}
+
+// LTTB downsamples vec to n samples with the largest triangle three buckets algorithm which keeps
+// the samples that preserve the visual shape of the series such as peaks and troughs. Vectors that
+// need upsampling or fewer than 3 samples fall back to Linear.
+func LTTB(vec []float64, n int) []float64 {
+	if n >= len(vec) || n < 3 {
+		return Linear(vec, n)
+	}
+
+	out := make([]float64, 0, n)
+	out = append(out, vec[0])
+
+	bucketSize := float64(len(vec)-2) / float64(n-2)
+	a := 0
+	for b := 0; b < n-2; b++ {
+		// average of the next bucket is the third point of the triangle
+		nextStart := int(float64(b+1)*bucketSize) + 1
+		nextEnd := int(float64(b+2)*bucketSize) + 1
+		if nextEnd > len(vec) {
+			nextEnd = len(vec)
+		}
+		var avgX, avgY float64
+		for i := nextStart; i < nextEnd; i++ {
+			avgX += float64(i)
+			avgY += vec[i]
+		}
+		if cnt := float64(nextEnd - nextStart); cnt > 0 {
+			avgX /= cnt
+			avgY /= cnt
+		}
+
+		start := int(float64(b)*bucketSize) + 1
+		end := int(float64(b+1)*bucketSize) + 1
+		maxArea := -1.0
+		next := start
+		for i := start; i < end; i++ {
+			area := math.Abs((float64(a)-avgX)*(vec[i]-vec[a]) - (float64(a)-float64(i))*(avgY-vec[a]))
+			if area > maxArea {
+				maxArea = area
+				next = i
+			}
+		}
+		out = append(out, vec[next])
+		a = next
+	}
+	return append(out, vec[len(vec)-1])
+}
+
+// PAA reduces vec to the given number of segments by averaging the samples in each segment. Segments
+// cover as equal a share of the samples as possible when the length is not divisible.
+func PAA(vec []float64, segments int) []float64 {
+	out := make([]float64, segments)
+	n := len(vec)
+	for s := range out {
+		start, end := s*n/segments, (s+1)*n/segments
+		if end == start {
+			end = start + 1
+		}
+		var sum float64
+		for _, v := range vec[start:end] {
+			sum += v
+		}
+		out[s] = sum / float64(end-start)
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package resample
+
+// Resample converts vec sampled every from units into n samples every to units starting at the time
+// of the first sample of vec. Downsampling averages the samples falling within each output period and
+// upsampling linearly interpolates between neighbouring samples. Output samples past the end of vec
+// are zero.
+func Resample(vec []float64, from, to int64, n int) []float64 {
+	out := make([]float64, n)
+	if from == to {
+		copy(out, vec)
+		return out
+	}
+
+	if to > from {
+		for k := range out {
+			start, end := int64(k)*to, int64(k+1)*to
+			var sum float64
+			var count int
+			for i := (start + from - 1) / from; i < int64(len(vec)) && i*from < end; i++ {
+				sum += vec[i]
+				count++
+			}
+			if count > 0 {
+				out[k] = sum / float64(count)
+			}
+		}
+		return out
+	}
+
+	for k := range out {
+		pos := float64(int64(k)*to) / float64(from)
+		i := int(pos)
+		switch {
+		case i >= len(vec):
+			out[k] = 0
+		case i+1 >= len(vec):
+			out[k] = vec[i]
+		default:
+			frac := pos - float64(i)
+			out[k] = vec[i] + frac*(vec[i+1]-vec[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package resample
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResample(t *testing.T) {
+	testData := []struct {
+		vec      []float64
+		from, to int64
+		n        int
+		expected []float64
+	}{
+		{[]float64{1, 2, 3}, 60, 60, 4, []float64{1, 2, 3, 0}},
+		{[]float64{1, 3, 5, 7, 9, 11}, 10, 30, 2, []float64{3, 9}},
+		{[]float64{1, 3, 5, 7}, 10, 30, 2, []float64{3, 7}},
+		{[]float64{0, 6}, 60, 20, 4, []float64{0, 2, 4, 6}},
+		{[]float64{0, 6}, 60, 20, 7, []float64{0, 2, 4, 6, 6, 6, 0}},
+	}
+	for _, td := range testData {
+		res := Resample(td.vec, td.from, td.to, td.n)
+		if len(res) != len(td.expected) {
+			t.Fatalf("expected %v, but got %v", td.expected, res)
+		}
+		for i := range res {
+			if math.Abs(res[i]-td.expected[i]) > 1e-9 {
+				t.Errorf("expected %v, but got %v", td.expected, res)
+				break
+			}
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	testData := []struct {
+		fit      func([]float64, int) []float64
+		vec      []float64
+		n        int
+		expected []float64
+	}{
+		{Linear, []float64{0, 2, 4}, 5, []float64{0, 1, 2, 3, 4}},
+		{Linear, []float64{0, 1, 2, 3, 4}, 3, []float64{0, 2, 4}},
+		{Linear, []float64{5}, 2, []float64{5, 5}},
+		{LTTB, []float64{0, 1, 9, 1, 0, -8, 0, 1}, 4, []float64{0, 9, -8, 1}},
+		{LTTB, []float64{0, 2, 4}, 5, []float64{0, 1, 2, 3, 4}},
+	}
+	for _, td := range testData {
+		res := td.fit(td.vec, td.n)
+		if len(res) != len(td.expected) {
+			t.Fatalf("expected %v, but got %v", td.expected, res)
+		}
+		for i := range res {
+			if math.Abs(res[i]-td.expected[i]) > 1e-9 {
+				t.Errorf("expected %v, but got %v", td.expected, res)
+				break
+			}
+		}
+	}
+}
+
+func TestPAA(t *testing.T) {
+	testData := []struct {
+		vec      []float64
+		segments int
+		expected []float64
+	}{
+		{[]float64{1, 3, 5, 7, 9, 11}, 3, []float64{2, 6, 10}},
+		{[]float64{1, 2, 3, 4, 5}, 2, []float64{1.5, 4}},
+		{[]float64{1, 2, 3}, 3, []float64{1, 2, 3}},
+	}
+	for _, td := range testData {
+		res := PAA(td.vec, td.segments)
+		for i := range res {
+			if math.Abs(res[i]-td.expected[i]) > 1e-9 {
+				t.Errorf("expected %v, but got %v", td.expected, res)
+				break
+			}
+		}
+	}
+}
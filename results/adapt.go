@@ -0,0 +1,40 @@
+package results
+
+import (
+	"math"
+	"sort"
+
+	"github.com/aouyang1/go-lsh/options"
+)
+
+// Adapt picks the threshold bringing the number of scores within the target starting from threshold.
+// The scores must be ordered by Compare and hold the top Max+1 scores passing a lower threshold so that
+// exceeding Max is detected. The threshold is lowered to the magnitude of the Min-th score when fewer
+// than Min pass it and raised to the magnitude of the Max-th score when more than Max do. Returns the
+// scores passing the picked threshold, at most Max of them, along with the threshold.
+func Adapt(scores Scores, target options.ResultRange, threshold float64) (Scores, float64) {
+	// magnitudes decrease along the scores so the number passing a threshold is a binary search
+	passing := func(t float64) int {
+		return sort.Search(len(scores), func(i int) bool {
+			return math.Abs(scores[i].Score) < t
+		})
+	}
+
+	n := passing(threshold)
+	switch {
+	case n > target.Max:
+		threshold = math.Abs(scores[target.Max-1].Score)
+	case n < target.Min && n < len(scores):
+		i := target.Min
+		if i > len(scores) {
+			i = len(scores)
+		}
+		threshold = math.Abs(scores[i-1].Score)
+	}
+	n = passing(threshold)
+	if n > target.Max {
+		// ties at the threshold are cut in the order defined by Compare
+		n = target.Max
+	}
+	return scores[:n], threshold
+}
@@ -0,0 +1,61 @@
+package results
+
+import "math"
+
+// Between returns the scores whose absolute value is between min and max inclusive keeping their order
+func (s Scores) Between(min, max float64) Scores {
+	out := make(Scores, 0, len(s))
+	for _, score := range s {
+		if abs := math.Abs(score.Score); abs >= min && abs <= max {
+			out = append(out, score)
+		}
+	}
+	return out
+}
+
+// GroupByUID returns the scores of each uid keeping their order
+func (s Scores) GroupByUID() map[uint64]Scores {
+	out := make(map[uint64]Scores)
+	for _, score := range s {
+		out[score.UID] = append(out[score.UID], score)
+	}
+	return out
+}
+
+// ByUID returns the best ranked score of each uid according to Compare
+func (s Scores) ByUID() map[uint64]Score {
+	out := make(map[uint64]Score, len(s))
+	for _, score := range s {
+		if best, exists := out[score.UID]; !exists || Compare(score, best) < 0 {
+			out[score.UID] = score
+		}
+	}
+	return out
+}
+
+// Merge combines the scores of searches fanned out over several indexes into the order defined by
+// Compare keeping the top n. Scores of the same uid and index are only kept once. n less than 1 keeps
+// every score.
+func Merge(n int, scores ...Scores) Scores {
+	type window struct {
+		uid   uint64
+		index int64
+	}
+	seen := make(map[window]struct{})
+	var out Scores
+	for _, s := range scores {
+		for _, score := range s {
+			w := window{score.UID, score.Index}
+			if _, exists := seen[w]; exists {
+				continue
+			}
+			seen[w] = struct{}{}
+			out = append(out, score)
+		}
+	}
+	out.Sort()
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package results
+
+import "testing"
+
+func TestScoresAggregation(t *testing.T) {
+	scores := Scores{
+		{UID: 1, Index: 0, Score: 0.9},
+		{UID: 2, Index: 0, Score: -0.6},
+		{UID: 1, Index: 60, Score: 0.95},
+		{UID: 3, Index: 0, Score: 0.4},
+	}
+
+	between := scores.Between(0.5, 0.9)
+	if len(between) != 2 || between[0].UID != 1 || between[1].UID != 2 {
+		t.Errorf("expected uids 1 and 2 between 0.5 and 0.9, but got %v", between)
+	}
+
+	groups := scores.GroupByUID()
+	if len(groups) != 3 || len(groups[1]) != 2 {
+		t.Errorf("expected %d groups with %d scores for uid 1, but got %v", 3, 2, groups)
+	}
+
+	best := scores.ByUID()
+	if best[1].Index != 60 {
+		t.Errorf("expected best score of uid 1 at index %d, but got %v", 60, best[1])
+	}
+
+	testData := []struct {
+		n        int
+		expected []uint64
+	}{
+		{0, []uint64{1, 1, 4, 2, 3}},
+		{3, []uint64{1, 1, 4}},
+	}
+	shard := Scores{{UID: 4, Index: 0, Score: 0.7}, {UID: 1, Index: 0, Score: 0.9}}
+	for _, td := range testData {
+		uids := Merge(td.n, scores, shard).UIDs()
+		if len(uids) != len(td.expected) {
+			t.Fatalf("expected %v, but got %v", td.expected, uids)
+		}
+		for i := range uids {
+			if uids[i] != td.expected[i] {
+				t.Fatalf("expected %v, but got %v", td.expected, uids)
+			}
+		}
+	}
+}
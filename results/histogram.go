@@ -0,0 +1,63 @@
+package results
+
+// Histogram counts scores in equal width bins spanning the correlation range of -1 to 1. The last bin
+// includes 1.
+type Histogram struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Counts []int   `json:"counts"`
+}
+
+// NewHistogram creates an empty histogram with the given number of bins
+func NewHistogram(bins int) *Histogram {
+	return &Histogram{Min: -1, Max: 1, Counts: make([]int, bins)}
+}
+
+// Add counts the score in its bin, scores outside the range count towards the nearest bin
+func (h *Histogram) Add(score float64) {
+	bin := int((score - h.Min) / (h.Max - h.Min) * float64(len(h.Counts)))
+	if bin < 0 {
+		bin = 0
+	}
+	if bin >= len(h.Counts) {
+		bin = len(h.Counts) - 1
+	}
+	h.Counts[bin]++
+}
+
+// Merge adds the counts of another histogram with the same bins
+func (h *Histogram) Merge(o *Histogram) {
+	for i := range h.Counts {
+		if i < len(o.Counts) {
+			h.Counts[i] += o.Counts[i]
+		}
+	}
+}
+
+// Total returns the number of counted scores
+func (h *Histogram) Total() int {
+	var total int
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+// Quantile returns the upper edge of the bin containing the q-th quantile of the counted scores, useful
+// for choosing a threshold that keeps a given fraction of candidates
+func (h *Histogram) Quantile(q float64) float64 {
+	total := h.Total()
+	if total == 0 {
+		return h.Min
+	}
+	width := (h.Max - h.Min) / float64(len(h.Counts))
+	target := q * float64(total)
+	var seen int
+	for i, c := range h.Counts {
+		seen += c
+		if float64(seen) >= target {
+			return h.Min + width*float64(i+1)
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,58 @@
+package results
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(4)
+	for _, s := range []float64{-1, -0.6, -0.2, 0, 0.3, 0.9, 1} {
+		h.Add(s)
+	}
+	expected := []int{2, 1, 2, 2}
+	for i, c := range expected {
+		if h.Counts[i] != c {
+			t.Fatalf("expected %v, but got %v", expected, h.Counts)
+		}
+	}
+	if h.Total() != 7 {
+		t.Errorf("expected %d, but got %d", 7, h.Total())
+	}
+
+	testData := []struct {
+		q        float64
+		expected float64
+	}{
+		{0, -0.5},
+		{0.5, 0.5},
+		{1, 1},
+	}
+	for _, td := range testData {
+		if q := h.Quantile(td.q); math.Abs(q-td.expected) > 1e-9 {
+			t.Errorf("expected %v, but got %v for quantile %v", td.expected, q, td.q)
+		}
+	}
+
+	o := NewHistogram(4)
+	o.Add(0.9)
+	h.Merge(o)
+	if h.Counts[3] != 3 {
+		t.Errorf("expected %d, but got %d", 3, h.Counts[3])
+	}
+}
+
+func TestResultsHistogram(t *testing.T) {
+	r := New(1, 0.9, 0)
+	r.Histogram = NewHistogram(2)
+	r.Update(Score{UID: 0, Score: 0.95})
+	r.Update(Score{UID: 1, Score: -0.5})
+	r.Update(Score{UID: 2, Score: 0.1})
+
+	if r.Histogram.Counts[0] != 1 || r.Histogram.Counts[1] != 2 {
+		t.Errorf("expected every scored candidate to be counted, but got %v", r.Histogram.Counts)
+	}
+	if len(r.Fetch()) != 1 {
+		t.Errorf("expected histogram not to affect the top results")
+	}
+}
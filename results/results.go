@@ -2,7 +2,9 @@ package results
 
 import (
 	"container/heap"
+	"encoding/json"
 	"math"
+	"sort"
 
 	"github.com/aouyang1/go-lsh/options"
 )
@@ -13,6 +15,34 @@ type Results struct {
 	SignFilter options.SignFilter
 	scores     Scores
 	NumScored  int
+	NumMatched int // scores passing the threshold and sign filter
+
+	// CountOnly counts the scores passing the threshold without keeping them
+	CountOnly bool
+
+	// NegativeThreshold is the magnitude negative scores must reach instead of Threshold when greater
+	// than 0
+	NegativeThreshold float64
+
+	// Trend records the linear trend slope of each scored vector before it was transformed
+	Trend bool
+
+	// Histogram counts every scored candidate regardless of threshold when set
+	Histogram *Histogram
+
+	// Precision rounds scores to this many decimal places when greater than 0
+	Precision int
+
+	// HalfLife decays the scores passing the threshold by how far their index lags behind the query
+	// index, halving them every HalfLife, when greater than 0
+	HalfLife int64
+
+	// MaxPerUID keeps at most this many of the top scores of each uid when greater than 0
+	MaxPerUID int
+
+	// Group keeps up to TopN scores for each group key instead of TopN overall when set
+	Group  func(Score) string
+	groups map[string]*Scores
 }
 
 // NewResults creates a new instance of results to track similar vectors
@@ -33,7 +63,11 @@ func New(topN int, threshold float64, signFilter options.SignFilter) *Results {
 
 // passed checks if the input score satisfies the Results lag and threshold requirements
 func (r *Results) passed(s Score) bool {
-	return math.Abs(float64(s.Score)) >= r.Threshold &&
+	threshold := r.Threshold
+	if s.Score < 0 && r.NegativeThreshold > 0 {
+		threshold = r.NegativeThreshold
+	}
+	return math.Abs(float64(s.Score)) >= threshold &&
 		(r.SignFilter == options.SignFilter_ANY ||
 			(s.Score > 0 && r.SignFilter == options.SignFilter_POS) ||
 			(s.Score < 0 && r.SignFilter == options.SignFilter_NEG))
@@ -42,21 +76,97 @@ func (r *Results) passed(s Score) bool {
 // Update records the input score
 func (r *Results) Update(s Score) {
 	r.NumScored++
+	if r.Precision > 0 {
+		s.Score = Round(s.Score, r.Precision)
+	}
+	if r.Histogram != nil {
+		r.Histogram.Add(s.Score)
+	}
 	if !r.passed(s) {
 		return
 	}
-	if r.scores.Len() == r.TopN {
-		if math.Abs(s.Score) > math.Abs(r.scores[0].Score) {
-			heap.Pop(&r.scores)
-			heap.Push(&r.scores, s)
+	r.NumMatched++
+	if r.CountOnly {
+		return
+	}
+	if r.HalfLife > 0 {
+		s.Score *= Decay(-s.Lag, r.HalfLife)
+		if r.Precision > 0 {
+			s.Score = Round(s.Score, r.Precision)
+		}
+	}
+	if r.Group == nil {
+		r.scores.keep(s, r.TopN, r.MaxPerUID)
+		return
+	}
+	if r.groups == nil {
+		r.groups = make(map[string]*Scores)
+	}
+	key := r.Group(s)
+	group, exists := r.groups[key]
+	if !exists {
+		group = &Scores{}
+		r.groups[key] = group
+	}
+	group.keep(s, r.TopN, r.MaxPerUID)
+}
+
+// keep pushes the score onto the heap holding at most n scores and, when perUID is greater than 0, at
+// most perUID scores of the same uid
+func (s *Scores) keep(score Score, n, perUID int) {
+	if perUID > 0 {
+		count, worst := 0, -1
+		for i, sc := range *s {
+			if sc.UID != score.UID {
+				continue
+			}
+			count++
+			if worst < 0 || Compare(sc, (*s)[worst]) > 0 {
+				worst = i
+			}
+		}
+		if count >= perUID {
+			// replace the lowest ranked score of the uid rather than consuming another slot
+			if Compare(score, (*s)[worst]) < 0 {
+				heap.Remove(s, worst)
+				heap.Push(s, score)
+			}
+			return
+		}
+	}
+	if s.Len() == n {
+		if Compare(score, (*s)[0]) < 0 {
+			heap.Pop(s)
+			heap.Push(s, score)
 		}
 	} else {
-		heap.Push(&r.scores, s)
+		heap.Push(s, score)
+	}
+}
+
+// Decay returns the factor halving every halfLife of age. Matches that are not older than the query
+// are not decayed.
+func Decay(age, halfLife int64) float64 {
+	if age <= 0 || halfLife <= 0 {
+		return 1
 	}
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
+
+// Round rounds the score to the given number of decimal places
+func Round(score float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(score*scale) / scale
 }
 
-// Fetch returns the sorted scores in ascending order
+// Fetch returns the scores in the order defined by Compare. The order is fully deterministic so it is
+// stable across repeated searches and can be relied on for pagination.
 func (r *Results) Fetch() Scores {
+	if r.groups != nil {
+		s := r.Sorted()
+		r.groups = nil
+		return s
+	}
 	s := make(Scores, len(r.scores))
 	var score Score
 	numScores := len(r.scores)
@@ -68,6 +178,26 @@ func (r *Results) Fetch() Scores {
 	return s
 }
 
+// Sorted returns a copy of the scores in the order defined by Compare without consuming them
+func (r *Results) Sorted() Scores {
+	s := make(Scores, len(r.scores))
+	copy(s, r.scores)
+	for _, group := range r.groups {
+		s = append(s, *group...)
+	}
+	s.Sort()
+	return s
+}
+
+// MarshalJSON encodes the results in the same shape as a search response so there is a single
+// serialization of scores along with the number of candidates scored
+func (r *Results) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Scores    Scores `json:"scores"`
+		NumScored int    `json:"num_scored"`
+	}{r.Sorted(), r.NumScored})
+}
+
 // Scores is a slice of individual Score's
 type Scores []Score
 
@@ -79,25 +209,38 @@ func (s Scores) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
+// Less orders the heap with the score that ranks last according to Compare at the root
 func (s Scores) Less(i, j int) bool {
-	a := s[i]
-	b := s[j]
-	if math.Abs(a.Score) < math.Abs(b.Score) {
-		return true
-	}
-	if math.Abs(a.Score) > math.Abs(b.Score) {
-		return false
-	}
-	if a.Index < b.Index {
-		return true
-	}
-	if a.Index > b.Index {
-		return false
-	}
-	if a.UID < b.UID {
-		return true
+	return Compare(s[i], s[j]) > 0
+}
+
+// Sort orders the scores as returned by Fetch
+func (s Scores) Sort() {
+	sort.Slice(s, func(i, j int) bool {
+		return Compare(s[i], s[j]) < 0
+	})
+}
+
+// Compare returns a negative number if a ranks before b, a positive number if a ranks after b and 0
+// if they are identical. Scores rank by descending absolute score, then ascending index and then
+// ascending uid.
+func Compare(a, b Score) int {
+	absA, absB := math.Abs(a.Score), math.Abs(b.Score)
+	switch {
+	case absA > absB:
+		return -1
+	case absA < absB:
+		return 1
+	case a.Index < b.Index:
+		return -1
+	case a.Index > b.Index:
+		return 1
+	case a.UID < b.UID:
+		return -1
+	case a.UID > b.UID:
+		return 1
 	}
-	return false
+	return 0
 }
 
 // Push implements the function in the heap interface
@@ -128,8 +271,44 @@ func (s Scores) Scores() []float64 {
 	return out
 }
 
+// Score is a matching window of a stored document. Every search encodes scores with the same json
+// schema of
+//
+//	{"uid": 1, "index": 3600, "lag": 60, "score": 0.93, "trend": 0.1, "label": "owner"}
+//
+// where trend and label are omitted when not set.
 type Score struct {
 	UID   uint64  `json:"uid"`
-	Index int64   `json:"index"`
+	Index int64   `json:"index"` // index of the start of the matching window
+	Lag   int64   `json:"lag"`   // index of the window relative to the index of the query
 	Score float64 `json:"score"`
+	Trend float64 `json:"trend,omitempty"` // slope per sample of the stored vector when requested
+	Label string  `json:"label,omitempty"` // access control label of the owner of the document
+}
+
+// Diagnostics describe how much of the index a search probed
+type Diagnostics struct {
+	NumCandidates   int     `json:"num_candidates"`
+	NumScored       int     `json:"num_scored"`
+	NumMatched      int     `json:"num_matched"` // scored candidates passing the threshold and sign filter
+	TablesProbed    int     `json:"tables_probed"`
+	EstimatedRecall float64 `json:"estimated_recall"` // probability a document correlated at the threshold collides in a probed table
+
+	// Generation is the sequence number of the last mutation applied when the search started. Results
+	// cached under an older generation than Generation of the index may be stale.
+	Generation uint64 `json:"generation"`
+
+	// Seed is the seed the candidates were sampled with when they exceeded MaxCandidates. Searching
+	// again with the seed samples the same candidates from an unchanged index.
+	Seed int64 `json:"seed,omitempty"`
+
+	// LengthAdjustment is the number of samples the length policy padded onto the query if positive or
+	// truncated from it if negative
+	LengthAdjustment int `json:"length_adjustment,omitempty"`
+
+	// Threshold is the threshold the results passed which differs from the search threshold when it was
+	// adapted to the target results
+	Threshold float64 `json:"threshold"`
+
+	Histogram *Histogram `json:"histogram,omitempty"` // distribution of all candidate scores when requested
 }
@@ -1,14 +1,17 @@
 package results
 
 import (
+	"encoding/json"
 	"testing"
+
+	"github.com/aouyang1/go-lsh/options"
 )
 
 func TestScores(t *testing.T) {
 	s := Scores{
-		{0, 0, 0.9},
-		{1, 0, 0.8},
-		{2, 0, 0.7},
+		{UID: 0, Index: 0, Score: 0.9},
+		{UID: 1, Index: 0, Score: 0.8},
+		{UID: 2, Index: 0, Score: 0.7},
 	}
 	res := s.Scores()
 	expected := []float64{0.9, 0.8, 0.7}
@@ -21,3 +24,229 @@ func TestScores(t *testing.T) {
 		}
 	}
 }
+
+func TestCompare(t *testing.T) {
+	testData := []struct {
+		a, b     Score
+		expected int
+	}{
+		{Score{UID: 0, Index: 0, Score: 0.9}, Score{UID: 1, Index: 0, Score: 0.8}, -1},
+		{Score{UID: 0, Index: 0, Score: -0.7}, Score{UID: 1, Index: 0, Score: 0.8}, 1},
+		{Score{UID: 1, Index: 60, Score: 0.8}, Score{UID: 0, Index: 120, Score: -0.8}, -1},
+		{Score{UID: 1, Index: 60, Score: 0.8}, Score{UID: 0, Index: 60, Score: 0.8}, 1},
+		{Score{UID: 1, Index: 60, Score: 0.8}, Score{UID: 1, Index: 60, Score: 0.8}, 0},
+	}
+	for _, td := range testData {
+		if res := Compare(td.a, td.b); res != td.expected {
+			t.Errorf("expected %d comparing %v to %v, but got %d", td.expected, td.a, td.b, res)
+		}
+	}
+}
+
+func TestFetchOrder(t *testing.T) {
+	scores := Scores{
+		{UID: 3, Index: 0, Score: 0.9},
+		{UID: 1, Index: 60, Score: 0.9},
+		{UID: 2, Index: 0, Score: -0.9},
+		{UID: 0, Index: 0, Score: 0.95},
+		{UID: 4, Index: 0, Score: 0.9},
+	}
+	expected := []uint64{0, 2, 3, 4}
+
+	// insertion order must not affect which ties are kept or how they are ordered
+	for shift := 0; shift < len(scores); shift++ {
+		res := New(4, 0.5, options.SignFilter_ANY)
+		for i := range scores {
+			res.Update(scores[(i+shift)%len(scores)])
+		}
+		uids := res.Fetch().UIDs()
+		if len(uids) != len(expected) {
+			t.Fatalf("expected %v, but got %v", expected, uids)
+		}
+		for i := range uids {
+			if uids[i] != expected[i] {
+				t.Fatalf("expected %v, but got %v", expected, uids)
+			}
+		}
+	}
+
+	sorted := make(Scores, len(scores))
+	copy(sorted, scores)
+	sorted.Sort()
+	if sorted[0].UID != 0 || sorted[len(sorted)-1].UID != 1 {
+		t.Errorf("expected sorted uids to start with 0 and end with 1, but got %v", sorted.UIDs())
+	}
+}
+
+func TestResultsJSON(t *testing.T) {
+	res := New(2, 0.5, options.SignFilter_ANY)
+	res.Update(Score{UID: 1, Index: 60, Score: 0.7})
+	res.Update(Score{UID: 2, Index: 0, Score: 0.9})
+	res.Update(Score{UID: 3, Index: 0, Score: 0.1})
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"scores":[{"uid":2,"index":0,"lag":0,"score":0.9},{"uid":1,"index":60,"lag":0,"score":0.7}],"num_scored":3}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, but got %s", expected, out)
+	}
+	if len(res.Fetch()) != 2 {
+		t.Errorf("expected marshaling to leave %d scores to fetch", 2)
+	}
+}
+
+func TestResultsPrecision(t *testing.T) {
+	res := New(2, 0.5, options.SignFilter_ANY)
+	res.Precision = 3
+	res.Update(Score{UID: 2, Index: 0, Score: 0.9000000001})
+	res.Update(Score{UID: 1, Index: 0, Score: 0.8999999999})
+	res.Update(Score{UID: 3, Index: 0, Score: 0.4996})
+
+	scores := res.Fetch()
+	expected := Scores{{UID: 1, Index: 0, Score: 0.9}, {UID: 2, Index: 0, Score: 0.9}}
+	if len(scores) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, scores)
+	}
+	for i := range scores {
+		if scores[i] != expected[i] {
+			t.Errorf("expected %v, but got %v", expected[i], scores[i])
+		}
+	}
+}
+
+func TestResultsHalfLife(t *testing.T) {
+	res := New(3, 0.5, options.SignFilter_ANY)
+	res.HalfLife = 60
+	res.Update(Score{UID: 1, Index: 0, Lag: -120, Score: 0.9})
+	res.Update(Score{UID: 2, Index: 120, Lag: 0, Score: 0.8})
+	res.Update(Score{UID: 3, Index: 60, Lag: -60, Score: -0.9})
+	res.Update(Score{UID: 4, Index: 240, Lag: 120, Score: 0.6})
+
+	// the stale uid 1 is equally similar to uid 3 but decays twice as much
+	expected := Scores{
+		{UID: 2, Index: 120, Score: 0.8},
+		{UID: 4, Index: 240, Lag: 120, Score: 0.6},
+		{UID: 3, Index: 60, Lag: -60, Score: -0.45},
+	}
+	scores := res.Fetch()
+	if len(scores) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, scores)
+	}
+	for i := range scores {
+		if scores[i] != expected[i] {
+			t.Errorf("expected %v, but got %v", expected[i], scores[i])
+		}
+	}
+}
+
+func TestResultsNegativeThreshold(t *testing.T) {
+	res := New(10, 0.85, options.SignFilter_ANY)
+	res.NegativeThreshold = 0.95
+	for uid, score := range []float64{0.9, 0.8, -0.9, -0.96, 0.85, -0.95} {
+		res.Update(Score{UID: uint64(uid), Score: score})
+	}
+
+	expected := []uint64{3, 5, 0, 4}
+	uids := res.Fetch().UIDs()
+	if len(uids) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, uids)
+	}
+	for i := range uids {
+		if uids[i] != expected[i] {
+			t.Fatalf("expected %v, but got %v", expected, uids)
+		}
+	}
+}
+
+func TestResultsMaxPerUID(t *testing.T) {
+	res := New(3, 0.5, options.SignFilter_ANY)
+	res.MaxPerUID = 2
+	updates := []Score{
+		{UID: 1, Index: 0, Score: 0.9},
+		{UID: 1, Index: 60, Score: 0.95},
+		{UID: 1, Index: 120, Score: 0.97},
+		{UID: 1, Index: 180, Score: 0.6},
+		{UID: 2, Index: 0, Score: 0.7},
+		{UID: 3, Index: 0, Score: 0.65},
+	}
+	for _, s := range updates {
+		res.Update(s)
+	}
+
+	// uid 1 keeps its two best windows leaving room for uid 2
+	expected := Scores{
+		{UID: 1, Index: 120, Score: 0.97},
+		{UID: 1, Index: 60, Score: 0.95},
+		{UID: 2, Index: 0, Score: 0.7},
+	}
+	scores := res.Fetch()
+	if len(scores) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, scores)
+	}
+	for i := range scores {
+		if scores[i] != expected[i] {
+			t.Errorf("expected %v, but got %v", expected[i], scores[i])
+		}
+	}
+}
+
+func TestResultsGroup(t *testing.T) {
+	res := New(2, 0.5, options.SignFilter_ANY)
+	res.Group = func(s Score) string {
+		if s.Score < 0 {
+			return "neg"
+		}
+		return "pos"
+	}
+	for uid, score := range []float64{0.9, 0.8, 0.7, -0.6, 0.95, -0.55, -0.52} {
+		res.Update(Score{UID: uint64(uid), Score: score})
+	}
+
+	// each sign keeps its own top 2 even though the positive scores all rank higher
+	expected := []uint64{4, 0, 3, 5}
+	uids := res.Fetch().UIDs()
+	if len(uids) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, uids)
+	}
+	for i := range uids {
+		if uids[i] != expected[i] {
+			t.Fatalf("expected %v, but got %v", expected, uids)
+		}
+	}
+	if len(res.Fetch()) != 0 {
+		t.Errorf("expected fetching to consume the grouped scores")
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	target := options.ResultRange{Min: 2, Max: 3}
+	testData := []struct {
+		scores    []float64
+		threshold float64
+
+		expectedThreshold float64
+		expectedLen       int
+	}{
+		{[]float64{0.95, 0.9, 0.85, 0.6}, 0.8, 0.8, 3},  // within the target
+		{[]float64{0.95, 0.9, 0.85, 0.8}, 0.5, 0.85, 3}, // raised to the 3rd score
+		{[]float64{0.95, 0.7, 0.6, 0.5}, 0.8, 0.7, 2},   // lowered to the 2nd score
+		{[]float64{0.6}, 0.8, 0.6, 1},                   // lowered to every score
+		{[]float64{0.9, -0.9, 0.9, 0.9}, 0.8, 0.9, 3},   // ties cut at the max
+		{nil, 0.8, 0.8, 0},
+	}
+	for _, td := range testData {
+		res := New(target.Max+1, 0, options.SignFilter_ANY)
+		for uid, score := range td.scores {
+			res.Update(Score{UID: uint64(uid), Score: score})
+		}
+		scores, threshold := Adapt(res.Fetch(), target, td.threshold)
+		if threshold != td.expectedThreshold {
+			t.Errorf("expected %v, but got %v for threshold of %v", td.expectedThreshold, threshold, td.scores)
+		}
+		if len(scores) != td.expectedLen {
+			t.Errorf("expected %d, but got %d results for %v", td.expectedLen, len(scores), td.scores)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package seriesid
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUIDCollision = errors.New("series hashes to a uid already mapped to a different series")
+)
+
+// Key is the identity of a series composed of the metric name and its labels
+type Key struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+}
+
+// String returns the canonical form of the key, e.g. cpu{dc="east",host="a"}
+func (k Key) String() string {
+	var sb strings.Builder
+	sb.WriteString(k.Metric)
+	sb.WriteByte('{')
+	for i, name := range sortedNames(k.Labels) {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(k.Labels[name])
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// Equal returns true if both keys have the same metric and labels
+func (k Key) Equal(o Key) bool {
+	if k.Metric != o.Metric || len(k.Labels) != len(o.Labels) {
+		return false
+	}
+	for name, v := range k.Labels {
+		if ov, exists := o.Labels[name]; !exists || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash deterministically maps a metric name and labels to a uid using FNV-1a over the metric
+// followed by the labels sorted by name. Label order does not affect the result.
+func Hash(metric string, labels map[string]string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(metric))
+	for _, name := range sortedNames(labels) {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		h.Write([]byte{'='})
+		h.Write([]byte(labels[name]))
+	}
+	return h.Sum64()
+}
+
+// Mapper assigns uids to series and keeps the reverse mapping so uids in search results can be
+// translated back into series identities. Safe for concurrent use.
+type Mapper struct {
+	mu   sync.RWMutex
+	keys map[uint64]Key
+}
+
+// NewMapper returns an empty mapper
+func NewMapper() *Mapper {
+	return &Mapper{keys: make(map[uint64]Key)}
+}
+
+// UID returns the uid for the series, registering it for reverse lookups. Returns an error if a
+// different series already maps to the same uid.
+func (m *Mapper) UID(metric string, labels map[string]string) (uint64, error) {
+	uid := Hash(metric, labels)
+	key := Key{Metric: metric, Labels: copyLabels(labels)}
+
+	m.mu.RLock()
+	existing, exists := m.keys[uid]
+	m.mu.RUnlock()
+	if exists {
+		if !existing.Equal(key) {
+			return 0, fmt.Errorf("%w, uid: %d, existing: %s, new: %s", ErrUIDCollision, uid, existing, key)
+		}
+		return uid, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, exists := m.keys[uid]; exists && !existing.Equal(key) {
+		return 0, fmt.Errorf("%w, uid: %d, existing: %s, new: %s", ErrUIDCollision, uid, existing, key)
+	}
+	m.keys[uid] = key
+	return uid, nil
+}
+
+// Lookup returns the series identity registered for the uid
+func (m *Mapper) Lookup(uid uint64) (Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, exists := m.keys[uid]
+	return k, exists
+}
+
+// LookupAll returns the series identities for each uid in the same order. Unknown uids are returned
+// as an empty key.
+func (m *Mapper) LookupAll(uids []uint64) []Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Key, len(uids))
+	for i, uid := range uids {
+		out[i] = m.keys[uid]
+	}
+	return out
+}
+
+// Forget removes the uid from the mapper
+func (m *Mapper) Forget(uid uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, uid)
+}
+
+// Size returns the number of registered series
+func (m *Mapper) Size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.keys)
+}
+
+func sortedNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
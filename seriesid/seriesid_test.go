@@ -0,0 +1,40 @@
+package seriesid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMapperUID(t *testing.T) {
+	m := NewMapper()
+
+	uid, err := m.UID("cpu", map[string]string{"host": "a", "dc": "east"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != Hash("cpu", map[string]string{"dc": "east", "host": "a"}) {
+		t.Fatalf("expected uid to be independent of label order")
+	}
+
+	again, err := m.UID("cpu", map[string]string{"dc": "east", "host": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != uid {
+		t.Fatalf("expected %d, but got %d", uid, again)
+	}
+
+	k, exists := m.Lookup(uid)
+	if !exists {
+		t.Fatalf("expected uid %d to be registered", uid)
+	}
+	if k.String() != `cpu{dc="east",host="a"}` {
+		t.Fatalf("unexpected key, %s", k)
+	}
+
+	// force a collision by registering a different series under the same uid
+	m.keys[Hash("mem", nil)] = Key{Metric: "disk"}
+	if _, err := m.UID("mem", nil); !errors.Is(err, ErrUIDCollision) {
+		t.Fatalf("expected %v, but got %v", ErrUIDCollision, err)
+	}
+}
@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+var (
+	ErrInvalidKeyLength = errors.New("invalid encryption key, must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256")
+	ErrDecrypt          = errors.New("unable to decrypt, the key is wrong or the data was modified")
+)
+
+// KeyProvider returns the encryption key, e.g. by unwrapping a data key through a KMS
+type KeyProvider func() ([]byte, error)
+
+// Cipher seals and opens data at rest with AES-GCM. Every sealed message is prefixed with its own
+// random nonce so the same cipher can be used for snapshot sections and WAL records.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns an AES-GCM cipher for the key
+func NewCipher(key []byte) (*Cipher, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidKeyLength
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// NewCipherFromProvider returns an AES-GCM cipher for the key returned by the provider
+func NewCipherFromProvider(kp KeyProvider) (*Cipher, error) {
+	key, err := kp()
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(key)
+}
+
+// Seal encrypts and authenticates the plaintext along with the additional data returning the nonce
+// followed by the ciphertext. The additional data is not stored and must be given again to Open.
+func (c *Cipher) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.sealedSize(len(plaintext)))
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open authenticates and decrypts data produced by Seal with the same additional data
+func (c *Cipher) Open(sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// sealedSize returns the size of a sealed plaintext of n bytes
+func (c *Cipher) sealedSize(n int) int {
+	return c.aead.NonceSize() + n + c.aead.Overhead()
+}
@@ -0,0 +1,45 @@
+package snapshot
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrInvalidCompressionLevel = errors.New("invalid zstd compression level, must be between 0 and 22")
+
+// NoCompression disables compression of sections
+const NoCompression = 0
+
+var decoder, _ = zstd.NewReader(nil)
+
+// Compressor compresses payloads with zstd at a fixed level so the same compression can be used for
+// snapshot sections and WAL records. A Compressor is safe for concurrent use.
+type Compressor struct {
+	enc *zstd.Encoder
+}
+
+// NewCompressor returns a compressor for the zstd level, 1 through 22, or nil for NoCompression
+func NewCompressor(level int) (*Compressor, error) {
+	if level < NoCompression || level > 22 {
+		return nil, ErrInvalidCompressionLevel
+	}
+	if level == NoCompression {
+		return nil, nil
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return nil, err
+	}
+	return &Compressor{enc: enc}, nil
+}
+
+// Compress returns the compressed payload
+func (c *Compressor) Compress(payload []byte) []byte {
+	return c.enc.EncodeAll(payload, make([]byte, 0, len(payload)/2))
+}
+
+// Decompress reverses Compress regardless of the level it was compressed at
+func Decompress(payload []byte) ([]byte, error) {
+	return decoder.DecodeAll(payload, nil)
+}
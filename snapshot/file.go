@@ -0,0 +1,170 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+var ErrSectionNotFound = errors.New("section not found in snapshot")
+
+// File provides random access to the sections of a snapshot. Only section headers are read when the
+// file is opened, payloads stay on disk until a section is loaded.
+type File struct {
+	r          io.ReaderAt
+	opts       Options
+	compressed bool
+	bound      []byte // header sealed sections are bound to, nil for unbound versions
+
+	sections []*Section
+	byName   map[string]*Section
+}
+
+// Section is a lazily loaded section of a snapshot file
+type Section struct {
+	Name   string
+	Offset int64 // byte offset of the start of the section header
+	Size   int64 // number of stored payload bytes
+
+	f          *File
+	ordinal    int // position of the section in the snapshot
+	payloadOff int64
+	crc        uint32
+
+	once    sync.Once
+	payload []byte
+	err     error
+}
+
+// Open indexes the sections of a snapshot of the given size without reading any payloads
+func Open(r io.ReaderAt, size int64, opts Options) (*File, error) {
+	hr, err := NewReader(io.NewSectionReader(r, 0, size), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{r: r, opts: opts, compressed: hr.compressed, bound: hr.bound, byName: make(map[string]*Section)}
+	offset := int64(headerSize)
+	for i := 0; ; i++ {
+		label := fmt.Sprintf("#%d", i)
+		corrupt := func(section, reason string) error {
+			return &CorruptionError{Section: section, Offset: offset, Reason: reason}
+		}
+
+		lenBuf := make([]byte, 2)
+		if _, err := r.ReadAt(lenBuf, offset); err != nil {
+			return nil, corrupt(label, "missing end of snapshot marker, file is truncated")
+		}
+		nameLen := int(binary.BigEndian.Uint16(lenBuf))
+		if nameLen == 0 {
+			if c := opts.Cipher; c != nil && f.bound != nil {
+				sealed := make([]byte, c.sealedSize(8))
+				if _, err := r.ReadAt(sealed, offset+2); err != nil {
+					return nil, corrupt(label, "sealed end of snapshot marker is truncated")
+				}
+				if reason := verifyEnd(c, f.bound, sealed, i); reason != "" {
+					return nil, corrupt(label, reason)
+				}
+			}
+			break
+		}
+
+		header := make([]byte, 2+nameLen+16)
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, corrupt(label, "section header is truncated")
+		}
+		if crc32.Checksum(header[:2+nameLen+12], crcTable) != binary.BigEndian.Uint32(header[2+nameLen+12:]) {
+			return nil, corrupt(label, "section header checksum mismatch")
+		}
+
+		s := &Section{
+			Name:       string(header[2 : 2+nameLen]),
+			Offset:     offset,
+			Size:       int64(binary.BigEndian.Uint64(header[2+nameLen:])),
+			f:          f,
+			ordinal:    i,
+			payloadOff: offset + int64(len(header)),
+			crc:        binary.BigEndian.Uint32(header[2+nameLen+8:]),
+		}
+		if s.Size < 0 || s.payloadOff+s.Size > size {
+			return nil, corrupt(s.Name, "payload is truncated")
+		}
+		f.sections = append(f.sections, s)
+		f.byName[s.Name] = s
+		offset = s.payloadOff + s.Size
+	}
+	return f, nil
+}
+
+// Sections returns the sections in the order they were written
+func (f *File) Sections() []*Section {
+	return f.sections
+}
+
+// Section returns the named section. If a name was written more than once the last one wins.
+func (f *File) Section(name string) (*Section, error) {
+	s, exists := f.byName[name]
+	if !exists {
+		return nil, fmt.Errorf("%w, %s", ErrSectionNotFound, name)
+	}
+	return s, nil
+}
+
+// LoadSections concurrently loads only the named sections on up to workers goroutines. A
+// non-positive number of workers uses GOMAXPROCS.
+func (f *File) LoadSections(names []string, workers int) (map[string][]byte, error) {
+	sections := make([]*Section, len(names))
+	for i, name := range names {
+		s, err := f.Section(name)
+		if err != nil {
+			return nil, err
+		}
+		sections[i] = s
+	}
+
+	payloads := make([][]byte, len(sections))
+	err := parallel(len(sections), workers, func(i int) error {
+		var err error
+		payloads[i], err = sections[i].Load()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string][]byte, len(sections))
+	for i, s := range sections {
+		loaded[s.Name] = payloads[i]
+	}
+	return loaded, nil
+}
+
+// Load reads, validates and decrypts the payload on first use. Subsequent calls return the same
+// payload.
+func (s *Section) Load() ([]byte, error) {
+	s.once.Do(func() {
+		s.payload, s.err = s.read()
+	})
+	return s.payload, s.err
+}
+
+// Release drops a loaded payload so it is read from disk again on the next Load
+func (s *Section) Release() {
+	s.once = sync.Once{}
+	s.payload = nil
+	s.err = nil
+}
+
+func (s *Section) read() ([]byte, error) {
+	payload := make([]byte, s.Size)
+	if _, err := s.f.r.ReadAt(payload, s.payloadOff); err != nil {
+		return nil, &CorruptionError{Section: s.Name, Offset: s.Offset, Reason: "payload is truncated"}
+	}
+	if crc32.Checksum(payload, crcTable) != s.crc {
+		return nil, &CorruptionError{Section: s.Name, Offset: s.Offset, Reason: "payload checksum mismatch"}
+	}
+	return decode(payload, s.f.opts, s.f.compressed, sectionAAD(s.f.bound, s.ordinal, s.Name))
+}
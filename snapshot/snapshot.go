@@ -0,0 +1,405 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+)
+
+var (
+	ErrInvalidMagic       = errors.New("not a snapshot file")
+	ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+	ErrEncrypted          = errors.New("snapshot is encrypted but no cipher was provided")
+	ErrNotEncrypted       = errors.New("snapshot is not encrypted but a cipher was provided")
+	ErrWriterClosed       = errors.New("snapshot writer is closed")
+	ErrInvalidSectionName = errors.New("invalid section name, must be between 1 and 65535 bytes")
+	ErrCorrupt            = errors.New("snapshot is corrupt")
+)
+
+// CorruptionError identifies the section of a snapshot that failed validation
+type CorruptionError struct {
+	Section string // name of the section or its position if the name itself could not be trusted
+	Offset  int64  // byte offset of the start of the section
+	Reason  string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%v, section %s at offset %d, %s", ErrCorrupt, e.Section, e.Offset, e.Reason)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return ErrCorrupt
+}
+
+const (
+	magic         = "GOLSHSNP"
+	formatVersion = uint16(3)
+	headerSize    = len(magic) + 4
+
+	// unboundVersion is the last version whose sealed sections are not bound to the header and their
+	// position, still read for compatibility
+	unboundVersion = uint16(2)
+
+	flagEncrypted  = uint16(1 << 0)
+	flagCompressed = uint16(1 << 1)
+)
+
+// Options configure how sections are stored
+type Options struct {
+	Cipher *Cipher // optional encryption of every section
+
+	// CompressionLevel is the zstd level, 1 through 22, sections are compressed with before being
+	// encrypted. Compression is detected from the header on read so it only applies to writers.
+	CompressionLevel int
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Writer writes a snapshot as a header followed by named sections. Each section is independently
+// compressed and sealed when enabled. Both the section header and the stored payload are checksummed
+// so a corrupt length is detected before the payload is read. Sealed sections are bound to the header,
+// their position and their name, and an encrypted snapshot ends with the sealed number of sections so
+// sections cannot be reordered, swapped or dropped without detection.
+//
+//	header:  magic[8] version[2] flags[2]
+//	section: nameLen[2] name payloadLen[8] payloadCRC[4] headerCRC[4] payload
+//	end:     nameLen[2]=0 [sealed numSections[8]]
+type Writer struct {
+	w        *bufio.Writer
+	opts     Options
+	comp     *Compressor
+	header   []byte
+	sections int // number of sections written
+	closed   bool
+}
+
+// NewWriter writes the snapshot header to w and returns a writer for the sections
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	comp, err := NewCompressor(opts.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(w)
+	var flags uint16
+	if opts.Cipher != nil {
+		flags |= flagEncrypted
+	}
+	if comp != nil {
+		flags |= flagCompressed
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint16(header[len(magic):], formatVersion)
+	binary.BigEndian.PutUint16(header[len(magic)+2:], flags)
+	if _, err := bw.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw, opts: opts, comp: comp, header: header}, nil
+}
+
+// WriteSection appends a named section to the snapshot
+func (w *Writer) WriteSection(name string, payload []byte) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if len(name) == 0 || len(name) > 0xFFFF {
+		return ErrInvalidSectionName
+	}
+	payload, err := w.encode(w.sections, name, payload)
+	if err != nil {
+		return err
+	}
+	return w.writeStored(name, payload)
+}
+
+// encode applies the configured compression and encryption to the payload of the section at the
+// position. Safe for concurrent use.
+func (w *Writer) encode(ordinal int, name string, payload []byte) ([]byte, error) {
+	if w.comp != nil {
+		payload = w.comp.Compress(payload)
+	}
+	if w.opts.Cipher != nil {
+		return w.opts.Cipher.Seal(payload, sectionAAD(w.header, ordinal, name))
+	}
+	return payload, nil
+}
+
+// writeStored writes the section header followed by the already encoded payload
+func (w *Writer) writeStored(name string, payload []byte) error {
+	buf := make([]byte, 2+len(name)+16)
+	binary.BigEndian.PutUint16(buf, uint16(len(name)))
+	copy(buf[2:], name)
+	binary.BigEndian.PutUint64(buf[2+len(name):], uint64(len(payload)))
+	binary.BigEndian.PutUint32(buf[2+len(name)+8:], crc32.Checksum(payload, crcTable))
+	binary.BigEndian.PutUint32(buf[2+len(name)+12:], crc32.Checksum(buf[:2+len(name)+12], crcTable))
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(payload); err != nil {
+		return err
+	}
+	w.sections++
+	return nil
+}
+
+// SectionEncoder lazily produces the payload of a named section
+type SectionEncoder struct {
+	Name   string
+	Encode func() ([]byte, error)
+}
+
+// WriteSections serializes, compresses and encrypts the sections concurrently on up to workers
+// goroutines and appends them to the snapshot in the order given. A non-positive number of workers
+// uses GOMAXPROCS.
+func (w *Writer) WriteSections(sections []SectionEncoder, workers int) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	for _, s := range sections {
+		if len(s.Name) == 0 || len(s.Name) > 0xFFFF {
+			return ErrInvalidSectionName
+		}
+	}
+
+	stored := make([][]byte, len(sections))
+	err := parallel(len(sections), workers, func(i int) error {
+		payload, err := sections[i].Encode()
+		if err != nil {
+			return fmt.Errorf("section %s, %w", sections[i].Name, err)
+		}
+		stored[i], err = w.encode(w.sections+i, sections[i].Name, payload)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, s := range sections {
+		if err := w.writeStored(s.Name, stored[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parallel runs fn for each index in [0, n) on up to workers goroutines returning the first error
+func parallel(n, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	next := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				if err := fn(idx); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return firstErr
+}
+
+// Close writes the end marker, sealing the number of sections written when encrypted, and flushes the
+// snapshot. The underlying writer is not closed.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	if _, err := w.w.Write([]byte{0, 0}); err != nil {
+		return err
+	}
+	if w.opts.Cipher != nil {
+		count := make([]byte, 8)
+		binary.BigEndian.PutUint64(count, uint64(w.sections))
+		sealed, err := w.opts.Cipher.Seal(count, sectionAAD(w.header, w.sections, ""))
+		if err != nil {
+			return err
+		}
+		if _, err := w.w.Write(sealed); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+// sectionAAD returns the additional data a section is sealed with binding it to the snapshot header,
+// its position and its name. The end marker is sealed with an empty name at the position following
+// the last section. Sections of a snapshot with a nil header are not bound.
+func sectionAAD(header []byte, ordinal int, name string) []byte {
+	if header == nil {
+		return nil
+	}
+	aad := make([]byte, len(header)+8+len(name))
+	copy(aad, header)
+	binary.BigEndian.PutUint64(aad[len(header):], uint64(ordinal))
+	copy(aad[len(header)+8:], name)
+	return aad
+}
+
+// verifyEnd opens the sealed number of sections following the end marker returning the reason it
+// doesn't match the number of sections read
+func verifyEnd(c *Cipher, header, sealed []byte, sections int) string {
+	count, err := c.Open(sealed, sectionAAD(header, sections, ""))
+	if err != nil {
+		return "end of snapshot marker fails authentication, sections are missing or out of order"
+	}
+	if n := binary.BigEndian.Uint64(count); n != uint64(sections) {
+		return fmt.Sprintf("snapshot holds %d of %d sections", sections, n)
+	}
+	return ""
+}
+
+// Reader streams the sections of a snapshot in the order they were written validating the checksums
+// of each section
+type Reader struct {
+	r          *bufio.Reader
+	opts       Options
+	compressed bool
+	bound      []byte // header sealed sections are bound to, nil for unbound versions
+
+	offset  int64 // offset of the next section
+	section int   // position of the next section
+}
+
+// NewReader reads and validates the snapshot header from r
+func NewReader(r io.Reader, opts Options) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalidMagic
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrInvalidMagic
+	}
+	bound := header
+	switch v := binary.BigEndian.Uint16(header[len(magic):]); v {
+	case formatVersion:
+	case unboundVersion:
+		bound = nil
+	default:
+		return nil, fmt.Errorf("%w, %d", ErrUnsupportedVersion, v)
+	}
+	flags := binary.BigEndian.Uint16(header[len(magic)+2:])
+	encrypted := flags&flagEncrypted != 0
+	if encrypted && opts.Cipher == nil {
+		return nil, ErrEncrypted
+	}
+	if !encrypted && opts.Cipher != nil {
+		return nil, ErrNotEncrypted
+	}
+	return &Reader{
+		r:          br,
+		opts:       opts,
+		compressed: flags&flagCompressed != 0,
+		bound:      bound,
+		offset:     int64(len(header)),
+	}, nil
+}
+
+// Next returns the name and payload of the next section or io.EOF after the last section. Returns a
+// *CorruptionError if the section is truncated or fails its checksums.
+func (r *Reader) Next() (string, []byte, error) {
+	start := r.offset
+	label := fmt.Sprintf("#%d", r.section)
+	corrupt := func(section, reason string) error {
+		return &CorruptionError{Section: section, Offset: start, Reason: reason}
+	}
+
+	lenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(r.r, lenBuf); err != nil {
+		return "", nil, corrupt(label, "missing end of snapshot marker, file is truncated")
+	}
+	nameLen := int(binary.BigEndian.Uint16(lenBuf))
+	if nameLen == 0 {
+		if c := r.opts.Cipher; c != nil && r.bound != nil {
+			sealed := make([]byte, c.sealedSize(8))
+			if _, err := io.ReadFull(r.r, sealed); err != nil {
+				return "", nil, corrupt(label, "sealed end of snapshot marker is truncated")
+			}
+			if reason := verifyEnd(c, r.bound, sealed, r.section); reason != "" {
+				return "", nil, corrupt(label, reason)
+			}
+		}
+		return "", nil, io.EOF
+	}
+
+	header := make([]byte, 2+nameLen+16)
+	copy(header, lenBuf)
+	if _, err := io.ReadFull(r.r, header[2:]); err != nil {
+		return "", nil, corrupt(label, "section header is truncated")
+	}
+	if crc32.Checksum(header[:2+nameLen+12], crcTable) != binary.BigEndian.Uint32(header[2+nameLen+12:]) {
+		return "", nil, corrupt(label, "section header checksum mismatch")
+	}
+	name := string(header[2 : 2+nameLen])
+	payloadLen := binary.BigEndian.Uint64(header[2+nameLen:])
+	payloadCRC := binary.BigEndian.Uint32(header[2+nameLen+8:])
+
+	// the length is only trusted as far as the payload is there so a corrupt length fails once the
+	// stream ends rather than allocating it upfront
+	if payloadLen > math.MaxInt64 {
+		return "", nil, corrupt(name, "payload is truncated")
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r.r, int64(payloadLen)); err != nil {
+		return "", nil, corrupt(name, "payload is truncated")
+	}
+	payload := buf.Bytes()
+	if crc32.Checksum(payload, crcTable) != payloadCRC {
+		return "", nil, corrupt(name, "payload checksum mismatch")
+	}
+	ordinal := r.section
+	r.offset += int64(len(header)) + int64(payloadLen)
+	r.section++
+
+	payload, err := decode(payload, r.opts, r.compressed, sectionAAD(r.bound, ordinal, name))
+	if err != nil {
+		return "", nil, err
+	}
+	return name, payload, nil
+}
+
+// decode reverses the encryption and compression applied to a stored payload sealed with the additional
+// data
+func decode(payload []byte, opts Options, compressed bool, aad []byte) ([]byte, error) {
+	var err error
+	if opts.Cipher != nil {
+		if payload, err = opts.Cipher.Open(payload, aad); err != nil {
+			return nil, err
+		}
+	}
+	if compressed {
+		return Decompress(payload)
+	}
+	return payload, nil
+}
@@ -0,0 +1,362 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+func writeSnapshot(t *testing.T, opts Options, sections map[string][]byte, order []string) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range order {
+		if err := w.WriteSection(name, sections[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readSnapshot(t *testing.T, data []byte, opts Options) ([]string, map[string][]byte) {
+	r, err := NewReader(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	sections := make(map[string][]byte)
+	for {
+		name, payload, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, name)
+		sections[name] = payload
+	}
+	return order, sections
+}
+
+func TestSnapshotEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := map[string][]byte{
+		"configs":  []byte(`{"num_tables":128}`),
+		"tables/0": bytes.Repeat([]byte("secret telemetry"), 10),
+	}
+	order := []string{"configs", "tables/0"}
+	data := writeSnapshot(t, Options{Cipher: c}, sections, order)
+	if bytes.Contains(data, []byte("secret telemetry")) {
+		t.Fatal("expected sections to be encrypted")
+	}
+
+	gotOrder, got := readSnapshot(t, data, Options{Cipher: c})
+	if len(gotOrder) != len(order) {
+		t.Fatalf("expected %d sections, but got %d", len(order), len(gotOrder))
+	}
+	for _, name := range order {
+		if !bytes.Equal(got[name], sections[name]) {
+			t.Fatalf("expected %q, but got %q for section %s", sections[name], got[name], name)
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader(data), Options{}); err != ErrEncrypted {
+		t.Fatalf("expected %v, but got %v", ErrEncrypted, err)
+	}
+
+	wrong, err := NewCipherFromProvider(func() ([]byte, error) { return bytes.Repeat([]byte{8}, 32), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(data), Options{Cipher: wrong})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Next(); err != ErrDecrypt {
+		t.Fatalf("expected %v, but got %v", ErrDecrypt, err)
+	}
+}
+
+func TestSnapshotTampering(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := map[string][]byte{
+		"tables/0": bytes.Repeat([]byte{0}, 16),
+		"tables/1": bytes.Repeat([]byte{1}, 16),
+		"tables/2": bytes.Repeat([]byte{2}, 16),
+	}
+	data := writeSnapshot(t, Options{Cipher: c}, sections, []string{"tables/0", "tables/1", "tables/2"})
+
+	// every section is stored with the same length
+	size := (len(data) - headerSize - 2 - c.sealedSize(8)) / 3
+	section := func(i int) []byte {
+		return data[headerSize+i*size : headerSize+(i+1)*size]
+	}
+	concat := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+	end := data[headerSize+3*size:]
+	flagged := concat(data[:headerSize], section(0), section(1), section(2), end)
+	flagged[len(magic)+3] |= byte(flagCompressed)
+
+	testData := []struct {
+		data []byte
+		err  error
+	}{
+		{concat(data[:headerSize], section(0), section(2), section(1), end), ErrDecrypt},
+		{concat(data[:headerSize], section(0), section(1), end), ErrCorrupt},
+		{concat(data[:headerSize], section(0), section(1), section(2), []byte{0, 0}), ErrCorrupt},
+		{flagged, ErrDecrypt},
+	}
+	for _, td := range testData {
+		r, err := NewReader(bytes.NewReader(td.data), Options{Cipher: c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			_, _, err = r.Next()
+		}
+		if !errors.Is(err, td.err) {
+			t.Errorf("expected %v, but got %v", td.err, err)
+		}
+		if _, err := Open(bytes.NewReader(td.data), int64(len(td.data)), Options{Cipher: c}); td.err == ErrCorrupt && !errors.Is(err, td.err) {
+			t.Errorf("expected %v opening the file, but got %v", td.err, err)
+		}
+	}
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	sections := map[string][]byte{
+		"configs":  []byte(`{"num_tables":128}`),
+		"tables/0": bytes.Repeat([]byte{1, 2, 3}, 100),
+	}
+	data := writeSnapshot(t, Options{}, sections, []string{"configs", "tables/0"})
+
+	flipped := make([]byte, len(data))
+	copy(flipped, data)
+	flipped[len(flipped)-10] ^= 0xFF
+
+	// a length claiming far more than the file holds with a valid header checksum
+	huge := make([]byte, len(data))
+	copy(huge, data)
+	nameEnd := headerSize + 2 + len("configs")
+	binary.BigEndian.PutUint64(huge[nameEnd:], 1<<40)
+	binary.BigEndian.PutUint32(huge[nameEnd+12:], crc32.Checksum(huge[headerSize:nameEnd+12], crcTable))
+
+	testData := []struct {
+		data    []byte
+		section string
+		reason  string
+	}{
+		{data[:len(data)-2], "#2", "truncated"},
+		{data[:len(data)-50], "tables/0", "payload is truncated"},
+		{flipped, "tables/0", "payload checksum mismatch"},
+		{huge, "configs", "payload is truncated"},
+	}
+	for _, td := range testData {
+		r, err := NewReader(bytes.NewReader(td.data), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			_, _, err = r.Next()
+			if err != nil {
+				break
+			}
+		}
+		var cerr *CorruptionError
+		if !errors.As(err, &cerr) || !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("expected corruption error, but got %v", err)
+		}
+		if cerr.Section != td.section || !strings.Contains(cerr.Reason, td.reason) {
+			t.Errorf("expected section %s with reason %q, but got %v", td.section, td.reason, cerr)
+		}
+	}
+}
+
+func TestSnapshotOpen(t *testing.T) {
+	sections := map[string][]byte{
+		"configs":  []byte(`{"num_tables":128}`),
+		"tables/0": bytes.Repeat([]byte{1, 2, 3}, 100),
+		"tables/1": bytes.Repeat([]byte{4, 5, 6}, 100),
+	}
+	order := []string{"configs", "tables/0", "tables/1"}
+	data := writeSnapshot(t, Options{}, sections, order)
+
+	f, err := Open(bytes.NewReader(data), int64(len(data)), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections()) != len(order) {
+		t.Fatalf("expected %d sections, but got %d", len(order), len(f.Sections()))
+	}
+	for i, s := range f.Sections() {
+		if s.Name != order[i] {
+			t.Errorf("expected section %s, but got %s", order[i], s.Name)
+		}
+	}
+
+	s, err := f.Section("tables/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, sections["tables/1"]) {
+		t.Errorf("expected payload %v, but got %v", sections["tables/1"], payload)
+	}
+
+	if _, err := f.Section("docs"); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("expected %v, but got %v", ErrSectionNotFound, err)
+	}
+
+	// corruption in a section is only detected once it is loaded
+	data[s.Offset+int64(2+len(s.Name)+16)] ^= 0xFF
+	f, err = Open(bytes.NewReader(data), int64(len(data)), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ = f.Section("tables/1")
+	if _, err := s.Load(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected %v, but got %v", ErrCorrupt, err)
+	}
+	s, _ = f.Section("tables/0")
+	if _, err := s.Load(); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+}
+
+func TestSnapshotCompression(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := map[string][]byte{
+		"configs":  []byte(`{"num_tables":128}`),
+		"tables/0": bytes.Repeat([]byte{1, 2, 3, 4}, 1000),
+	}
+	order := []string{"configs", "tables/0"}
+
+	testData := []struct {
+		opts Options
+	}{
+		{Options{CompressionLevel: 1}},
+		{Options{CompressionLevel: 19}},
+		{Options{CompressionLevel: 3, Cipher: c}},
+	}
+	plain := writeSnapshot(t, Options{}, sections, order)
+	for _, td := range testData {
+		data := writeSnapshot(t, td.opts, sections, order)
+		if len(data) >= len(plain) {
+			t.Errorf("expected compressed snapshot smaller than %d bytes, but got %d", len(plain), len(data))
+		}
+
+		readOpts := Options{Cipher: td.opts.Cipher}
+		_, got := readSnapshot(t, data, readOpts)
+		for name, payload := range sections {
+			if !bytes.Equal(got[name], payload) {
+				t.Errorf("expected section %s to round trip", name)
+			}
+		}
+
+		f, err := Open(bytes.NewReader(data), int64(len(data)), readOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := f.Section("tables/0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(payload, sections["tables/0"]) {
+			t.Errorf("expected lazily loaded section to round trip")
+		}
+	}
+
+	if _, err := NewWriter(io.Discard, Options{CompressionLevel: 23}); err != ErrInvalidCompressionLevel {
+		t.Errorf("expected %v, but got %v", ErrInvalidCompressionLevel, err)
+	}
+}
+
+func TestSnapshotParallel(t *testing.T) {
+	numTables := 16
+	encoders := make([]SectionEncoder, numTables)
+	sections := make(map[string][]byte)
+	for i := 0; i < numTables; i++ {
+		name := fmt.Sprintf("tables/%d", i)
+		payload := bytes.Repeat([]byte{byte(i)}, 100+i)
+		sections[name] = payload
+		encoders[i] = SectionEncoder{Name: name, Encode: func() ([]byte, error) { return payload, nil }}
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{CompressionLevel: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSections(encoders, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	order, got := readSnapshot(t, buf.Bytes(), Options{})
+	for i, name := range order {
+		if name != encoders[i].Name {
+			t.Errorf("expected section %s at position %d, but got %s", encoders[i].Name, i, name)
+		}
+		if !bytes.Equal(got[name], sections[name]) {
+			t.Errorf("expected section %s to round trip", name)
+		}
+	}
+
+	f, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := f.LoadSections([]string{"tables/3", "tables/11"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partial) != 2 || !bytes.Equal(partial["tables/11"], sections["tables/11"]) {
+		t.Errorf("expected only the requested sections, but got %d", len(partial))
+	}
+
+	encodeErr := errors.New("encode failed")
+	encoders[5].Encode = func() ([]byte, error) { return nil, encodeErr }
+	w, err = NewWriter(io.Discard, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSections(encoders, 4); !errors.Is(err, encodeErr) {
+		t.Errorf("expected %v, but got %v", encodeErr, err)
+	}
+}
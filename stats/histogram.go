@@ -0,0 +1,31 @@
+package stats
+
+// SizeBucket counts the observations less than or equal to its upper bound
+type SizeBucket struct {
+	UpperBound uint64 `json:"le"`
+	Count      uint64 `json:"count"` // cumulative count including the smaller buckets
+}
+
+// SizeHistogram is a cumulative histogram of per query sizes with exponential buckets. Observations
+// above the last bound are only counted in Count. Rates over two snapshots give the distribution of a
+// recent period.
+type SizeHistogram struct {
+	Buckets []SizeBucket `json:"buckets"`
+	Count   uint64       `json:"count"`
+	Sum     uint64       `json:"sum"`
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th quantile of the observations or 0
+// if nothing was observed. Quantiles beyond the last bucket return the last bound.
+func (h SizeHistogram) Quantile(q float64) uint64 {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	for _, b := range h.Buckets {
+		if b.Count >= rank {
+			return b.UpperBound
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1].UpperBound
+}
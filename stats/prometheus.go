@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// MetricsPrefix prefixes the names of the metrics written by WritePrometheus
+const MetricsPrefix = "golsh_"
+
+// WritePrometheus writes the document count, cumulative counters and size histograms of the
+// statistics in the Prometheus text exposition format
+func WritePrometheus(w io.Writer, s *Statistics) error {
+	bw := bufio.NewWriter(w)
+	gauge := func(name, help string, v int) {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s gauge\n%s%s %d\n", MetricsPrefix, name, help, MetricsPrefix, name, MetricsPrefix, name, v)
+	}
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s counter\n%s%s %d\n", MetricsPrefix, name, help, MetricsPrefix, name, MetricsPrefix, name, v)
+	}
+	histogram := func(name, help string, h SizeHistogram) {
+		name = MetricsPrefix + name
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+		for _, b := range h.Buckets {
+			fmt.Fprintf(bw, "%s_bucket{le=\"%d\"} %d\n", name, b.UpperBound, b.Count)
+		}
+		fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %d\n%s_count %d\n", name, h.Count, name, h.Sum, name, h.Count)
+	}
+
+	gauge("num_docs", "Number of stored documents.", s.NumDocs)
+	counter("indexed_total", "Documents indexed.", s.Counters.TotalIndexed)
+	counter("deleted_total", "Documents deleted.", s.Counters.TotalDeleted)
+	counter("evicted_total", "Documents evicted to make room.", s.Counters.TotalEvicted)
+	counter("searches_total", "Searches performed.", s.Counters.TotalSearches)
+	counter("candidates_total", "Candidates across all searches.", s.Counters.TotalCandidates)
+	histogram("search_candidates", "Candidates per search.", s.CandidateSizes)
+	histogram("search_scored", "Candidates scored per search.", s.ScoredSizes)
+	return bw.Flush()
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	s := &Statistics{
+		NumDocs:  3,
+		Counters: Counters{TotalSearches: 2, TotalCandidates: 5},
+		CandidateSizes: SizeHistogram{
+			Buckets: []SizeBucket{{UpperBound: 1, Count: 0}, {UpperBound: 2, Count: 1}, {UpperBound: 4, Count: 2}},
+			Count:   2,
+			Sum:     5,
+		},
+	}
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"golsh_num_docs 3\n",
+		"# TYPE golsh_searches_total counter\ngolsh_searches_total 2\n",
+		"golsh_search_candidates_bucket{le=\"2\"} 1\n",
+		"golsh_search_candidates_bucket{le=\"+Inf\"} 2\ngolsh_search_candidates_sum 5\ngolsh_search_candidates_count 2\n",
+		"golsh_search_scored_count 0\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(buf.String(), e) {
+			t.Errorf("expected %q in the metrics, but got\n%s", e, buf.String())
+		}
+	}
+
+	if q := s.CandidateSizes.Quantile(0.5); q != 2 {
+		t.Errorf("expected median bound %d, but got %d", 2, q)
+	}
+}
@@ -1,11 +1,95 @@
 package stats
 
+import "time"
+
 // Statistics returns the total number of indexed documents along with a slice of the false negative
 // errors for a variety of query thresholds. This can help determine if the configured number of
 // hyperplanes and tables can give the desired results for a given threshold.
 type Statistics struct {
 	NumDocs             int                  `json:"num_docs"`
 	FalseNegativeErrors []FalseNegativeError `json:"false_negative_errors"`
+	Counters            Counters             `json:"counters"`
+	Memory              Memory               `json:"memory"`
+	Shadow              *Shadow              `json:"shadow,omitempty"`
+	Fragmentation       Fragmentation        `json:"fragmentation"`
+	RowWindows          []RowWindow          `json:"row_windows"`
+
+	// CandidateSizes and ScoredSizes are histograms of the candidates found and scored by each search.
+	// A growing share of large candidate sets indicates drift degrading the selectivity of the tables.
+	CandidateSizes SizeHistogram `json:"candidate_sizes"`
+	ScoredSizes    SizeHistogram `json:"scored_sizes"`
+
+	// CandidateEstimates predict the candidates scored per search pass at each threshold of
+	// FalseNegativeErrors for the current number of documents
+	CandidateEstimates []CandidateEstimate `json:"candidate_estimates"`
+}
+
+// CandidateEstimate is the expected cost of a search pass of one sign modeling the stored vectors at
+// uniformly distributed angles to the query. Candidates beyond the expected matches are scored only to
+// be discarded by the threshold.
+type CandidateEstimate struct {
+	Threshold          float64 `json:"threshold"`
+	ExpectedCandidates float64 `json:"expected_candidates"`
+	ExpectedMatches    float64 `json:"expected_matches"` // candidates correlated at or above the threshold
+	CollisionRate      float64 `json:"collision_rate"`   // fraction of the corpus expected as candidates
+}
+
+// RowWindow describes the windows indexed into one row window of the tables
+type RowWindow struct {
+	Start       int64     `json:"start"`
+	NumDocs     int       `json:"num_docs"`     // windows indexed with an index within the row
+	LastUpdated time.Time `json:"last_updated"` // last time a window of the row was indexed or deleted
+}
+
+// Shadow compares searches mirrored against alternative tables with the served searches
+type Shadow struct {
+	NumTables        int           `json:"num_tables"`
+	Searches         uint64        `json:"searches"`
+	MeanRecall       float64       `json:"mean_recall"`        // mean fraction of served results also found by the shadow
+	MeanLatencyDelta time.Duration `json:"mean_latency_delta"` // mean shadow latency minus served latency
+}
+
+// Fragmentation measures space held by the index that compaction may reclaim
+type Fragmentation struct {
+	EmptyBuckets   int     `json:"empty_buckets"` // buckets no longer holding any uids
+	EmptyRows      int     `json:"empty_rows"`    // rows no longer holding any buckets
+	BitmapBytes    uint64  `json:"bitmap_bytes"`
+	BitmapUIDs     uint64  `json:"bitmap_uids"`     // uids held across all bucket bitmaps
+	BytesPerUID    float64 `json:"bytes_per_uid"`   // container efficiency of the bucket bitmaps, lower is better
+	ArenaGarbage   uint64  `json:"arena_garbage"`   // bytes of deleted and expanded vectors not yet reclaimed from the arena
+	TombstoneRatio float64 `json:"tombstone_ratio"` // fraction of the values handed out by the arena that are garbage
+	DiskGarbage    uint64  `json:"disk_garbage"`    // bytes of superseded records in the file of a disk forward index
+}
+
+// CompactionReport describes the fragmentation of the index before and after a compaction
+type CompactionReport struct {
+	Before         Fragmentation `json:"before"`
+	After          Fragmentation `json:"after"`
+	BytesReclaimed uint64        `json:"bytes_reclaimed"` // decrease of the estimated memory usage
+}
+
+// Memory describes the memory held by the vectors of the forward index and the tables
+type Memory struct {
+	NumDocs     int    `json:"num_docs"`
+	VectorBytes uint64 `json:"vector_bytes"` // bytes of vector values referenced by stored documents
+	ArenaChunks int    `json:"arena_chunks"`
+	ArenaBytes  uint64 `json:"arena_bytes"` // bytes reserved by arena chunks including garbage and free space
+	ArenaUsed   uint64 `json:"arena_used"`  // bytes handed out by arena chunks including garbage
+	TableBytes  uint64 `json:"table_bytes"` // estimated bytes of the table bitmaps and uid mappings
+	DiskBytes   uint64 `json:"disk_bytes"`  // bytes of the file of a disk forward index including garbage
+	DiskUsed    uint64 `json:"disk_used"`   // bytes of the latest record of each stored document on disk
+}
+
+// Counters are cumulative totals of operations on the index. They are carried in snapshots so capacity
+// trends survive restarts.
+type Counters struct {
+	TotalIndexed    uint64 `json:"total_indexed"`
+	TotalDeleted    uint64 `json:"total_deleted"`
+	TotalEvicted    uint64 `json:"total_evicted"` // documents deleted to make room under MaxDocs or MemoryBudget
+	TotalSearches   uint64 `json:"total_searches"`
+	TotalCandidates uint64 `json:"total_candidates"` // total candidates across all searches
+
+	TotalLengthAdjusted uint64 `json:"total_length_adjusted"` // documents padded or truncated by the length policy
 }
 
 // FalseNegativeError represents the probability that a document will be missed during a search when it
@@ -17,3 +101,17 @@ type FalseNegativeError struct {
 	Threshold   float64 `json:"threshold"`
 	Probability float64 `json:"probability"`
 }
+
+// Table describes a single table of the index
+type Table struct {
+	Name     string `json:"name"`
+	Family   string `json:"family"`   // registered name of the hash family
+	Bits     int    `json:"bits"`     // number of bits of each bucket key
+	Checksum uint32 `json:"checksum"` // checksum of the hash family parameters
+	Rows     int    `json:"rows"`
+	Buckets  int    `json:"buckets"`
+	Docs     int    `json:"docs"`
+	Bytes    uint64 `json:"bytes"`
+	Queries  uint64 `json:"queries"` // number of times the table has been filtered
+	Hits     uint64 `json:"hits"`    // number of candidate uids the table has produced
+}
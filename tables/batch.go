@@ -0,0 +1,71 @@
+package tables
+
+import (
+	"github.com/aouyang1/go-lsh/bitmap"
+)
+
+// DeleteBatch removes the uids from the table visiting each bucket holding any of them once instead
+// of scanning the table for every uid. Returns the uids that are not stored in the table.
+func (t *Table) DeleteBatch(uids []uint64) ([]uint64, error) {
+	if err := t.Materialize(); err != nil {
+		return nil, err
+	}
+	var notStored []uint64
+	byHash := make(map[uint64]*bitmap.Bitmap)
+	for _, uid := range uids {
+		hashes, exists := t.Doc2Hash[uid]
+		if !exists {
+			notStored = append(notStored, uid)
+			continue
+		}
+		for hash := range uniqueHashes(hashes) {
+			rb, exists := byHash[hash]
+			if !exists {
+				rb = bitmap.New()
+				byHash[hash] = rb
+			}
+			rb.Add(uid)
+		}
+		t.bytes.Add(-doc2HashEntryBytes - bytesPerHash*int64(len(hashes)))
+		delete(t.Doc2Hash, uid)
+		t.Timestamps.release(uid)
+	}
+
+	for hash, group := range byHash {
+		rows := make([]int64, 0, len(t.HashRows[hash]))
+		for rowIndex := range t.HashRows[hash] {
+			rows = append(rows, rowIndex)
+		}
+		for _, rowIndex := range rows {
+			tbl := t.Table[rowIndex]
+			rb, exists := tbl[hash]
+			if !exists {
+				continue
+			}
+
+			before := rb.SizeInBytes()
+			rb.AndNot(group)
+			if rb.IsEmpty() {
+				t.bytes.Add(-int64(before))
+				delete(tbl, hash)
+				delete(t.Splits[rowIndex], hash)
+				t.removeHashRow(hash, rowIndex)
+				continue
+			}
+			t.bytes.Add(int64(rb.SizeInBytes()) - int64(before))
+			if root, exists := t.Splits[rowIndex][hash]; exists {
+				it := group.Rb.Iterator()
+				for it.HasNext() {
+					root.remove(it.Next())
+				}
+			}
+		}
+	}
+	for hash, group := range byHash {
+		it := group.Rb.Iterator()
+		for it.HasNext() {
+			t.unsample(it.Next(), map[uint64]struct{}{hash: {}})
+		}
+	}
+	return notStored, nil
+}
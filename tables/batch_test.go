@@ -0,0 +1,64 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+)
+
+func TestTableDeleteBatch(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 0, 1}),
+		document.NewSimple(1, 0, []float64{0, 1, 0}),
+		document.NewSimple(2, 0, []float64{0, 0, 1}),
+		document.NewSimple(0, cfg.RowSize, []float64{0, 0, 1}),
+	}
+	for _, d := range docs {
+		if err := tbl.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notStored, err := tbl.DeleteBatch([]uint64{0, 1, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notStored) != 1 || notStored[0] != 5 {
+		t.Fatalf("expected %v not stored, but got %v", []uint64{5}, notStored)
+	}
+	if len(tbl.Doc2Hash) != 1 {
+		t.Fatalf("expected %d uid to remain, but got %d", 1, len(tbl.Doc2Hash))
+	}
+	if _, exists := tbl.Table[cfg.RowSize]; exists && len(tbl.Table[cfg.RowSize]) > 0 {
+		t.Errorf("expected the bucket of the second row to be removed")
+	}
+	for _, rb := range tbl.Table[0] {
+		if rb.Cardinality() != 1 || !rb.Rb.Contains(2) {
+			t.Errorf("expected only uid 2 to remain in the first row")
+		}
+	}
+
+	if _, err := tbl.DeleteBatch([]uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.bytes.Load() != 0 {
+		t.Errorf("expected empty table to hold %d bytes, but got %d", 0, tbl.bytes.Load())
+	}
+	if len(tbl.HashRows) != 0 {
+		t.Errorf("expected hash rows to be removed with their buckets")
+	}
+}
@@ -0,0 +1,58 @@
+package tables
+
+import "fmt"
+
+// Check verifies that the buckets, the hash of every window and the timestamps of the table agree with
+// each other returning the first inconsistency found. Must not be called concurrently with indexing or
+// deleting.
+func (t *Table) Check() error {
+	if err := t.Materialize(); err != nil {
+		return err
+	}
+	var err error
+	t.Timestamps.Range(func(uid uint64, indexes []int64) bool {
+		if _, exists := t.Doc2Hash[uid]; !exists {
+			err = fmt.Errorf("%w, uid %d has timestamps but no hashes", ErrInconsistent, uid)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for uid, hashes := range t.Doc2Hash {
+		indexes := t.Timestamps.Get(uid)
+		if len(indexes) != len(hashes) {
+			return fmt.Errorf("%w, uid %d has %d hashes for %d timestamps", ErrInconsistent, uid, len(hashes), len(indexes))
+		}
+		for i, hash := range hashes {
+			rowIndex := indexes[i] / t.Cfg.RowSize * t.Cfg.RowSize
+			if rb := t.Table[rowIndex][hash]; rb == nil || !rb.Contains(uid) {
+				return fmt.Errorf("%w, uid %d at index %d is missing from bucket %d", ErrInconsistent, uid, indexes[i], hash)
+			}
+			if _, exists := t.HashRows[hash][rowIndex]; !exists {
+				return fmt.Errorf("%w, row %d of hash %d is not tracked", ErrInconsistent, rowIndex, hash)
+			}
+		}
+	}
+
+	for rowIndex, tbl := range t.Table {
+		for hash, rb := range tbl {
+			if rb == nil {
+				continue
+			}
+			rb.Lock()
+			it := rb.Rb.Iterator()
+			for it.HasNext() && err == nil {
+				if uid := it.Next(); !t.hasWindow(uid, rowIndex, hash) {
+					err = fmt.Errorf("%w, bucket %d of row %d holds uid %d without a window", ErrInconsistent, hash, rowIndex, uid)
+				}
+			}
+			rb.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package tables
+
+import "github.com/aouyang1/go-lsh/stats"
+
+// Fragmentation measures the empty buckets and rows and the container efficiency of the bitmaps
+func (t *Table) Fragmentation() (stats.Fragmentation, error) {
+	var f stats.Fragmentation
+	if err := t.Materialize(); err != nil {
+		return f, err
+	}
+	for _, tbl := range t.Table {
+		if len(tbl) == 0 {
+			f.EmptyRows++
+			continue
+		}
+		for _, rb := range tbl {
+			if rb == nil || rb.IsEmpty() {
+				f.EmptyBuckets++
+				continue
+			}
+			f.BitmapBytes += rb.SizeInBytes()
+			f.BitmapUIDs += rb.Cardinality()
+		}
+	}
+	if f.BitmapUIDs > 0 {
+		f.BytesPerUID = float64(f.BitmapBytes) / float64(f.BitmapUIDs)
+	}
+	return f, nil
+}
+
+// Compact removes empty buckets and rows and run length encodes bitmap containers where it is smaller.
+// Must not be called concurrently with indexing or deleting.
+func (t *Table) Compact() error {
+	if err := t.Materialize(); err != nil {
+		return err
+	}
+	for rowIndex, tbl := range t.Table {
+		for hash, rb := range tbl {
+			if rb == nil || rb.IsEmpty() {
+				if rb != nil {
+					t.bytes.Add(-int64(rb.SizeInBytes()))
+				}
+				delete(tbl, hash)
+				if rows, exists := t.HashRows[hash]; exists {
+					delete(rows, rowIndex)
+					if len(rows) == 0 {
+						delete(t.HashRows, hash)
+					}
+				}
+				continue
+			}
+			before := rb.SizeInBytes()
+			rb.RunOptimize()
+			t.bytes.Add(int64(rb.SizeInBytes()) - int64(before))
+		}
+		if len(tbl) == 0 {
+			delete(t.Table, rowIndex)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package tables
+
+import (
+	"hash/crc32"
+
+	"github.com/aouyang1/go-lsh/stats"
+)
+
+// Info describes the table for operational tooling. The checksum of the hash family identifies tables
+// hashing with the same parameters across processes.
+func (t *Table) Info() (stats.Table, error) {
+	if err := t.Materialize(); err != nil {
+		return stats.Table{}, err
+	}
+	info := stats.Table{
+		Name:    t.Name,
+		Family:  t.Family.Name(),
+		Bits:    t.Family.Bits(),
+		Rows:    len(t.Table),
+		Docs:    len(t.Doc2Hash),
+		Bytes:   t.SizeInBytes(),
+		Queries: t.queries.Load(),
+		Hits:    t.hits.Load(),
+	}
+	if data, err := t.Family.MarshalBinary(); err == nil {
+		info.Checksum = crc32.ChecksumIEEE(data)
+	}
+	for _, tbl := range t.Table {
+		info.Buckets += len(tbl)
+	}
+	return info, nil
+}
@@ -0,0 +1,269 @@
+package tables
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/bitmap"
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/hashfamily"
+)
+
+var (
+	ErrCorruptSplit = errors.New("split tree does not match its encoded nodes")
+)
+
+// State is the serializable form of a table. The hash family is stored by its registered name and
+// binary form so restored tables hash exactly like the saved ones.
+type State struct {
+	Name       string
+	Family     string
+	FamilyData []byte
+	Table      map[int64]map[uint64]*bitmap.Bitmap
+	Doc2Hash   map[uint64][]uint64
+	Splits     map[int64]map[uint64]*SplitNode
+	Samples    map[uint64]*Reservoir
+}
+
+// Snapshot returns the state of every table along with the timestamps they share. Must not be called
+// concurrently with indexing or deleting.
+func Snapshot(tables []*Table) ([]State, map[uint64][]int64, error) {
+	states := make([]State, 0, len(tables))
+	for _, t := range tables {
+		if err := t.Materialize(); err != nil {
+			return nil, nil, err
+		}
+		data, err := t.Family.MarshalBinary()
+		if err != nil {
+			return nil, nil, err
+		}
+		s := State{
+			Name:       t.Name,
+			Family:     t.Family.Name(),
+			FamilyData: data,
+			Table:      make(map[int64]map[uint64]*bitmap.Bitmap, len(t.Table)),
+			Doc2Hash:   t.Doc2Hash,
+			Splits:     t.Splits,
+			Samples:    t.Samples,
+		}
+		for rowIndex, tbl := range t.Table {
+			row := make(map[uint64]*bitmap.Bitmap, len(tbl))
+			for hash, rb := range tbl {
+				if rb != nil && !rb.IsEmpty() {
+					row[hash] = rb
+				}
+			}
+			if len(row) > 0 {
+				s.Table[rowIndex] = row
+			}
+		}
+		states = append(states, s)
+	}
+
+	timestamps := make(map[uint64][]int64)
+	if len(tables) > 0 {
+		tables[0].Timestamps.Range(func(uid uint64, indexes []int64) bool {
+			timestamps[uid] = indexes
+			return true
+		})
+	}
+	return states, timestamps, nil
+}
+
+// Loader returns the state of a table restored by RestoreLazy
+type Loader func() (State, error)
+
+// lazyState holds the loader of a table restored by RestoreLazy until it is first used
+type lazyState struct {
+	once sync.Once
+	load Loader
+	held []uint64 // uids of the restored timestamps the table was assumed to hold
+	err  error
+}
+
+// Restore returns the tables of the states sharing the restored timestamps
+func Restore(cfg *configs.LSHConfigs, states []State, timestamps map[uint64][]int64) ([]*Table, error) {
+	tables, err := restoreFamilies(cfg, states, timestamps)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range tables {
+		t.restore(states[i])
+	}
+	return tables, nil
+}
+
+// RestoreLazy returns the tables of the states like Restore only restoring their names and hash
+// families. The rest of the state of each table is returned by its loader the first time the table is
+// used or materialized.
+func RestoreLazy(cfg *configs.LSHConfigs, states []State, loaders []Loader, timestamps map[uint64][]int64) ([]*Table, error) {
+	if len(loaders) != len(states) {
+		return nil, ErrTableToHyperplanesMismatch
+	}
+	tables, err := restoreFamilies(cfg, states, timestamps)
+	if err != nil {
+		return nil, err
+	}
+	held := make([]uint64, 0, len(timestamps))
+	for uid := range timestamps {
+		held = append(held, uid)
+	}
+	for i, t := range tables {
+		// every table holds the uids until loaded so the shared timestamps outlive deletes from the
+		// tables loaded first
+		for _, uid := range held {
+			t.Timestamps.acquire(uid)
+		}
+		t.lazy = &lazyState{load: loaders[i], held: held}
+	}
+	return tables, nil
+}
+
+// restoreFamilies returns empty tables with the names and hash families of the states sharing the
+// restored timestamps
+func restoreFamilies(cfg *configs.LSHConfigs, states []State, timestamps map[uint64][]int64) ([]*Table, error) {
+	if len(states) != cfg.NumTables {
+		return nil, ErrTableToHyperplanesMismatch
+	}
+
+	shared := NewTimestamps()
+	for uid, indexes := range timestamps {
+		for _, index := range indexes {
+			shared.insert(uid, index)
+		}
+	}
+	tables := make([]*Table, len(states))
+	for i, s := range states {
+		f, err := hashfamily.Unmarshal(s.Family, s.FamilyData)
+		if err != nil {
+			return nil, err
+		}
+		t, err := NewTable(s.Name, f, cfg)
+		if err != nil {
+			return nil, err
+		}
+		t.Timestamps = shared
+		tables[i] = t
+	}
+	return tables, nil
+}
+
+// Materialize loads the state of a table restored by RestoreLazy if it wasn't used yet returning the
+// error of its loader. A table failing to load is left empty.
+func (t *Table) Materialize() error {
+	if t.lazy == nil {
+		return nil
+	}
+	t.lazy.once.Do(func() {
+		s, err := t.lazy.load()
+		if err == nil {
+			t.restore(s)
+		}
+		t.lazy.err = err
+		for _, uid := range t.lazy.held {
+			t.Timestamps.release(uid)
+		}
+		t.lazy.held = nil
+	})
+	return t.lazy.err
+}
+
+// restore adopts the buckets, hashes, splits and samples of the state rebuilding the hash rows and
+// estimated bytes derived from them
+func (t *Table) restore(s State) {
+	for rowIndex, tbl := range s.Table {
+		t.Table[rowIndex] = tbl
+		for hash, rb := range tbl {
+			rows, exists := t.HashRows[hash]
+			if !exists {
+				rows = make(map[int64]struct{})
+				t.HashRows[hash] = rows
+			}
+			rows[rowIndex] = struct{}{}
+			t.bytes.Add(int64(rb.SizeInBytes()))
+		}
+	}
+	for uid, hashes := range s.Doc2Hash {
+		t.Doc2Hash[uid] = hashes
+		t.Timestamps.acquire(uid)
+		t.bytes.Add(doc2HashEntryBytes + bytesPerHash*int64(len(hashes)))
+	}
+	for rowIndex, splits := range s.Splits {
+		t.Splits[rowIndex] = splits
+	}
+	for hash, r := range s.Samples {
+		t.Samples[hash] = r
+		for _, v := range r.Vectors {
+			t.bytes.Add(8 + 8*int64(len(v)))
+		}
+	}
+}
+
+// splitEntry is a node of a split tree encoded in preorder where leaves have no plane
+type splitEntry struct {
+	Plane  []float64
+	Bitmap *bitmap.Bitmap
+}
+
+// GobEncode encodes the tree in preorder since gob cannot encode the missing children of leaves
+func (n *SplitNode) GobEncode() ([]byte, error) {
+	var entries []splitEntry
+	var walk func(node *SplitNode)
+	walk = func(node *SplitNode) {
+		entries = append(entries, splitEntry{Plane: node.Plane, Bitmap: node.Bitmap})
+		if !node.isLeaf() {
+			walk(node.Children[0])
+			walk(node.Children[1])
+		}
+	}
+	walk(n)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode rebuilds the tree encoded by GobEncode
+func (n *SplitNode) GobDecode(data []byte) error {
+	var entries []splitEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return err
+	}
+	rest, err := n.decode(entries)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return ErrCorruptSplit
+	}
+	return nil
+}
+
+// decode rebuilds the subtree from its preorder entries returning the entries left over
+func (n *SplitNode) decode(entries []splitEntry) ([]splitEntry, error) {
+	if len(entries) == 0 {
+		return nil, ErrCorruptSplit
+	}
+	e := entries[0]
+	entries = entries[1:]
+	n.Plane, n.Bitmap = e.Plane, e.Bitmap
+	if n.isLeaf() {
+		if n.Bitmap == nil {
+			n.Bitmap = bitmap.New()
+		}
+		return entries, nil
+	}
+	n.Bitmap = nil
+	var err error
+	for i := range n.Children {
+		n.Children[i] = new(SplitNode)
+		if entries, err = n.Children[i].decode(entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,54 @@
+package tables
+
+import (
+	"github.com/aouyang1/go-lsh/bitmap"
+	"github.com/aouyang1/go-lsh/document"
+)
+
+// Placement describes the bucket a document would be indexed into
+type Placement struct {
+	Table      string `json:"table"`
+	Row        int64  `json:"row"`
+	Hash       uint64 `json:"hash"`
+	NewBucket  bool   `json:"new_bucket"`
+	BucketSize uint64 `json:"bucket_size"` // uids currently in the bucket
+
+	// EstimatedBytes is the growth of the estimated size of the table if the document was indexed
+	EstimatedBytes uint64 `json:"estimated_bytes"`
+}
+
+// Place returns the bucket the document would be indexed into without modifying the table
+func (t *Table) Place(d document.Document) (Placement, error) {
+	if err := t.Materialize(); err != nil {
+		return Placement{}, err
+	}
+	key, err := t.key(d)
+	if err != nil {
+		return Placement{}, err
+	}
+	uid := d.GetUID()
+	p := Placement{
+		Table: t.Name,
+		Row:   d.GetIndex() / t.Cfg.RowSize * t.Cfg.RowSize,
+		Hash:  key,
+	}
+
+	rb, exists := t.Table[p.Row][p.Hash]
+	if !exists || rb == nil {
+		p.NewBucket = true
+		rb = bitmap.New()
+		rb.Add(uid)
+		p.EstimatedBytes = rb.SizeInBytes()
+	} else {
+		p.BucketSize = rb.Cardinality()
+		p.EstimatedBytes = rb.AddedBytes(uid)
+	}
+
+	if _, exists := t.Doc2Hash[uid]; !exists {
+		p.EstimatedBytes += doc2HashEntryBytes
+	}
+	if _, indexes := t.Timestamps.Between(uid, d.GetIndex(), d.GetIndex()); len(indexes) == 0 {
+		p.EstimatedBytes += bytesPerHash
+	}
+	return p, nil
+}
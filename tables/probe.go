@@ -0,0 +1,57 @@
+package tables
+
+import (
+	"math"
+	"sort"
+
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+// Probe describes a bucket a filter would read
+type Probe struct {
+	Table       string `json:"table"`
+	Row         int64  `json:"row"`
+	Hash        uint64 `json:"hash"`
+	Cardinality uint64 `json:"cardinality"` // uids in the bucket or the split of the bucket the vector falls in
+}
+
+// Probe returns the buckets Filter would read without reading them or counting the filter in the hit
+// rate of the table
+func (t *Table) Probe(d document.Document, maxLag int64) ([]Probe, error) {
+	if maxLag > options.AllLags {
+		return t.ProbeRange(d, d.GetIndex()-maxLag, d.GetIndex()+maxLag)
+	}
+	return t.probe(d, 0, math.MaxInt64, true)
+}
+
+// ProbeRange returns the buckets FilterRange would read
+func (t *Table) ProbeRange(d document.Document, start, end int64) ([]Probe, error) {
+	return t.probe(d, start, end, false)
+}
+
+// ProbeAll returns the buckets FilterAll would read
+func (t *Table) ProbeAll(d document.Document) ([]Probe, error) {
+	return t.probe(d, math.MinInt64, math.MaxInt64, true)
+}
+
+func (t *Table) probe(d document.Document, startIdx, endIdx int64, allRows bool) ([]Probe, error) {
+	if err := t.Materialize(); err != nil {
+		return nil, err
+	}
+	v := d.GetVector()
+	hash, _ := t.key(d)
+
+	var probes []Probe
+	for _, rowIndex := range t.rowIndexes(t.HashRows[hash], startIdx, endIdx, allRows) {
+		rb := t.bucket(rowIndex, hash, v)
+		if rb == nil {
+			continue
+		}
+		probes = append(probes, Probe{Table: t.Name, Row: rowIndex, Hash: hash, Cardinality: rb.Cardinality()})
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		return probes[i].Row < probes[j].Row
+	})
+	return probes, nil
+}
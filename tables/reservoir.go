@@ -0,0 +1,107 @@
+package tables
+
+import (
+	"math/rand"
+)
+
+// Reservoir is a uniform sample of the vectors hashed to a bucket hash across every row
+type Reservoir struct {
+	Seen    int         // number of vectors offered to the sample
+	UIDs    []uint64    // uid of each sampled vector
+	Vectors [][]float64 // sampled hashed vectors
+}
+
+// offer adds the vector to the sample with probability size / seen once the sample is full returning
+// the change in bytes held
+func (r *Reservoir) offer(uid uint64, v []float64, size int, rng *rand.Rand) int64 {
+	r.Seen++
+	vec := make([]float64, len(v))
+	copy(vec, v)
+	if len(r.Vectors) < size {
+		r.UIDs = append(r.UIDs, uid)
+		r.Vectors = append(r.Vectors, vec)
+		return 8 + 8*int64(len(vec))
+	}
+	i := rng.Intn(r.Seen)
+	if i >= size {
+		return 0
+	}
+	delta := 8 * int64(len(vec)-len(r.Vectors[i]))
+	r.UIDs[i] = uid
+	r.Vectors[i] = vec
+	return delta
+}
+
+// remove drops the sampled vectors of the uid returning the change in bytes held
+func (r *Reservoir) remove(uid uint64) int64 {
+	var delta int64
+	n := 0
+	for i, u := range r.UIDs {
+		if u == uid {
+			delta -= 8 + 8*int64(len(r.Vectors[i]))
+			continue
+		}
+		r.UIDs[n] = u
+		r.Vectors[n] = r.Vectors[i]
+		n++
+	}
+	r.UIDs = r.UIDs[:n]
+	r.Vectors = r.Vectors[:n]
+	return delta
+}
+
+// Centroid returns the mean of the sampled vectors or nil if the sample is empty
+func (r *Reservoir) Centroid() []float64 {
+	if len(r.Vectors) == 0 {
+		return nil
+	}
+	centroid := make([]float64, len(r.Vectors[0]))
+	for _, v := range r.Vectors {
+		for i, val := range v {
+			centroid[i] += val
+		}
+	}
+	for i := range centroid {
+		centroid[i] /= float64(len(r.Vectors))
+	}
+	return centroid
+}
+
+// sample offers the hashed vector of the uid to the reservoir of the hash
+func (t *Table) sample(hash uint64, uid uint64, v []float64) {
+	if t.Cfg.BucketSampleSize < 1 {
+		return
+	}
+	r, exists := t.Samples[hash]
+	if !exists {
+		r = new(Reservoir)
+		t.Samples[hash] = r
+	}
+	t.bytes.Add(r.offer(uid, v, t.Cfg.BucketSampleSize, t.rng))
+}
+
+// unsample removes the uid from the reservoirs of the hashes dropping reservoirs of hashes no longer
+// stored in any row
+func (t *Table) unsample(uid uint64, hashes map[uint64]struct{}) {
+	for hash := range hashes {
+		r, exists := t.Samples[hash]
+		if !exists {
+			continue
+		}
+		t.bytes.Add(r.remove(uid))
+		if _, exists := t.HashRows[hash]; !exists {
+			for _, v := range r.Vectors {
+				t.bytes.Add(-8 - 8*int64(len(v)))
+			}
+			delete(t.Samples, hash)
+		}
+	}
+}
+
+// BucketSample returns the reservoir sample of the hash or nil if no vectors have been sampled
+func (t *Table) BucketSample(hash uint64) (*Reservoir, error) {
+	if err := t.Materialize(); err != nil {
+		return nil, err
+	}
+	return t.Samples[hash], nil
+}
@@ -0,0 +1,62 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+)
+
+func TestBucketSample(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.BucketSampleSize = 2
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 1, 1}),
+		document.NewSimple(1, 0, []float64{0, 3, 1}),
+		document.NewSimple(2, cfg.RowSize, []float64{0, 2, 1}),
+		document.NewSimple(3, 0, []float64{0, 2, 1}),
+	}
+	for _, d := range docs {
+		if err := tbl.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, _ := h.Hash([]float64{0, 1, 1})
+	r, err := tbl.BucketSample(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil {
+		t.Fatalf("expected a sample of the bucket")
+	}
+	if r.Seen != 4 || len(r.Vectors) != 2 {
+		t.Fatalf("expected 2 of 4 vectors sampled across rows, but got %d of %d", len(r.Vectors), r.Seen)
+	}
+	centroid := r.Centroid()
+	if centroid[0] != 0 || centroid[2] != 1 || centroid[1] < 1 || centroid[1] > 3 {
+		t.Errorf("expected centroid of the sampled vectors, but got %v", centroid)
+	}
+
+	for _, uid := range []uint64{0, 1, 2, 3} {
+		if err := tbl.Delete(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, _ := tbl.BucketSample(key); r != nil {
+		t.Errorf("expected the sample to be dropped with its buckets")
+	}
+	if tbl.bytes.Load() != 0 {
+		t.Errorf("expected empty table to hold %d bytes, but got %d", 0, tbl.bytes.Load())
+	}
+}
@@ -0,0 +1,146 @@
+package tables
+
+import (
+	"github.com/aouyang1/go-lsh/bitmap"
+	"gonum.org/v1/gonum/floats"
+)
+
+// maxSplitDepth bounds the recursive partitioning of a bucket so identical vectors can't split forever
+const maxSplitDepth = 8
+
+// VectorLookup returns the stored vector of a uid at an index in the same space the table hashes, or
+// nil if it is not available
+type VectorLookup func(uid uint64, index int64) []float64
+
+// SplitNode recursively partitions an oversized bucket with an additional hyperplane local to that
+// bucket. Internal nodes hold the plane and two children while leaves hold the uids on their side.
+type SplitNode struct {
+	Plane    []float64
+	Children [2]*SplitNode
+	Bitmap   *bitmap.Bitmap
+}
+
+func newSplitLeaf() *SplitNode {
+	return &SplitNode{Bitmap: bitmap.New()}
+}
+
+func (n *SplitNode) isLeaf() bool {
+	return n.Plane == nil
+}
+
+// side returns which child the vector belongs to
+func (n *SplitNode) side(v []float64) int {
+	return planeSide(n.Plane, v)
+}
+
+// leaf descends to the leaf the vector belongs to along with its depth
+func (n *SplitNode) leaf(v []float64) (*SplitNode, int) {
+	var depth int
+	for !n.isLeaf() {
+		n = n.Children[n.side(v)]
+		depth++
+	}
+	return n, depth
+}
+
+// remove deletes the uid from every leaf returning true if the subtree no longer holds any uids
+func (n *SplitNode) remove(uid uint64) bool {
+	if n.isLeaf() {
+		n.Bitmap.CheckedRemove(uid)
+		return n.Bitmap.IsEmpty()
+	}
+	empty0 := n.Children[0].remove(uid)
+	empty1 := n.Children[1].remove(uid)
+	return empty0 && empty1
+}
+
+// split adds the uid's vector to the bucket splits creating or further splitting the leaf it lands in
+// when the leaf exceeds the configured max bucket size
+func (t *Table) split(rowIndex int64, hash uint64, uid uint64, v []float64) {
+	if t.Cfg.MaxBucketSize < 1 || t.Vectors == nil || len(v) == 0 {
+		return
+	}
+
+	splits, exists := t.Splits[rowIndex]
+	if !exists {
+		splits = make(map[uint64]*SplitNode)
+		t.Splits[rowIndex] = splits
+	}
+	root, exists := splits[hash]
+	if !exists {
+		rb := t.Table[rowIndex][hash]
+		if rb.Cardinality() <= uint64(t.Cfg.MaxBucketSize) {
+			return
+		}
+		// start the partitioning with the whole bucket as a single leaf
+		root = newSplitLeaf()
+		rb.Lock()
+		root.Bitmap.Rb.Or(rb.Rb)
+		rb.Unlock()
+		splits[hash] = root
+	}
+
+	leaf, depth := root.leaf(v)
+	leaf.Bitmap.Add(uid)
+	if leaf.Bitmap.Cardinality() <= uint64(t.Cfg.MaxBucketSize) || depth >= maxSplitDepth {
+		return
+	}
+
+	plane := t.randomPlane(len(v))
+	children := [2]*SplitNode{newSplitLeaf(), newSplitLeaf()}
+	children[planeSide(plane, v)].Bitmap.Add(uid)
+
+	leaf.Bitmap.Lock()
+	members := leaf.Bitmap.Rb.ToArray()
+	leaf.Bitmap.Unlock()
+
+	for _, member := range members {
+		for _, index := range t.indexes(member, hash) {
+			if index/t.Cfg.RowSize*t.Cfg.RowSize != rowIndex {
+				continue
+			}
+			mv := t.Vectors(member, index)
+			if mv == nil {
+				continue
+			}
+			// only windows that were routed to this leaf are redistributed
+			if l, _ := root.leaf(mv); l == leaf {
+				children[planeSide(plane, mv)].Bitmap.Add(member)
+			}
+		}
+	}
+
+	leaf.Plane = plane
+	leaf.Children = children
+	leaf.Bitmap = nil
+}
+
+// bucket returns the bitmap of uids the vector can collide with in the row and hash, refined by any
+// splits of the bucket
+func (t *Table) bucket(rowIndex int64, hash uint64, v []float64) *bitmap.Bitmap {
+	rb := t.Table[rowIndex][hash]
+	if rb == nil {
+		return nil
+	}
+	if root, exists := t.Splits[rowIndex][hash]; exists {
+		leaf, _ := root.leaf(v)
+		return leaf.Bitmap
+	}
+	return rb
+}
+
+func planeSide(p, v []float64) int {
+	if floats.Dot(p, v) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (t *Table) randomPlane(n int) []float64 {
+	p := make([]float64, n)
+	for i := range p {
+		p[i] = t.rng.Float64() - 0.5
+	}
+	floats.Scale(1/floats.Norm(p, 2), p)
+	return p
+}
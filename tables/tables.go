@@ -2,38 +2,66 @@ package tables
 
 import (
 	"errors"
+	"hash/crc32"
 	"math"
+	"math/rand"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/aouyang1/go-lsh/bitmap"
 	"github.com/aouyang1/go-lsh/configs"
 	"github.com/aouyang1/go-lsh/document"
-	"github.com/aouyang1/go-lsh/hyperplanes"
+	"github.com/aouyang1/go-lsh/hashfamily"
 	"github.com/aouyang1/go-lsh/lsherrors"
 	"github.com/aouyang1/go-lsh/options"
+	"gonum.org/v1/gonum/floats"
 )
 
 var (
-	ErrNoHyperplanes              = errors.New("no hyperplanes provided to creation of new tables")
-	ErrTableToHyperplanesMismatch = errors.New("number of hyperplane tables does not match configured tables in options")
+	ErrNoHyperplanes              = errors.New("no hash families provided to creation of new tables")
+	ErrTableToHyperplanesMismatch = errors.New("number of hash families does not match configured tables in options")
 	ErrHashNotFound               = errors.New("hash not found in table")
+	ErrFamilyTooWide              = errors.New("hash family produces more bits than a table key can store")
+	ErrInconsistent               = errors.New("table buckets, hashes and timestamps disagree")
 )
 
-func New(cfg *configs.LSHConfigs, ht []*hyperplanes.Hyperplanes) ([]*Table, error) {
+// uidBuffers are scratch buffers bucket uids are read into while filtering so each bucket doesn't
+// allocate an array of its uids
+var uidBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]uint64, 256)
+		return &buf
+	},
+}
+
+// maxKeyBits is the width of the bucket keys stored in a table
+const maxKeyBits = 64
+
+// approximate bytes held by a uid's entry in Doc2Hash excluding its hashes
+const doc2HashEntryBytes = 64
+
+// bytes of the hash of a window in Doc2Hash
+const bytesPerHash = 8
+
+func New(cfg *configs.LSHConfigs, families []hashfamily.Family) ([]*Table, error) {
 	var err error
-	if ht == nil {
+	if families == nil {
 		return nil, ErrNoHyperplanes
 	}
-	if len(ht) != cfg.NumTables {
+	if len(families) != cfg.NumTables {
 		return nil, ErrTableToHyperplanesMismatch
 	}
 
+	// timestamps are shared by every table rather than duplicated
+	timestamps := NewTimestamps()
 	tables := make([]*Table, cfg.NumTables)
 	for i := 0; i < cfg.NumTables; i++ {
-		tables[i], err = NewTable(strconv.Itoa(i), ht[i], cfg)
+		tables[i], err = NewTable(strconv.Itoa(i), families[i], cfg)
 		if err != nil {
 			return nil, err
 		}
+		tables[i].Timestamps = timestamps
 	}
 	return tables, err
 }
@@ -44,32 +72,70 @@ type Table struct {
 	Name string
 	Cfg  *configs.LSHConfigs
 
-	Hyperplanes *hyperplanes.Hyperplanes
-	Table       map[int64]map[uint16]*bitmap.Bitmap // row index to hash to bitmaps
-	Doc2Hash    map[uint64]map[uint16][]int64       // uid to hash to slice of timestamps
+	Family     hashfamily.Family                   // hash family mapping vectors to bucket keys
+	Table      map[int64]map[uint64]*bitmap.Bitmap // row index to hash to bitmaps
+	Doc2Hash   map[uint64][]uint64                 // uid to the hash of each window aligned with its timestamps
+	Timestamps *Timestamps                         // sorted timestamps of the windows of each uid which may be shared with other tables
+	HashRows   map[uint64]map[int64]struct{}       // hash to the row indexes with a bucket for it
+	Splits     map[int64]map[uint64]*SplitNode     // row index to hash to partitioning of oversized buckets
+	Vectors    VectorLookup                        // stored vectors used to repartition buckets when splitting
+	Samples    map[uint64]*Reservoir               // hash to a sample of its hashed vectors when BucketSampleSize is set
+
+	queries atomic.Uint64 // number of times the table has been filtered
+	hits    atomic.Uint64 // number of candidate uids the table has produced
+	bytes   atomic.Int64  // estimated bytes held by the bitmaps and Doc2Hash
+	rng     *rand.Rand    // source of the bucket samples and splits
+	lazy    *lazyState    // set for tables restored by RestoreLazy
 }
 
-func NewTable(name string, h *hyperplanes.Hyperplanes, cfg *configs.LSHConfigs) (*Table, error) {
+func NewTable(name string, f hashfamily.Family, cfg *configs.LSHConfigs) (*Table, error) {
+	if f.Bits() > maxKeyBits {
+		return nil, ErrFamilyTooWide
+	}
+
 	t := new(Table)
 	t.Name = name
 	t.Cfg = cfg
+	t.Family = f
 
-	var err error
-	t.Hyperplanes = h
-	if err != nil {
-		return nil, err
+	t.Table = make(map[int64]map[uint64]*bitmap.Bitmap)
+	t.Doc2Hash = make(map[uint64][]uint64)
+	t.Timestamps = NewTimestamps()
+	t.Samples = make(map[uint64]*Reservoir)
+	seed := rand.Int63()
+	if cfg.Seed != 0 {
+		seed = cfg.Seed + int64(crc32.ChecksumIEEE([]byte(name)))
 	}
-
-	t.Table = make(map[int64]map[uint16]*bitmap.Bitmap)
-	t.Doc2Hash = make(map[uint64]map[uint16][]int64)
+	t.rng = rand.New(rand.NewSource(seed))
+	t.HashRows = make(map[uint64]map[int64]struct{})
+	t.Splits = make(map[int64]map[uint64]*SplitNode)
 	return t, nil
 }
 
+// Keyed is implemented by documents carrying bucket keys precomputed by a batch projection so tables
+// don't hash the vector themselves
+type Keyed interface {
+	Key(f hashfamily.Family) (uint64, bool)
+}
+
+// key returns the bucket key of the document from its precomputed keys or by hashing its vector
+func (t *Table) key(d document.Document) (uint64, error) {
+	if kd, ok := d.(Keyed); ok {
+		if key, ok := kd.Key(t.Family); ok {
+			return key, nil
+		}
+	}
+	return t.Family.Hash(d.GetVector())
+}
+
 func (t *Table) Index(d document.Document) error {
+	if err := t.Materialize(); err != nil {
+		return err
+	}
 	uid := d.GetUID()
 	v := d.GetVector()
 
-	hash, err := t.Hyperplanes.Hash16(v)
+	hash, err := t.key(d)
 	if err != nil {
 		return err
 	}
@@ -78,104 +144,330 @@ func (t *Table) Index(d document.Document) error {
 
 	tbl, exists := t.Table[rowIndex]
 	if !exists {
-		tbl = make(map[uint16]*bitmap.Bitmap)
+		tbl = make(map[uint64]*bitmap.Bitmap)
 		t.Table[rowIndex] = tbl
 	}
 	rb, exists := tbl[hash]
-	if !exists || rb == nil {
+	newBucket := !exists || rb == nil
+	if newBucket {
 		rb = bitmap.New()
 		tbl[hash] = rb
+
+		rows, exists := t.HashRows[hash]
+		if !exists {
+			rows = make(map[int64]struct{})
+			t.HashRows[hash] = rows
+		}
+		rows[rowIndex] = struct{}{}
 	}
 
+	var before uint64
+	if !newBucket {
+		before = rb.SizeInBytes()
+	}
 	rb.Add(uid)
+	t.bytes.Add(int64(rb.SizeInBytes()) - int64(before))
 
-	hashTimestamps, exists := t.Doc2Hash[uid]
+	pos, n := t.Timestamps.insert(uid, d.GetIndex())
+	hashes, exists := t.Doc2Hash[uid]
 	if !exists {
-		hashTimestamps = make(map[uint16][]int64)
-		t.Doc2Hash[uid] = hashTimestamps
+		t.Timestamps.acquire(uid)
+		t.bytes.Add(doc2HashEntryBytes)
 	}
-	timestamps := hashTimestamps[hash]
-	timestamps = append(timestamps, d.GetIndex())
-	hashTimestamps[hash] = timestamps
+	if len(hashes) < n {
+		hashes = append(hashes, 0)
+		copy(hashes[pos+1:], hashes[pos:])
+		hashes[pos] = hash
+		t.bytes.Add(bytesPerHash)
+		t.Doc2Hash[uid] = hashes
+	} else if prev := hashes[pos]; prev != hash {
+		// reindexing a window moves it out of the bucket of its previous hash
+		hashes[pos] = hash
+		if !t.hasWindow(uid, rowIndex, prev) {
+			t.removeFromBucket(uid, rowIndex, prev)
+		}
+	}
+
+	t.sample(hash, uid, v)
+	t.split(rowIndex, hash, uid, v)
 	return nil
 }
 
-func (t *Table) Filter(d document.Document, maxLag int64) map[uint64]map[int64]struct{} {
-	v := d.GetVector()
-	hash, _ := t.Hyperplanes.Hash16(v)
-	docToIndex := make(map[uint64]map[int64]struct{})
-	var rowIndexes []int64
+// Filter returns the candidates colliding with the vector whose windows start within maxLag of the
+// index of the query. Returns the error of a lazily restored table failing to load.
+func (t *Table) Filter(d document.Document, maxLag int64) (map[uint64]map[int64]struct{}, error) {
+	return t.FilterSigned(d, maxLag, options.SignFilter_POS)
+}
+
+// FilterRange returns the candidates colliding with the vector whose windows start between start and
+// end inclusive regardless of the index of the query
+func (t *Table) FilterRange(d document.Document, start, end int64) (map[uint64]map[int64]struct{}, error) {
+	return t.FilterRangeSigned(d, start, end, options.SignFilter_POS)
+}
 
-	// settings for no max lag
-	startIdx := int64(0)
-	endIdx := int64(math.MaxInt64)
+// FilterAll returns the candidates colliding with the vector across every stored window ignoring the
+// indexes of both the query and the documents
+func (t *Table) FilterAll(d document.Document) (map[uint64]map[int64]struct{}, error) {
+	return t.FilterAllSigned(d, options.SignFilter_POS)
+}
 
+// FilterSigned returns the candidates of Filter colliding with the vector, its negation or both. The
+// key of the negation is derived from the key of the vector for families implementing
+// hashfamily.Negator so both signs are filtered with a single hash and a single pass.
+func (t *Table) FilterSigned(d document.Document, maxLag int64, sign options.SignFilter) (map[uint64]map[int64]struct{}, error) {
 	if maxLag > options.AllLags {
 		// indicates we're looking for time windows with some wiggle room
-		startIdx = d.GetIndex() - maxLag
-		endIdx = d.GetIndex() + maxLag
-		startRow := startIdx / t.Cfg.RowSize * t.Cfg.RowSize
-		endRow := endIdx / t.Cfg.RowSize * t.Cfg.RowSize
-		rows := (endRow-startRow)/t.Cfg.RowSize + 1
-		for i := int64(0); i < rows; i++ {
-			rowIndexes = append(rowIndexes, startRow+i*t.Cfg.RowSize)
-		}
-	} else {
-		for rowIndex := range t.Table {
-			rowIndexes = append(rowIndexes, rowIndex)
-		}
+		return t.FilterRangeSigned(d, d.GetIndex()-maxLag, d.GetIndex()+maxLag, sign)
 	}
+	return t.filter(d, 0, math.MaxInt64, true, sign)
+}
 
-	for _, rowIndex := range rowIndexes {
-		tblRow, exists := t.Table[rowIndex]
-		if !exists {
-			continue
-		}
-		rb := tblRow[hash]
+// FilterRangeSigned returns the candidates of FilterRange for the signs selected like FilterSigned
+func (t *Table) FilterRangeSigned(d document.Document, start, end int64, sign options.SignFilter) (map[uint64]map[int64]struct{}, error) {
+	return t.filter(d, start, end, false, sign)
+}
+
+// FilterAllSigned returns the candidates of FilterAll for the signs selected like FilterSigned
+func (t *Table) FilterAllSigned(d document.Document, sign options.SignFilter) (map[uint64]map[int64]struct{}, error) {
+	return t.filter(d, math.MinInt64, math.MaxInt64, true, sign)
+}
+
+func (t *Table) filter(d document.Document, startIdx, endIdx int64, allRows bool, sign options.SignFilter) (map[uint64]map[int64]struct{}, error) {
+	if err := t.Materialize(); err != nil {
+		return nil, err
+	}
+	v := d.GetVector()
+	key, _ := t.key(d)
+	docToIndex := make(map[uint64]map[int64]struct{})
+	if sign != options.SignFilter_NEG {
+		t.collect(docToIndex, key, v, startIdx, endIdx, allRows)
+	}
+	if sign != options.SignFilter_POS {
+		negKey, negVec := t.negate(key, v)
+		t.collect(docToIndex, negKey, negVec, startIdx, endIdx, allRows)
+	}
+	t.queries.Add(1)
+	t.hits.Add(uint64(len(docToIndex)))
+	return docToIndex, nil
+}
+
+// negate returns the key of the negated vector along with the negated vector if the buckets may need
+// it to descend their splits
+func (t *Table) negate(key uint64, v []float64) (uint64, []float64) {
+	negator, ok := t.Family.(hashfamily.Negator)
+	if ok && len(t.Splits) == 0 {
+		return negator.NegateKey(key), nil
+	}
+	neg := make([]float64, len(v))
+	floats.ScaleTo(neg, -1, v)
+	if ok {
+		return negator.NegateKey(key), neg
+	}
+	negKey, _ := t.Family.Hash(neg)
+	return negKey, neg
+}
+
+// collect adds the uids and indexes of the windows within the range hashed into the buckets of the hash
+func (t *Table) collect(docToIndex map[uint64]map[int64]struct{}, hash uint64, v []float64, startIdx, endIdx int64, allRows bool) {
+	// skip the table entirely if no row has a bucket for the hash
+	hashRows := t.HashRows[hash]
+	if len(hashRows) == 0 {
+		return
+	}
+	buf := uidBuffers.Get().(*[]uint64)
+	defer uidBuffers.Put(buf)
+	for _, rowIndex := range t.rowIndexes(hashRows, startIdx, endIdx, allRows) {
+		rb := t.bucket(rowIndex, hash, v)
 		if rb == nil {
 			continue
 		}
 		rb.Lock()
-		for _, uid := range rb.Rb.ToArray() {
-			indexMap, exists := docToIndex[uid]
-			if !exists {
-				indexMap = make(map[int64]struct{})
-				docToIndex[uid] = indexMap
-			}
-			for _, index := range t.Doc2Hash[uid][hash] {
+		it := rb.Rb.ManyIterator()
+		for n := it.NextMany(*buf); n > 0; n = it.NextMany(*buf) {
+			for _, uid := range (*buf)[:n] {
+				indexMap, exists := docToIndex[uid]
+				if !exists {
+					indexMap = make(map[int64]struct{})
+					docToIndex[uid] = indexMap
+				}
 				// keep only indexes within the specified lag
-				if index >= startIdx && index <= endIdx {
-					indexMap[index] = struct{}{}
+				hashes := t.Doc2Hash[uid]
+				pos, indexes := t.Timestamps.Between(uid, startIdx, endIdx)
+				for i, index := range indexes {
+					if pos+i < len(hashes) && hashes[pos+i] == hash {
+						indexMap[index] = struct{}{}
+					}
 				}
 			}
 		}
 		rb.Unlock()
 	}
-	return docToIndex
+}
+
+// rowIndexes returns the rows with a bucket for the hash whose windows may start between start and end
+func (t *Table) rowIndexes(hashRows map[int64]struct{}, startIdx, endIdx int64, allRows bool) []int64 {
+	var rowIndexes []int64
+	if allRows {
+		for rowIndex := range hashRows {
+			rowIndexes = append(rowIndexes, rowIndex)
+		}
+		return rowIndexes
+	}
+
+	startRow := startIdx / t.Cfg.RowSize * t.Cfg.RowSize
+	endRow := endIdx / t.Cfg.RowSize * t.Cfg.RowSize
+	rows := (endRow-startRow)/t.Cfg.RowSize + 1
+	if rows > int64(len(hashRows)) {
+		for rowIndex := range hashRows {
+			if rowIndex >= startRow && rowIndex <= endRow {
+				rowIndexes = append(rowIndexes, rowIndex)
+			}
+		}
+		return rowIndexes
+	}
+	for i := int64(0); i < rows; i++ {
+		rowIndex := startRow + i*t.Cfg.RowSize
+		if _, exists := hashRows[rowIndex]; exists {
+			rowIndexes = append(rowIndexes, rowIndex)
+		}
+	}
+	return rowIndexes
+}
+
+// HitRate returns the average number of candidate uids produced per filter. Tables that have not been
+// filtered yet return +Inf so they are explored first.
+func (t *Table) HitRate() float64 {
+	queries := t.queries.Load()
+	if queries == 0 {
+		return math.Inf(1)
+	}
+	return float64(t.hits.Load()) / float64(queries)
+}
+
+// DeleteReport describes what deleting a uid removed from a table
+type DeleteReport struct {
+	BucketsEmptied int
+	BytesFreed     uint64
 }
 
 func (t *Table) Delete(uid uint64) error {
+	_, err := t.DeleteWithReport(uid)
+	return err
+}
+
+// DeleteWithReport removes the uid like Delete additionally reporting the buckets emptied and the
+// estimated bytes freed. Only the rows holding a bucket for one of the uid's hashes are visited.
+func (t *Table) DeleteWithReport(uid uint64) (DeleteReport, error) {
+	var report DeleteReport
+	if err := t.Materialize(); err != nil {
+		return report, err
+	}
 	hashes, exists := t.Doc2Hash[uid]
 	if !exists {
-		return lsherrors.DocumentNotStored
+		return report, lsherrors.DocumentNotStored
 	}
 
+	before := t.bytes.Load()
 	err := ErrHashNotFound
-	for _, tbl := range t.Table {
-		for hash := range hashes {
-			rb, exists := tbl[hash]
-			if !exists {
+	for hash := range uniqueHashes(hashes) {
+		rows := make([]int64, 0, len(t.HashRows[hash]))
+		for rowIndex := range t.HashRows[hash] {
+			rows = append(rows, rowIndex)
+		}
+		for _, rowIndex := range rows {
+			removed, emptied := t.removeFromBucket(uid, rowIndex, hash)
+			if !removed {
 				continue
 			}
 			err = nil
-
-			rb.CheckedRemove(uid)
-
-			if rb.IsEmpty() {
-				delete(tbl, hash)
+			if emptied {
+				report.BucketsEmptied++
 			}
 		}
 	}
+	t.bytes.Add(-doc2HashEntryBytes - bytesPerHash*int64(len(hashes)))
+	t.unsample(uid, uniqueHashes(hashes))
 	delete(t.Doc2Hash, uid)
-	return err
+	t.Timestamps.release(uid)
+	if freed := before - t.bytes.Load(); freed > 0 {
+		report.BytesFreed = uint64(freed)
+	}
+	return report, err
+}
+
+// removeFromBucket removes the uid from the bucket of the row and hash dropping the bucket once it is
+// empty. Returns whether the uid was in the bucket and if the bucket was emptied.
+func (t *Table) removeFromBucket(uid uint64, rowIndex int64, hash uint64) (bool, bool) {
+	tbl := t.Table[rowIndex]
+	rb, exists := tbl[hash]
+	if !exists {
+		return false, false
+	}
+	size := rb.SizeInBytes()
+	if !rb.CheckedRemove(uid) {
+		return false, false
+	}
+	if root, exists := t.Splits[rowIndex][hash]; exists {
+		root.remove(uid)
+	}
+	if !rb.IsEmpty() {
+		t.bytes.Add(int64(rb.SizeInBytes()) - int64(size))
+		return true, false
+	}
+	t.bytes.Add(-int64(size))
+	delete(tbl, hash)
+	delete(t.Splits[rowIndex], hash)
+	t.removeHashRow(hash, rowIndex)
+	return true, true
+}
+
+// indexes returns the timestamps of the windows of the uid with the hash
+func (t *Table) indexes(uid uint64, hash uint64) []int64 {
+	hashes := t.Doc2Hash[uid]
+	timestamps := t.Timestamps.Get(uid)
+	var indexes []int64
+	for i, h := range hashes {
+		if h == hash && i < len(timestamps) {
+			indexes = append(indexes, timestamps[i])
+		}
+	}
+	return indexes
+}
+
+// hasWindow returns true if any window of the uid in the row has the hash
+func (t *Table) hasWindow(uid uint64, rowIndex int64, hash uint64) bool {
+	for _, index := range t.indexes(uid, hash) {
+		if index/t.Cfg.RowSize*t.Cfg.RowSize == rowIndex {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueHashes(hashes []uint64) map[uint64]struct{} {
+	unique := make(map[uint64]struct{}, len(hashes))
+	for _, h := range hashes {
+		unique[h] = struct{}{}
+	}
+	return unique
+}
+
+func (t *Table) removeHashRow(hash uint64, rowIndex int64) {
+	rows, exists := t.HashRows[hash]
+	if !exists {
+		return
+	}
+	delete(rows, rowIndex)
+	if len(rows) == 0 {
+		delete(t.HashRows, hash)
+	}
+}
+
+// SizeInBytes estimates the memory held by the bitmaps and the uid to hash mapping of the table. The
+// size is maintained as documents are indexed and deleted so this is cheap to call.
+func (t *Table) SizeInBytes() uint64 {
+	if size := t.bytes.Load(); size > 0 {
+		return uint64(size)
+	}
+	return 0
 }
@@ -0,0 +1,180 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+	"github.com/aouyang1/go-lsh/options"
+)
+
+func TestTableHashRows(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 0, 1}),
+		document.NewSimple(1, 0, []float64{0, 1, 0}),
+		document.NewSimple(0, cfg.RowSize, []float64{0, 0, 1}),
+	}
+	for _, d := range docs {
+		if err := tbl.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tbl.HashRows) != 2 {
+		t.Fatalf("expected %d hashes, but got %d", 2, len(tbl.HashRows))
+	}
+	if len(tbl.HashRows[4]) != 2 {
+		t.Fatalf("expected %d rows for hash, but got %d", 2, len(tbl.HashRows[4]))
+	}
+
+	res, err := tbl.Filter(document.NewSimple(0, 0, []float64{1, 0, 0}), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expected no candidates for a hash without rows, but got %v", res)
+	}
+	res, err = tbl.Filter(document.NewSimple(0, 0, []float64{0, 0, 1}), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res[0]) != 2 {
+		t.Fatalf("expected %d indexes, but got %v", 2, res)
+	}
+
+	if err := tbl.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := tbl.HashRows[4]; exists {
+		t.Fatal("expected hash rows to be removed with their buckets")
+	}
+}
+
+func TestTableFilterSigned(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{1, 2, 3}),
+		document.NewSimple(1, 0, []float64{-1, -2, -3}),
+		document.NewSimple(2, 0, []float64{-1, 2, 3}),
+	}
+	for _, d := range docs {
+		if err := tbl.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := document.NewSimple(0, 0, []float64{2, 1, 1})
+	testData := []struct {
+		sign     options.SignFilter
+		expected []uint64
+	}{
+		{options.SignFilter_POS, []uint64{0}},
+		{options.SignFilter_NEG, []uint64{1}},
+		{options.SignFilter_ANY, []uint64{0, 1}},
+	}
+	for _, td := range testData {
+		res, err := tbl.FilterSigned(query, options.AllLags, td.sign)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != len(td.expected) {
+			t.Errorf("expected %v, but got %v for sign %d", td.expected, res, td.sign)
+			continue
+		}
+		for _, uid := range td.expected {
+			if _, exists := res[uid][0]; !exists {
+				t.Errorf("expected uid %d, but got %v for sign %d", uid, res, td.sign)
+			}
+		}
+	}
+}
+
+func TestTableSizeInBytes(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []document.Document{
+		document.NewSimple(0, 0, []float64{0, 0, 1}),
+		document.NewSimple(1, 0, []float64{0, 1, 0}),
+		document.NewSimple(0, cfg.RowSize, []float64{0, 0, 1}),
+	}
+	for _, d := range docs {
+		if err := tbl.Index(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tbl.SizeInBytes() == 0 {
+		t.Fatalf("expected table size to be tracked")
+	}
+
+	for _, uid := range []uint64{0, 1} {
+		if err := tbl.Delete(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tbl.bytes.Load() != 0 {
+		t.Errorf("expected empty table to hold %d bytes, but got %d", 0, tbl.bytes.Load())
+	}
+}
+
+func BenchmarkTableFilter(b *testing.B) {
+	cfg := configs.NewDefaultLSHConfigs()
+	h := &hyperplanes.Hyperplanes{
+		Planes: [][]float64{
+			{0, 0, 1},
+			{0, 1, 0},
+			{1, 0, 0},
+		},
+	}
+	tbl, err := NewTable("0", h, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for uid := uint64(0); uid < 1000; uid++ {
+		if err := tbl.Index(document.NewSimple(uid, 0, []float64{0, 0, 1})); err != nil {
+			b.Fatal(err)
+		}
+	}
+	d := document.NewSimple(0, 0, []float64{0, 0, 1})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if res, _ := tbl.Filter(d, 0); len(res) != 1000 {
+			b.Fatal("expected every uid to be a candidate")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package tables
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// maxBlockLen is the number of timestamps a block holds before it is split in two
+const maxBlockLen = 128
+
+// bytes held by a block excluding its encoded deltas
+const blockBytes = 48
+
+// timestampList is a sorted set of timestamps compressed as blocks of varint encoded deltas. Each
+// block starts with a full timestamp so a range is found by a binary search over the blocks and only
+// the blocks overlapping the range are decoded.
+type timestampList struct {
+	blocks []*block
+	n      int
+}
+
+type block struct {
+	first  int64
+	last   int64
+	count  int
+	deltas []byte // varint deltas of every timestamp after the first
+}
+
+func encodeBlock(indexes []int64) *block {
+	b := &block{first: indexes[0], last: indexes[len(indexes)-1], count: len(indexes)}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i := 1; i < len(indexes); i++ {
+		n := binary.PutUvarint(buf, uint64(indexes[i]-indexes[i-1]))
+		b.deltas = append(b.deltas, buf[:n]...)
+	}
+	return b
+}
+
+func (b *block) decode(dst []int64) []int64 {
+	prev := b.first
+	dst = append(dst, prev)
+	for buf := b.deltas; len(buf) > 0; {
+		delta, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		prev += int64(delta)
+		dst = append(dst, prev)
+	}
+	return dst
+}
+
+func (b *block) size() int {
+	return blockBytes + cap(b.deltas)
+}
+
+// size returns the estimated bytes held by the list
+func (l *timestampList) size() int {
+	size := 24
+	for _, b := range l.blocks {
+		size += 8 + b.size()
+	}
+	return size
+}
+
+// insert adds the timestamp if it is not already present returning its position
+func (l *timestampList) insert(index int64) (int, bool) {
+	if len(l.blocks) == 0 {
+		l.blocks = []*block{encodeBlock([]int64{index})}
+		l.n = 1
+		return 0, true
+	}
+
+	// the last block starting at or before the timestamp holds it, earlier timestamps go in the first
+	bi := sort.Search(len(l.blocks), func(i int) bool { return l.blocks[i].first > index }) - 1
+	if bi < 0 {
+		bi = 0
+	}
+	offset := l.offset(bi)
+	b := l.blocks[bi]
+	if index > b.last {
+		// appending is the common case of series indexed in order and needs no decoding
+		buf := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(buf, uint64(index-b.last))
+		b.deltas = append(b.deltas, buf[:n]...)
+		b.last = index
+		b.count++
+		l.n++
+		pos := offset + b.count - 1
+		l.split(bi)
+		return pos, true
+	}
+
+	indexes := b.decode(make([]int64, 0, b.count+1))
+	i := sort.Search(len(indexes), func(i int) bool { return indexes[i] >= index })
+	if i < len(indexes) && indexes[i] == index {
+		return offset + i, false
+	}
+	indexes = append(indexes, 0)
+	copy(indexes[i+1:], indexes[i:])
+	indexes[i] = index
+	l.blocks[bi] = encodeBlock(indexes)
+	l.n++
+	l.split(bi)
+	return offset + i, true
+}
+
+// split divides the block in two once it exceeds the max block length
+func (l *timestampList) split(bi int) {
+	b := l.blocks[bi]
+	if b.count <= maxBlockLen {
+		return
+	}
+	indexes := b.decode(make([]int64, 0, b.count))
+	half := len(indexes) / 2
+	l.blocks = append(l.blocks, nil)
+	copy(l.blocks[bi+2:], l.blocks[bi+1:])
+	l.blocks[bi] = encodeBlock(indexes[:half])
+	l.blocks[bi+1] = encodeBlock(indexes[half:])
+}
+
+// offset returns the position of the first timestamp of the block
+func (l *timestampList) offset(bi int) int {
+	var offset int
+	for _, b := range l.blocks[:bi] {
+		offset += b.count
+	}
+	return offset
+}
+
+// all returns every timestamp in order
+func (l *timestampList) all() []int64 {
+	indexes := make([]int64, 0, l.n)
+	for _, b := range l.blocks {
+		indexes = b.decode(indexes)
+	}
+	return indexes
+}
+
+// between returns the position of the first timestamp within start and end inclusive along with
+// every timestamp in the range decoding only the overlapping blocks
+func (l *timestampList) between(start, end int64) (int, []int64) {
+	bi := sort.Search(len(l.blocks), func(i int) bool { return l.blocks[i].last >= start })
+	pos := l.offset(bi)
+	var indexes []int64
+	for first := true; bi < len(l.blocks) && l.blocks[bi].first <= end; bi++ {
+		b := l.blocks[bi]
+		decoded := b.decode(make([]int64, 0, b.count))
+		lo := sort.Search(len(decoded), func(i int) bool { return decoded[i] >= start })
+		if first {
+			pos += lo
+			first = false
+		}
+		for _, index := range decoded[lo:] {
+			if index > end {
+				break
+			}
+			indexes = append(indexes, index)
+		}
+	}
+	return pos, indexes
+}
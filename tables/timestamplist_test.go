@@ -0,0 +1,71 @@
+package tables
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTimestampList(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var l timestampList
+	seen := make(map[int64]struct{})
+	var expected []int64
+	for i := 0; i < 1000; i++ {
+		index := r.Int63n(5000) * 60
+		pos, added := l.insert(index)
+		_, exists := seen[index]
+		if added == exists {
+			t.Fatalf("expected added to be %v for %d", !exists, index)
+		}
+		if !exists {
+			seen[index] = struct{}{}
+			expected = append(expected, index)
+			sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+		}
+		if expected[pos] != index {
+			t.Fatalf("expected %d at position %d, but got %d", index, pos, expected[pos])
+		}
+	}
+	if len(l.blocks) < 2 {
+		t.Fatalf("expected blocks to be split, but got %d", len(l.blocks))
+	}
+	if err := compareInt64s(expected, l.all()); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		start, end int64
+	}{
+		{0, 300000},
+		{-100, -1},
+		{60000, 60000},
+		{59999, 120001},
+		{299000, 400000},
+	}
+	for _, td := range testData {
+		lo := sort.Search(len(expected), func(i int) bool { return expected[i] >= td.start })
+		hi := sort.Search(len(expected), func(i int) bool { return expected[i] > td.end })
+		pos, indexes := l.between(td.start, td.end)
+		if lo < hi && pos != lo {
+			t.Errorf("expected position %d, but got %d for range %d to %d", lo, pos, td.start, td.end)
+		}
+		if err := compareInt64s(expected[lo:hi], indexes); len(indexes) > 0 && err != nil {
+			t.Errorf("%v for range %d to %d", err, td.start, td.end)
+		}
+		if len(indexes) != hi-lo {
+			t.Errorf("expected %d timestamps, but got %d for range %d to %d", hi-lo, len(indexes), td.start, td.end)
+		}
+	}
+}
+
+func TestTimestampListCompression(t *testing.T) {
+	var l timestampList
+	n := 10000
+	for i := 0; i < n; i++ {
+		l.insert(int64(i) * 60)
+	}
+	if l.size() >= 2*n {
+		t.Errorf("expected fewer than %d bytes for regular windows, but got %d", 2*n, l.size())
+	}
+}
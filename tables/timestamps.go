@@ -0,0 +1,116 @@
+package tables
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// approximate bytes held by a uid's entry in Timestamps excluding its timestamps
+const timestampsEntryBytes = 64
+
+// Timestamps stores the sorted timestamps of the windows indexed for each uid once for every table
+// compressed as deltas. Tables only keep the hash of each window aligned with the uid's timestamps.
+type Timestamps struct {
+	mu    sync.RWMutex
+	uids  map[uint64]*windows
+	bytes atomic.Int64
+}
+
+type windows struct {
+	list timestampList
+	refs int // number of tables holding hashes of the uid
+}
+
+// NewTimestamps returns an empty timestamp store
+func NewTimestamps() *Timestamps {
+	return &Timestamps{uids: make(map[uint64]*windows)}
+}
+
+// insert adds the timestamp of the uid if it is not already present returning its position and the
+// number of timestamps of the uid
+func (s *Timestamps) insert(uid uint64, index int64) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, exists := s.uids[uid]
+	if !exists {
+		w = new(windows)
+		s.uids[uid] = w
+		s.bytes.Add(timestampsEntryBytes)
+	}
+	before := w.list.size()
+	pos, _ := w.list.insert(index)
+	s.bytes.Add(int64(w.list.size() - before))
+	return pos, w.list.n
+}
+
+// acquire records that another table holds hashes of the uid
+func (s *Timestamps) acquire(uid uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, exists := s.uids[uid]; exists {
+		w.refs++
+	}
+}
+
+// release removes the uid once no table holds hashes of it
+func (s *Timestamps) release(uid uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, exists := s.uids[uid]
+	if !exists {
+		return
+	}
+	w.refs--
+	if w.refs > 0 {
+		return
+	}
+	s.bytes.Add(-timestampsEntryBytes - int64(w.list.size()))
+	delete(s.uids, uid)
+}
+
+// Get returns the sorted timestamps of the windows indexed for the uid
+func (s *Timestamps) Get(uid uint64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if w, exists := s.uids[uid]; exists {
+		return w.list.all()
+	}
+	return nil
+}
+
+// Between returns the position of the first timestamp of the uid within start and end inclusive along
+// with the sorted timestamps in the range
+func (s *Timestamps) Between(uid uint64, start, end int64) (int, []int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if w, exists := s.uids[uid]; exists {
+		return w.list.between(start, end)
+	}
+	return 0, nil
+}
+
+// Len returns the number of uids with indexed windows
+func (s *Timestamps) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.uids)
+}
+
+// Range calls fn with the timestamps of every uid. Iteration stops early if fn returns false.
+func (s *Timestamps) Range(fn func(uid uint64, indexes []int64) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for uid, w := range s.uids {
+		if !fn(uid, w.list.all()) {
+			return
+		}
+	}
+}
+
+// SizeInBytes estimates the memory held by the stored timestamps
+func (s *Timestamps) SizeInBytes() uint64 {
+	if size := s.bytes.Load(); size > 0 {
+		return uint64(size)
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package tables
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/configs"
+	"github.com/aouyang1/go-lsh/document"
+	"github.com/aouyang1/go-lsh/hashfamily"
+	"github.com/aouyang1/go-lsh/hyperplanes"
+)
+
+func TestSharedTimestamps(t *testing.T) {
+	cfg := configs.NewDefaultLSHConfigs()
+	cfg.NumTables = 2
+	families := []hashfamily.Family{
+		&hyperplanes.Hyperplanes{Planes: [][]float64{{0, 0, 1}, {0, 1, 0}}},
+		&hyperplanes.Hyperplanes{Planes: [][]float64{{1, 0, 0}}},
+	}
+	tbls, err := New(cfg, families)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbls[0].Timestamps != tbls[1].Timestamps {
+		t.Fatalf("expected tables to share timestamps")
+	}
+	timestamps := tbls[0].Timestamps
+
+	// windows indexed out of order are kept sorted with their hashes aligned
+	docs := []document.Document{
+		document.NewSimple(0, 120, []float64{0, 0, 1}),
+		document.NewSimple(0, 0, []float64{0, 1, 0}),
+		document.NewSimple(0, 60, []float64{0, 0, 1}),
+	}
+	for _, d := range docs {
+		for _, tbl := range tbls {
+			if err := tbl.Index(d); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := compareInt64s([]int64{0, 60, 120}, timestamps.Get(0)); err != nil {
+		t.Fatal(err)
+	}
+	up, _ := families[0].Hash([]float64{0, 0, 1})
+	side, _ := families[0].Hash([]float64{0, 1, 0})
+	if err := compareInt64s([]int64{60, 120}, tbls[0].indexes(0, up)); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareInt64s([]int64{0}, tbls[0].indexes(0, side)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reindexing a window with a new hash moves it between buckets
+	for _, tbl := range tbls {
+		if err := tbl.Index(document.NewSimple(0, 0, []float64{0, 0, 1})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(timestamps.Get(0)) != 3 {
+		t.Fatalf("expected %d timestamps, but got %v", 3, timestamps.Get(0))
+	}
+	if _, exists := tbls[0].Table[0][side]; exists {
+		t.Errorf("expected the bucket of the previous hash to be removed")
+	}
+	res, err := tbls[0].Filter(document.NewSimple(0, 0, []float64{0, 0, 1}), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res[0]) != 3 {
+		t.Errorf("expected %d indexes, but got %v", 3, res)
+	}
+
+	if err := tbls[0].Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if timestamps.Len() != 1 {
+		t.Fatalf("expected timestamps to be kept until every table deletes the uid")
+	}
+	if err := tbls[1].Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if timestamps.Len() != 0 || timestamps.SizeInBytes() != 0 {
+		t.Errorf("expected timestamps to be released, but got %d uids and %d bytes", timestamps.Len(), timestamps.SizeInBytes())
+	}
+}
+
+func compareInt64s(expected, actual []int64) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("expected %v, but got %v", expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			return fmt.Errorf("expected %v, but got %v", expected, actual)
+		}
+	}
+	return nil
+}
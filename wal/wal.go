@@ -0,0 +1,380 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+var (
+	ErrClosed  = errors.New("write-ahead log is closed")
+	ErrCorrupt = errors.New("write-ahead log is corrupt")
+)
+
+const (
+	segmentExt = ".wal"
+	headerSize = 8 // payload length and checksum of a record
+
+	// flagCompressed is set on the payload length of a compressed record
+	flagCompressed = uint32(1 << 31)
+
+	// DefaultSegmentSize is the size a segment grows to before writes start a new one
+	DefaultSegmentSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options configure how records are stored
+type Options struct {
+	Cipher *snapshot.Cipher // optional encryption of every record
+
+	// NoSync skips syncing every record to disk trading the durability of the last records written
+	// before a machine crash for throughput
+	NoSync bool
+
+	// SegmentSize is the size in bytes a segment grows to before a new one is started. 0 uses
+	// DefaultSegmentSize.
+	SegmentSize int64
+
+	// CompressionLevel is the zstd level, 1 through 22, records are compressed with before being
+	// encrypted. Compression is flagged on each record so it only applies to writers.
+	CompressionLevel int
+}
+
+// Log is a write-ahead log of the mutations applied to an index. Mutations are appended to segment
+// files named by the sequence number of their first mutation so segments covered by a snapshot can be
+// removed as a whole. Each record is checksummed so a record torn by a crash is detected and dropped.
+// The highest bit of the payload length flags a compressed record.
+//
+//	record: payloadLen[4] payloadCRC[4] payload
+type Log struct {
+	mu     sync.Mutex
+	dir    string
+	opts   Options
+	comp   *snapshot.Compressor
+	f      *os.File // current segment, nil until the next write
+	size   int64    // bytes written to the current segment
+	last   uint64   // sequence number of the last mutation written
+	closed bool
+}
+
+// Open opens the log in dir creating the directory if needed. A torn record at the end of the last
+// segment is truncated and the following writes start a new segment.
+func Open(dir string, opts Options) (*Log, error) {
+	comp, err := snapshot.NewCompressor(opts.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, opts: opts, comp: comp}
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		if l.last, err = repair(last.path, opts); err != nil {
+			return nil, err
+		}
+		if l.last == 0 {
+			l.last = last.first - 1
+		}
+	}
+	return l, nil
+}
+
+// Write appends the mutation implementing the cdc.Writer interface
+func (l *Log) Write(m cdc.Mutation) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return err
+	}
+	payload := buf.Bytes()
+	length := uint32(0)
+	if l.comp != nil {
+		payload = l.comp.Compress(payload)
+		length |= flagCompressed
+	}
+	if l.opts.Cipher != nil {
+		var err error
+		if payload, err = l.opts.Cipher.Seal(payload, nil); err != nil {
+			return err
+		}
+	}
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record, length|uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	segmentSize := l.opts.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if l.f != nil && l.size >= segmentSize {
+		if err := l.closeSegment(); err != nil {
+			return err
+		}
+	}
+	if l.f == nil {
+		f, err := os.OpenFile(segmentPath(l.dir, m.Seq), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		l.f, l.size = f, 0
+	}
+	if _, err := l.f.Write(record); err != nil {
+		return err
+	}
+	l.size += int64(len(record))
+	l.last = m.Seq
+	if l.opts.NoSync {
+		return nil
+	}
+	return l.f.Sync()
+}
+
+// Rotate closes the current segment so the next write starts a new one
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return l.closeSegment()
+}
+
+func (l *Log) closeSegment() error {
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Sync()
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// Truncate removes the segments only holding mutations up to and including seq, e.g. once they are
+// covered by a snapshot. The segment being written to is kept.
+func (l *Log) Truncate(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for i, s := range segments {
+		last := l.last
+		if i+1 < len(segments) {
+			last = segments[i+1].first - 1
+		} else if l.f != nil {
+			break
+		}
+		if last > seq {
+			break
+		}
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the current segment
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.closeSegment()
+}
+
+type segment struct {
+	path  string
+	first uint64 // sequence number of the first mutation
+}
+
+func segmentPath(dir string, first uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+// listSegments returns the segments of dir ordered by their first sequence number
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []segment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{path: filepath.Join(dir, name), first: first})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].first < segments[j].first
+	})
+	return segments, nil
+}
+
+// repair truncates the segment after its last intact record returning the sequence number of that
+// record or 0 if the segment holds none
+func repair(path string, opts Options) (uint64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		last  uint64
+		valid int64
+	)
+	sr := &segmentReader{r: bufio.NewReader(f), opts: opts}
+	for {
+		m, err := sr.next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		last = m.Seq
+		valid = sr.offset
+	}
+	if err := f.Truncate(valid); err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+// segmentReader decodes the records of a segment
+type segmentReader struct {
+	r      io.Reader
+	opts   Options
+	offset int64 // end of the last record read
+}
+
+// next returns the next mutation, io.EOF at the end of the segment or io.ErrUnexpectedEOF if the
+// record is torn
+func (s *segmentReader) next() (cdc.Mutation, error) {
+	var m cdc.Mutation
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(s.r, header); err != nil {
+		return m, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	// the buffer grows with the bytes actually read so a torn header claiming a huge record doesn't
+	// allocate it up front
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, s.r, int64(length&^flagCompressed)); err != nil {
+		return m, io.ErrUnexpectedEOF
+	}
+	payload := buf.Bytes()
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+		return m, io.ErrUnexpectedEOF
+	}
+	size := int64(headerSize + len(payload))
+	var err error
+	if s.opts.Cipher != nil {
+		if payload, err = s.opts.Cipher.Open(payload, nil); err != nil {
+			return m, err
+		}
+	}
+	if length&flagCompressed != 0 {
+		if payload, err = snapshot.Decompress(payload); err != nil {
+			return m, err
+		}
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&m); err != nil {
+		return m, err
+	}
+	s.offset += size
+	return m, nil
+}
+
+// Reader reads the mutations of a log in order implementing the cdc.Reader interface. A torn record at
+// the end of the last segment ends the log while damage anywhere else is reported as ErrCorrupt.
+type Reader struct {
+	opts     Options
+	segments []segment
+	f        *os.File
+	sr       *segmentReader
+}
+
+// NewReader returns a reader of the segments present in dir
+func NewReader(dir string, opts Options) (*Reader, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{opts: opts, segments: segments}, nil
+}
+
+// Next returns the next mutation or io.EOF once every segment has been read
+func (r *Reader) Next() (cdc.Mutation, error) {
+	for {
+		if r.sr == nil {
+			if len(r.segments) == 0 {
+				return cdc.Mutation{}, io.EOF
+			}
+			f, err := os.Open(r.segments[0].path)
+			if err != nil {
+				return cdc.Mutation{}, err
+			}
+			r.f, r.sr = f, &segmentReader{r: bufio.NewReader(f), opts: r.opts}
+		}
+
+		m, err := r.sr.next()
+		if err == nil {
+			return m, nil
+		}
+		if err == io.ErrUnexpectedEOF && len(r.segments) > 1 {
+			err = fmt.Errorf("%w, torn record in %s", ErrCorrupt, r.segments[0].path)
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			return cdc.Mutation{}, err
+		}
+		r.Close()
+		r.segments = r.segments[1:]
+	}
+}
+
+// Close closes the segment being read
+func (r *Reader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f, r.sr = nil, nil
+	return err
+}
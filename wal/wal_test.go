@@ -0,0 +1,233 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/aouyang1/go-lsh/cdc"
+	"github.com/aouyang1/go-lsh/snapshot"
+)
+
+func readAll(t *testing.T, dir string, opts Options) []cdc.Mutation {
+	t.Helper()
+	r, err := NewReader(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var out []cdc.Mutation
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, m)
+	}
+}
+
+func TestLog(t *testing.T) {
+	cipher, err := snapshot.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts := Options{Cipher: cipher, SegmentSize: 256}
+	l, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 20; seq++ {
+		m := cdc.Mutation{Seq: seq, Op: cdc.OpIndex, UID: seq, Vector: []float64{1, math.NaN(), 3}}
+		if seq%5 == 0 {
+			m = cdc.Mutation{Seq: seq, Op: cdc.OpDelete, UID: seq - 1}
+		}
+		if err := l.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected writes to roll over segments, but got %d", len(segments))
+	}
+
+	muts := readAll(t, dir, opts)
+	if len(muts) != 20 {
+		t.Fatalf("expected %d mutations, but got %d", 20, len(muts))
+	}
+	for i, m := range muts {
+		if m.Seq != uint64(i+1) {
+			t.Errorf("expected sequence %d, but got %d", i+1, m.Seq)
+		}
+	}
+	if muts[0].Op != cdc.OpIndex || !math.IsNaN(muts[0].Vector[1]) {
+		t.Errorf("expected index mutation with a missing value, but got %+v", muts[0])
+	}
+	if muts[4].Op != cdc.OpDelete || muts[4].UID != 4 {
+		t.Errorf("expected delete of uid 4, but got %+v", muts[4])
+	}
+
+	// tear the last record as a crash mid write would
+	last := segments[len(segments)-1].path
+	info, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(last, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	if muts = readAll(t, dir, opts); len(muts) != 19 {
+		t.Fatalf("expected torn record to be dropped leaving %d mutations, but got %d", 19, len(muts))
+	}
+
+	l, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(cdc.Mutation{Seq: 20, Op: cdc.OpDelete, UID: 19}); err != nil {
+		t.Fatal(err)
+	}
+	if muts = readAll(t, dir, opts); len(muts) != 20 || muts[19].UID != 19 {
+		t.Fatalf("expected rewritten mutation after repair, but got %d mutations", len(muts))
+	}
+
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Truncate(15); err != nil {
+		t.Fatal(err)
+	}
+	muts = readAll(t, dir, opts)
+	if len(muts) == 0 || muts[0].Seq > 16 || muts[len(muts)-1].Seq != 20 {
+		t.Errorf("expected mutations after 15 to be kept, but got %d mutations", len(muts))
+	}
+	if err := l.Truncate(20); err != nil {
+		t.Fatal(err)
+	}
+	if muts = readAll(t, dir, opts); len(muts) != 0 {
+		t.Errorf("expected all segments to be removed, but got %d mutations", len(muts))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// damage to a segment other than the last is corruption
+	dir = t.TempDir()
+	l, err = Open(dir, Options{SegmentSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := l.Write(cdc.Mutation{Seq: seq, Op: cdc.OpDelete, UID: seq}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	first := segmentPath(dir, 1)
+	info, err = os.Stat(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(first, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("expected corruption error, but got %v", err)
+	}
+}
+
+func TestLogCompression(t *testing.T) {
+	cipher, err := snapshot.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(t.TempDir(), Options{CompressionLevel: 23}); err != snapshot.ErrInvalidCompressionLevel {
+		t.Fatalf("expected %v, but got %v", snapshot.ErrInvalidCompressionLevel, err)
+	}
+
+	vec := make([]float64, 1000)
+	write := func(dir string, opts Options, first, last uint64) {
+		l, err := Open(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seq := first; seq <= last; seq++ {
+			if err := l.Write(cdc.Mutation{Seq: seq, Op: cdc.OpIndex, UID: seq, Vector: vec}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := func(dir string) int64 {
+		segments, err := listSegments(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		for _, s := range segments {
+			info, err := os.Stat(s.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += info.Size()
+		}
+		return n
+	}
+
+	plain, compressed := t.TempDir(), t.TempDir()
+	write(plain, Options{Cipher: cipher}, 1, 10)
+	write(compressed, Options{Cipher: cipher, CompressionLevel: 3}, 1, 10)
+	if size(compressed) >= size(plain)/2 {
+		t.Errorf("expected compressed records to be smaller, but got %d of %d bytes", size(compressed), size(plain))
+	}
+
+	// records written before compression was enabled are read along with the compressed ones
+	write(plain, Options{Cipher: cipher, CompressionLevel: 3}, 11, 20)
+	muts := readAll(t, plain, Options{Cipher: cipher})
+	if len(muts) != 20 {
+		t.Fatalf("expected %d mutations, but got %d", 20, len(muts))
+	}
+	for i, m := range muts {
+		if m.Seq != uint64(i+1) || len(m.Vector) != len(vec) {
+			t.Errorf("expected sequence %d with %d values, but got %d with %d", i+1, len(vec), m.Seq, len(m.Vector))
+		}
+	}
+}
+
+func TestTornLength(t *testing.T) {
+	// a torn header claiming a record far larger than the segment
+	record := make([]byte, headerSize+16)
+	binary.BigEndian.PutUint32(record, 1<<30)
+	sr := &segmentReader{r: bytes.NewReader(record)}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := sr.next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected %v, but got %v", io.ErrUnexpectedEOF, err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected the record length not to be allocated up front, but got %d bytes allocated", allocated)
+	}
+}